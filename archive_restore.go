@@ -0,0 +1,394 @@
+package kafka_toolkit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/klauspost/compress/zstd"
+)
+
+const archiveRestoreBatchSize = 500
+
+// CorruptArchiveRecordKind registro binario con largos inconsistentes
+var CorruptArchiveRecordKind = "Registro de archivo corrupto"
+
+// ArchiveReader lee los registros de un archivo generado por ArchiveSink
+type ArchiveReader struct {
+	file         *os.File
+	decompressor io.ReadCloser
+	reader       *bufio.Reader
+	format       string
+	topic        string
+	partition    int32
+}
+
+// OpenArchive abre un archivo, el formato y la compresion se obtienen de la extension
+func OpenArchive(path string) (*ArchiveReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	format, compression := archiveFileFormat(path)
+	r := &ArchiveReader{file: file, format: format}
+	r.topic, r.partition = archivePathTopicPartition(path)
+
+	var source io.Reader = file
+	switch compression {
+	case ArchiveCompressionGzip:
+		gz, err := gzip.NewReader(file)
+		if err == io.EOF {
+			// archivo .part vacio, aun sin header gzip
+			source = strings.NewReader("")
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		r.decompressor = gz
+		source = gz
+	case ArchiveCompressionZstd:
+		decoder, err := zstd.NewReader(file, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		r.decompressor = decoder.IOReadCloser()
+		source = r.decompressor
+	}
+
+	r.reader = bufio.NewReader(source)
+
+	return r, nil
+}
+
+// Next retorna el siguiente mensaje o io.EOF al terminar el archivo
+func (r *ArchiveReader) Next() (*ConsumerMessage, error) {
+	if r.format == ArchiveFormatBinary {
+		return r.nextFrame()
+	}
+
+	line, err := r.reader.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record FixtureRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return nil, err
+	}
+
+	return record.ConsumerMessage()
+}
+
+func (r *ArchiveReader) nextFrame() (*ConsumerMessage, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r.reader, size[:]); err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(r.reader, body); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	msg, err := decodeArchiveFrame(body)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Topic = r.topic
+	msg.Partition = r.partition
+
+	return msg, nil
+}
+
+// Close cierra el archivo
+func (r *ArchiveReader) Close() error {
+	if r.decompressor != nil {
+		r.decompressor.Close()
+	}
+
+	return r.file.Close()
+}
+
+// decodeArchiveFrame inverso de encodeArchiveFrame sin el largo inicial
+func decodeArchiveFrame(body []byte) (*ConsumerMessage, error) {
+	d := archiveFrameDecoder{body: body}
+
+	msg := &ConsumerMessage{}
+	msg.Offset = int64(d.uint64())
+	if timestamp := int64(d.uint64()); timestamp != 0 {
+		msg.Timestamp = time.Unix(0, timestamp*int64(time.Millisecond))
+	}
+	msg.Key = d.bytes()
+	msg.Msg = d.bytes()
+
+	count := d.uint32()
+	if count > 0 && d.err == nil {
+		msg.Headers = make(map[string]string, count)
+	}
+
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		name := d.next(int(d.uint16()))
+		value := d.next(int(d.uint32()))
+		msg.Headers[string(name)] = string(value)
+	}
+
+	if d.err != nil || len(d.body) > 0 {
+		return nil, errors.New(CorruptArchiveRecordKind)
+	}
+
+	return msg, nil
+}
+
+type archiveFrameDecoder struct {
+	body []byte
+	err  error
+}
+
+func (d *archiveFrameDecoder) next(n int) []byte {
+	if d.err != nil || n < 0 || n > len(d.body) {
+		d.err = errors.New(CorruptArchiveRecordKind)
+		return nil
+	}
+
+	content := d.body[:n]
+	d.body = d.body[n:]
+
+	return content
+}
+
+func (d *archiveFrameDecoder) uint16() uint16 {
+	if content := d.next(2); content != nil {
+		return binary.BigEndian.Uint16(content)
+	}
+	return 0
+}
+
+func (d *archiveFrameDecoder) uint32() uint32 {
+	if content := d.next(4); content != nil {
+		return binary.BigEndian.Uint32(content)
+	}
+	return 0
+}
+
+func (d *archiveFrameDecoder) uint64() uint64 {
+	if content := d.next(8); content != nil {
+		return binary.BigEndian.Uint64(content)
+	}
+	return 0
+}
+
+func (d *archiveFrameDecoder) bytes() []byte {
+	size := int32(d.uint32())
+	if size < 0 {
+		return nil
+	}
+
+	return append([]byte{}, d.next(int(size))...)
+}
+
+// archiveFileFormat formato y compresion segun la extension, ignorando los sufijos .part y .tmp
+func archiveFileFormat(path string) (string, string) {
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), archiveTmpSuffix), archivePartSuffix)
+
+	compression := ArchiveCompressionNone
+	switch filepath.Ext(name) {
+	case ".gz":
+		compression = ArchiveCompressionGzip
+		name = strings.TrimSuffix(name, ".gz")
+	case ".zst":
+		compression = ArchiveCompressionZstd
+		name = strings.TrimSuffix(name, ".zst")
+	}
+
+	format := ArchiveFormatJSONL
+	if filepath.Ext(name) == ".bin" {
+		format = ArchiveFormatBinary
+	}
+
+	return format, compression
+}
+
+// ArchiveFiles lista los archivos finalizados de un directorio de archivo en orden de topico, fecha, hora,
+// particion y offset. Si path es un archivo retorna solo ese archivo.
+func ArchiveFiles(path string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := info.Name()
+		if info.IsDir() || strings.HasSuffix(name, archivePartSuffix) || strings.HasSuffix(name, archiveTmpSuffix) {
+			return nil
+		}
+
+		if strings.Contains(name, ".jsonl") || strings.Contains(name, ".bin") {
+			files = append(files, file)
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+// ArchiveRestoreConfig configuracion de restauracion de un archivo a un topico
+type ArchiveRestoreConfig struct {
+	// Producer configuracion de conexion del cluster de destino
+	Producer BaseProducerConfigInput
+	// Topic topico de destino, vacio utiliza el topico original de cada registro
+	Topic string
+	// KeepPartitions produce cada mensaje en su particion original, por defecto particiona por hash de key
+	KeepPartitions bool
+	// Rate mensajes por segundo, 0 sin limite
+	Rate float64
+}
+
+// RestoreArchive vuelve a producir los mensajes de un archivo o directorio de archivo, conservando key,
+// headers y timestamp. Retorna la cantidad de mensajes producidos.
+func RestoreArchive(ctx context.Context, path string, config ArchiveRestoreConfig) (int64, error) {
+	files, err := ArchiveFiles(path)
+	if err != nil {
+		return 0, err
+	}
+
+	conf, err := NewBaseProducerConfigurer().GenerateConfig(config.Producer)
+	if err != nil {
+		return 0, err
+	}
+
+	conf.SaramaConfig.Producer.Partitioner = sarama.NewHashPartitioner
+	if config.KeepPartitions {
+		conf.SaramaConfig.Producer.Partitioner = sarama.NewManualPartitioner
+	}
+
+	producer, err := sarama.NewSyncProducer(conf.Brokers, conf.SaramaConfig)
+	if err != nil {
+		return 0, err
+	}
+	defer producer.Close()
+
+	var limiter *RateLimiter
+	if config.Rate > 0 {
+		limiter = NewRateLimiter(RateLimitConfig{Rate: config.Rate, Burst: 1})
+	}
+
+	var restored int64
+	for _, file := range files {
+		n, err := restoreArchiveFile(ctx, file, producer, limiter, config.Topic)
+		restored += n
+		if err != nil {
+			return restored, err
+		}
+
+		Log.Info(
+			"message", "Archivo restaurado",
+			"path", file,
+			"messages", n)
+	}
+
+	return restored, nil
+}
+
+func restoreArchiveFile(ctx context.Context, path string, producer sarama.SyncProducer, limiter *RateLimiter, topic string) (int64, error) {
+	reader, err := OpenArchive(path)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	var (
+		restored int64
+		batch    []*sarama.ProducerMessage
+	)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := producer.SendMessages(batch); err != nil {
+			return err
+		}
+
+		restored += int64(len(batch))
+		batch = batch[:0]
+
+		return nil
+	}
+
+	for {
+		msg, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return restored, err
+		}
+
+		if limiter != nil {
+			if err := flush(); err != nil {
+				return restored, err
+			}
+			if err := limiter.Wait(ctx, msg); err != nil {
+				return restored, err
+			}
+		} else if ctx.Err() != nil {
+			return restored, ctx.Err()
+		}
+
+		batch = append(batch, archiveProducerMessage(msg, topic))
+		if len(batch) >= archiveRestoreBatchSize {
+			if err := flush(); err != nil {
+				return restored, err
+			}
+		}
+	}
+
+	return restored, flush()
+}
+
+// archiveProducerMessage mensaje a producir a partir de un registro restaurado
+func archiveProducerMessage(msg *ConsumerMessage, topic string) *sarama.ProducerMessage {
+	if topic == "" {
+		topic = msg.Topic
+	}
+
+	out := &sarama.ProducerMessage{
+		Topic:     topic,
+		Partition: msg.Partition,
+		Headers:   encodeHeaders(msg.Headers),
+		Timestamp: msg.Timestamp,
+	}
+
+	if msg.Key != nil {
+		out.Key = sarama.ByteEncoder(msg.Key)
+	}
+
+	// un valor nil se conserva como tombstone
+	if msg.Msg != nil {
+		out.Value = sarama.ByteEncoder(msg.Msg)
+	}
+
+	return out
+}
@@ -0,0 +1,670 @@
+package kafka_toolkit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// ArchiveFormatJSONL un registro de fixture JSON por linea
+	ArchiveFormatJSONL = "jsonl"
+	// ArchiveFormatBinary registros binarios con prefijo de largo
+	ArchiveFormatBinary = "binary"
+
+	// ArchiveCompressionNone sin compresion
+	ArchiveCompressionNone = ""
+	// ArchiveCompressionGzip compresion gzip
+	ArchiveCompressionGzip = "gzip"
+	// ArchiveCompressionZstd compresion zstd
+	ArchiveCompressionZstd = "zstd"
+
+	archivePartSuffix   = ".part"
+	archiveTmpSuffix    = ".tmp"
+	archiveOffsetFormat = "%020d"
+
+	defaultArchiveMaxFileBytes = 128 * 1024 * 1024
+	defaultArchiveMaxFileAge   = time.Hour
+	defaultArchiveRetryBackoff = time.Second
+	archiveRotateInterval      = time.Second
+)
+
+// InvalidArchiveFormatKind formato de archivo no soportado
+var InvalidArchiveFormatKind = "Formato de archivo invalido, debe ser jsonl o binary"
+
+// InvalidArchiveCompressionKind compresion no soportada
+var InvalidArchiveCompressionKind = "Compresion de archivo invalida, debe ser gzip o zstd"
+
+// ArchiveSinkClosedKind el sink ya fue cerrado
+var ArchiveSinkClosedKind = "Archive sink cerrado"
+
+// ArchiveSinkConfig configuracion del sink de archivo
+type ArchiveSinkConfig struct {
+	// Dir directorio base, los archivos se escriben en <Dir>/<topic>/<YYYY-MM-DD>/<HH>/<partition>
+	Dir string
+	// Format ArchiveFormatJSONL (por defecto) o ArchiveFormatBinary
+	Format string
+	// Compression ArchiveCompressionNone (por defecto), ArchiveCompressionGzip o ArchiveCompressionZstd
+	Compression string
+	// MaxFileBytes tamaño en disco a partir del cual se rota el archivo, por defecto 128MiB
+	MaxFileBytes int64
+	// MaxFileAge tiempo maximo que un archivo permanece abierto, por defecto 1h
+	MaxFileAge time.Duration
+	// RetryBackoff espera entre reintentos de escritura fallida, por defecto 1s
+	RetryBackoff time.Duration
+}
+
+// ArchiveSink escribe los mensajes consumidos en archivos particionados por topico, fecha, hora y particion.
+// Implementa MessageHandler y BatchMessageHandler, retorna recien cuando los mensajes estan en disco (fsync),
+// por lo que los offsets se marcan solo despues de persistir. Una escritura fallida se reintenta hasta tener
+// exito; si antes termina la sesion, vence el context o se cierra el sink retorna un error que envuelve
+// ErrSessionClosed, de modo que el consumer no marca los mensajes y los vuelve a entregar.
+// Los archivos se escriben con sufijo .part y se renombran a <primer offset>-<ultimo offset>.<ext> al rotar.
+type ArchiveSink struct {
+	mu      sync.Mutex
+	config  ArchiveSinkConfig
+	writers map[topicPartition]*archiveWriter
+	closed  bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewArchiveSink crea el sink, los archivos .part de una ejecucion anterior se recuperan y finalizan
+func NewArchiveSink(config ArchiveSinkConfig) (*ArchiveSink, error) {
+	if config.Format == "" {
+		config.Format = ArchiveFormatJSONL
+	}
+
+	if config.Format != ArchiveFormatJSONL && config.Format != ArchiveFormatBinary {
+		return nil, errors.New(InvalidArchiveFormatKind)
+	}
+
+	if config.Compression != ArchiveCompressionNone && config.Compression != ArchiveCompressionGzip &&
+		config.Compression != ArchiveCompressionZstd {
+		return nil, errors.New(InvalidArchiveCompressionKind)
+	}
+
+	if config.MaxFileBytes <= 0 {
+		config.MaxFileBytes = defaultArchiveMaxFileBytes
+	}
+
+	if config.MaxFileAge <= 0 {
+		config.MaxFileAge = defaultArchiveMaxFileAge
+	}
+
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaultArchiveRetryBackoff
+	}
+
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	if err := recoverArchiveParts(config.Dir); err != nil {
+		return nil, err
+	}
+
+	sink := &ArchiveSink{
+		config:  config,
+		writers: make(map[topicPartition]*archiveWriter),
+		done:    make(chan struct{}),
+	}
+
+	sink.wg.Add(1)
+	go sink.rotateLoop()
+
+	return sink, nil
+}
+
+// HandleMessage escribe el mensaje y sincroniza el archivo antes de retornar
+func (s *ArchiveSink) HandleMessage(ctx context.Context, inMsg *ConsumerMessage) error {
+	return s.persist(ctx, []*ConsumerMessage{inMsg})
+}
+
+// HandleMessages escribe el lote y sincroniza una vez cada archivo modificado antes de retornar
+func (s *ArchiveSink) HandleMessages(ctx context.Context, inMsgs []*ConsumerMessage) error {
+	return s.persist(ctx, inMsgs)
+}
+
+// persist reintenta writeAll hasta tener exito, terminar la sesion, vencer el context o cerrarse el sink
+func (s *ArchiveSink) persist(ctx context.Context, inMsgs []*ConsumerMessage) error {
+	for {
+		err := s.writeAll(inMsgs)
+		if err == nil {
+			return nil
+		}
+
+		if errors.Is(err, ErrSessionClosed) {
+			return err
+		}
+
+		Log.Warn(
+			"message", "Error persistiendo mensajes en archivo, se reintenta",
+			"messages", len(inMsgs),
+			"retry_in", s.config.RetryBackoff.String(),
+			"error", err)
+
+		retry := time.NewTimer(s.config.RetryBackoff)
+		select {
+		case <-retry.C:
+		case <-SessionDoneFromContext(ctx):
+			retry.Stop()
+			return ErrSessionClosed
+		case <-ctx.Done():
+			retry.Stop()
+			return fmt.Errorf("%v: %w", err, ErrSessionClosed)
+		case <-s.done:
+			retry.Stop()
+			return fmt.Errorf("%s: %w", ArchiveSinkClosedKind, ErrSessionClosed)
+		}
+	}
+}
+
+// writeAll escribe los mensajes y sincroniza una vez cada archivo modificado. Si una escritura o un fsync
+// falla se descarta el lote completo en todos los archivos, para que el reintento no duplique registros.
+func (s *ArchiveSink) writeAll(inMsgs []*ConsumerMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("%s: %w", ArchiveSinkClosedKind, ErrSessionClosed)
+	}
+
+	// touched tamaño en disco de cada archivo modificado antes del lote, todos quedan sincronizados al terminar
+	// el lote anterior
+	touched := make(map[*archiveWriter]int64)
+	for _, inMsg := range inMsgs {
+		if err := s.write(inMsg, touched); err != nil {
+			s.rollbackLocked(touched, err)
+			return err
+		}
+	}
+
+	for w := range touched {
+		if err := w.sync(); err != nil {
+			s.rollbackLocked(touched, err)
+			return err
+		}
+	}
+
+	// el lote ya esta en disco, un error al finalizar deja el .part que se recupera al reiniciar
+	for w := range touched {
+		if w.size() >= s.config.MaxFileBytes {
+			s.finalizeLocked(w.key(), w)
+		}
+	}
+
+	return nil
+}
+
+// Close finaliza todos los archivos abiertos
+func (s *ArchiveSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for key, w := range s.writers {
+		if err := w.finalize(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.writers, key)
+	}
+
+	return firstErr
+}
+
+// write escribe el mensaje en el archivo de su particion. Rota cuando el mensaje pertenece a una hora posterior
+// a la del archivo o este supera su edad; un mensaje con timestamp anterior se escribe en el archivo abierto,
+// para que los timestamps no monotonicos no generen un archivo por mensaje. Un archivo modificado en el lote
+// no se rota hasta sincronizarlo, de modo que un error posterior del lote lo pueda descartar.
+func (s *ArchiveSink) write(inMsg *ConsumerMessage, touched map[*archiveWriter]int64) error {
+	key := topicPartition{topic: inMsg.Topic, partition: inMsg.Partition}
+	bucket := archiveBucket(inMsg.Timestamp)
+
+	w := s.writers[key]
+	if _, inBatch := touched[w]; w != nil && !inBatch && (bucket > w.bucket || s.expired(w, time.Now())) {
+		if err := s.finalizeLocked(key, w); err != nil {
+			return err
+		}
+		w = nil
+	}
+
+	if w == nil {
+		dir := filepath.Join(s.config.Dir, inMsg.Topic, filepath.FromSlash(bucket), strconv.Itoa(int(inMsg.Partition)))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf(archiveOffsetFormat, inMsg.Offset)+
+			archiveExtension(s.config.Format, s.config.Compression)+archivePartSuffix)
+
+		var err error
+		if w, err = createArchiveWriter(path, inMsg.Offset, s.config.Format, s.config.Compression); err != nil {
+			return err
+		}
+		w.bucket = bucket
+		s.writers[key] = w
+	}
+
+	if _, ok := touched[w]; !ok {
+		touched[w] = w.size()
+	}
+
+	record, err := encodeArchiveRecord(s.config.Format, inMsg)
+	if err != nil {
+		return err
+	}
+
+	return w.write(record, inMsg.Offset)
+}
+
+func (s *ArchiveSink) finalizeLocked(key topicPartition, w *archiveWriter) error {
+	delete(s.writers, key)
+
+	if err := w.finalize(); err != nil {
+		Log.Error(
+			"errorMessage", "Error finalizando archivo, se recuperara al reiniciar",
+			"path", w.path,
+			"error", err)
+		return err
+	}
+
+	return nil
+}
+
+// rollbackLocked descarta los registros del lote fallido: cierra cada archivo modificado, lo trunca al tamaño
+// sincronizado antes del lote y lo finaliza con esos registros. El reintento abre archivos nuevos.
+func (s *ArchiveSink) rollbackLocked(touched map[*archiveWriter]int64, cause error) {
+	for w, synced := range touched {
+		if key := w.key(); s.writers[key] == w {
+			delete(s.writers, key)
+		}
+		w.file.Close()
+
+		var err error
+		if synced == 0 {
+			err = os.Remove(w.path)
+		} else if err = os.Truncate(w.path, synced); err == nil {
+			err = recoverArchivePart(w.path)
+		}
+
+		if err != nil {
+			Log.Error(
+				"errorMessage", "Error descartando lote fallido, el archivo se recuperara al reiniciar",
+				"path", w.path,
+				"cause", cause,
+				"error", err)
+		}
+	}
+}
+
+func (s *ArchiveSink) expired(w *archiveWriter, now time.Time) bool {
+	return now.Sub(w.opened) >= s.config.MaxFileAge
+}
+
+// rotateLoop finaliza los archivos que superan MaxFileAge aunque no lleguen mensajes nuevos
+func (s *ArchiveSink) rotateLoop() {
+	defer s.wg.Done()
+
+	interval := archiveRotateInterval
+	if s.config.MaxFileAge < interval {
+		interval = s.config.MaxFileAge
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for key, w := range s.writers {
+				if s.expired(w, now) {
+					s.finalizeLocked(key, w)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// archiveBucket directorio fecha/hora del mensaje en UTC, mensajes sin timestamp usan la hora actual
+func archiveBucket(timestamp time.Time) string {
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	return timestamp.UTC().Format("2006-01-02/15")
+}
+
+// archiveExtension extension de los archivos segun formato y compresion
+func archiveExtension(format string, compression string) string {
+	ext := ".jsonl"
+	if format == ArchiveFormatBinary {
+		ext = ".bin"
+	}
+
+	switch compression {
+	case ArchiveCompressionGzip:
+		ext += ".gz"
+	case ArchiveCompressionZstd:
+		ext += ".zst"
+	}
+
+	return ext
+}
+
+// archiveWriter archivo abierto de una particion
+type archiveWriter struct {
+	topic      string
+	partition  int32
+	bucket     string
+	path       string
+	ext        string
+	file       *os.File
+	counter    *countingWriter
+	compressor io.WriteCloser
+	out        io.Writer
+	first      int64
+	last       int64
+	opened     time.Time
+}
+
+// createArchiveWriter crea el archivo temporal de escritura, al finalizar se renombra en el mismo directorio
+func createArchiveWriter(path string, first int64, format string, compression string) (*archiveWriter, error) {
+	ext := archiveExtension(format, compression)
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &archiveWriter{
+		path:    path,
+		ext:     ext,
+		file:    file,
+		counter: &countingWriter{writer: file},
+		first:   first,
+		last:    first,
+		opened:  time.Now(),
+	}
+	w.out = w.counter
+	w.topic, w.partition = archivePathTopicPartition(path)
+
+	switch compression {
+	case ArchiveCompressionGzip:
+		w.compressor = gzip.NewWriter(w.counter)
+	case ArchiveCompressionZstd:
+		if w.compressor, err = zstd.NewWriter(w.counter, zstd.WithEncoderConcurrency(1)); err != nil {
+			file.Close()
+			os.Remove(path)
+			return nil, err
+		}
+	}
+
+	if w.compressor != nil {
+		w.out = w.compressor
+	}
+
+	return w, nil
+}
+
+func (w *archiveWriter) key() topicPartition {
+	return topicPartition{topic: w.topic, partition: w.partition}
+}
+
+func (w *archiveWriter) write(record []byte, offset int64) error {
+	if _, err := w.out.Write(record); err != nil {
+		return err
+	}
+
+	w.last = offset
+
+	return nil
+}
+
+// size bytes escritos en disco, con compresion es aproximado hasta el siguiente flush
+func (w *archiveWriter) size() int64 {
+	return w.counter.written
+}
+
+// sync vacia el compresor y sincroniza el archivo, un archivo .part sincronizado es legible hasta ese punto
+func (w *archiveWriter) sync() error {
+	if flusher, ok := w.compressor.(interface{ Flush() error }); ok {
+		if err := flusher.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return w.file.Sync()
+}
+
+// finalize cierra el compresor, sincroniza y renombra el archivo a <primer offset>-<ultimo offset><ext>
+func (w *archiveWriter) finalize() error {
+	if w.compressor != nil {
+		if err := w.compressor.Close(); err != nil {
+			w.file.Close()
+			return err
+		}
+	}
+
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf(archiveOffsetFormat+"-"+archiveOffsetFormat, w.first, w.last) + w.ext
+	if err := os.Rename(w.path, filepath.Join(filepath.Dir(w.path), name)); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(w.path))
+}
+
+// countingWriter cuenta los bytes escritos
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.writer.Write(p)
+	c.written += int64(n)
+	return n, err
+}
+
+// syncDir sincroniza el directorio para que el rename sea durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// archivePathTopicPartition obtiene topico y particion de <Dir>/<topic>/<YYYY-MM-DD>/<HH>/<partition>/<archivo>
+func archivePathTopicPartition(path string) (string, int32) {
+	partitionDir := filepath.Dir(path)
+	partition, _ := strconv.ParseInt(filepath.Base(partitionDir), 10, 32)
+	topic := filepath.Base(filepath.Dir(filepath.Dir(filepath.Dir(partitionDir))))
+
+	return topic, int32(partition)
+}
+
+// encodeArchiveRecord serializa el mensaje segun el formato
+func encodeArchiveRecord(format string, inMsg *ConsumerMessage) ([]byte, error) {
+	if format == ArchiveFormatJSONL {
+		line, err := json.Marshal(NewFixtureRecord(inMsg))
+		if err != nil {
+			return nil, err
+		}
+
+		return append(line, '\n'), nil
+	}
+
+	return encodeArchiveFrame(inMsg), nil
+}
+
+// encodeArchiveFrame formato binario big endian:
+// largo uint32 | offset int64 | timestamp ms int64 | key int32+bytes | valor int32+bytes | headers uint32 |
+// por header: key uint16+bytes, valor uint32+bytes. Un largo -1 en key o valor representa nil.
+func encodeArchiveFrame(inMsg *ConsumerMessage) []byte {
+	var body bytes.Buffer
+
+	var timestamp int64
+	if !inMsg.Timestamp.IsZero() {
+		timestamp = inMsg.Timestamp.UnixNano() / int64(time.Millisecond)
+	}
+
+	binary.Write(&body, binary.BigEndian, inMsg.Offset)
+	binary.Write(&body, binary.BigEndian, timestamp)
+	writeArchiveBytes(&body, inMsg.Key)
+	writeArchiveBytes(&body, inMsg.Msg)
+
+	names := make([]string, 0, len(inMsg.Headers))
+	for name := range inMsg.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	binary.Write(&body, binary.BigEndian, uint32(len(names)))
+	for _, name := range names {
+		binary.Write(&body, binary.BigEndian, uint16(len(name)))
+		body.WriteString(name)
+		binary.Write(&body, binary.BigEndian, uint32(len(inMsg.Headers[name])))
+		body.WriteString(inMsg.Headers[name])
+	}
+
+	frame := make([]byte, 4, 4+body.Len())
+	binary.BigEndian.PutUint32(frame, uint32(body.Len()))
+
+	return append(frame, body.Bytes()...)
+}
+
+func writeArchiveBytes(buf *bytes.Buffer, content []byte) {
+	if content == nil {
+		binary.Write(buf, binary.BigEndian, int32(-1))
+		return
+	}
+
+	binary.Write(buf, binary.BigEndian, int32(len(content)))
+	buf.Write(content)
+}
+
+// recoverArchiveParts finaliza los archivos .part de una ejecucion interrumpida con los registros legibles,
+// los registros posteriores al ultimo fsync se descartan y se vuelven a consumir porque su offset no se marco
+func recoverArchiveParts(dir string) error {
+	var parts []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+		case strings.HasSuffix(path, archivePartSuffix):
+			parts = append(parts, path)
+		case strings.HasSuffix(path, archivePartSuffix+archiveTmpSuffix):
+			return os.Remove(path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, part := range parts {
+		if err := recoverArchivePart(part); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func recoverArchivePart(part string) error {
+	format, compression := archiveFileFormat(part)
+
+	reader, err := OpenArchive(part)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var w *archiveWriter
+	for {
+		msg, err := reader.Next()
+		if err != nil {
+			if err != io.EOF {
+				Log.Warn(
+					"message", "Archivo .part truncado, se conservan los registros legibles",
+					"path", part,
+					"error", err)
+			}
+			break
+		}
+
+		if w == nil {
+			// el archivo recuperado se escribe como temporal para no pisar el .part original
+			if w, err = createArchiveWriter(part+archiveTmpSuffix, msg.Offset, format, compression); err != nil {
+				return err
+			}
+		}
+
+		record, err := encodeArchiveRecord(format, msg)
+		if err != nil {
+			return err
+		}
+
+		if err := w.write(record, msg.Offset); err != nil {
+			w.file.Close()
+			return err
+		}
+	}
+
+	if w != nil {
+		if err := w.finalize(); err != nil {
+			return err
+		}
+	}
+
+	Log.Info(
+		"message", "Archivo .part recuperado",
+		"path", part)
+
+	return os.Remove(part)
+}
@@ -0,0 +1,437 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+func TestArchiveSinkRetriesFailedWrites(t *testing.T) {
+	dir, sink := newBlockedArchiveSink(t)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.Remove(filepath.Join(dir, "archive"))
+	}()
+
+	if err := sink.HandleMessages(context.Background(), archiveMessages(0, 1)); err != nil {
+		t.Fatalf("se esperaba exito luego de reintentar, se obtuvo %v", err)
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := kafka.ArchiveFiles(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("se esperaba un archivo finalizado, se obtuvo %v (%v)", files, err)
+	}
+
+	if offsets := archivedOffsets(t, files[0]); !reflect.DeepEqual(offsets, []int64{0, 1}) {
+		t.Errorf("offsets archivados: se esperaba [0 1], se obtuvo %v", offsets)
+	}
+}
+
+func TestArchiveSinkFailedWriteEndsWithSession(t *testing.T) {
+	_, sink := newBlockedArchiveSink(t)
+	defer sink.Close()
+
+	done := make(chan struct{})
+	ctx := kafka.ContextWithSessionDone(context.Background(), done)
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		close(done)
+	}()
+
+	err := sink.HandleMessage(ctx, archiveMessages(0)[0])
+	if !errors.Is(err, kafka.ErrSessionClosed) {
+		t.Fatalf("se esperaba ErrSessionClosed para no marcar el mensaje, se obtuvo %v", err)
+	}
+}
+
+// newBlockedArchiveSink crea un sink cuyo directorio de topico es un archivo, por lo que las escrituras fallan
+// hasta eliminarlo
+func newBlockedArchiveSink(t *testing.T) (string, *kafka.ArchiveSink) {
+	t.Helper()
+	kafkatest.EnsureLogger()
+
+	dir := t.TempDir()
+	sink, err := kafka.NewArchiveSink(kafka.ArchiveSinkConfig{Dir: dir, RetryBackoff: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "archive"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, sink
+}
+
+func archiveMessages(offsets ...int64) []*kafka.ConsumerMessage {
+	msgs := make([]*kafka.ConsumerMessage, 0, len(offsets))
+	for _, offset := range offsets {
+		msgs = append(msgs, &kafka.ConsumerMessage{
+			Topic:     "archive",
+			Partition: 0,
+			Offset:    offset,
+			Key:       []byte("key"),
+			Msg:       []byte("value"),
+			Timestamp: time.Now(),
+		})
+	}
+
+	return msgs
+}
+
+var archiveBaseTime = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+func newArchiveSink(t *testing.T, config kafka.ArchiveSinkConfig) *kafka.ArchiveSink {
+	t.Helper()
+	kafkatest.EnsureLogger()
+
+	if config.Dir == "" {
+		config.Dir = t.TempDir()
+	}
+	if config.RetryBackoff == 0 {
+		config.RetryBackoff = 10 * time.Millisecond
+	}
+
+	sink, err := kafka.NewArchiveSink(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sink
+}
+
+// archiveMessage mensaje de la particion con timestamp relativo a archiveBaseTime
+func archiveMessage(partition int32, offset int64, at time.Duration) *kafka.ConsumerMessage {
+	return &kafka.ConsumerMessage{
+		Topic:     "archive",
+		Partition: partition,
+		Offset:    offset,
+		Key:       []byte("key-" + strconv.FormatInt(offset, 10)),
+		Msg:       []byte{0, 1, 2, byte(offset)},
+		Headers:   map[string]string{"trace": "abc"},
+		Timestamp: archiveBaseTime.Add(at),
+	}
+}
+
+func readArchive(t *testing.T, file string) []*kafka.ConsumerMessage {
+	t.Helper()
+
+	reader, err := kafka.OpenArchive(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var msgs []*kafka.ConsumerMessage
+	for {
+		msg, err := reader.Next()
+		if err == io.EOF {
+			return msgs
+		}
+		if err != nil {
+			t.Fatalf("error leyendo %s: %v", file, err)
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+func archivedOffsets(t *testing.T, file string) []int64 {
+	t.Helper()
+
+	var offsets []int64
+	for _, msg := range readArchive(t, file) {
+		offsets = append(offsets, msg.Offset)
+	}
+
+	return offsets
+}
+
+// archivedFiles archivos finalizados con sus offsets, por ruta relativa al directorio
+func archivedFiles(t *testing.T, dir string) map[string][]int64 {
+	t.Helper()
+
+	files, err := kafka.ArchiveFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archived := make(map[string][]int64)
+	for _, file := range files {
+		rel, _ := filepath.Rel(dir, file)
+		archived[filepath.ToSlash(rel)] = archivedOffsets(t, file)
+	}
+
+	return archived
+}
+
+func TestArchiveSinkFormats(t *testing.T) {
+	tests := []struct {
+		format      string
+		compression string
+		ext         string
+	}{
+		{format: kafka.ArchiveFormatJSONL, ext: ".jsonl"},
+		{format: kafka.ArchiveFormatJSONL, compression: kafka.ArchiveCompressionGzip, ext: ".jsonl.gz"},
+		{format: kafka.ArchiveFormatJSONL, compression: kafka.ArchiveCompressionZstd, ext: ".jsonl.zst"},
+		{format: kafka.ArchiveFormatBinary, ext: ".bin"},
+		{format: kafka.ArchiveFormatBinary, compression: kafka.ArchiveCompressionGzip, ext: ".bin.gz"},
+		{format: kafka.ArchiveFormatBinary, compression: kafka.ArchiveCompressionZstd, ext: ".bin.zst"},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.TrimPrefix(test.ext, "."), func(t *testing.T) {
+			dir := t.TempDir()
+			sink := newArchiveSink(t, kafka.ArchiveSinkConfig{Dir: dir, Format: test.format, Compression: test.compression})
+
+			msgs := []*kafka.ConsumerMessage{archiveMessage(0, 5, 0), archiveMessage(0, 6, time.Minute)}
+			if err := sink.HandleMessages(context.Background(), msgs); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := sink.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			name := "archive/2024-01-01/10/0/00000000000000000005-00000000000000000006" + test.ext
+			archived := archivedFiles(t, dir)
+			if _, ok := archived[name]; !ok || len(archived) != 1 {
+				t.Fatalf("se esperaba el archivo %s, se obtuvo %v", name, archived)
+			}
+
+			restored := readArchive(t, filepath.Join(dir, filepath.FromSlash(name)))
+			if len(restored) != len(msgs) {
+				t.Fatalf("se esperaban %d registros, se obtuvo %d", len(msgs), len(restored))
+			}
+
+			for i, msg := range restored {
+				if !msg.Timestamp.Equal(msgs[i].Timestamp) {
+					t.Errorf("timestamp: se esperaba %v, se obtuvo %v", msgs[i].Timestamp, msg.Timestamp)
+				}
+
+				msg.Timestamp = msgs[i].Timestamp
+				if !reflect.DeepEqual(msg, msgs[i]) {
+					t.Errorf("registro: se esperaba %+v, se obtuvo %+v", msgs[i], msg)
+				}
+			}
+		})
+	}
+}
+
+func TestArchiveSinkRotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	sink := newArchiveSink(t, kafka.ArchiveSinkConfig{Dir: dir, MaxFileBytes: 1})
+
+	// el tamaño se evalua despues del fsync de cada lote
+	if err := sink.HandleMessages(context.Background(), []*kafka.ConsumerMessage{archiveMessage(0, 0, 0), archiveMessage(0, 1, 0)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.HandleMessage(context.Background(), archiveMessage(0, 2, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]int64{
+		"archive/2024-01-01/10/0/00000000000000000000-00000000000000000001.jsonl": {0, 1},
+		"archive/2024-01-01/10/0/00000000000000000002-00000000000000000002.jsonl": {2},
+	}
+
+	if archived := archivedFiles(t, dir); !reflect.DeepEqual(archived, expected) {
+		t.Errorf("archivos rotados por tamaño antes de cerrar: se esperaba %v, se obtuvo %v", expected, archived)
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveSinkRotatesByAge(t *testing.T) {
+	dir := t.TempDir()
+	sink := newArchiveSink(t, kafka.ArchiveSinkConfig{Dir: dir, MaxFileAge: 50 * time.Millisecond})
+	defer sink.Close()
+
+	if err := sink.HandleMessage(context.Background(), archiveMessage(0, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// el archivo se finaliza sin nuevos mensajes ni cerrar el sink
+	deadline := time.Now().Add(kafkatest.DefaultTimeout)
+	for len(archivedFiles(t, dir)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("el archivo no se roto al superar MaxFileAge")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := sink.HandleMessage(context.Background(), archiveMessage(0, 1, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if archived := archivedFiles(t, dir); len(archived) != 2 {
+		t.Errorf("se esperaban 2 archivos, se obtuvo %v", archived)
+	}
+}
+
+func TestArchiveSinkLateMessagesDoNotRotate(t *testing.T) {
+	dir := t.TempDir()
+	sink := newArchiveSink(t, kafka.ArchiveSinkConfig{Dir: dir})
+
+	// los mensajes atrasados se escriben en el archivo abierto, solo una hora posterior rota
+	for offset, at := range []time.Duration{time.Hour, 0, time.Hour + time.Minute, 30 * time.Minute, 2 * time.Hour} {
+		if err := sink.HandleMessage(context.Background(), archiveMessage(0, int64(offset), at)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]int64{
+		"archive/2024-01-01/11/0/00000000000000000000-00000000000000000003.jsonl": {0, 1, 2, 3},
+		"archive/2024-01-01/12/0/00000000000000000004-00000000000000000004.jsonl": {4},
+	}
+
+	if archived := archivedFiles(t, dir); !reflect.DeepEqual(archived, expected) {
+		t.Errorf("se esperaba %v, se obtuvo %v", expected, archived)
+	}
+}
+
+func TestArchiveSinkDiscardsFailedBatch(t *testing.T) {
+	dir := t.TempDir()
+	sink := newArchiveSink(t, kafka.ArchiveSinkConfig{Dir: dir})
+
+	if err := sink.HandleMessage(context.Background(), archiveMessage(0, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// el directorio de la particion 1 es un archivo, el lote falla despues de escribir en la particion 0
+	blocked := filepath.Join(dir, "archive", "2024-01-01", "10", "1")
+	if err := os.WriteFile(blocked, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.Remove(blocked)
+	}()
+
+	batch := []*kafka.ConsumerMessage{archiveMessage(0, 1, 0), archiveMessage(1, 0, 0)}
+	if err := sink.HandleMessages(context.Background(), batch); err != nil {
+		t.Fatalf("se esperaba exito luego de reintentar, se obtuvo %v", err)
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// el intento fallido se descarta de la particion 0, el reintento no duplica el offset 1
+	expected := map[string][]int64{
+		"archive/2024-01-01/10/0/00000000000000000000-00000000000000000000.jsonl": {0},
+		"archive/2024-01-01/10/0/00000000000000000001-00000000000000000001.jsonl": {1},
+		"archive/2024-01-01/10/1/00000000000000000000-00000000000000000000.jsonl": {0},
+	}
+
+	if archived := archivedFiles(t, dir); !reflect.DeepEqual(archived, expected) {
+		t.Errorf("se esperaba %v, se obtuvo %v", expected, archived)
+	}
+}
+
+func TestArchiveSinkRecoversPartFiles(t *testing.T) {
+	dir := t.TempDir()
+	sink := newArchiveSink(t, kafka.ArchiveSinkConfig{Dir: dir})
+	defer sink.Close()
+
+	if err := sink.HandleMessages(context.Background(), []*kafka.ConsumerMessage{archiveMessage(0, 3, 0), archiveMessage(0, 4, 0)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// se copia el .part sincronizado como si el proceso terminara, con un registro a medio escribir
+	rel := filepath.Join("archive", "2024-01-01", "10", "0", "00000000000000000003.jsonl.part")
+	content, err := os.ReadFile(filepath.Join(dir, rel))
+	if err != nil {
+		t.Fatalf("no existe el archivo .part: %v", err)
+	}
+
+	crashed := t.TempDir()
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(crashed, rel)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(crashed, rel), append(content, `{"offset":5,"ke`...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	recovered := newArchiveSink(t, kafka.ArchiveSinkConfig{Dir: crashed})
+	defer recovered.Close()
+
+	expected := map[string][]int64{
+		"archive/2024-01-01/10/0/00000000000000000003-00000000000000000004.jsonl": {3, 4},
+	}
+
+	if archived := archivedFiles(t, crashed); !reflect.DeepEqual(archived, expected) {
+		t.Errorf("se esperaba %v, se obtuvo %v", expected, archived)
+	}
+
+	if _, err := os.Stat(filepath.Join(crashed, rel)); !os.IsNotExist(err) {
+		t.Errorf("el archivo .part no se elimino al recuperarlo: %v", err)
+	}
+}
+
+func TestRestoreArchive(t *testing.T) {
+	dir := t.TempDir()
+	sink := newArchiveSink(t, kafka.ArchiveSinkConfig{Dir: dir, Format: kafka.ArchiveFormatBinary, Compression: kafka.ArchiveCompressionZstd})
+
+	if err := sink.HandleMessages(context.Background(), []*kafka.ConsumerMessage{archiveMessage(0, 0, 0), archiveMessage(0, 1, 0)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.HandleMessage(context.Background(), archiveMessage(0, 2, time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{"archive": 1, "restored": 1}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), kafkatest.DefaultTimeout)
+	defer cancel()
+
+	restored, err := kafka.RestoreArchive(ctx, dir, kafka.ArchiveRestoreConfig{
+		Producer:       cluster.ProducerInput(""),
+		Topic:          "restored",
+		KeepPartitions: true,
+	})
+	if err != nil {
+		t.Fatalf("error restaurando: %v", err)
+	}
+
+	if restored != 3 {
+		t.Errorf("se esperaban 3 mensajes restaurados, se obtuvo %d", restored)
+	}
+
+	// una solicitud de produce por archivo
+	if got := cluster.ProduceRequests(); got != 2 {
+		t.Errorf("solicitudes de produce: se esperaba 2, se obtuvo %d", got)
+	}
+}
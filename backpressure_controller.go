@@ -0,0 +1,202 @@
+package kafka_toolkit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBackpressureInterval    = time.Second
+	defaultBackpressureWindow      = 30 * time.Second
+	defaultBackpressureResumeAfter = 5 * time.Second
+	defaultBackpressureMinSamples  = 10
+)
+
+// HealthProbe verifica la salud del sistema downstream, retorna error si esta degradado
+type HealthProbe func(ctx context.Context) error
+
+// BackpressureConfig configuracion del controlador de backpressure, los umbrales en 0 se desactivan
+type BackpressureConfig struct {
+	// Probe health check del downstream, opcional
+	Probe HealthProbe
+	// Interval frecuencia de evaluacion, por defecto 1 segundo
+	Interval time.Duration
+	// MaxInFlight mensajes en proceso simultaneamente sobre los que se pausa
+	MaxInFlight int64
+	// MaxErrorRate tasa de error (0 a 1) dentro de Window sobre la que se pausa
+	MaxErrorRate float64
+	// Window ventana de calculo de tasa de error, por defecto 30 segundos
+	Window time.Duration
+	// MinSamples cantidad minima de mensajes en la ventana para evaluar la tasa de error, por defecto 10
+	MinSamples int64
+	// ResumeAfter tiempo que el sistema debe estar sano antes de reanudar, por defecto 5 segundos
+	ResumeAfter time.Duration
+}
+
+// BackpressureController pausa el consumer cuando el downstream esta degradado y lo reanuda al recuperarse
+type BackpressureController struct {
+	config BackpressureConfig
+
+	inFlight int64
+	total    int64
+	errors   int64
+
+	mu           sync.Mutex
+	pauser       Pauser
+	paused       bool
+	healthySince time.Time
+	windowStart  time.Time
+}
+
+// NewBackpressureController constructor de BackpressureController
+func NewBackpressureController(config BackpressureConfig) *BackpressureController {
+	if config.Interval <= 0 {
+		config.Interval = defaultBackpressureInterval
+	}
+
+	if config.Window <= 0 {
+		config.Window = defaultBackpressureWindow
+	}
+
+	if config.ResumeAfter <= 0 {
+		config.ResumeAfter = defaultBackpressureResumeAfter
+	}
+
+	if config.MinSamples <= 0 {
+		config.MinSamples = defaultBackpressureMinSamples
+	}
+
+	return &BackpressureController{config: config, windowStart: time.Now()}
+}
+
+// Attach asocia el consumer a pausar, lo realiza el builder al utilizar WithBackpressure
+func (c *BackpressureController) Attach(pauser Pauser) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pauser = pauser
+}
+
+// Middleware message handler middleware que registra mensajes en proceso y errores
+func (c *BackpressureController) Middleware() MessageHandlerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		return &backpressureMessageHandler{next: next, controller: c}
+	}
+}
+
+// Run evalua periodicamente el estado del downstream hasta que el context se cancele
+func (c *BackpressureController) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.Evaluate(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Evaluate evalua una vez el estado y pausa o reanuda el consumer
+func (c *BackpressureController) Evaluate(ctx context.Context) {
+	reason := c.unhealthyReason(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pauser == nil {
+		return
+	}
+
+	now := time.Now()
+
+	if reason != "" {
+		c.healthySince = time.Time{}
+
+		if !c.paused {
+			c.paused = true
+			Log.Warn(
+				"message", "Backpressure: pausando consumer",
+				"reason", reason)
+			c.pauser.PauseAll()
+		}
+
+		return
+	}
+
+	if !c.paused {
+		return
+	}
+
+	if c.healthySince.IsZero() {
+		c.healthySince = now
+	}
+
+	if now.Sub(c.healthySince) >= c.config.ResumeAfter {
+		c.paused = false
+		c.healthySince = time.Time{}
+		Log.Info("message", "Backpressure: downstream recuperado, reanudando consumer")
+		c.pauser.ResumeAll()
+	}
+}
+
+// Paused indica si el controlador mantiene pausado el consumer
+func (c *BackpressureController) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.paused
+}
+
+func (c *BackpressureController) unhealthyReason(ctx context.Context) string {
+	if c.config.Probe != nil {
+		if err := c.config.Probe(ctx); err != nil {
+			return fmt.Sprintf("health probe: %v", err)
+		}
+	}
+
+	if inFlight := atomic.LoadInt64(&c.inFlight); c.config.MaxInFlight > 0 && inFlight > c.config.MaxInFlight {
+		return fmt.Sprintf("mensajes en proceso %d mayor a %d", inFlight, c.config.MaxInFlight)
+	}
+
+	c.mu.Lock()
+	if time.Since(c.windowStart) >= c.config.Window {
+		atomic.StoreInt64(&c.total, 0)
+		atomic.StoreInt64(&c.errors, 0)
+		c.windowStart = time.Now()
+	}
+	c.mu.Unlock()
+
+	total := atomic.LoadInt64(&c.total)
+	if c.config.MaxErrorRate > 0 && total >= c.config.MinSamples {
+		if rate := float64(atomic.LoadInt64(&c.errors)) / float64(total); rate > c.config.MaxErrorRate {
+			return fmt.Sprintf("tasa de error %.2f mayor a %.2f", rate, c.config.MaxErrorRate)
+		}
+	}
+
+	return ""
+}
+
+type backpressureMessageHandler struct {
+	next       MessageHandler
+	controller *BackpressureController
+}
+
+func (h *backpressureMessageHandler) HandleMessage(ctx context.Context, inMsg *ConsumerMessage) error {
+	atomic.AddInt64(&h.controller.inFlight, 1)
+	defer atomic.AddInt64(&h.controller.inFlight, -1)
+
+	err := h.next.HandleMessage(ctx, inMsg)
+
+	atomic.AddInt64(&h.controller.total, 1)
+	if err != nil {
+		atomic.AddInt64(&h.controller.errors, 1)
+	}
+
+	return err
+}
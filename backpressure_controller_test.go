@@ -0,0 +1,162 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+func newAttachedBackpressure(config kafka.BackpressureConfig) (*kafka.BackpressureController, *fakePauser) {
+	kafkatest.EnsureLogger()
+
+	pauser := &fakePauser{}
+	controller := kafka.NewBackpressureController(config)
+	controller.Attach(pauser)
+
+	return controller, pauser
+}
+
+// assertBackpressure evalua una vez y verifica el estado del consumer y las pausas y reanudaciones acumuladas
+func assertBackpressure(t *testing.T, controller *kafka.BackpressureController, pauser *fakePauser, paused bool, pauses int, resumes int) {
+	t.Helper()
+
+	controller.Evaluate(context.Background())
+
+	if controller.Paused() != paused || pauser.Paused() != paused {
+		t.Errorf("se esperaba pausado %v, el controlador indica %v y el consumer %v", paused, controller.Paused(), pauser.Paused())
+	}
+
+	if gotPauses, gotResumes := pauser.counts(); gotPauses != pauses || gotResumes != resumes {
+		t.Errorf("se esperaban %d pausas y %d reanudaciones, se obtuvo %d y %d", pauses, resumes, gotPauses, gotResumes)
+	}
+}
+
+func TestBackpressureMaxInFlight(t *testing.T) {
+	controller, pauser := newAttachedBackpressure(kafka.BackpressureConfig{MaxInFlight: 2, ResumeAfter: 50 * time.Millisecond})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := controller.Middleware()(kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.HandleMessage(context.Background(), &kafka.ConsumerMessage{})
+		}()
+		<-started
+
+		// el umbral se supera recien con 3 mensajes en proceso
+		if i == 1 {
+			assertBackpressure(t, controller, pauser, false, 0, 0)
+		}
+	}
+
+	assertBackpressure(t, controller, pauser, true, 1, 0)
+
+	close(release)
+	wg.Wait()
+
+	// sano, pero se espera ResumeAfter antes de reanudar
+	assertBackpressure(t, controller, pauser, true, 1, 0)
+
+	time.Sleep(60 * time.Millisecond)
+	assertBackpressure(t, controller, pauser, false, 1, 1)
+}
+
+func TestBackpressureErrorRate(t *testing.T) {
+	controller, pauser := newAttachedBackpressure(kafka.BackpressureConfig{
+		MaxErrorRate: 0.5,
+		MinSamples:   4,
+		Window:       50 * time.Millisecond,
+		ResumeAfter:  time.Millisecond,
+	})
+
+	handler := controller.Middleware()(kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		if string(inMsg.Msg) == "error" {
+			return errors.New("downstream no disponible")
+		}
+		return nil
+	}))
+
+	for _, value := range []string{"error", "error", "error"} {
+		handler.HandleMessage(context.Background(), &kafka.ConsumerMessage{Msg: []byte(value)})
+	}
+
+	// sin MinSamples no se evalua la tasa
+	assertBackpressure(t, controller, pauser, false, 0, 0)
+
+	handler.HandleMessage(context.Background(), &kafka.ConsumerMessage{Msg: []byte("ok")})
+	assertBackpressure(t, controller, pauser, true, 1, 0)
+
+	// al vencer la ventana se reinician los conteos
+	time.Sleep(60 * time.Millisecond)
+	assertBackpressure(t, controller, pauser, true, 1, 0)
+
+	time.Sleep(5 * time.Millisecond)
+	assertBackpressure(t, controller, pauser, false, 1, 1)
+}
+
+func TestBackpressureProbeRestartsResumeWait(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		healthy bool
+	)
+	setHealthy := func(value bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		healthy = value
+	}
+
+	controller, pauser := newAttachedBackpressure(kafka.BackpressureConfig{
+		ResumeAfter: 50 * time.Millisecond,
+		Probe: func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if !healthy {
+				return errors.New("latencia alta")
+			}
+			return nil
+		},
+	})
+
+	assertBackpressure(t, controller, pauser, true, 1, 0)
+
+	setHealthy(true)
+	assertBackpressure(t, controller, pauser, true, 1, 0)
+	time.Sleep(30 * time.Millisecond)
+
+	// una falla durante la espera la reinicia
+	setHealthy(false)
+	assertBackpressure(t, controller, pauser, true, 1, 0)
+	setHealthy(true)
+	assertBackpressure(t, controller, pauser, true, 1, 0)
+	time.Sleep(30 * time.Millisecond)
+	assertBackpressure(t, controller, pauser, true, 1, 0)
+
+	time.Sleep(30 * time.Millisecond)
+	assertBackpressure(t, controller, pauser, false, 1, 1)
+}
+
+func TestBackpressureWithoutConsumer(t *testing.T) {
+	controller := kafka.NewBackpressureController(kafka.BackpressureConfig{
+		Probe: func(ctx context.Context) error { return errors.New("caido") },
+	})
+
+	controller.Evaluate(context.Background())
+
+	if controller.Paused() {
+		t.Errorf("no se esperaba pausar sin consumer asociado")
+	}
+}
@@ -2,6 +2,7 @@ package kafka_toolkit
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/Shopify/sarama"
 )
@@ -11,6 +12,9 @@ const (
 	RoundRobin = "roundrobin"
 	//Range estrategia range
 	Range = "range"
+	//Sticky estrategia sticky, intenta mantener las asignaciones previas. El rebalanceo sigue siendo eager:
+	// sarama no implementa el protocolo cooperativo (KIP-429) y cada rebalanceo revoca todas las particiones
+	Sticky = "sticky"
 )
 
 //BalanceStrategyResolver resuelve estrategia de balance
@@ -25,14 +29,30 @@ func NewBalanceStrategyResolver() BalanceStrategyResolver {
 	return &balanceStrategyResolver{}
 }
 
-//Resolve resuelve a estrategia de sarama, si estrategia es invalida retorna error
+//Resolve resuelve a estrategia de sarama, acepta una lista separada por coma en orden de preferencia
+// y retorna la primera soportada, si ninguna es valida retorna error. Sarama anuncia una sola estrategia
+// al unirse al grupo, por lo que no hay negociacion entre miembros y todos deben resolver la misma
 func (r *balanceStrategyResolver) Resolve(balanceStrategy string) (sarama.BalanceStrategy, error) {
-	switch balanceStrategy {
+	for _, name := range strings.Split(balanceStrategy, ",") {
+		name = strings.TrimSpace(name)
+
+		if strategy := resolveBalanceStrategy(name); strategy != nil {
+			return strategy, nil
+		}
+	}
+
+	return nil, errors.New(InvalidBalanceStrategyKind)
+}
+
+func resolveBalanceStrategy(name string) sarama.BalanceStrategy {
+	switch name {
 	case RoundRobin:
-		return sarama.BalanceStrategyRoundRobin, nil
+		return sarama.BalanceStrategyRoundRobin
 	case Range:
-		return sarama.BalanceStrategyRange, nil
+		return sarama.BalanceStrategyRange
+	case Sticky:
+		return sarama.BalanceStrategySticky
 	default:
-		return nil, errors.New(InvalidBalanceStrategyKind)
+		return nil
 	}
 }
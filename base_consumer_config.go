@@ -26,6 +26,33 @@ type ConsumerGroupInput struct {
 	Mechanism              string
 	CaFile                 string
 	SessionDurationSeconds int64
+	// TLSEnabled habilita TLS sin SASL (por ejemplo clusters mTLS), Security sigue habilitando SASL sobre TLS
+	TLSEnabled            bool
+	CertFile              string
+	KeyFile               string
+	TLSServerName         string
+	TLSMinVersion         string
+	TLSInsecureSkipVerify bool
+	TLSReloadSeconds      int64
+	// OAuth para Mechanism OAUTHBEARER, OAuthScopes separados por coma
+	OAuthTokenURL  string
+	OAuthScopes    string
+	OAuthTokenFile string
+	// GroupInstanceID habilita static membership, acepta variables de entorno (${POD_NAME}) y {hostname}
+	GroupInstanceID string
+	// StaticMembership sin GroupInstanceID deriva el id desde POD_NAME o el hostname
+	StaticMembership bool
+	// RackID rack del cliente para fetch desde la replica mas cercana (broker.rack)
+	RackID string
+	// StartFrom posicion inicial: earliest, latest, timestamp:<RFC3339|unix ms>, tail:<N> u offsets:<particion>=<offset>,...
+	// reemplaza a Earliest y Latest
+	StartFrom string
+	// ForceStartFrom aplica StartFrom al iniciar aunque el grupo tenga offsets comprometidos
+	ForceStartFrom bool
+	// HandlerTimeoutMillis tiempo maximo de procesamiento por mensaje, 0 sin limite
+	HandlerTimeoutMillis int64
+	// SessionTimeoutMillis session timeout del consumer group en milisegundos, reemplaza a SessionDurationSeconds
+	SessionTimeoutMillis int64
 }
 
 //ConsumerGroupConfig represents a consumer group config
@@ -34,6 +61,10 @@ type ConsumerGroupConfig struct {
 	Brokers      []string
 	Group        string
 	SaramaConfig *sarama.Config
+	// StartPosition posicion inicial a aplicar en el setup de la sesion, nil si basta con Offsets.Initial
+	StartPosition *StartPosition
+	// HandlerTimeout tiempo maximo de procesamiento por mensaje, 0 sin limite
+	HandlerTimeout time.Duration
 }
 
 //SaramaConsumerConfigurer generates Sarama Consumer config
@@ -56,6 +87,7 @@ func (s *saramaConsumerConfigurer) GenerateConfig(input ConsumerGroupInput) (*Co
 	consumerConfig.Topic = input.Topic
 	consumerConfig.Brokers = strings.Split(input.Brokers, ",")
 	consumerConfig.Group = input.Group
+	consumerConfig.HandlerTimeout = time.Duration(input.HandlerTimeoutMillis) * time.Millisecond
 
 	saramaConf, err := s.parseSaramaConsumerConfig(input)
 
@@ -63,6 +95,24 @@ func (s *saramaConsumerConfigurer) GenerateConfig(input ConsumerGroupInput) (*Co
 		return nil, err
 	}
 
+	if input.StartFrom != "" {
+		position, err := ParseStartPosition(input.StartFrom, input.ForceStartFrom)
+		if err != nil {
+			return nil, err
+		}
+
+		switch position.Mode {
+		case StartEarliest:
+			saramaConf.Consumer.Offsets.Initial = sarama.OffsetOldest
+		case StartLatest:
+			saramaConf.Consumer.Offsets.Initial = sarama.OffsetNewest
+		}
+
+		if position.needsResolver() {
+			consumerConfig.StartPosition = position
+		}
+	}
+
 	consumerConfig.SaramaConfig = saramaConf
 
 	return consumerConfig, nil
@@ -85,6 +135,10 @@ func (s *saramaConsumerConfigurer) parseSaramaConsumerConfig(input ConsumerGroup
 
 	saramaConf.Version = version
 
+	if err := configStaticMembership(saramaConf, input); err != nil {
+		return nil, err
+	}
+
 	strategy, err := s.balanceStrategyResolver.Resolve(input.BalanceStrategy)
 
 	if err != nil {
@@ -102,27 +156,38 @@ func (s *saramaConsumerConfigurer) parseSaramaConsumerConfig(input ConsumerGroup
 
 	saramaConf.Consumer.Offsets.AutoCommit.Interval = 250 * time.Millisecond
 
-	if !input.Security {
-		return saramaConf, nil
+	if input.SessionTimeoutMillis > 0 {
+		saramaConf.Consumer.Group.Session.Timeout = time.Duration(input.SessionTimeoutMillis) * time.Millisecond
+	} else if input.SessionDurationSeconds > 0 {
+		saramaConf.Consumer.Group.Session.Timeout = time.Duration(input.SessionDurationSeconds) * time.Second
 	}
 
-	saslConfig, err := SaramaSASLConfig(KafkaSASLSecurity{
-		Username:      input.Username,
-		Password:      input.Password,
-		CaFile:        input.CaFile,
-		MechanismSASL: input.Mechanism,
+	security := securityFromInput(input.Security, input.TLSEnabled, KafkaSASLSecurity{
+		Username:       input.Username,
+		Password:       input.Password,
+		CaFile:         input.CaFile,
+		MechanismSASL:  input.Mechanism,
+		OAuthTokenURL:  input.OAuthTokenURL,
+		OAuthScopes:    splitList(input.OAuthScopes),
+		OAuthTokenFile: input.OAuthTokenFile,
+	}, KafkaTLSSecurity{
+		CaFile:             input.CaFile,
+		CertFile:           input.CertFile,
+		KeyFile:            input.KeyFile,
+		ServerName:         input.TLSServerName,
+		MinVersion:         input.TLSMinVersion,
+		InsecureSkipVerify: input.TLSInsecureSkipVerify,
+		ReloadInterval:     time.Duration(input.TLSReloadSeconds) * time.Second,
 	})
 
-	if input.SessionDurationSeconds > 0 {
-		saramaConf.Consumer.Group.Session.Timeout = time.Duration(input.SessionDurationSeconds) * time.Second
+	if security == nil {
+		return saramaConf, nil
 	}
 
-	if err != nil {
+	if err := applySecurityConfig(saramaConf, security); err != nil {
 		return nil, err
 	}
 
-	saramaConf.Net = saslConfig.Net
-
 	return saramaConf, nil
 
 }
@@ -0,0 +1,48 @@
+package kafka_toolkit_test
+
+import (
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+func TestGenerateConfigAppliesSessionTimeoutWithoutSecurity(t *testing.T) {
+	input, err := kafka.LoadConsumerGroupInput(kafka.MapConfigSource(map[string]string{
+		"bootstrap.servers":  "localhost:9092",
+		"topic":              "orders",
+		"group.id":           "billing",
+		"kafka.version":      "2.8.0",
+		"session.timeout.ms": "45500",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := kafka.NewSaramaConsumerConfigurer(kafka.NewBalanceStrategyResolver()).GenerateConfig(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if timeout := config.SaramaConfig.Consumer.Group.Session.Timeout; timeout != 45500*time.Millisecond {
+		t.Errorf("session timeout: se esperaba 45.5s, se obtuvo %v", timeout)
+	}
+}
+
+func TestGenerateConfigAppliesSessionDurationSeconds(t *testing.T) {
+	config, err := kafka.NewSaramaConsumerConfigurer(kafka.NewBalanceStrategyResolver()).GenerateConfig(kafka.ConsumerGroupInput{
+		Brokers:                "localhost:9092",
+		Topic:                  "orders",
+		Group:                  "billing",
+		Version:                "2.8.0",
+		BalanceStrategy:        kafka.Range,
+		SessionDurationSeconds: 20,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if timeout := config.SaramaConfig.Consumer.Group.Session.Timeout; timeout != 20*time.Second {
+		t.Errorf("session timeout: se esperaba 20s, se obtuvo %v", timeout)
+	}
+}
@@ -39,10 +39,15 @@ func NewBaseLogger(logger kitlog.Logger) BaseLogger {
 		logger = kitlog.NewJSONLogger(kitlog.NewSyncWriter(os.Stdout))
 	}
 
-	Log = &baseLogger{
+	Log = newBaseLogger(logger)
+	return Log
+}
+
+// newBaseLogger BaseLogger sobre logger sin reemplazar el logger global
+func newBaseLogger(logger kitlog.Logger) BaseLogger {
+	return &baseLogger{
 		logger: logger,
 	}
-	return Log
 }
 
 func (b *baseLogger) Debug(keyvals ...interface{}) {
@@ -61,7 +66,7 @@ func (b *baseLogger) Error(keyvals ...interface{}) {
 	level.Error(b.logger).Log(keyvals...)
 }
 func (b *baseLogger) Panic(keyvals ...interface{}) {
-	level.Error(b.logger).Log("panic", "true", keyvals)
+	level.Error(b.logger).Log(append([]interface{}{"panic", "true"}, keyvals...)...)
 }
 
 func (b *baseLogger) Fatal(msg string, args ...interface{}) {
@@ -24,6 +24,18 @@ type BaseProducerConfigInput struct {
 	ClientID         string
 	FlushFrequencyMs int64
 	TimeoutMs        int64
+	// TLSEnabled habilita TLS sin SASL (por ejemplo clusters mTLS), Security sigue habilitando SASL sobre TLS
+	TLSEnabled            bool
+	CertFile              string
+	KeyFile               string
+	TLSServerName         string
+	TLSMinVersion         string
+	TLSInsecureSkipVerify bool
+	TLSReloadSeconds      int64
+	// OAuth para Mechanism OAUTHBEARER, OAuthScopes separados por coma
+	OAuthTokenURL  string
+	OAuthScopes    string
+	OAuthTokenFile string
 }
 
 // BaseProducerConfig configuracion base de producer
@@ -70,18 +82,26 @@ func (b *baseProducerConfigurer) GenerateConfig(confInput BaseProducerConfigInpu
 		config.Producer.Flush.Frequency = FlushFrequencyByDefault
 	}
 
-	if confInput.Security {
-		saslConfig, err := SaramaSASLConfig(KafkaSASLSecurity{
-			Username:      confInput.Username,
-			Password:      confInput.Password,
-			CaFile:        confInput.CaFile,
-			MechanismSASL: confInput.Mechanism,
-		})
-		if err != nil {
-			return nil, err
-		}
-
-		config.Net = saslConfig.Net
+	security := securityFromInput(confInput.Security, confInput.TLSEnabled, KafkaSASLSecurity{
+		Username:       confInput.Username,
+		Password:       confInput.Password,
+		CaFile:         confInput.CaFile,
+		MechanismSASL:  confInput.Mechanism,
+		OAuthTokenURL:  confInput.OAuthTokenURL,
+		OAuthScopes:    splitList(confInput.OAuthScopes),
+		OAuthTokenFile: confInput.OAuthTokenFile,
+	}, KafkaTLSSecurity{
+		CaFile:             confInput.CaFile,
+		CertFile:           confInput.CertFile,
+		KeyFile:            confInput.KeyFile,
+		ServerName:         confInput.TLSServerName,
+		MinVersion:         confInput.TLSMinVersion,
+		InsecureSkipVerify: confInput.TLSInsecureSkipVerify,
+		ReloadInterval:     time.Duration(confInput.TLSReloadSeconds) * time.Second,
+	})
+
+	if err := applySecurityConfig(config, security); err != nil {
+		return nil, err
 	}
 
 	return &BaseProducerConfig{brokers, config}, nil
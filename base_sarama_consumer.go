@@ -2,7 +2,9 @@ package kafka_toolkit
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Shopify/sarama"
 )
@@ -16,36 +18,72 @@ type BaseConsumer struct {
 	Ready          chan bool
 	MessageHandler MessageHandler
 	ErrorHandler   ConsumerErrorHandler
+	// RebalanceListener opcional, notificado al asignar o revocar particiones
+	RebalanceListener RebalanceListener
+	// HandlerTimeout tiempo maximo de procesamiento por mensaje, 0 sin limite. Al vencer se cancela el
+	// context del handler, que debe respetar ctx.Done() para que el consumer continue en orden
+	HandlerTimeout time.Duration
+	// HandlerTimeoutGrace espera adicional a que finalice un handler vencido antes de abandonarlo y
+	// reiniciar la sesion sin marcar el mensaje, por defecto igual a HandlerTimeout
+	HandlerTimeoutGrace time.Duration
+	// HandlerMetrics metricas de panics y timeouts del handler, opcional
+	HandlerMetrics *HandlerGuardMetrics
+
+	assignment    *partitionAssignment
+	startPosition *startPositionResolver
+	pause         *pauseState
+	abandoned     *abandonedHandlers
+	group         sarama.ConsumerGroup
 }
 
 const errorSaramaMessage = "sarama message is nil"
 
 // NewBaseConsumer construye un nuevo consumer base
 func NewBaseConsumer(handler MessageHandler, errorHandler ConsumerErrorHandler) BaseConsumer {
-	return BaseConsumer{MessageHandler: handler, ErrorHandler: errorHandler, Ready: make(chan bool)}
+	return BaseConsumer{MessageHandler: handler, ErrorHandler: errorHandler, Ready: make(chan bool), assignment: newPartitionAssignment(), pause: newPauseState(), abandoned: newAbandonedHandlers()}
 }
 
 // Setup is run at the beginning of a new session, before ConsumeClaim
-func (consumer *BaseConsumer) Setup(sarama.ConsumerGroupSession) error {
+func (consumer *BaseConsumer) Setup(session sarama.ConsumerGroupSession) error {
+	if consumer.startPosition != nil {
+		if err := consumer.startPosition.apply(session); err != nil {
+			Log.Error(
+				"errorMessage", "Error aplicando posicion inicial",
+				"error", err)
+			return err
+		}
+	}
+
+	consumer.assignPartitions(session.Claims())
+
 	// Mark the consumer as ready
 	close(consumer.Ready)
 	return nil
 }
 
-// Cleanup Realiza clean up de sarama.
+// Cleanup Realiza clean up de sarama, revoca todas las particiones de la sesion. Sarama detiene todos los
+// claims en cada rebalanceo, por lo que la siguiente sesion vuelve a asignar las particiones que conserve
 func (consumer *BaseConsumer) Cleanup(sess sarama.ConsumerGroupSession) error {
-	//TODO: verificar que se debe hacer en cleanup
+	consumer.revokeAllPartitions()
+
 	return nil
 }
 
-// ConsumeClaim inicia loop para cobrar mensajes
+// ConsumeClaim inicia loop para cobrar mensajes, antes espera a que finalicen los handlers abandonados de la particion
 func (consumer *BaseConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	consumer.reapplyPause(claim)
+	consumer.awaitAbandoned(session, claim.Topic(), claim.Partition())
+
 	for {
 		go logClaims(session)
 
 		select {
 		case message := <-claim.Messages():
-			consumer.HandleSaramaMessage(session, message)
+			// Un mensaje sin procesar detiene el claim para no marcar los siguientes, la sesion se reinicia
+			// y el mensaje se vuelve a entregar
+			if err := consumer.handleSaramaMessage(session, message); errors.Is(err, ErrSessionClosed) {
+				return err
+			}
 		case <-session.Context().Done():
 			return nil
 		}
@@ -60,18 +98,39 @@ func logClaims(session sarama.ConsumerGroupSession) {
 
 //HandleSaramaMessage maneja el mensaje Sarama
 func (consumer *BaseConsumer) HandleSaramaMessage(session sarama.ConsumerGroupSession, saramaMessage *sarama.ConsumerMessage) {
+	consumer.handleSaramaMessage(session, saramaMessage)
+}
+
+// handleSaramaMessage procesa el mensaje y lo marca aunque el handler falle (el error se envia al error handler).
+// Si el mensaje quedo sin procesar (sesion terminada o handler abandonado por HandlerTimeout) no lo marca y retorna
+// el error, que envuelve ErrSessionClosed, para que el claim se detenga y el mensaje se vuelva a entregar
+func (consumer *BaseConsumer) handleSaramaMessage(session sarama.ConsumerGroupSession, saramaMessage *sarama.ConsumerMessage) error {
 	if saramaMessage == nil {
 		Log.Error("error", errorSaramaMessage)
-		return
+		return nil
 	}
 
+	ctx := ContextWithSessionDone(context.Background(), session.Context().Done())
+
+	if err := consumer.processSaramaMessage(ctx, saramaMessage); errors.Is(err, ErrSessionClosed) {
+		return err
+	}
+
+	session.MarkMessage(saramaMessage, "")
+
+	return nil
+}
+
+// processSaramaMessage ejecuta el message handler y el error handler, retorna el error del handler
+func (consumer *BaseConsumer) processSaramaMessage(ctx context.Context, saramaMessage *sarama.ConsumerMessage) error {
 	msg := saramaToGenericMessage(saramaMessage)
 
-	if err := consumer.MessageHandler.HandleMessage(context.Background(), msg); err != nil {
+	err := consumer.invokeHandler(ctx, msg)
+	if err != nil && !errors.Is(err, ErrSessionClosed) {
 		consumer.ErrorHandler.HandleError(msg.Msg, err)
 	}
 
-	session.MarkMessage(saramaMessage, "")
+	return err
 }
 
 func saramaToGenericMessage(msg *sarama.ConsumerMessage) *ConsumerMessage {
@@ -96,7 +155,8 @@ func saramaHeaderToMap(saramaHeaders []*sarama.RecordHeader) map[string]string {
 	return headers
 }
 
-// Close implementa metodo close de sarama.Consumer
+// Close implementa metodo close de sarama.Consumer, revoca las particiones que aun esten asignadas
 func (consumer *BaseConsumer) Close() error {
+	consumer.revokeAllPartitions()
 	return nil
 }
@@ -38,8 +38,10 @@ func (b *baseProducer) SendMessage(ctx context.Context, msg *ProducerMessage) er
 		return errors.New(InvalidInputProducerErrorKind)
 	}
 
+	topic := destinationTopic(b.topic, msg)
+
 	producerMsg := &sarama.ProducerMessage{
-		Topic:     b.topic,
+		Topic:     topic,
 		Value:     sarama.StringEncoder(msg.Msg),
 		Key:       sarama.StringEncoder(msg.Key),
 		Timestamp: time.Now(),
@@ -54,7 +56,7 @@ func (b *baseProducer) SendMessage(ctx context.Context, msg *ProducerMessage) er
 	Log.Info(
 		"message", "Mensaje enviado",
 		"outMessage", string(msg.Msg),
-		"topic", b.topic,
+		"topic", topic,
 		"partition", partition,
 		"offset", offset,
 		"dd.trace_id", traceId,
@@ -84,9 +86,10 @@ func (b *baseProducerAsync) SendMessage(ctx context.Context, msg *ProducerMessag
 	}
 
 	traceId, spanId := GetDatadogTraceAndSpanFromContext(ctx)
+	topic := destinationTopic(b.topic, msg)
 
 	producerMsg := &sarama.ProducerMessage{
-		Topic:     b.topic,
+		Topic:     topic,
 		Value:     sarama.StringEncoder(msg.Msg),
 		Key:       sarama.StringEncoder(msg.Key),
 		Timestamp: time.Now(),
@@ -102,7 +105,7 @@ func (b *baseProducerAsync) SendMessage(ctx context.Context, msg *ProducerMessag
 				Log.Info(
 					"message", "Produce message success",
 					"outMessage:", string(msg.Msg),
-					"topic", b.topic,
+					"topic", topic,
 					"partition", producerMsg.Partition,
 					"offset", producerMsg.Offset,
 					"dd.trace_id", traceId,
@@ -132,6 +135,15 @@ func (b *baseProducerAsync) SendMessage(ctx context.Context, msg *ProducerMessag
 	return nil
 }
 
+// destinationTopic topico del mensaje si fue indicado, si no el topico del producer
+func destinationTopic(topic string, msg *ProducerMessage) string {
+	if msg.Topic != "" {
+		return msg.Topic
+	}
+
+	return topic
+}
+
 func encodeHeaders(headers map[string]string) []sarama.RecordHeader {
 	var recordHeaders []sarama.RecordHeader = make([]sarama.RecordHeader, 0)
 
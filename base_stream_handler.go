@@ -24,6 +24,12 @@ func (h *streamHandler) HandleMessage(ctx context.Context, inMsg *ConsumerMessag
 		return err
 	}
 
+	// Sin mensaje de salida el mensaje fue filtrado
+	if outMsg == nil {
+		logFilteredMessage(Log, inMsg)
+		return nil
+	}
+
 	if err := h.producer.SendMessage(ctx, outMsg); err != nil {
 		Log.Error(
 			"errorMessage", "Error enviando mensaje",
@@ -0,0 +1,326 @@
+package kafka_toolkit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Estados de circuit breaker
+const (
+	CircuitClosed   = "closed"
+	CircuitHalfOpen = "half-open"
+	CircuitOpen     = "open"
+)
+
+const (
+	defaultBreakerFailureRatio = 0.5
+	defaultBreakerMinRequests  = 10
+	defaultBreakerWindow       = time.Minute
+	defaultBreakerCoolDown     = 30 * time.Second
+)
+
+// CircuitBreakerConfig configuracion de circuit breaker
+type CircuitBreakerConfig struct {
+	// Name nombre del breaker, utilizado en logs y metricas
+	Name string
+	// FailureRatio proporcion de errores dentro de Window sobre la que se abre el breaker, por defecto 0.5
+	FailureRatio float64
+	// MinRequests cantidad minima de llamadas en la ventana para evaluar FailureRatio, por defecto 10
+	MinRequests int64
+	// Window ventana de calculo de errores, por defecto 1 minuto
+	Window time.Duration
+	// CoolDown tiempo en estado abierto antes de pasar a half-open, por defecto 30 segundos
+	CoolDown time.Duration
+	// HalfOpenMaxRequests llamadas exitosas en half-open necesarias para cerrar, por defecto 1
+	HalfOpenMaxRequests int64
+	// BlockWhileOpen espera a que el breaker permita llamadas en lugar de fallar, evitando que el consumer
+	// comprometa mensajes sin procesar mientras el breaker esta abierto
+	BlockWhileOpen bool
+	// IsFailure indica si un error cuenta como falla, por defecto todo error
+	IsFailure func(error) bool
+	// Metrics metricas de estado y transiciones, opcional
+	Metrics *CircuitBreakerMetrics
+}
+
+// CircuitBreaker circuit breaker con estados closed, open y half-open
+type CircuitBreaker struct {
+	config CircuitBreakerConfig
+
+	mu               sync.Mutex
+	state            string
+	openedAt         time.Time
+	windowStart      time.Time
+	total            int64
+	failures         int64
+	halfOpenInFlight int64
+	halfOpenSuccess  int64
+	changed          chan struct{}
+	pauser           Pauser
+	coolDownTimer    *time.Timer
+}
+
+// NewCircuitBreaker constructor de CircuitBreaker
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	if config.FailureRatio <= 0 {
+		config.FailureRatio = defaultBreakerFailureRatio
+	}
+
+	if config.MinRequests <= 0 {
+		config.MinRequests = defaultBreakerMinRequests
+	}
+
+	if config.Window <= 0 {
+		config.Window = defaultBreakerWindow
+	}
+
+	if config.CoolDown <= 0 {
+		config.CoolDown = defaultBreakerCoolDown
+	}
+
+	if config.HalfOpenMaxRequests <= 0 {
+		config.HalfOpenMaxRequests = 1
+	}
+
+	if config.IsFailure == nil {
+		config.IsFailure = func(err error) bool { return err != nil }
+	}
+
+	cb := &CircuitBreaker{
+		config:      config,
+		state:       CircuitClosed,
+		windowStart: time.Now(),
+		changed:     make(chan struct{}),
+	}
+	cb.config.Metrics.setState(config.Name, CircuitClosed)
+
+	return cb
+}
+
+// Attach asocia un consumer que se pausa mientras el breaker esta abierto y se reanuda al pasar a half-open,
+// implica BlockWhileOpen
+func (cb *CircuitBreaker) Attach(pauser Pauser) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.pauser = pauser
+	cb.config.BlockWhileOpen = true
+}
+
+// State estado actual del breaker
+func (cb *CircuitBreaker) State() string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.refreshLocked(time.Now())
+
+	return cb.state
+}
+
+// Execute ejecuta fn si el breaker lo permite y registra el resultado
+func (cb *CircuitBreaker) Execute(ctx context.Context, fn func() error) error {
+	halfOpen, err := cb.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	cb.record(halfOpen, cb.config.IsFailure(err))
+
+	return err
+}
+
+// acquire espera o falla segun el estado, retorna true si la llamada es una prueba en half-open.
+// Si la sesion del consumer termina durante la espera retorna ErrSessionClosed para que el mensaje no se marque.
+func (cb *CircuitBreaker) acquire(ctx context.Context) (bool, error) {
+	for {
+		cb.mu.Lock()
+		now := time.Now()
+		cb.refreshLocked(now)
+
+		switch {
+		case cb.state == CircuitClosed:
+			cb.mu.Unlock()
+			return false, nil
+		case cb.state == CircuitHalfOpen && cb.halfOpenInFlight < cb.config.HalfOpenMaxRequests:
+			cb.halfOpenInFlight++
+			cb.mu.Unlock()
+			return true, nil
+		case !cb.config.BlockWhileOpen:
+			cb.mu.Unlock()
+			return false, errors.New(CircuitOpenErrorKind)
+		}
+
+		wait := cb.config.CoolDown - now.Sub(cb.openedAt)
+		if cb.state == CircuitHalfOpen || wait <= 0 {
+			wait = cb.config.CoolDown
+		}
+		changed := cb.changed
+		cb.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		case <-SessionDoneFromContext(ctx):
+			timer.Stop()
+			return false, ErrSessionClosed
+		case <-ctx.Done():
+			timer.Stop()
+			return false, ctx.Err()
+		}
+	}
+}
+
+func (cb *CircuitBreaker) record(halfOpen bool, failure bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+
+	if halfOpen {
+		cb.halfOpenInFlight--
+
+		if cb.state != CircuitHalfOpen {
+			return
+		}
+
+		if failure {
+			cb.transitionLocked(CircuitOpen, now)
+			return
+		}
+
+		cb.halfOpenSuccess++
+		if cb.halfOpenSuccess >= cb.config.HalfOpenMaxRequests {
+			cb.transitionLocked(CircuitClosed, now)
+		}
+
+		return
+	}
+
+	if cb.state != CircuitClosed {
+		return
+	}
+
+	if now.Sub(cb.windowStart) >= cb.config.Window {
+		cb.windowStart = now
+		cb.total = 0
+		cb.failures = 0
+	}
+
+	cb.total++
+	if failure {
+		cb.failures++
+	}
+
+	if cb.total >= cb.config.MinRequests && float64(cb.failures)/float64(cb.total) >= cb.config.FailureRatio {
+		cb.transitionLocked(CircuitOpen, now)
+	}
+}
+
+// refreshLocked pasa de open a half-open una vez cumplido el cool down
+func (cb *CircuitBreaker) refreshLocked(now time.Time) {
+	if cb.state == CircuitOpen && now.Sub(cb.openedAt) >= cb.config.CoolDown {
+		cb.transitionLocked(CircuitHalfOpen, now)
+	}
+}
+
+func (cb *CircuitBreaker) transitionLocked(state string, now time.Time) {
+	from := cb.state
+	cb.state = state
+
+	switch state {
+	case CircuitOpen:
+		cb.openedAt = now
+		cb.armCoolDownLocked()
+	case CircuitHalfOpen:
+		cb.halfOpenSuccess = 0
+	case CircuitClosed:
+		cb.windowStart = now
+		cb.total = 0
+		cb.failures = 0
+	}
+
+	close(cb.changed)
+	cb.changed = make(chan struct{})
+
+	if state == CircuitOpen {
+		Log.Warn(
+			"message", "Circuit breaker abierto",
+			"breaker", cb.config.Name,
+			"from", from,
+			"to", state)
+	} else {
+		Log.Info(
+			"message", "Circuit breaker cambio de estado",
+			"breaker", cb.config.Name,
+			"from", from,
+			"to", state)
+	}
+
+	cb.config.Metrics.transition(cb.config.Name, from, state)
+
+	if cb.pauser == nil {
+		return
+	}
+
+	switch {
+	case state == CircuitOpen:
+		cb.pauser.PauseAll()
+	case from == CircuitOpen:
+		cb.pauser.ResumeAll()
+	}
+}
+
+// armCoolDownLocked programa el paso a half-open al cumplirse el cool down, necesario cuando el consumer
+// esta pausado y no llegan llamadas que evaluen el estado
+func (cb *CircuitBreaker) armCoolDownLocked() {
+	if cb.coolDownTimer != nil {
+		cb.coolDownTimer.Stop()
+	}
+
+	cb.coolDownTimer = time.AfterFunc(cb.config.CoolDown, func() {
+		cb.mu.Lock()
+		defer cb.mu.Unlock()
+
+		cb.refreshLocked(time.Now())
+	})
+}
+
+type circuitBreakerMessageHandler struct {
+	next    MessageHandler
+	breaker *CircuitBreaker
+}
+
+// MakeCircuitBreakerMessageHandlerMiddleware message handler middleware con circuit breaker
+func MakeCircuitBreakerMessageHandlerMiddleware(breaker *CircuitBreaker) MessageHandlerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		return &circuitBreakerMessageHandler{next: next, breaker: breaker}
+	}
+}
+
+func (h *circuitBreakerMessageHandler) HandleMessage(ctx context.Context, inMsg *ConsumerMessage) error {
+	return h.breaker.Execute(ctx, func() error {
+		return h.next.HandleMessage(ctx, inMsg)
+	})
+}
+
+type circuitBreakerProducer struct {
+	next    MessageProducer
+	breaker *CircuitBreaker
+}
+
+// MakeCircuitBreakerProducerMiddleware producer middleware con circuit breaker
+func MakeCircuitBreakerProducerMiddleware(breaker *CircuitBreaker) ProducerMessageMiddleware {
+	return func(next MessageProducer) MessageProducer {
+		return &circuitBreakerProducer{next: next, breaker: breaker}
+	}
+}
+
+func (p *circuitBreakerProducer) SendMessage(ctx context.Context, msg *ProducerMessage) error {
+	return p.breaker.Execute(ctx, func() error {
+		return p.next.SendMessage(ctx, msg)
+	})
+}
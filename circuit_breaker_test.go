@@ -0,0 +1,147 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+func TestCircuitBreakerBlockedWaitEndsWithSession(t *testing.T) {
+	kafkatest.EnsureLogger()
+
+	breaker := kafka.NewCircuitBreaker(kafka.CircuitBreakerConfig{
+		MinRequests:    1,
+		CoolDown:       time.Hour,
+		BlockWhileOpen: true,
+	})
+
+	failure := errors.New("falla")
+	if err := breaker.Execute(context.Background(), func() error { return failure }); err != failure {
+		t.Fatalf("se esperaba el error del handler, se obtuvo %v", err)
+	}
+
+	if state := breaker.State(); state != kafka.CircuitOpen {
+		t.Fatalf("se esperaba breaker abierto, se obtuvo %s", state)
+	}
+
+	done := make(chan struct{})
+	ctx := kafka.ContextWithSessionDone(context.Background(), done)
+
+	result := make(chan error, 1)
+	go func() {
+		result <- breaker.Execute(ctx, func() error {
+			t.Errorf("no se esperaba ejecucion con el breaker abierto")
+			return nil
+		})
+	}()
+
+	close(done)
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, kafka.ErrSessionClosed) {
+			t.Errorf("se esperaba ErrSessionClosed, se obtuvo %v", err)
+		}
+	case <-time.After(kafkatest.DefaultTimeout):
+		t.Fatalf("la espera del breaker no termino con la sesion")
+	}
+}
+
+type fakePauser struct {
+	mu      sync.Mutex
+	paused  bool
+	pauses  int
+	resumes int
+}
+
+func (p *fakePauser) Pause(partitions map[string][]int32)  {}
+func (p *fakePauser) Resume(partitions map[string][]int32) {}
+
+func (p *fakePauser) PauseAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.paused = true
+	p.pauses++
+}
+
+func (p *fakePauser) ResumeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.paused = false
+	p.resumes++
+}
+
+func (p *fakePauser) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.paused
+}
+
+func (p *fakePauser) counts() (int, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.pauses, p.resumes
+}
+
+func TestCircuitBreakerAttachResumesAfterCoolDown(t *testing.T) {
+	kafkatest.EnsureLogger()
+
+	breaker := kafka.NewCircuitBreaker(kafka.CircuitBreakerConfig{
+		MinRequests: 1,
+		CoolDown:    100 * time.Millisecond,
+	})
+
+	pauser := &fakePauser{}
+	breaker.Attach(pauser)
+
+	failure := errors.New("falla")
+	breaker.Execute(context.Background(), func() error { return failure })
+
+	if !pauser.Paused() {
+		t.Fatalf("se esperaba el consumer pausado con el breaker abierto")
+	}
+
+	deadline := time.Now().Add(kafkatest.DefaultTimeout)
+	for pauser.Paused() {
+		if time.Now().After(deadline) {
+			t.Fatalf("el consumer no se reanudo luego del cool down")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// la prueba en half-open falla y vuelve a pausar
+	breaker.Execute(context.Background(), func() error { return failure })
+
+	if pauses, resumes := pauser.counts(); pauses != 2 || resumes != 1 {
+		t.Fatalf("se esperaban 2 pausas y 1 reanudacion, se obtuvo %d y %d", pauses, resumes)
+	}
+
+	deadline = time.Now().Add(kafkatest.DefaultTimeout)
+	for pauser.Paused() {
+		if time.Now().After(deadline) {
+			t.Fatalf("el consumer no se reanudo luego del segundo cool down")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := breaker.Execute(context.Background(), func() error { return nil }); err != nil {
+		t.Fatalf("no se esperaba error en la prueba half-open, se obtuvo %v", err)
+	}
+
+	if state := breaker.State(); state != kafka.CircuitClosed {
+		t.Fatalf("se esperaba breaker cerrado, se obtuvo %s", state)
+	}
+
+	if pauses, resumes := pauser.counts(); pauses != 2 || resumes != 2 {
+		t.Fatalf("se esperaban 2 pausas y 2 reanudaciones, se obtuvo %d y %d", pauses, resumes)
+	}
+}
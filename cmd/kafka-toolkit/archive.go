@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+const archiveUsage = "uso: kafka-toolkit archive restore --path <directorio|archivo> [--topic <topico>] [flags]"
+
+func runArchive(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "restore" {
+		return errors.New(archiveUsage)
+	}
+
+	fs := flag.NewFlagSet("archive restore", flag.ContinueOnError)
+
+	var conn connectionFlags
+	conn.register(fs, true, false)
+
+	path := fs.String("path", "", "directorio base del archivo, un subdirectorio o un archivo")
+	keepPartitions := fs.Bool("keep-partitions", false, "produce en la particion original, por defecto particiona por key")
+	rate := fs.Float64("rate", 0, "mensajes por segundo, 0 sin limite")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if *path == "" {
+		return errors.New(archiveUsage)
+	}
+
+	// sin --topic cada registro vuelve a su topico original
+	topic := conn.topic
+	if topic == "" {
+		conn.topic = anyTopic
+	}
+
+	producer, err := conn.producerInput()
+	if err != nil {
+		return err
+	}
+
+	restored, err := kafka.RestoreArchive(ctx, *path, kafka.ArchiveRestoreConfig{
+		Producer:       producer,
+		Topic:          topic,
+		KeepPartitions: *keepPartitions,
+		Rate:           *rate,
+	})
+
+	fmt.Fprintf(stdout, "%d mensajes restaurados\n", restored)
+
+	return err
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+const (
+	defaultEnvPrefix    = "KAFKA"
+	defaultGroup        = "kafka-toolkit-cli"
+	defaultKafkaVersion = "2.1.0"
+	// anyTopic completa topic para comandos que no operan sobre un topico y reutilizan la validacion del loader
+	anyTopic = "-"
+)
+
+// serviceEnvKeys variables de entorno de los servicios (configuracion naga) y su key de configuracion
+var serviceEnvKeys = map[string]string{
+	"kafka_brokers":   "bootstrap.servers",
+	"consumer_group":  "group.id",
+	"input_topic":     "topic",
+	"kafka_cert_part": "ssl.ca.location",
+	"kafka_username":  "sasl.username",
+	"kafka_password":  "sasl.password",
+}
+
+// serviceSecurityEnv variable de entorno de los servicios que habilita SASL sobre TLS
+const serviceSecurityEnv = "security_enabled"
+
+// connectionFlags flags de conexion comunes, se aplican sobre el archivo y las variables de entorno
+type connectionFlags struct {
+	configFile string
+	envPrefix  string
+	brokers    string
+	topic      string
+	group      string
+}
+
+func (c *connectionFlags) register(fs *flag.FlagSet, withTopic bool, withGroup bool) {
+	fs.StringVar(&c.configFile, "config", "", "archivo de configuracion YAML, JSON o .properties")
+	fs.StringVar(&c.envPrefix, "env-prefix", defaultEnvPrefix, "prefijo de las variables de entorno estilo librdkafka, alias de las variables de los servicios")
+	fs.StringVar(&c.brokers, "brokers", "", "brokers separados por coma, sobreescribe bootstrap.servers")
+
+	if withTopic {
+		fs.StringVar(&c.topic, "topic", "", "topico, sobreescribe topic")
+	}
+
+	if withGroup {
+		fs.StringVar(&c.group, "group", "", "consumer group, sobreescribe group.id")
+	}
+}
+
+// sources fuentes de configuracion en orden de prioridad: valores por defecto, archivo, entorno con prefijo,
+// entorno de los servicios y flags
+func (c *connectionFlags) sources(defaults map[string]string) []kafka.ConfigSource {
+	sources := []kafka.ConfigSource{kafka.MapConfigSource(defaults)}
+
+	if c.configFile != "" {
+		sources = append(sources, kafka.FileConfigSource(c.configFile))
+	}
+
+	sources = append(sources, kafka.EnvConfigSource(c.envPrefix), serviceEnvConfigSource)
+
+	overrides := make(map[string]string)
+	if c.brokers != "" {
+		overrides["bootstrap.servers"] = c.brokers
+	}
+	if c.topic != "" {
+		overrides["topic"] = c.topic
+	}
+	if c.group != "" {
+		overrides["group.id"] = c.group
+	}
+
+	return append(sources, kafka.MapConfigSource(overrides))
+}
+
+// serviceEnvConfigSource lee las variables de entorno que utilizan los servicios (kafka_brokers, consumer_group, etc.),
+// en minusculas o mayusculas
+func serviceEnvConfigSource() (map[string]string, error) {
+	values := make(map[string]string)
+
+	for name, key := range serviceEnvKeys {
+		if value, ok := lookupServiceEnv(name); ok {
+			values[key] = value
+		}
+	}
+
+	if value, ok := lookupServiceEnv(serviceSecurityEnv); ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("valor %q invalido para %s, debe ser true o false", value, serviceSecurityEnv)
+		}
+
+		values["security.protocol"] = kafka.SecurityProtocolPlaintext
+		if enabled {
+			values["security.protocol"] = kafka.SecurityProtocolSASLSSL
+		}
+	}
+
+	return values, nil
+}
+
+func lookupServiceEnv(name string) (string, bool) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true
+	}
+
+	return os.LookupEnv(strings.ToUpper(name))
+}
+
+func (c *connectionFlags) consumerInput(topic string) (kafka.ConsumerGroupInput, error) {
+	return kafka.LoadConsumerGroupInput(c.sources(map[string]string{
+		"group.id":      defaultGroup,
+		"client.id":     defaultGroup,
+		"kafka.version": defaultKafkaVersion,
+		"topic":         topic,
+	})...)
+}
+
+func (c *connectionFlags) producerInput() (kafka.BaseProducerConfigInput, error) {
+	return kafka.LoadProducerConfigInput(c.sources(map[string]string{
+		"client.id":     defaultGroup,
+		"kafka.version": defaultKafkaVersion,
+	})...)
+}
+
+// client cliente sarama con la configuracion de consumer del toolkit, incluyendo TLS y SASL
+func (c *connectionFlags) client(topic string) (sarama.Client, kafka.ConsumerGroupInput, error) {
+	input, err := c.consumerInput(topic)
+	if err != nil {
+		return nil, input, err
+	}
+
+	conf, err := kafka.NewSaramaConsumerConfigurer(kafka.NewBalanceStrategyResolver()).GenerateConfig(input)
+	if err != nil {
+		return nil, input, err
+	}
+
+	client, err := sarama.NewClient(conf.Brokers, conf.SaramaConfig)
+	if err != nil {
+		return nil, input, fmt.Errorf("error conectando a %s: %v", input.Brokers, err)
+	}
+
+	return client, input, nil
+}
+
+// headerFlags flag repetible --header key=value
+type headerFlags map[string]string
+
+func (h headerFlags) String() string {
+	items := make([]string, 0, len(h))
+	for k, v := range h {
+		items = append(items, k+"="+v)
+	}
+
+	return strings.Join(items, ",")
+}
+
+func (h headerFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("header %q invalido, debe ser key=value", value)
+	}
+
+	h[parts[0]] = parts[1]
+
+	return nil
+}
+
+// partitionFlags flag de particiones separadas por coma, vacio incluye todas
+type partitionFlags []int32
+
+func (p *partitionFlags) String() string {
+	items := make([]string, 0, len(*p))
+	for _, partition := range *p {
+		items = append(items, fmt.Sprint(partition))
+	}
+
+	return strings.Join(items, ",")
+}
+
+func (p *partitionFlags) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		var partition int32
+		if _, err := fmt.Sscan(strings.TrimSpace(item), &partition); err != nil || partition < 0 {
+			return fmt.Errorf("particion %q invalida", item)
+		}
+
+		*p = append(*p, partition)
+	}
+
+	return nil
+}
+
+func (p partitionFlags) filter(partitions []int32) ([]int32, error) {
+	if len(p) == 0 {
+		return partitions, nil
+	}
+
+	available := make(map[int32]bool, len(partitions))
+	for _, partition := range partitions {
+		available[partition] = true
+	}
+
+	for _, partition := range p {
+		if !available[partition] {
+			return nil, fmt.Errorf("particion %d no existe", partition)
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// setenv define una variable de entorno durante el test y restaura su valor anterior
+func setenv(t *testing.T, name string, value string) {
+	t.Helper()
+
+	previous, existed := os.LookupEnv(name)
+	if err := os.Setenv(name, value); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if existed {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func TestServiceEnvMapping(t *testing.T) {
+	setenv(t, "kafka_brokers", "b1:9093,b2:9093")
+	setenv(t, "CONSUMER_GROUP", "billing")
+	setenv(t, "input_topic", "payments")
+	setenv(t, "security_enabled", "true")
+	setenv(t, "kafka_cert_part", "/etc/kafka/ca.pem")
+	setenv(t, "kafka_username", "svc")
+	setenv(t, "kafka_password", "secret")
+
+	flags := connectionFlags{envPrefix: defaultEnvPrefix}
+
+	input, err := flags.consumerInput(anyTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if input.Brokers != "b1:9093,b2:9093" || input.Group != "billing" || input.Topic != "payments" {
+		t.Errorf("conexion: se obtuvo %+v", input)
+	}
+
+	if !input.Security || input.CaFile != "/etc/kafka/ca.pem" || input.Username != "svc" || input.Password != "secret" {
+		t.Errorf("seguridad: se obtuvo %+v", input)
+	}
+}
+
+func TestServiceEnvPriority(t *testing.T) {
+	setenv(t, "KAFKA_BOOTSTRAP_SERVERS", "alias:9092")
+	setenv(t, "KAFKA_GROUP_ID", "alias-group")
+	setenv(t, "kafka_brokers", "service:9092")
+
+	flags := connectionFlags{envPrefix: defaultEnvPrefix}
+
+	input, err := flags.consumerInput(anyTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if input.Brokers != "service:9092" {
+		t.Errorf("se esperaba la variable del servicio sobre el alias, se obtuvo %s", input.Brokers)
+	}
+
+	if input.Group != "alias-group" {
+		t.Errorf("se esperaba el grupo del alias, se obtuvo %s", input.Group)
+	}
+
+	flags.brokers = "flag:9092"
+
+	input, err = flags.consumerInput(anyTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if input.Brokers != "flag:9092" {
+		t.Errorf("se esperaba el flag sobre el entorno, se obtuvo %s", input.Brokers)
+	}
+}
+
+func TestServiceEnvInvalidSecurity(t *testing.T) {
+	setenv(t, "kafka_brokers", "b1:9092")
+	setenv(t, "security_enabled", "quizas")
+
+	flags := connectionFlags{envPrefix: defaultEnvPrefix}
+
+	if _, err := flags.consumerInput(anyTopic); err == nil {
+		t.Errorf("se esperaba error con security_enabled invalido")
+	}
+
+	setenv(t, "security_enabled", "false")
+
+	input, err := flags.consumerInput(anyTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if input.Security || input.TLSEnabled {
+		t.Errorf("se esperaba PLAINTEXT con security_enabled=false, se obtuvo %+v", input)
+	}
+}
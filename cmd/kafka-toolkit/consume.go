@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+const (
+	formatText  = "text"
+	formatJSON  = "json"
+	formatValue = "value"
+)
+
+// consumeOptions opciones de consume y tail
+type consumeOptions struct {
+	from       string
+	partitions partitionFlags
+	max        int
+	follow     bool
+	format     string
+	idle       time.Duration
+}
+
+func runConsume(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	return consume(ctx, "consume", args, stdout, consumeOptions{from: kafka.StartEarliest})
+}
+
+func runTail(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	return consume(ctx, "tail", args, stdout, consumeOptions{from: "tail:10", follow: true})
+}
+
+func consume(ctx context.Context, name string, args []string, stdout io.Writer, defaults consumeOptions) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	var conn connectionFlags
+	conn.register(fs, true, false)
+
+	options := defaults
+	fs.StringVar(&options.from, "from", defaults.from, "posicion inicial: earliest, latest, timestamp:<RFC3339|unix ms>, tail:<N> u offsets:<particion>=<offset>,...")
+	fs.Var(&options.partitions, "partition", "particiones separadas por coma, por defecto todas")
+	fs.IntVar(&options.max, "max", 0, "cantidad maxima de mensajes, 0 sin limite")
+	fs.BoolVar(&options.follow, "follow", defaults.follow, "espera mensajes nuevos al llegar al final de las particiones")
+	fs.StringVar(&options.format, "format", formatText, "formato de salida: text, json (formato fixture) o value")
+	fs.DurationVar(&options.idle, "idle-timeout", 10*time.Second, "sin --follow, tiempo sin mensajes tras el cual una particion se da por terminada (por ejemplo marcadores de transaccion al final)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch options.format {
+	case formatText, formatJSON, formatValue:
+	default:
+		return fmt.Errorf("formato %q invalido, debe ser text, json o value", options.format)
+	}
+
+	position, err := kafka.ParseStartPosition(options.from, false)
+	if err != nil {
+		return err
+	}
+
+	client, input, err := conn.client("")
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	allPartitions, err := client.Partitions(input.Topic)
+	if err != nil {
+		return err
+	}
+
+	partitions, err := options.partitions.filter(allPartitions)
+	if err != nil {
+		return err
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	messages := make(chan *sarama.ConsumerMessage)
+	var wg sync.WaitGroup
+
+	for _, partition := range partitions {
+		start, end, err := partitionRange(client, input.Topic, partition, position)
+		if err != nil {
+			return err
+		}
+
+		if !options.follow && start >= end {
+			continue
+		}
+
+		partitionConsumer, err := consumer.ConsumePartition(input.Topic, partition, start)
+		if err != nil {
+			return fmt.Errorf("particion %d: %v", partition, err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer partitionConsumer.Close()
+
+			// sin --follow el idle da por terminada la particion si los ultimos offsets no existen
+			var idle <-chan time.Time
+			var idleTimer *time.Timer
+			if !options.follow {
+				idleTimer = time.NewTimer(options.idle)
+				defer idleTimer.Stop()
+				idle = idleTimer.C
+			}
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-idle:
+					return
+				case msg, ok := <-partitionConsumer.Messages():
+					if !ok {
+						return
+					}
+
+					select {
+					case messages <- msg:
+					case <-ctx.Done():
+						return
+					}
+
+					if !options.follow {
+						if msg.Offset >= end-1 {
+							return
+						}
+
+						if !idleTimer.Stop() {
+							<-idleTimer.C
+						}
+						idleTimer.Reset(options.idle)
+					}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(messages)
+	}()
+
+	printed := 0
+	for msg := range messages {
+		if err := printMessage(stdout, options.format, msg); err != nil {
+			return err
+		}
+
+		printed++
+		if options.max > 0 && printed >= options.max {
+			cancel()
+			break
+		}
+	}
+
+	return nil
+}
+
+// partitionRange offset inicial segun la posicion y high water mark de la particion al iniciar
+func partitionRange(client sarama.Client, topic string, partition int32, position *kafka.StartPosition) (int64, int64, error) {
+	oldest, err := client.GetOffset(topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	newest, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	start := oldest
+
+	switch position.Mode {
+	case kafka.StartLatest:
+		start = newest
+	case kafka.StartTimestamp:
+		offset, err := client.GetOffset(topic, partition, position.Timestamp.UnixNano()/int64(time.Millisecond))
+		if err != nil {
+			return 0, 0, err
+		}
+
+		start = newest
+		if offset >= 0 {
+			start = offset
+		}
+	case kafka.StartTail:
+		start = newest - position.Tail
+	case kafka.StartOffsets:
+		offset, ok := position.Offsets[partition]
+		if ok {
+			start = offset
+		}
+	}
+
+	if start < oldest {
+		start = oldest
+	}
+	if start > newest {
+		start = newest
+	}
+
+	return start, newest, nil
+}
+
+func printMessage(out io.Writer, format string, msg *sarama.ConsumerMessage) error {
+	consumerMsg := toConsumerMessage(msg)
+
+	switch format {
+	case formatJSON:
+		line, err := json.Marshal(kafka.NewFixtureRecord(consumerMsg))
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(out, "%s\n", line)
+		return err
+	case formatValue:
+		_, err := fmt.Fprintf(out, "%s\n", consumerMsg.Msg)
+		return err
+	default:
+		_, err := fmt.Fprintf(out, "%s/%d@%d %s key=%q%s\n%s\n", consumerMsg.Topic, consumerMsg.Partition, consumerMsg.Offset,
+			consumerMsg.Timestamp.UTC().Format(time.RFC3339Nano), consumerMsg.Key, formatHeaders(consumerMsg.Headers), consumerMsg.Msg)
+		return err
+	}
+}
+
+func formatHeaders(headers map[string]string) string {
+	if len(headers) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%q", k, headers[k])
+	}
+
+	return b.String()
+}
+
+func toConsumerMessage(msg *sarama.ConsumerMessage) *kafka.ConsumerMessage {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, header := range msg.Headers {
+		headers[string(header.Key)] = string(header.Value)
+	}
+
+	return &kafka.ConsumerMessage{
+		Headers:   headers,
+		Timestamp: msg.Timestamp,
+		Key:       msg.Key,
+		Msg:       msg.Value,
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+const dlqUsage = "uso: kafka-toolkit dlq replay --topic <dead-letter topic> [flags]"
+
+func runDLQ(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "replay" {
+		return errors.New(dlqUsage)
+	}
+
+	fs := flag.NewFlagSet("dlq replay", flag.ContinueOnError)
+
+	var conn connectionFlags
+	conn.register(fs, true, false)
+
+	var (
+		originalPartitions partitionFlags
+		keys               stringsFlag
+		removeHeaders      stringsFlag
+	)
+	matchHeaders := make(headerFlags)
+	setHeaders := make(headerFlags)
+
+	targetTopic := fs.String("target-topic", "", "topico de destino, por defecto el header de topico original")
+	errorContains := fs.String("error-contains", "", "reenvia solo mensajes cuyo header de error contiene el texto")
+	from := fs.String("from", "", "fecha minima del error, RFC3339 o unix ms")
+	to := fs.String("to", "", "fecha maxima del error (exclusiva), RFC3339 o unix ms")
+	stripMetadata := fs.Bool("strip-metadata", false, "elimina los headers de metadata del dead-letter topic")
+	rate := fs.Float64("rate", 0, "mensajes por segundo, 0 sin limite")
+	checkpoint := fs.String("checkpoint", "", "archivo de checkpoint para retomar un replay interrumpido")
+	execute := fs.Bool("execute", false, "reenvia los mensajes, por defecto solo muestra el plan (dry-run)")
+	fs.Var(&originalPartitions, "original-partition", "particiones originales separadas por coma")
+	fs.Var(&keys, "key", "key de mensaje, puede repetirse")
+	fs.Var(matchHeaders, "match-header", "header key=value que deben cumplir los mensajes, puede repetirse")
+	fs.Var(setHeaders, "set-header", "header key=value agregado a los mensajes reenviados, puede repetirse")
+	fs.Var(&removeHeaders, "remove-header", "header eliminado de los mensajes reenviados, puede repetirse")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	filter := kafka.DLQReplayFilter{
+		ErrorContains:      *errorContains,
+		OriginalPartitions: originalPartitions,
+		Keys:               keys,
+		Headers:            matchHeaders,
+	}
+
+	var err error
+	if filter.From, err = parseTime(*from); err != nil {
+		return fmt.Errorf("--from: %v", err)
+	}
+	if filter.To, err = parseTime(*to); err != nil {
+		return fmt.Errorf("--to: %v", err)
+	}
+
+	source, err := conn.consumerInput("")
+	if err != nil {
+		return err
+	}
+
+	target, err := conn.producerInput()
+	if err != nil {
+		return err
+	}
+
+	config := kafka.DLQReplayConfig{
+		TargetTopic:          *targetTopic,
+		Filter:               filter,
+		SetHeaders:           setHeaders,
+		RemoveHeaders:        removeHeaders,
+		StripMetadataHeaders: *stripMetadata,
+		Rate:                 *rate,
+		DryRun:               !*execute,
+	}
+
+	if *checkpoint != "" {
+		config.Checkpoint = kafka.NewFileReplayCheckpoint(*checkpoint)
+	}
+
+	if config.DryRun {
+		config.Observer = func(record kafka.DLQReplayRecord) {
+			source := record.Source
+			if record.Target == nil {
+				fmt.Fprintf(stdout, "%s/%d@%d omitido: %s\n", source.Topic, source.Partition, source.Offset, record.Reason)
+				return
+			}
+
+			fmt.Fprintf(stdout, "%s/%d@%d -> %s key=%q%s\n", source.Topic, source.Partition, source.Offset,
+				record.Target.Topic, source.Key, formatHeaders(record.Target.Headers))
+		}
+	}
+
+	replayer, err := kafka.NewDLQReplayer(source, target, config)
+	if err != nil {
+		return err
+	}
+
+	summary, err := replayer.Run(ctx)
+	if summary != nil {
+		printReplaySummary(stdout, summary, config.DryRun)
+	}
+
+	return err
+}
+
+func printReplaySummary(out io.Writer, summary *kafka.DLQReplaySummary, dryRun bool) {
+	action := "reenviados"
+	if dryRun {
+		action = "a reenviar (dry-run, utilizar --execute para aplicar)"
+	}
+
+	fmt.Fprintf(out, "\nleidos %d, omitidos %d, %s %d\n", summary.Read, summary.Skipped, action, summary.Replayed)
+
+	topics := make([]string, 0, len(summary.ByTopic))
+	for topic := range summary.ByTopic {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	for _, topic := range topics {
+		fmt.Fprintf(out, "  %s: %d\n", topic, summary.ByTopic[topic])
+	}
+
+	if len(summary.IdlePartitions) > 0 {
+		fmt.Fprintf(out, "particiones %v terminadas por inactividad antes del final del topico\n", summary.IdlePartitions)
+	}
+
+	if !summary.Completed {
+		fmt.Fprintln(out, "replay interrumpido, ejecutar nuevamente con el mismo --checkpoint para continuar")
+	}
+}
+
+// parseTime interpreta RFC3339 o unix ms, vacio retorna la fecha cero
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, ms*int64(time.Millisecond)), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// stringsFlag flag repetible de texto
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
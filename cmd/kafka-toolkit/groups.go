@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+const groupsUsage = "uso: kafka-toolkit groups describe|reset|delete --group <group> [flags]"
+
+func runGroups(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(groupsUsage)
+	}
+
+	switch args[0] {
+	case "describe":
+		return runGroupsDescribe(args[1:], stdout)
+	case "reset":
+		return runGroupsReset(args[1:], stdout)
+	case "delete":
+		return runGroupsDelete(args[1:], stdout)
+	default:
+		return errors.New(groupsUsage)
+	}
+}
+
+// groupAdmin crea el admin con la configuracion de conexion, el grupo es requerido
+func groupAdmin(conn *connectionFlags) (kafka.ConsumerGroupAdmin, string, error) {
+	input, err := conn.consumerInput(anyTopic)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if input.Group == defaultGroup {
+		return nil, "", errors.New("--group es requerido")
+	}
+
+	admin, err := kafka.NewConsumerGroupAdmin(input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return admin, input.Group, nil
+}
+
+func runGroupsDescribe(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("groups describe", flag.ContinueOnError)
+
+	var conn connectionFlags
+	conn.register(fs, false, true)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	admin, group, err := groupAdmin(&conn)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	description, err := admin.Describe(group)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "GROUP %s  STATE %s  PROTOCOL %s  MEMBERS %d  LAG %d\n\n", description.Group, description.State,
+		description.Protocol, len(description.Members), description.TotalLag())
+
+	if len(description.Members) > 0 {
+		w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "MEMBER\tCLIENT\tHOST\tASSIGNMENTS")
+		for _, member := range description.Members {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", member.MemberID, member.ClientID, member.ClientHost, formatAssignments(member.Assignments))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout)
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tPARTITION\tCOMMITTED\tLOG-END\tLAG\tMEMBER")
+	for _, partition := range description.Partitions {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%d\t%s\n", partition.Topic, partition.Partition, formatOffset(partition.Committed),
+			partition.LogEnd, partition.Lag, orDash(partition.MemberID))
+	}
+
+	return w.Flush()
+}
+
+func runGroupsReset(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("groups reset", flag.ContinueOnError)
+
+	var conn connectionFlags
+	conn.register(fs, true, true)
+
+	var partitions partitionFlags
+	to := fs.String("to", "", "destino: earliest, latest, timestamp:<RFC3339|unix ms>, shift:<+N|-N> u offsets:<particion>=<offset>,...")
+	execute := fs.Bool("execute", false, "compromete los offsets, por defecto solo muestra el plan (dry-run)")
+	fs.Var(&partitions, "partition", "particiones separadas por coma, por defecto todas")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	target, err := kafka.ParseOffsetResetTarget(*to)
+	if err != nil {
+		return err
+	}
+
+	admin, group, err := groupAdmin(&conn)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	plan, err := admin.ResetOffsets(kafka.OffsetResetInput{
+		Group:      group,
+		Topic:      conn.topic,
+		Partitions: partitions,
+		Target:     target,
+		DryRun:     !*execute,
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tPARTITION\tCURRENT\tTARGET")
+	for _, partition := range plan.Partitions {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\n", partition.Topic, partition.Partition, formatOffset(partition.Current), partition.Target)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if plan.DryRun {
+		fmt.Fprintln(stdout, "\ndry-run: offsets no comprometidos, utilizar --execute para aplicar")
+		if plan.ActiveMembers > 0 {
+			fmt.Fprintf(stdout, "advertencia: el grupo tiene %d miembros activos, el reset sera rechazado\n", plan.ActiveMembers)
+		}
+	}
+
+	return nil
+}
+
+func runGroupsDelete(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("groups delete", flag.ContinueOnError)
+
+	var conn connectionFlags
+	conn.register(fs, false, true)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	admin, group, err := groupAdmin(&conn)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	if err := admin.Delete(group); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "consumer group %s eliminado\n", group)
+
+	return nil
+}
+
+func formatAssignments(assignments map[string][]int32) string {
+	topics := make([]string, 0, len(assignments))
+	for topic := range assignments {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	items := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		partitions := make([]string, 0, len(assignments[topic]))
+		for _, partition := range assignments[topic] {
+			partitions = append(partitions, fmt.Sprint(partition))
+		}
+		items = append(items, fmt.Sprintf("%s[%s]", topic, strings.Join(partitions, ",")))
+	}
+
+	return orDash(strings.Join(items, " "))
+}
+
+func formatOffset(offset int64) string {
+	if offset < 0 {
+		return "-"
+	}
+
+	return fmt.Sprint(offset)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
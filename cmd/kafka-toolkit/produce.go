@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+func runProduce(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("produce", flag.ContinueOnError)
+
+	var conn connectionFlags
+	conn.register(fs, true, false)
+
+	headers := make(headerFlags)
+	key := fs.String("key", "", "key de todos los mensajes")
+	keySeparator := fs.String("key-separator", "", "separa key y valor en cada linea, por ejemplo '|'")
+	file := fs.String("file", "", "archivo de entrada, por defecto stdin")
+	fs.Var(headers, "header", "header key=value, puede repetirse")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *key != "" && *keySeparator != "" {
+		return errors.New("--key y --key-separator son excluyentes")
+	}
+
+	input, err := conn.producerInput()
+	if err != nil {
+		return err
+	}
+
+	reader := stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		reader = f
+	}
+
+	producer, err := kafka.NewSimpleSyncProducer(input)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	produced := 0
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			break
+		}
+
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		msg := &kafka.ProducerMessage{Headers: headers, Msg: []byte(line)}
+
+		switch {
+		case *key != "":
+			msg.Key = []byte(*key)
+		case *keySeparator != "":
+			if idx := strings.Index(line, *keySeparator); idx >= 0 {
+				msg.Key, msg.Msg = []byte(line[:idx]), []byte(line[idx+len(*keySeparator):])
+			}
+		}
+
+		if err := producer.SendMessage(ctx, msg); err != nil {
+			return fmt.Errorf("mensaje %d: %v", produced+1, err)
+		}
+
+		produced++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%d mensajes producidos en %s\n", produced, input.Topic)
+
+	return ctx.Err()
+}
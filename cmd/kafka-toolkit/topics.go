@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+func runTopics(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "list" {
+		return errors.New("uso: kafka-toolkit topics list [flags]")
+	}
+
+	fs := flag.NewFlagSet("topics list", flag.ContinueOnError)
+
+	var conn connectionFlags
+	conn.register(fs, false, false)
+
+	all := fs.Bool("all", false, "incluye topicos internos (__consumer_offsets, etc.)")
+	prefix := fs.String("prefix", "", "lista solo topicos con el prefijo")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	client, _, err := conn.client(anyTopic)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	topics, err := client.Topics()
+	if err != nil {
+		return err
+	}
+	sort.Strings(topics)
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tPARTITIONS\tREPLICAS")
+
+	for _, topic := range topics {
+		if (!*all && strings.HasPrefix(topic, "__")) || !strings.HasPrefix(topic, *prefix) {
+			continue
+		}
+
+		partitions, err := client.Partitions(topic)
+		if err != nil {
+			return err
+		}
+
+		replicas := 0
+		if len(partitions) > 0 {
+			if ids, err := client.Replicas(topic, partitions[0]); err == nil {
+				replicas = len(ids)
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%d\n", topic, len(partitions), replicas)
+	}
+
+	return w.Flush()
+}
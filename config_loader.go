@@ -0,0 +1,571 @@
+package kafka_toolkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"gopkg.in/yaml.v3"
+)
+
+// Protocolos de seguridad estilo librdkafka (security.protocol)
+const (
+	SecurityProtocolPlaintext = "PLAINTEXT"
+	SecurityProtocolSSL       = "SSL"
+	SecurityProtocolSASLSSL   = "SASL_SSL"
+)
+
+// ConfigSource fuente de configuracion, retorna keys estilo librdkafka (bootstrap.servers, group.id, etc.)
+type ConfigSource func() (map[string]string, error)
+
+// ConfigValidationError agrupa todos los errores de validacion de una configuracion
+type ConfigValidationError struct {
+	Kind   string
+	Errors []string
+}
+
+func (e *ConfigValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, strings.Join(e.Errors, "; "))
+}
+
+type configSetter func(value string) error
+
+// EnvConfigSource lee variables de entorno con prefijo, KAFKA_BOOTSTRAP_SERVERS corresponde a bootstrap.servers con prefijo KAFKA
+func EnvConfigSource(prefix string) ConfigSource {
+	return func() (map[string]string, error) {
+		values := make(map[string]string)
+
+		for _, key := range knownConfigKeys() {
+			if value, ok := os.LookupEnv(EnvVarName(prefix, key)); ok {
+				values[key] = value
+			}
+		}
+
+		return values, nil
+	}
+}
+
+// EnvVarName nombre de variable de entorno para una key de configuracion
+func EnvVarName(prefix, key string) string {
+	name := strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+
+	if prefix == "" {
+		return name
+	}
+
+	return strings.ToUpper(strings.TrimSuffix(prefix, "_")) + "_" + name
+}
+
+// FileConfigSource lee configuracion desde archivo JSON, YAML o .properties segun su extension
+func FileConfigSource(path string) ConfigSource {
+	return func() (map[string]string, error) {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			return parseJSONConfig(content)
+		case ".properties", ".conf":
+			return parsePropertiesConfig(content), nil
+		case ".yaml", ".yml":
+			return parseYAMLConfig(content)
+		default:
+			return nil, fmt.Errorf("Formato de archivo de configuracion no soportado: %s", path)
+		}
+	}
+}
+
+// MapConfigSource fuente de configuracion en memoria
+func MapConfigSource(values map[string]string) ConfigSource {
+	return func() (map[string]string, error) {
+		return values, nil
+	}
+}
+
+// LoadConsumerGroupInput genera ConsumerGroupInput desde las fuentes indicadas, las ultimas fuentes tienen prioridad.
+// Retorna ConfigValidationError con InvalidConsumerInputConfigKind y todos los errores encontrados.
+func LoadConsumerGroupInput(sources ...ConfigSource) (ConsumerGroupInput, error) {
+	input := ConsumerGroupInput{BalanceStrategy: RoundRobin}
+
+	values, err := mergeConfigSources(sources)
+	if err != nil {
+		return input, err
+	}
+
+	errs := applyConfigValues(values, consumerConfigSetters(&input), producerConfigKeys())
+	errs = append(errs, validateConsumerGroupInput(input)...)
+
+	if len(errs) > 0 {
+		return input, &ConfigValidationError{Kind: InvalidConsumerInputConfigKind, Errors: errs}
+	}
+
+	return input, nil
+}
+
+// LoadProducerConfigInput genera BaseProducerConfigInput desde las fuentes indicadas, las ultimas fuentes tienen prioridad.
+// Retorna ConfigValidationError con InvalidProducerInputConfigKind y todos los errores encontrados.
+func LoadProducerConfigInput(sources ...ConfigSource) (BaseProducerConfigInput, error) {
+	input := BaseProducerConfigInput{Ack: int16(sarama.WaitForAll), Retries: 3}
+
+	values, err := mergeConfigSources(sources)
+	if err != nil {
+		return input, err
+	}
+
+	errs := applyConfigValues(values, producerConfigSetters(&input), consumerConfigKeys())
+	errs = append(errs, validateProducerConfigInput(input)...)
+
+	if len(errs) > 0 {
+		return input, &ConfigValidationError{Kind: InvalidProducerInputConfigKind, Errors: errs}
+	}
+
+	return input, nil
+}
+
+func mergeConfigSources(sources []ConfigSource) (map[string]string, error) {
+	values := make(map[string]string)
+
+	for _, source := range sources {
+		sourceValues, err := source()
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range sourceValues {
+			values[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		}
+	}
+
+	return values, nil
+}
+
+// applyConfigValues aplica los valores con sus setters, las keys del otro tipo de cliente se ignoran
+func applyConfigValues(values map[string]string, setters map[string]configSetter, ignored []string) []string {
+	errs := make([]string, 0)
+
+	ignoredSet := make(map[string]bool, len(ignored))
+	for _, key := range ignored {
+		ignoredSet[key] = true
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		setter, ok := setters[key]
+		if !ok {
+			if !ignoredSet[key] {
+				errs = append(errs, fmt.Sprintf("key desconocida %q", key))
+			}
+			continue
+		}
+
+		if err := setter(values[key]); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+
+	return errs
+}
+
+func consumerConfigSetters(input *ConsumerGroupInput) map[string]configSetter {
+	setters := map[string]configSetter{
+		"bootstrap.servers":             setString(&input.Brokers),
+		"topic":                         setString(&input.Topic),
+		"group.id":                      setString(&input.Group),
+		"client.id":                     setString(&input.ClientID),
+		"partition.assignment.strategy": setString(&input.BalanceStrategy),
+		"kafka.version":                 setString(&input.Version),
+		"group.instance.id":             setString(&input.GroupInstanceID),
+		"group.static.membership":       setBool(&input.StaticMembership),
+		"client.rack":                   setString(&input.RackID),
+		"start.from":                    setString(&input.StartFrom),
+		"start.from.force":              setBool(&input.ForceStartFrom),
+		"handler.timeout.ms":            setInt64(&input.HandlerTimeoutMillis),
+		"session.timeout.ms":            setInt64(&input.SessionTimeoutMillis),
+		"auto.offset.reset": func(value string) error {
+			switch strings.ToLower(value) {
+			case "earliest", "smallest", "beginning":
+				input.Latest = false
+			case "latest", "largest", "end":
+				input.Latest = true
+			default:
+				return fmt.Errorf("valor %q invalido, debe ser earliest o latest", value)
+			}
+			return nil
+		},
+	}
+
+	addSecuritySetters(setters, &securityFields{
+		security:              &input.Security,
+		tlsEnabled:            &input.TLSEnabled,
+		username:              &input.Username,
+		password:              &input.Password,
+		mechanism:             &input.Mechanism,
+		caFile:                &input.CaFile,
+		certFile:              &input.CertFile,
+		keyFile:               &input.KeyFile,
+		tlsServerName:         &input.TLSServerName,
+		tlsMinVersion:         &input.TLSMinVersion,
+		tlsInsecureSkipVerify: &input.TLSInsecureSkipVerify,
+		tlsReloadSeconds:      &input.TLSReloadSeconds,
+		oauthTokenURL:         &input.OAuthTokenURL,
+		oauthScopes:           &input.OAuthScopes,
+		oauthTokenFile:        &input.OAuthTokenFile,
+	})
+
+	return setters
+}
+
+func producerConfigSetters(input *BaseProducerConfigInput) map[string]configSetter {
+	setters := map[string]configSetter{
+		"bootstrap.servers":  setString(&input.Brokers),
+		"topic":              setString(&input.Topic),
+		"client.id":          setString(&input.ClientID),
+		"kafka.version":      setString(&input.Version),
+		"linger.ms":          setInt64(&input.FlushFrequencyMs),
+		"message.timeout.ms": setInt64(&input.TimeoutMs),
+		"retries": func(value string) error {
+			retries, err := strconv.Atoi(value)
+			if err != nil {
+				return err
+			}
+			input.Retries = retries
+			return nil
+		},
+		"acks": func(value string) error {
+			switch strings.ToLower(value) {
+			case "all", "-1":
+				input.Ack = int16(sarama.WaitForAll)
+			case "0":
+				input.Ack = int16(sarama.NoResponse)
+			case "1":
+				input.Ack = int16(sarama.WaitForLocal)
+			default:
+				return fmt.Errorf("valor %q invalido, debe ser all, -1, 0 o 1", value)
+			}
+			return nil
+		},
+	}
+
+	addSecuritySetters(setters, &securityFields{
+		security:              &input.Security,
+		tlsEnabled:            &input.TLSEnabled,
+		username:              &input.Username,
+		password:              &input.Password,
+		mechanism:             &input.Mechanism,
+		caFile:                &input.CaFile,
+		certFile:              &input.CertFile,
+		keyFile:               &input.KeyFile,
+		tlsServerName:         &input.TLSServerName,
+		tlsMinVersion:         &input.TLSMinVersion,
+		tlsInsecureSkipVerify: &input.TLSInsecureSkipVerify,
+		tlsReloadSeconds:      &input.TLSReloadSeconds,
+		oauthTokenURL:         &input.OAuthTokenURL,
+		oauthScopes:           &input.OAuthScopes,
+		oauthTokenFile:        &input.OAuthTokenFile,
+	})
+
+	return setters
+}
+
+// securityFields punteros a los campos de seguridad comunes de consumer y producer
+type securityFields struct {
+	security              *bool
+	tlsEnabled            *bool
+	username              *string
+	password              *string
+	mechanism             *string
+	caFile                *string
+	certFile              *string
+	keyFile               *string
+	tlsServerName         *string
+	tlsMinVersion         *string
+	tlsInsecureSkipVerify *bool
+	tlsReloadSeconds      *int64
+	oauthTokenURL         *string
+	oauthScopes           *string
+	oauthTokenFile        *string
+}
+
+func addSecuritySetters(setters map[string]configSetter, fields *securityFields) {
+	setters["security.protocol"] = func(value string) error {
+		switch strings.ToUpper(value) {
+		case SecurityProtocolPlaintext:
+			*fields.security, *fields.tlsEnabled = false, false
+		case SecurityProtocolSSL:
+			*fields.security, *fields.tlsEnabled = false, true
+		case SecurityProtocolSASLSSL:
+			*fields.security, *fields.tlsEnabled = true, true
+		default:
+			return fmt.Errorf("valor %q invalido, debe ser uno de: %s, %s, %s", value,
+				SecurityProtocolPlaintext, SecurityProtocolSSL, SecurityProtocolSASLSSL)
+		}
+		return nil
+	}
+	setters["sasl.username"] = setString(fields.username)
+	setters["sasl.password"] = setString(fields.password)
+	setters["sasl.mechanism"] = setString(fields.mechanism)
+	setters["sasl.mechanisms"] = setString(fields.mechanism)
+	setters["sasl.oauthbearer.token.endpoint.url"] = setString(fields.oauthTokenURL)
+	setters["sasl.oauthbearer.scope"] = setString(fields.oauthScopes)
+	setters["sasl.oauthbearer.token.file"] = setString(fields.oauthTokenFile)
+	setters["ssl.ca.location"] = setString(fields.caFile)
+	setters["ssl.certificate.location"] = setString(fields.certFile)
+	setters["ssl.key.location"] = setString(fields.keyFile)
+	setters["ssl.server.name"] = setString(fields.tlsServerName)
+	setters["ssl.min.version"] = setString(fields.tlsMinVersion)
+	setters["ssl.reload.seconds"] = setInt64(fields.tlsReloadSeconds)
+	setters["enable.ssl.certificate.verification"] = func(value string) error {
+		verify, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*fields.tlsInsecureSkipVerify = !verify
+		return nil
+	}
+}
+
+func setString(field *string) configSetter {
+	return func(value string) error {
+		*field = value
+		return nil
+	}
+}
+
+func setBool(field *bool) configSetter {
+	return func(value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field = parsed
+		return nil
+	}
+}
+
+func setInt64(field *int64) configSetter {
+	return func(value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*field = parsed
+		return nil
+	}
+}
+
+func consumerConfigKeys() []string {
+	return setterKeys(consumerConfigSetters(&ConsumerGroupInput{}))
+}
+
+func producerConfigKeys() []string {
+	return setterKeys(producerConfigSetters(&BaseProducerConfigInput{}))
+}
+
+// knownConfigKeys keys soportadas por consumer o producer
+func knownConfigKeys() []string {
+	setters := consumerConfigSetters(&ConsumerGroupInput{})
+
+	for key, setter := range producerConfigSetters(&BaseProducerConfigInput{}) {
+		setters[key] = setter
+	}
+
+	return setterKeys(setters)
+}
+
+func setterKeys(setters map[string]configSetter) []string {
+	keys := make([]string, 0, len(setters))
+
+	for key := range setters {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func validateConsumerGroupInput(input ConsumerGroupInput) []string {
+	errs := make([]string, 0)
+
+	if input.Brokers == "" {
+		errs = append(errs, "bootstrap.servers es requerido")
+	}
+
+	if input.Topic == "" {
+		errs = append(errs, "topic es requerido")
+	}
+
+	if input.Group == "" {
+		errs = append(errs, "group.id es requerido")
+	}
+
+	if _, err := NewBalanceStrategyResolver().Resolve(input.BalanceStrategy); err != nil {
+		errs = append(errs, fmt.Sprintf("partition.assignment.strategy %q invalida", input.BalanceStrategy))
+	}
+
+	version, err := sarama.ParseKafkaVersion(input.Version)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("kafka.version %q invalida", input.Version))
+	}
+
+	instanceID, err := ResolveGroupInstanceID(input)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("group.instance.id: %v", err))
+	} else if err := validateStaticMembership(version, instanceID, input.RackID); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if input.SessionTimeoutMillis < 0 || input.SessionDurationSeconds < 0 {
+		errs = append(errs, "session.timeout.ms no puede ser negativo")
+	}
+
+	if input.HandlerTimeoutMillis < 0 {
+		errs = append(errs, "handler.timeout.ms no puede ser negativo")
+	}
+
+	if input.StartFrom != "" {
+		if _, err := ParseStartPosition(input.StartFrom, input.ForceStartFrom); err != nil {
+			errs = append(errs, fmt.Sprintf("start.from: %v", err))
+		}
+	}
+
+	return append(errs, validateSecurityFields(input.Security, input.TLSEnabled, input.Username, input.Password,
+		input.Mechanism, input.CertFile, input.KeyFile, input.TLSMinVersion)...)
+}
+
+func validateProducerConfigInput(input BaseProducerConfigInput) []string {
+	errs := make([]string, 0)
+
+	if input.Brokers == "" {
+		errs = append(errs, "bootstrap.servers es requerido")
+	}
+
+	if input.Topic == "" {
+		errs = append(errs, "topic es requerido")
+	}
+
+	if input.Version != "" {
+		if _, err := sarama.ParseKafkaVersion(input.Version); err != nil {
+			errs = append(errs, fmt.Sprintf("kafka.version %q invalida", input.Version))
+		}
+	}
+
+	if input.Retries < 0 {
+		errs = append(errs, "retries no puede ser negativo")
+	}
+
+	if input.FlushFrequencyMs < 0 || input.TimeoutMs < 0 {
+		errs = append(errs, "linger.ms y message.timeout.ms no pueden ser negativos")
+	}
+
+	return append(errs, validateSecurityFields(input.Security, input.TLSEnabled, input.Username, input.Password,
+		input.Mechanism, input.CertFile, input.KeyFile, input.TLSMinVersion)...)
+}
+
+func validateSecurityFields(security, tlsEnabled bool, username, password, mechanism, certFile, keyFile, minVersion string) []string {
+	errs := make([]string, 0)
+
+	if security && mechanism != OAuthBearer && (username == "" || password == "") {
+		errs = append(errs, "sasl.username y sasl.password son requeridos con SASL_SSL")
+	}
+
+	switch mechanism {
+	case "", sarama.SASLTypePlaintext, sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512, OAuthBearer:
+	default:
+		errs = append(errs, fmt.Sprintf("sasl.mechanism %q no soportado", mechanism))
+	}
+
+	if (certFile == "") != (keyFile == "") {
+		errs = append(errs, "ssl.certificate.location y ssl.key.location deben venir juntos")
+	}
+
+	if _, err := parseTLSVersion(minVersion); err != nil && (security || tlsEnabled) {
+		errs = append(errs, fmt.Sprintf("ssl.min.version %q invalida", minVersion))
+	}
+
+	return errs
+}
+
+func parseJSONConfig(content []byte) (map[string]string, error) {
+	var raw map[string]interface{}
+
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	flattenConfig("", raw, values)
+
+	return values, nil
+}
+
+func parseYAMLConfig(content []byte) (map[string]string, error) {
+	var raw map[string]interface{}
+
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	flattenConfig("", raw, values)
+
+	return values, nil
+}
+
+func flattenConfig(prefix string, raw map[string]interface{}, values map[string]string) {
+	for k, v := range raw {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		switch typed := v.(type) {
+		case map[string]interface{}:
+			flattenConfig(key, typed, values)
+		case []interface{}:
+			items := make([]string, 0, len(typed))
+			for _, item := range typed {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[key] = strings.Join(items, ",")
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(typed)
+		}
+	}
+}
+
+func parsePropertiesConfig(content []byte) map[string]string {
+	values := make(map[string]string)
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		idx := strings.IndexAny(line, "=:")
+		if idx < 0 {
+			values[line] = ""
+			continue
+		}
+
+		values[strings.TrimSpace(line[:idx])] = strings.TrimSpace(line[idx+1:])
+	}
+
+	return values
+}
@@ -0,0 +1,84 @@
+package kafka_toolkit_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+func writeConfigFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestFileConfigSourceFormats(t *testing.T) {
+	files := map[string]string{
+		"kafka.json": `{"bootstrap": {"servers": "b1:9092,b2:9092"}, "topic": "orders", "group.id": "billing", "kafka.version": "2.8.0"}`,
+		"kafka.properties": `# consumer de billing
+bootstrap.servers=b1:9092,b2:9092
+topic=orders
+group.id=billing
+kafka.version=2.8.0
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			input, err := kafka.LoadConsumerGroupInput(kafka.FileConfigSource(writeConfigFile(t, name, content)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if input.Brokers != "b1:9092,b2:9092" || input.Topic != "orders" || input.Group != "billing" {
+				t.Errorf("configuracion: se obtuvo %+v", input)
+			}
+		})
+	}
+}
+
+func TestFileConfigSourceYAML(t *testing.T) {
+	path := writeConfigFile(t, "kafka.yaml", `# consumer de billing
+bootstrap:
+  servers:
+    - b1:9092
+    - b2:9092
+topic: orders
+group.id: "billing"
+kafka.version: 2.8.0
+security:
+  protocol: SASL_SSL
+sasl:
+  mechanism: SCRAM-SHA-512
+  username: billing # usuario de servicio
+  password: "secreto: con # caracteres"
+`)
+
+	input, err := kafka.LoadConsumerGroupInput(kafka.FileConfigSource(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if input.Brokers != "b1:9092,b2:9092" || input.Topic != "orders" || input.Group != "billing" {
+		t.Errorf("configuracion: se obtuvo %+v", input)
+	}
+
+	if !input.Security || input.Username != "billing" || input.Password != "secreto: con # caracteres" {
+		t.Errorf("seguridad: se obtuvo %+v", input)
+	}
+}
+
+func TestFileConfigSourceInvalidYAML(t *testing.T) {
+	path := writeConfigFile(t, "kafka.yml", "bootstrap.servers: [b1:9092\n")
+
+	if _, err := kafka.LoadConsumerGroupInput(kafka.FileConfigSource(path)); err == nil {
+		t.Errorf("se esperaba error de YAML invalido")
+	}
+}
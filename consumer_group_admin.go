@@ -0,0 +1,529 @@
+package kafka_toolkit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	// ResetShift desplaza el offset comprometido en N mensajes, N puede ser negativo
+	ResetShift = "shift"
+)
+
+var (
+	// InvalidOffsetResetKind destino de reset invalido
+	InvalidOffsetResetKind = "Destino de reset invalido, debe ser earliest, latest, timestamp:<RFC3339|unix ms>, shift:<+N|-N> u offsets:<particion>=<offset>,..."
+	// ActiveConsumerGroupKind el grupo tiene miembros activos
+	ActiveConsumerGroupKind = "El consumer group tiene miembros activos, se deben detener los consumers antes de resetear offsets"
+	// MissingCommittedOffsetKind shift requiere offset comprometido
+	MissingCommittedOffsetKind = "La particion no tiene offset comprometido para desplazar"
+)
+
+// ConsumerGroupMember miembro de un consumer group y sus particiones asignadas
+type ConsumerGroupMember struct {
+	MemberID    string
+	ClientID    string
+	ClientHost  string
+	Assignments map[string][]int32
+}
+
+// ConsumerGroupPartition offset comprometido y lag de una particion, Committed es -1 sin offset comprometido
+type ConsumerGroupPartition struct {
+	Topic     string
+	Partition int32
+	Committed int64
+	LogEnd    int64
+	Lag       int64
+	MemberID  string
+}
+
+// ConsumerGroupDescription estado, miembros y lag por particion de un consumer group
+type ConsumerGroupDescription struct {
+	Group      string
+	State      string
+	Protocol   string
+	Members    []ConsumerGroupMember
+	Partitions []ConsumerGroupPartition
+}
+
+// TotalLag suma del lag de todas las particiones
+func (d *ConsumerGroupDescription) TotalLag() int64 {
+	total := int64(0)
+	for _, partition := range d.Partitions {
+		total += partition.Lag
+	}
+
+	return total
+}
+
+// OffsetResetTarget destino de un reset de offsets
+type OffsetResetTarget struct {
+	Mode      string
+	Timestamp time.Time
+	Shift     int64
+	Offsets   map[int32]int64
+}
+
+// ParseOffsetResetTarget interpreta earliest, latest, timestamp:<RFC3339|unix ms>, shift:<+N|-N> u offsets:<particion>=<offset>,...
+func ParseOffsetResetTarget(value string) (*OffsetResetTarget, error) {
+	if idx := strings.Index(value, ":"); idx >= 0 && strings.ToLower(strings.TrimSpace(value[:idx])) == ResetShift {
+		shift, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(value[idx+1:]), "+"), 10, 64)
+		if err != nil {
+			return nil, errors.New(InvalidOffsetResetKind)
+		}
+
+		return &OffsetResetTarget{Mode: ResetShift, Shift: shift}, nil
+	}
+
+	position, err := ParseStartPosition(value, false)
+	if err != nil || position.Mode == StartTail {
+		return nil, errors.New(InvalidOffsetResetKind)
+	}
+
+	return &OffsetResetTarget{Mode: position.Mode, Timestamp: position.Timestamp, Offsets: position.Offsets}, nil
+}
+
+// OffsetResetInput reset de offsets de un grupo, Topic vacio incluye los topicos con offsets comprometidos
+// y Partitions vacio todas las particiones del topico
+type OffsetResetInput struct {
+	Group      string
+	Topic      string
+	Partitions []int32
+	Target     *OffsetResetTarget
+	DryRun     bool
+}
+
+// OffsetResetPartition offset actual y nuevo de una particion
+type OffsetResetPartition struct {
+	Topic     string
+	Partition int32
+	Current   int64
+	Target    int64
+}
+
+// OffsetResetPlan resultado de un reset, con DryRun los offsets no se comprometen
+type OffsetResetPlan struct {
+	Group         string
+	DryRun        bool
+	ActiveMembers int
+	Partitions    []OffsetResetPartition
+}
+
+// ConsumerGroupAdmin operaciones de administracion de consumer groups: describe, reset de offsets y eliminacion
+type ConsumerGroupAdmin interface {
+	Describe(group string) (*ConsumerGroupDescription, error)
+	ResetOffsets(input OffsetResetInput) (*OffsetResetPlan, error)
+	Delete(group string) error
+	Close() error
+}
+
+type consumerGroupAdmin struct {
+	client sarama.Client
+	admin  sarama.ClusterAdmin
+}
+
+// NewConsumerGroupAdmin crea el admin con la configuracion de conexion y seguridad del input, Topic y Group no se utilizan
+func NewConsumerGroupAdmin(input ConsumerGroupInput) (ConsumerGroupAdmin, error) {
+	conf, err := NewSaramaConsumerConfigurer(NewBalanceStrategyResolver()).GenerateConfig(input)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sarama.NewClient(conf.Brokers, conf.SaramaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewConsumerGroupAdminFromClient(client)
+}
+
+// NewConsumerGroupAdminFromClient crea el admin desde un cliente existente, Close cierra el cliente
+func NewConsumerGroupAdminFromClient(client sarama.Client) (ConsumerGroupAdmin, error) {
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &consumerGroupAdmin{client: client, admin: admin}, nil
+}
+
+func (a *consumerGroupAdmin) Describe(group string) (*ConsumerGroupDescription, error) {
+	groups, err := a.admin.DescribeConsumerGroups([]string{group})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(groups) != 1 {
+		return nil, fmt.Errorf("consumer group %s no encontrado", group)
+	}
+
+	if !errors.Is(groups[0].Err, sarama.ErrNoError) {
+		return nil, groups[0].Err
+	}
+
+	description := &ConsumerGroupDescription{
+		Group:    group,
+		State:    groups[0].State,
+		Protocol: groups[0].Protocol,
+	}
+
+	owners := make(map[string]map[int32]string)
+	for memberID, member := range groups[0].Members {
+		assignments := make(map[string][]int32)
+
+		if assignment, err := member.GetMemberAssignment(); err == nil && assignment != nil {
+			assignments = assignment.Topics
+		}
+
+		for topic, partitions := range assignments {
+			if owners[topic] == nil {
+				owners[topic] = make(map[int32]string)
+			}
+
+			for _, partition := range partitions {
+				owners[topic][partition] = memberID
+			}
+		}
+
+		description.Members = append(description.Members, ConsumerGroupMember{
+			MemberID:    memberID,
+			ClientID:    member.ClientId,
+			ClientHost:  member.ClientHost,
+			Assignments: assignments,
+		})
+	}
+
+	sort.Slice(description.Members, func(i, j int) bool {
+		return description.Members[i].MemberID < description.Members[j].MemberID
+	})
+
+	committed, err := a.committedOffsets(group)
+	if err != nil {
+		return nil, err
+	}
+
+	topics := make(map[string]bool)
+	for topic := range committed {
+		topics[topic] = true
+	}
+	for topic := range owners {
+		topics[topic] = true
+	}
+
+	for _, topic := range sortedKeys(topics) {
+		partitions, err := a.client.Partitions(topic)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, partition := range partitions {
+			offset, ok := committed[topic][partition]
+			owner := owners[topic][partition]
+
+			if !ok && owner == "" {
+				continue
+			}
+
+			if !ok {
+				offset = -1
+			}
+
+			logEnd, err := a.client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, err
+			}
+
+			lag := int64(0)
+			if offset >= 0 && logEnd > offset {
+				lag = logEnd - offset
+			}
+
+			description.Partitions = append(description.Partitions, ConsumerGroupPartition{
+				Topic:     topic,
+				Partition: partition,
+				Committed: offset,
+				LogEnd:    logEnd,
+				Lag:       lag,
+				MemberID:  owner,
+			})
+		}
+	}
+
+	return description, nil
+}
+
+// ResetOffsets calcula los offsets destino y los compromete salvo DryRun. Retorna ActiveConsumerGroupKind
+// si el grupo tiene miembros activos, con DryRun el plan informa los miembros activos sin error.
+func (a *consumerGroupAdmin) ResetOffsets(input OffsetResetInput) (*OffsetResetPlan, error) {
+	if input.Target == nil {
+		return nil, errors.New(InvalidOffsetResetKind)
+	}
+
+	description, err := a.Describe(input.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &OffsetResetPlan{
+		Group:         input.Group,
+		DryRun:        input.DryRun,
+		ActiveMembers: len(description.Members),
+	}
+
+	if plan.ActiveMembers > 0 && !input.DryRun {
+		return plan, errors.New(ActiveConsumerGroupKind)
+	}
+
+	committed, err := a.committedOffsets(input.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := a.resetPartitions(input, committed)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tp := range targets {
+		current, ok := committed[tp.topic][tp.partition]
+		if !ok {
+			current = -1
+		}
+
+		target, err := a.resolveTarget(tp.topic, tp.partition, current, input.Target)
+		if err != nil {
+			return nil, err
+		}
+
+		plan.Partitions = append(plan.Partitions, OffsetResetPartition{
+			Topic:     tp.topic,
+			Partition: tp.partition,
+			Current:   current,
+			Target:    target,
+		})
+	}
+
+	if input.DryRun || len(plan.Partitions) == 0 {
+		return plan, nil
+	}
+
+	return plan, a.commitOffsets(input.Group, plan.Partitions)
+}
+
+func (a *consumerGroupAdmin) Delete(group string) error {
+	return a.admin.DeleteConsumerGroup(group)
+}
+
+func (a *consumerGroupAdmin) Close() error {
+	return a.admin.Close()
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// resetPartitions particiones incluidas en el reset segun topico y particiones del input
+func (a *consumerGroupAdmin) resetPartitions(input OffsetResetInput, committed map[string]map[int32]int64) ([]topicPartition, error) {
+	topics := []string{input.Topic}
+	if input.Topic == "" {
+		topics = make([]string, 0, len(committed))
+		for topic := range committed {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+	}
+
+	result := make([]topicPartition, 0)
+	for _, topic := range topics {
+		partitions, err := a.client.Partitions(topic)
+		if err != nil {
+			return nil, err
+		}
+
+		requested := input.Partitions
+		if input.Target.Mode == StartOffsets {
+			requested = offsetPartitions(input.Partitions, input.Target.Offsets)
+		}
+
+		if len(requested) > 0 {
+			available := make(map[int32]bool, len(partitions))
+			for _, partition := range partitions {
+				available[partition] = true
+			}
+
+			for _, partition := range requested {
+				if !available[partition] {
+					return nil, fmt.Errorf("particion %d no existe en %s", partition, topic)
+				}
+			}
+
+			partitions = requested
+		}
+
+		for _, partition := range partitions {
+			result = append(result, topicPartition{topic: topic, partition: partition})
+		}
+	}
+
+	return result, nil
+}
+
+// resolveTarget offset destino acotado al rango disponible de la particion
+func (a *consumerGroupAdmin) resolveTarget(topic string, partition int32, current int64, target *OffsetResetTarget) (int64, error) {
+	oldest, err := a.client.GetOffset(topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, err
+	}
+
+	newest, err := a.client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, err
+	}
+
+	timestampOffset := int64(-1)
+	if target.Mode == StartTimestamp {
+		if timestampOffset, err = a.client.GetOffset(topic, partition, target.Timestamp.UnixNano()/int64(time.Millisecond)); err != nil {
+			return 0, err
+		}
+	}
+
+	offset, err := resolveResetOffset(target, partition, current, oldest, newest, timestampOffset)
+	if err != nil {
+		return 0, fmt.Errorf("%v: %s/%d", err, topic, partition)
+	}
+
+	return offset, nil
+}
+
+// resolveResetOffset offset destino acotado a [oldest, newest]. current es -1 sin offset comprometido y
+// timestampOffset es el primer offset con timestamp mayor o igual al del destino, -1 si no existe.
+func resolveResetOffset(target *OffsetResetTarget, partition int32, current, oldest, newest, timestampOffset int64) (int64, error) {
+	offset := oldest
+
+	switch target.Mode {
+	case StartEarliest:
+		offset = oldest
+	case StartLatest:
+		offset = newest
+	case StartTimestamp:
+		offset = timestampOffset
+		if offset < 0 {
+			offset = newest
+		}
+	case ResetShift:
+		if current < 0 {
+			return 0, errors.New(MissingCommittedOffsetKind)
+		}
+
+		offset = current + target.Shift
+	case StartOffsets:
+		offset = target.Offsets[partition]
+	}
+
+	if offset < oldest {
+		offset = oldest
+	}
+	if offset > newest {
+		offset = newest
+	}
+
+	return offset, nil
+}
+
+// commitOffsets compromete los offsets fuera de una generacion del grupo, permitido solo con el grupo vacio
+func (a *consumerGroupAdmin) commitOffsets(group string, partitions []OffsetResetPartition) error {
+	coordinator, err := a.client.Coordinator(group)
+	if err != nil {
+		return err
+	}
+
+	request := &sarama.OffsetCommitRequest{
+		Version:                 2,
+		ConsumerGroup:           group,
+		ConsumerGroupGeneration: sarama.GroupGenerationUndefined,
+		RetentionTime:           -1,
+	}
+
+	for _, partition := range partitions {
+		request.AddBlock(partition.Topic, partition.Partition, partition.Target, -1, 0, "")
+	}
+
+	response, err := coordinator.CommitOffset(request)
+	if err != nil {
+		return err
+	}
+
+	for topic, partitionErrors := range response.Errors {
+		for partition, kerr := range partitionErrors {
+			if !errors.Is(kerr, sarama.ErrNoError) {
+				return fmt.Errorf("%s/%d: %v", topic, partition, kerr)
+			}
+		}
+	}
+
+	return nil
+}
+
+// committedOffsets offsets comprometidos por el grupo en todos los topicos
+func (a *consumerGroupAdmin) committedOffsets(group string) (map[string]map[int32]int64, error) {
+	response, err := a.admin.ListConsumerGroupOffsets(group, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !errors.Is(response.Err, sarama.ErrNoError) {
+		return nil, response.Err
+	}
+
+	committed := make(map[string]map[int32]int64)
+	for topic, blocks := range response.Blocks {
+		for partition, block := range blocks {
+			if block == nil || block.Offset < 0 || !errors.Is(block.Err, sarama.ErrNoError) {
+				continue
+			}
+
+			if committed[topic] == nil {
+				committed[topic] = make(map[int32]int64)
+			}
+
+			committed[topic][partition] = block.Offset
+		}
+	}
+
+	return committed, nil
+}
+
+// offsetPartitions particiones con offset explicito, filtradas por partitions si no viene vacio
+func offsetPartitions(partitions []int32, offsets map[int32]int64) []int32 {
+	filter := make(map[int32]bool, len(partitions))
+	for _, partition := range partitions {
+		filter[partition] = true
+	}
+
+	result := make([]int32, 0, len(offsets))
+	for partition := range offsets {
+		if len(filter) == 0 || filter[partition] {
+			result = append(result, partition)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+
+	return result
+}
+
+func sortedKeys(values map[string]bool) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,379 @@
+package kafka_toolkit_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+var adminResetTimestamp = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+// newAdminBroker broker con el topico payments de dos particiones, el grupo vacio idle con offset comprometido
+// 5 en la particion 0 y el grupo active con un miembro asignado a ambas particiones
+func newAdminBroker(t *testing.T) *sarama.MockBroker {
+	t.Helper()
+	kafkatest.EnsureLogger()
+
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+
+	metadata := sarama.NewMockMetadataResponse(t).
+		SetBroker(broker.Addr(), broker.BrokerID()).
+		SetController(broker.BrokerID()).
+		SetLeader("payments", 0, broker.BrokerID()).
+		SetLeader("payments", 1, broker.BrokerID())
+
+	timestamp := adminResetTimestamp.UnixNano() / int64(time.Millisecond)
+	offsets := sarama.NewMockOffsetResponse(t).
+		SetOffset("payments", 0, sarama.OffsetOldest, 2).
+		SetOffset("payments", 0, sarama.OffsetNewest, 10).
+		SetOffset("payments", 0, timestamp, 7).
+		SetOffset("payments", 1, sarama.OffsetOldest, 0).
+		SetOffset("payments", 1, sarama.OffsetNewest, 4).
+		SetOffset("payments", 1, timestamp, -1)
+
+	coordinator := sarama.NewMockFindCoordinatorResponse(t)
+	offsetFetch := sarama.NewMockOffsetFetchResponse(t)
+	for _, group := range []string{"idle", "active"} {
+		coordinator.SetCoordinator(sarama.CoordinatorGroup, group, broker)
+		offsetFetch.SetOffset(group, "payments", 0, 5, "", sarama.ErrNoError)
+		offsetFetch.SetOffset(group, "payments", 1, -1, "", sarama.ErrNoError)
+	}
+
+	describe := sarama.NewMockDescribeGroupsResponse(t).
+		AddGroupDescription("idle", &sarama.GroupDescription{GroupId: "idle", State: "Empty", ProtocolType: "consumer"}).
+		AddGroupDescription("active", &sarama.GroupDescription{
+			GroupId:      "active",
+			State:        "Stable",
+			ProtocolType: "consumer",
+			Protocol:     "range",
+			Members: map[string]*sarama.GroupMemberDescription{
+				"member-1": {
+					MemberId:         "member-1",
+					ClientId:         "payments-consumer",
+					ClientHost:       "/10.0.0.1",
+					MemberAssignment: encodeAssignment("payments", 0, 1),
+				},
+			},
+		})
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest":        metadata,
+		"OffsetRequest":          offsets,
+		"FindCoordinatorRequest": coordinator,
+		"OffsetFetchRequest":     offsetFetch,
+		"OffsetCommitRequest":    sarama.NewMockOffsetCommitResponse(t),
+		"DescribeGroupsRequest":  describe,
+		"DeleteGroupsRequest":    sarama.NewMockDeleteGroupsRequest(t).SetDeletedGroups([]string{"idle"}),
+	})
+
+	return broker
+}
+
+// encodeAssignment asignacion de consumer group en el formato del protocolo consumer, version 0
+func encodeAssignment(topic string, partitions ...int32) []byte {
+	var buffer bytes.Buffer
+
+	binary.Write(&buffer, binary.BigEndian, int16(0))
+	binary.Write(&buffer, binary.BigEndian, int32(1))
+	binary.Write(&buffer, binary.BigEndian, int16(len(topic)))
+	buffer.WriteString(topic)
+	binary.Write(&buffer, binary.BigEndian, int32(len(partitions)))
+	binary.Write(&buffer, binary.BigEndian, partitions)
+	// user data nula
+	binary.Write(&buffer, binary.BigEndian, int32(-1))
+
+	return buffer.Bytes()
+}
+
+func newTestGroupAdmin(t *testing.T, broker *sarama.MockBroker) kafka.ConsumerGroupAdmin {
+	t.Helper()
+
+	admin, err := kafka.NewConsumerGroupAdmin(kafka.ConsumerGroupInput{
+		Brokers:         broker.Addr(),
+		Topic:           "payments",
+		Group:           "admin",
+		BalanceStrategy: kafka.Range,
+		Version:         kafkatest.MockKafkaVersion,
+	})
+	if err != nil {
+		t.Fatalf("error creando admin: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	return admin
+}
+
+func committedRequests(broker *sarama.MockBroker) []*sarama.OffsetCommitRequest {
+	var requests []*sarama.OffsetCommitRequest
+	for _, exchange := range broker.History() {
+		if request, ok := exchange.Request.(*sarama.OffsetCommitRequest); ok {
+			requests = append(requests, request)
+		}
+	}
+
+	return requests
+}
+
+func TestConsumerGroupAdminDescribe(t *testing.T) {
+	admin := newTestGroupAdmin(t, newAdminBroker(t))
+
+	description, err := admin.Describe("active")
+	if err != nil {
+		t.Fatalf("error describiendo grupo: %v", err)
+	}
+
+	if description.State != "Stable" || len(description.Members) != 1 {
+		t.Fatalf("grupo: se esperaba Stable con un miembro, se obtuvo %+v", description)
+	}
+
+	member := description.Members[0]
+	if member.MemberID != "member-1" || member.ClientID != "payments-consumer" || !reflect.DeepEqual(member.Assignments["payments"], []int32{0, 1}) {
+		t.Errorf("miembro: %+v", member)
+	}
+
+	expected := []kafka.ConsumerGroupPartition{
+		{Topic: "payments", Partition: 0, Committed: 5, LogEnd: 10, Lag: 5, MemberID: "member-1"},
+		{Topic: "payments", Partition: 1, Committed: -1, LogEnd: 4, Lag: 0, MemberID: "member-1"},
+	}
+
+	if !reflect.DeepEqual(description.Partitions, expected) {
+		t.Errorf("particiones: se esperaba %+v, se obtuvo %+v", expected, description.Partitions)
+	}
+
+	if description.TotalLag() != 5 {
+		t.Errorf("lag total: se esperaba 5, se obtuvo %d", description.TotalLag())
+	}
+}
+
+func TestConsumerGroupAdminRefusesActiveGroup(t *testing.T) {
+	broker := newAdminBroker(t)
+	admin := newTestGroupAdmin(t, broker)
+	target := &kafka.OffsetResetTarget{Mode: kafka.StartEarliest}
+
+	plan, err := admin.ResetOffsets(kafka.OffsetResetInput{Group: "active", Topic: "payments", Target: target})
+	if err == nil || err.Error() != kafka.ActiveConsumerGroupKind {
+		t.Fatalf("se esperaba %q, se obtuvo %v", kafka.ActiveConsumerGroupKind, err)
+	}
+
+	if plan == nil || plan.ActiveMembers != 1 {
+		t.Errorf("plan: se esperaba 1 miembro activo, se obtuvo %+v", plan)
+	}
+
+	// con DryRun se informa el plan sin error
+	plan, err = admin.ResetOffsets(kafka.OffsetResetInput{Group: "active", Topic: "payments", Target: target, DryRun: true})
+	if err != nil || plan.ActiveMembers != 1 || len(plan.Partitions) != 2 {
+		t.Errorf("dry-run: se esperaba el plan de 2 particiones, se obtuvo %+v (%v)", plan, err)
+	}
+
+	if requests := committedRequests(broker); len(requests) != 0 {
+		t.Errorf("se comprometieron offsets de un grupo activo: %d solicitudes", len(requests))
+	}
+}
+
+func TestConsumerGroupAdminResetShift(t *testing.T) {
+	broker := newAdminBroker(t)
+	admin := newTestGroupAdmin(t, broker)
+
+	// 5 - 10 se acota al offset mas antiguo disponible
+	plan, err := admin.ResetOffsets(kafka.OffsetResetInput{
+		Group:      "idle",
+		Topic:      "payments",
+		Partitions: []int32{0},
+		Target:     &kafka.OffsetResetTarget{Mode: kafka.ResetShift, Shift: -10},
+	})
+	if err != nil {
+		t.Fatalf("error de reset: %v", err)
+	}
+
+	expected := []kafka.OffsetResetPartition{{Topic: "payments", Partition: 0, Current: 5, Target: 2}}
+	if !reflect.DeepEqual(plan.Partitions, expected) {
+		t.Errorf("plan: se esperaba %+v, se obtuvo %+v", expected, plan.Partitions)
+	}
+
+	requests := committedRequests(broker)
+	if len(requests) != 1 {
+		t.Fatalf("se esperaba 1 commit, se obtuvo %d", len(requests))
+	}
+
+	if offset, _, err := requests[0].Offset("payments", 0); err != nil || offset != 2 {
+		t.Errorf("offset comprometido: se esperaba 2, se obtuvo %d (%v)", offset, err)
+	}
+
+	// la particion 1 no tiene offset comprometido para desplazar
+	_, err = admin.ResetOffsets(kafka.OffsetResetInput{
+		Group:  "idle",
+		Topic:  "payments",
+		Target: &kafka.OffsetResetTarget{Mode: kafka.ResetShift, Shift: 1},
+	})
+	if err == nil || !strings.Contains(err.Error(), kafka.MissingCommittedOffsetKind) {
+		t.Errorf("se esperaba %q, se obtuvo %v", kafka.MissingCommittedOffsetKind, err)
+	}
+}
+
+func TestConsumerGroupAdminResetTimestamp(t *testing.T) {
+	admin := newTestGroupAdmin(t, newAdminBroker(t))
+
+	plan, err := admin.ResetOffsets(kafka.OffsetResetInput{
+		Group:  "idle",
+		Topic:  "payments",
+		Target: &kafka.OffsetResetTarget{Mode: kafka.StartTimestamp, Timestamp: adminResetTimestamp},
+		DryRun: true,
+	})
+	if err != nil {
+		t.Fatalf("error de reset: %v", err)
+	}
+
+	// la particion 1 no tiene mensajes posteriores al timestamp, se posiciona al final
+	expected := []kafka.OffsetResetPartition{
+		{Topic: "payments", Partition: 0, Current: 5, Target: 7},
+		{Topic: "payments", Partition: 1, Current: -1, Target: 4},
+	}
+	if !reflect.DeepEqual(plan.Partitions, expected) {
+		t.Errorf("plan: se esperaba %+v, se obtuvo %+v", expected, plan.Partitions)
+	}
+}
+
+func TestConsumerGroupAdminResetOffsets(t *testing.T) {
+	broker := newAdminBroker(t)
+	admin := newTestGroupAdmin(t, broker)
+
+	target, err := kafka.ParseOffsetResetTarget("offsets:0=100")
+	if err != nil {
+		t.Fatalf("error interpretando destino: %v", err)
+	}
+
+	plan, err := admin.ResetOffsets(kafka.OffsetResetInput{Group: "idle", Topic: "payments", Target: target, DryRun: true})
+	if err != nil {
+		t.Fatalf("error de reset: %v", err)
+	}
+
+	// solo se incluye la particion indicada, acotada al final de la particion
+	expected := []kafka.OffsetResetPartition{{Topic: "payments", Partition: 0, Current: 5, Target: 10}}
+	if !reflect.DeepEqual(plan.Partitions, expected) {
+		t.Errorf("plan: se esperaba %+v, se obtuvo %+v", expected, plan.Partitions)
+	}
+
+	if requests := committedRequests(broker); len(requests) != 0 {
+		t.Errorf("dry-run comprometio offsets: %d solicitudes", len(requests))
+	}
+
+	_, err = admin.ResetOffsets(kafka.OffsetResetInput{
+		Group:  "idle",
+		Topic:  "payments",
+		Target: &kafka.OffsetResetTarget{Mode: kafka.StartOffsets, Offsets: map[int32]int64{5: 1}},
+	})
+	if err == nil {
+		t.Errorf("se esperaba error por particion inexistente")
+	}
+}
+
+func TestConsumerGroupAdminDelete(t *testing.T) {
+	broker := newAdminBroker(t)
+	admin := newTestGroupAdmin(t, broker)
+
+	if err := admin.Delete("idle"); err != nil {
+		t.Fatalf("error eliminando grupo: %v", err)
+	}
+
+	deleted := false
+	for _, exchange := range broker.History() {
+		if request, ok := exchange.Request.(*sarama.DeleteGroupsRequest); ok && reflect.DeepEqual(request.Groups, []string{"idle"}) {
+			deleted = true
+		}
+	}
+
+	if !deleted {
+		t.Errorf("no se envio la solicitud de eliminacion del grupo idle")
+	}
+}
+
+func TestParseOffsetResetTarget(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected *kafka.OffsetResetTarget
+	}{
+		{value: "earliest", expected: &kafka.OffsetResetTarget{Mode: kafka.StartEarliest}},
+		{value: " LATEST ", expected: &kafka.OffsetResetTarget{Mode: kafka.StartLatest}},
+		{value: "shift:+5", expected: &kafka.OffsetResetTarget{Mode: kafka.ResetShift, Shift: 5}},
+		{value: "shift: -100", expected: &kafka.OffsetResetTarget{Mode: kafka.ResetShift, Shift: -100}},
+		{value: "timestamp:2024-01-01T10:00:00Z", expected: &kafka.OffsetResetTarget{Mode: kafka.StartTimestamp, Timestamp: adminResetTimestamp}},
+		{value: "offsets:0=10,1=20", expected: &kafka.OffsetResetTarget{Mode: kafka.StartOffsets, Offsets: map[int32]int64{0: 10, 1: 20}}},
+		{value: "tail:10"},
+		{value: "shift:abc"},
+		{value: "offsets:"},
+		{value: "ayer"},
+		{value: ""},
+	}
+
+	for _, test := range tests {
+		target, err := kafka.ParseOffsetResetTarget(test.value)
+
+		if test.expected == nil {
+			if err == nil || err.Error() != kafka.InvalidOffsetResetKind {
+				t.Errorf("%q: se esperaba %q, se obtuvo %+v (%v)", test.value, kafka.InvalidOffsetResetKind, target, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: error inesperado %v", test.value, err)
+			continue
+		}
+
+		if !test.expected.Timestamp.IsZero() && test.expected.Timestamp.Equal(target.Timestamp) {
+			target.Timestamp = test.expected.Timestamp
+		}
+
+		if !reflect.DeepEqual(target, test.expected) {
+			t.Errorf("%q: se esperaba %+v, se obtuvo %+v", test.value, test.expected, target)
+		}
+	}
+
+	ms, err := kafka.ParseOffsetResetTarget("timestamp:1704103200000")
+	if err != nil || !ms.Timestamp.Equal(adminResetTimestamp) {
+		t.Errorf("timestamp en unix ms: se esperaba %v, se obtuvo %+v (%v)", adminResetTimestamp, ms, err)
+	}
+}
+
+func TestResolveResetOffsetClamping(t *testing.T) {
+	const oldest, newest = 20, 50
+
+	tests := []struct {
+		name            string
+		target          kafka.OffsetResetTarget
+		current         int64
+		timestampOffset int64
+		expected        int64
+	}{
+		{name: "earliest", target: kafka.OffsetResetTarget{Mode: kafka.StartEarliest}, expected: oldest},
+		{name: "latest", target: kafka.OffsetResetTarget{Mode: kafka.StartLatest}, expected: newest},
+		{name: "timestamp", target: kafka.OffsetResetTarget{Mode: kafka.StartTimestamp}, timestampOffset: 30, expected: 30},
+		{name: "timestamp sin mensajes posteriores", target: kafka.OffsetResetTarget{Mode: kafka.StartTimestamp}, timestampOffset: -1, expected: newest},
+		{name: "shift", target: kafka.OffsetResetTarget{Mode: kafka.ResetShift, Shift: -5}, current: 40, expected: 35},
+		{name: "shift antes del inicio", target: kafka.OffsetResetTarget{Mode: kafka.ResetShift, Shift: -30}, current: 40, expected: oldest},
+		{name: "shift despues del final", target: kafka.OffsetResetTarget{Mode: kafka.ResetShift, Shift: 30}, current: 40, expected: newest},
+		{name: "offset explicito", target: kafka.OffsetResetTarget{Mode: kafka.StartOffsets, Offsets: map[int32]int64{3: 25}}, expected: 25},
+		{name: "offset compactado", target: kafka.OffsetResetTarget{Mode: kafka.StartOffsets, Offsets: map[int32]int64{3: 1}}, expected: oldest},
+		{name: "offset posterior al final", target: kafka.OffsetResetTarget{Mode: kafka.StartOffsets, Offsets: map[int32]int64{3: 99}}, expected: newest},
+	}
+
+	for _, test := range tests {
+		offset, err := kafka.ResolveResetOffset(&test.target, 3, test.current, oldest, newest, test.timestampOffset)
+		if err != nil || offset != test.expected {
+			t.Errorf("%s: se esperaba %d, se obtuvo %d (%v)", test.name, test.expected, offset, err)
+		}
+	}
+
+	_, err := kafka.ResolveResetOffset(&kafka.OffsetResetTarget{Mode: kafka.ResetShift, Shift: 1}, 3, -1, oldest, newest, -1)
+	if err == nil || err.Error() != kafka.MissingCommittedOffsetKind {
+		t.Errorf("shift sin offset comprometido: se esperaba %q, se obtuvo %v", kafka.MissingCommittedOffsetKind, err)
+	}
+}
@@ -0,0 +1,253 @@
+package kafka_toolkit
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// PanicError error generado al recuperar un panic del message handler, incluye el stack trace
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s: %v\n%s", HandlerPanicErrorKind, e.Value, e.Stack)
+}
+
+// ErrHandlerAbandoned el handler no finalizo dentro de HandlerTimeout mas la espera adicional. Envuelve
+// ErrSessionClosed: el mensaje no se marca ni se envia al error handler y el claim se detiene para que
+// la sesion se reinicie y el mensaje se vuelva a entregar. El siguiente claim de la particion espera a que
+// el handler abandonado finalice, hasta HandlerTimeoutGrace; si sigue en ejecucion el mensaje se procesa
+// dos veces en paralelo, por lo que el handler debe ser idempotente.
+var ErrHandlerAbandoned = fmt.Errorf("%s: %w", HandlerAbandonedErrorKind, ErrSessionClosed)
+
+// invokeHandler ejecuta el message handler recuperando panics y aplicando HandlerTimeout.
+// Al vencer el tiempo se cancela el context del handler y se espera hasta HandlerTimeoutGrace a que finalice,
+// por lo que el handler debe respetar ctx.Done(). Si finaliza se retorna su resultado, con error de timeout
+// si fallo, y el consumer continua con el siguiente mensaje en orden. Si no finaliza se retorna
+// ErrHandlerAbandoned y se reporta la duracion del handler cuando termine.
+// Ver ErrHandlerAbandoned sobre la segunda ejecucion del handler.
+func (consumer *BaseConsumer) invokeHandler(ctx context.Context, msg *ConsumerMessage) error {
+	return consumer.guard(ctx, msg, func(ctx context.Context) error {
+		return consumer.MessageHandler.HandleMessage(ctx, msg)
+	})
+}
+
+// guard aplica la recuperacion de panics y HandlerTimeout a handle, msg identifica el trabajo en logs y metricas
+func (consumer *BaseConsumer) guard(ctx context.Context, msg *ConsumerMessage, handle func(context.Context) error) error {
+	if consumer.HandlerTimeout <= 0 {
+		return consumer.safeHandle(ctx, msg, handle)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, consumer.HandlerTimeout)
+	defer cancel()
+
+	start := time.Now()
+	result := make(chan error, 1)
+
+	go func() {
+		result <- consumer.safeHandle(ctx, msg, handle)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+	}
+
+	// El handler pudo finalizar junto con el vencimiento del context
+	select {
+	case err := <-result:
+		return err
+	default:
+	}
+
+	if ctx.Err() != context.DeadlineExceeded {
+		return consumer.awaitCancelled(msg, result, start, ctx.Err())
+	}
+
+	consumer.HandlerMetrics.timeout(msg.Topic)
+
+	Log.Warn(
+		"message", HandlerTimeoutErrorKind,
+		"topic", msg.Topic,
+		"partition", msg.Partition,
+		"offset", msg.Offset,
+		"timeout", consumer.HandlerTimeout.String())
+
+	return consumer.awaitCancelled(msg, result, start, fmt.Errorf("%s: %s", HandlerTimeoutErrorKind, consumer.HandlerTimeout))
+}
+
+// awaitCancelled espera hasta HandlerTimeoutGrace a que finalice un handler con el context cancelado
+func (consumer *BaseConsumer) awaitCancelled(msg *ConsumerMessage, result <-chan error, start time.Time, cause error) error {
+	grace := consumer.HandlerTimeoutGrace
+	if grace <= 0 {
+		grace = consumer.HandlerTimeout
+	}
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+
+	select {
+	case err := <-result:
+		consumer.HandlerMetrics.overdue(msg.Topic, time.Since(start))
+
+		if err == nil {
+			return nil
+		}
+
+		return fmt.Errorf("%v: %w", cause, err)
+	case <-timer.C:
+	}
+
+	Log.Error(
+		"errorMessage", HandlerAbandonedErrorKind,
+		"topic", msg.Topic,
+		"partition", msg.Partition,
+		"offset", msg.Offset,
+		"grace", grace.String())
+
+	finished := consumer.abandoned.add(msg.Topic, msg.Partition)
+
+	go func() {
+		err := <-result
+		elapsed := time.Since(start)
+
+		consumer.abandoned.done(msg.Topic, msg.Partition, finished)
+
+		consumer.HandlerMetrics.overdue(msg.Topic, elapsed)
+
+		Log.Warn(
+			"message", "Handler abandonado finalizado",
+			"topic", msg.Topic,
+			"partition", msg.Partition,
+			"offset", msg.Offset,
+			"elapsed", elapsed.String(),
+			"error", err)
+	}()
+
+	return ErrHandlerAbandoned
+}
+
+// awaitAbandoned espera antes de consumir la particion a que finalicen los handlers abandonados que siguen en
+// ejecucion, hasta HandlerTimeoutGrace o el fin de la sesion, para no procesar el mensaje vuelto a entregar en
+// paralelo con su ejecucion anterior
+func (consumer *BaseConsumer) awaitAbandoned(session sarama.ConsumerGroupSession, topic string, partition int32) {
+	pending := consumer.abandoned.pending(topic, partition)
+	if len(pending) == 0 {
+		return
+	}
+
+	grace := consumer.HandlerTimeoutGrace
+	if grace <= 0 {
+		grace = consumer.HandlerTimeout
+	}
+
+	Log.Warn(
+		"message", "Esperando handler abandonado antes de consumir la particion",
+		"topic", topic,
+		"partition", partition,
+		"grace", grace.String())
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+
+	for _, finished := range pending {
+		select {
+		case <-finished:
+		case <-timer.C:
+			Log.Error(
+				"errorMessage", "Handler abandonado sigue en ejecucion, el mensaje puede procesarse dos veces",
+				"topic", topic,
+				"partition", partition)
+			return
+		case <-session.Context().Done():
+			return
+		}
+	}
+}
+
+// abandonedHandlers handlers abandonados que siguen en ejecucion por particion, con receptor nil no registra
+type abandonedHandlers struct {
+	mu      sync.Mutex
+	running map[string]map[int32][]chan struct{}
+}
+
+func newAbandonedHandlers() *abandonedHandlers {
+	return &abandonedHandlers{running: make(map[string]map[int32][]chan struct{})}
+}
+
+func (a *abandonedHandlers) add(topic string, partition int32) chan struct{} {
+	finished := make(chan struct{})
+	if a == nil {
+		return finished
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.running[topic] == nil {
+		a.running[topic] = make(map[int32][]chan struct{})
+	}
+	a.running[topic][partition] = append(a.running[topic][partition], finished)
+
+	return finished
+}
+
+func (a *abandonedHandlers) done(topic string, partition int32, finished chan struct{}) {
+	close(finished)
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	running := a.running[topic][partition]
+	for i, ch := range running {
+		if ch == finished {
+			a.running[topic][partition] = append(running[:i], running[i+1:]...)
+			break
+		}
+	}
+}
+
+func (a *abandonedHandlers) pending(topic string, partition int32) []chan struct{} {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]chan struct{}(nil), a.running[topic][partition]...)
+}
+
+// safeHandle ejecuta handle convirtiendo un panic en PanicError
+func (consumer *BaseConsumer) safeHandle(ctx context.Context, msg *ConsumerMessage, handle func(context.Context) error) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			stack := debug.Stack()
+
+			consumer.HandlerMetrics.panic(msg.Topic)
+
+			Log.Panic(
+				"errorMessage", HandlerPanicErrorKind,
+				"topic", msg.Topic,
+				"partition", msg.Partition,
+				"offset", msg.Offset,
+				"error", fmt.Sprint(recovered),
+				"stack", string(stack))
+
+			err = &PanicError{Value: recovered, Stack: stack}
+		}
+	}()
+
+	return handle(ctx)
+}
@@ -0,0 +1,158 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+func TestHandlerTimeoutWaitsForCancelledHandler(t *testing.T) {
+	var active, overlapped int32
+
+	handler := kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		if atomic.AddInt32(&active, 1) > 1 {
+			atomic.StoreInt32(&overlapped, 1)
+		}
+		defer atomic.AddInt32(&active, -1)
+
+		if inMsg.Offset == 0 {
+			<-ctx.Done()
+			// trabajo de limpieza posterior a la cancelacion
+			time.Sleep(10 * time.Millisecond)
+			return ctx.Err()
+		}
+
+		return nil
+	})
+
+	errorHandler := kafkatest.NewRecordingErrorHandler()
+	consumer := kafka.NewBaseConsumer(handler, errorHandler)
+	consumer.HandlerTimeout = 30 * time.Millisecond
+
+	session, err := kafkatest.ConsumeMessages(&consumer, "guard", 0,
+		kafkatest.Message(0, "a", "lento", nil),
+		kafkatest.Message(1, "b", "rapido", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&overlapped) == 1 {
+		t.Errorf("el siguiente mensaje se proceso en paralelo con el handler vencido")
+	}
+
+	kafkatest.AssertErrorCount(t, errorHandler, 1)
+	kafkatest.AssertErrorContains(t, errorHandler, kafka.HandlerTimeoutErrorKind)
+	kafkatest.AssertMarked(t, session, "guard", 0, 2)
+}
+
+func TestHandlerTimeoutAbandonsHungHandler(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	var handled int32
+	handler := kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		atomic.AddInt32(&handled, 1)
+		if inMsg.Offset == 0 {
+			// ignora la cancelacion del context
+			<-release
+		}
+
+		return nil
+	})
+
+	errorHandler := kafkatest.NewRecordingErrorHandler()
+	consumer := kafka.NewBaseConsumer(handler, errorHandler)
+	consumer.HandlerTimeout = 20 * time.Millisecond
+	consumer.HandlerTimeoutGrace = 20 * time.Millisecond
+
+	session, err := kafkatest.ConsumeMessages(&consumer, "guard", 0,
+		kafkatest.Message(0, "a", "colgado", nil),
+		kafkatest.Message(1, "b", "siguiente", nil))
+	if !errors.Is(err, kafka.ErrHandlerAbandoned) {
+		t.Fatalf("se esperaba ErrHandlerAbandoned, se obtuvo %v", err)
+	}
+
+	if offset, ok := session.Offset("guard", 0); ok {
+		t.Errorf("no se esperaba offset marcado, se obtuvo %d", offset)
+	}
+
+	if count := atomic.LoadInt32(&handled); count != 1 {
+		t.Errorf("se esperaba que el claim se detuviera luego del handler abandonado, mensajes procesados %d", count)
+	}
+
+	kafkatest.AssertNoErrors(t, errorHandler)
+}
+
+func TestHandlerPanicIsReported(t *testing.T) {
+	handler := kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		panic("boom")
+	})
+
+	errorHandler := kafkatest.NewRecordingErrorHandler()
+	consumer := kafka.NewBaseConsumer(handler, errorHandler)
+	consumer.HandlerTimeout = time.Second
+
+	session, err := kafkatest.ConsumeMessages(&consumer, "guard", 0, kafkatest.Message(0, "a", "panic", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kafkatest.AssertErrorCount(t, errorHandler, 1)
+	kafkatest.AssertErrorContains(t, errorHandler, kafka.HandlerPanicErrorKind)
+	kafkatest.AssertMarked(t, session, "guard", 0, 1)
+}
+
+func TestHandlerTimeoutRedeliveryWaitsForAbandonedHandler(t *testing.T) {
+	release := make(chan struct{})
+	var active, overlapped, handled int32
+
+	handler := kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		if atomic.AddInt32(&active, 1) > 1 {
+			atomic.StoreInt32(&overlapped, 1)
+		}
+		defer atomic.AddInt32(&active, -1)
+
+		if atomic.AddInt32(&handled, 1) == 1 {
+			// la primera ejecucion ignora la cancelacion del context
+			<-release
+		}
+
+		return nil
+	})
+
+	errorHandler := kafkatest.NewRecordingErrorHandler()
+	consumer := kafka.NewBaseConsumer(handler, errorHandler)
+	consumer.HandlerTimeout = 20 * time.Millisecond
+	consumer.HandlerTimeoutGrace = 20 * time.Millisecond
+	_, err := kafkatest.ConsumeMessages(&consumer, "guard", 0, kafkatest.Message(0, "a", "colgado", nil))
+	if !errors.Is(err, kafka.ErrHandlerAbandoned) {
+		t.Fatalf("se esperaba ErrHandlerAbandoned, se obtuvo %v", err)
+	}
+
+	// el siguiente claim espera hasta HandlerTimeoutGrace al handler abandonado
+	consumer.HandlerTimeoutGrace = time.Second
+	time.AfterFunc(100*time.Millisecond, func() { close(release) })
+
+	// la sesion siguiente vuelve a entregar el mensaje
+	start := time.Now()
+	session, err := kafkatest.ConsumeMessages(&consumer, "guard", 0, kafkatest.Message(0, "a", "colgado", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&overlapped) == 1 {
+		t.Errorf("el mensaje vuelto a entregar se proceso en paralelo con el handler abandonado")
+	}
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("se esperaba que el claim esperara al handler abandonado, espero %s", elapsed)
+	}
+
+	kafkatest.AssertMarked(t, session, "guard", 0, 1)
+	kafkatest.AssertNoErrors(t, errorHandler)
+}
@@ -0,0 +1,201 @@
+package kafka_toolkit
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-kit/kit/metrics"
+)
+
+var errConsumerPaused = "Consumer pausado"
+
+// Pauser permite pausar y reanudar el fetch de particiones
+type Pauser interface {
+	Pause(partitions map[string][]int32)
+	Resume(partitions map[string][]int32)
+	PauseAll()
+	ResumeAll()
+	Paused() bool
+}
+
+// PausableKafkaConsumer consumer que permite pausar y reanudar particiones,
+// el consumer retornado por MakeSaramaConsumerBuilder implementa esta interfaz
+type PausableKafkaConsumer interface {
+	KafkaConsumer
+	Pauser
+}
+
+// pauseState estado de pausa del consumer, se mantiene entre rebalanceos ya que sarama
+// crea nuevos partition consumers en cada sesion
+type pauseState struct {
+	mu         sync.Mutex
+	all        bool
+	partitions map[string]map[int32]bool
+	gauge      metrics.Gauge
+}
+
+func newPauseState() *pauseState {
+	return &pauseState{partitions: make(map[string]map[int32]bool)}
+}
+
+func (p *pauseState) pause(partitions map[string][]int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for topic, list := range partitions {
+		if p.partitions[topic] == nil {
+			p.partitions[topic] = make(map[int32]bool)
+		}
+
+		for _, partition := range list {
+			p.partitions[topic][partition] = true
+		}
+	}
+
+	p.updateGauge()
+}
+
+// resume reanuda particiones, si todo estaba pausado se mantienen pausadas las demas asignadas
+func (p *pauseState) resume(partitions map[string][]int32, assigned map[string][]int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.all {
+		p.all = false
+		for topic, list := range assigned {
+			if p.partitions[topic] == nil {
+				p.partitions[topic] = make(map[int32]bool)
+			}
+
+			for _, partition := range list {
+				p.partitions[topic][partition] = true
+			}
+		}
+	}
+
+	for topic, list := range partitions {
+		for _, partition := range list {
+			delete(p.partitions[topic], partition)
+		}
+	}
+
+	p.updateGauge()
+}
+
+func (p *pauseState) pauseAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.all = true
+	p.updateGauge()
+}
+
+func (p *pauseState) resumeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.all = false
+	p.partitions = make(map[string]map[int32]bool)
+	p.updateGauge()
+}
+
+func (p *pauseState) isPaused(topic string, partition int32) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.all || p.partitions[topic][partition]
+}
+
+func (p *pauseState) paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.pausedLocked()
+}
+
+func (p *pauseState) pausedLocked() bool {
+	if p.all {
+		return true
+	}
+
+	for _, partitions := range p.partitions {
+		if len(partitions) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *pauseState) updateGauge() {
+	if p.gauge == nil {
+		return
+	}
+
+	if p.pausedLocked() {
+		p.gauge.Set(1)
+	} else {
+		p.gauge.Set(0)
+	}
+}
+
+// reapplyPause vuelve a pausar la particion del claim si estaba pausada en una sesion anterior
+func (consumer *BaseConsumer) reapplyPause(claim sarama.ConsumerGroupClaim) {
+	if consumer.pause == nil || consumer.group == nil {
+		return
+	}
+
+	if consumer.pause.isPaused(claim.Topic(), claim.Partition()) {
+		consumer.group.Pause(map[string][]int32{claim.Topic(): {claim.Partition()}})
+	}
+}
+
+func (s *saramaKafkaConsumer) Pause(partitions map[string][]int32) {
+	s.consumer.pause.pause(partitions)
+	s.client.Pause(partitions)
+
+	Log.Warn("message", "Particiones pausadas", "partitions", partitions)
+}
+
+func (s *saramaKafkaConsumer) Resume(partitions map[string][]int32) {
+	s.consumer.pause.resume(partitions, s.consumer.assignment.snapshot())
+	s.client.Resume(partitions)
+
+	Log.Info("message", "Particiones reanudadas", "partitions", partitions)
+}
+
+func (s *saramaKafkaConsumer) PauseAll() {
+	s.consumer.pause.pauseAll()
+	s.client.PauseAll()
+
+	Log.Warn("message", "Consumer pausado")
+}
+
+func (s *saramaKafkaConsumer) ResumeAll() {
+	s.consumer.pause.resumeAll()
+	s.client.ResumeAll()
+
+	Log.Info("message", "Consumer reanudado")
+}
+
+func (s *saramaKafkaConsumer) Paused() bool {
+	return s.consumer.pause.paused()
+}
+
+type pauseReadinessCheck struct {
+	pauser Pauser
+}
+
+// NewPauseReadinessCheck health check de readiness que falla mientras el consumer este pausado
+func NewPauseReadinessCheck(pauser Pauser) HealthCheck {
+	return &pauseReadinessCheck{pauser: pauser}
+}
+
+func (c *pauseReadinessCheck) Health() error {
+	if c.pauser.Paused() {
+		return errors.New(errConsumerPaused)
+	}
+
+	return nil
+}
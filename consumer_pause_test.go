@@ -0,0 +1,181 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-kit/kit/metrics"
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+// fakeConsumerGroup sarama.ConsumerGroup que registra las particiones pausadas
+type fakeConsumerGroup struct {
+	mu     sync.Mutex
+	paused []string
+}
+
+func (g *fakeConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	return nil
+}
+
+func (g *fakeConsumerGroup) Errors() <-chan error {
+	return nil
+}
+
+func (g *fakeConsumerGroup) Close() error {
+	return nil
+}
+
+func (g *fakeConsumerGroup) Pause(partitions map[string][]int32) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for topic, list := range partitions {
+		for _, partition := range list {
+			g.paused = append(g.paused, fmt.Sprintf("%s/%d", topic, partition))
+		}
+	}
+}
+
+func (g *fakeConsumerGroup) Resume(partitions map[string][]int32) {}
+
+func (g *fakeConsumerGroup) PauseAll() {}
+
+func (g *fakeConsumerGroup) ResumeAll() {}
+
+// takePaused retorna y limpia las particiones pausadas registradas
+func (g *fakeConsumerGroup) takePaused() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	paused := g.paused
+	g.paused = nil
+	sort.Strings(paused)
+
+	return paused
+}
+
+// fakeGroupSession sesion terminada, ConsumeClaim retorna luego de reaplicar la pausa
+type fakeGroupSession struct {
+	claims map[string][]int32
+	ctx    context.Context
+}
+
+func newFakeGroupSession(claims map[string][]int32) *fakeGroupSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	return &fakeGroupSession{claims: claims, ctx: ctx}
+}
+
+func (s *fakeGroupSession) Claims() map[string][]int32 { return s.claims }
+func (s *fakeGroupSession) MemberID() string           { return "member" }
+func (s *fakeGroupSession) GenerationID() int32        { return 1 }
+func (s *fakeGroupSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (s *fakeGroupSession) Commit() {}
+func (s *fakeGroupSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (s *fakeGroupSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {}
+func (s *fakeGroupSession) Context() context.Context                                 { return s.ctx }
+
+type fakeGroupClaim struct {
+	topic     string
+	partition int32
+}
+
+func (c *fakeGroupClaim) Topic() string                            { return c.topic }
+func (c *fakeGroupClaim) Partition() int32                         { return c.partition }
+func (c *fakeGroupClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeGroupClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c *fakeGroupClaim) Messages() <-chan *sarama.ConsumerMessage { return nil }
+
+// recordingGauge metrics.Gauge que conserva el ultimo valor
+type recordingGauge struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (g *recordingGauge) With(labelValues ...string) metrics.Gauge { return g }
+
+func (g *recordingGauge) Set(value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.value = value
+}
+
+func (g *recordingGauge) Add(delta float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.value += delta
+}
+
+func (g *recordingGauge) current() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.value
+}
+
+func TestPauseIsReappliedAfterRebalance(t *testing.T) {
+	kafkatest.EnsureLogger()
+
+	group := &fakeConsumerGroup{}
+	gauge := &recordingGauge{}
+	consumer, handler := kafka.NewTestPausableConsumer(group, gauge)
+	readiness := kafka.NewPauseReadinessCheck(consumer)
+
+	claims := map[string][]int32{"orders": {0, 1, 2}}
+	session := newFakeGroupSession(claims)
+	if err := handler.Setup(session); err != nil {
+		t.Fatal(err)
+	}
+
+	// rebalance inicia un claim por particion como en la sesion siguiente y retorna las particiones pausadas
+	rebalance := func() []string {
+		group.takePaused()
+		for _, partition := range claims["orders"] {
+			if err := handler.ConsumeClaim(session, &fakeGroupClaim{topic: "orders", partition: partition}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return group.takePaused()
+	}
+
+	tests := []struct {
+		name     string
+		action   func()
+		expected []string
+	}{
+		{name: "particion pausada", action: func() { consumer.Pause(map[string][]int32{"orders": {1}}) }, expected: []string{"orders/1"}},
+		{name: "todo pausado", action: consumer.PauseAll, expected: []string{"orders/0", "orders/1", "orders/2"}},
+		{name: "reanuda una particion con todo pausado", action: func() { consumer.Resume(map[string][]int32{"orders": {0}}) }, expected: []string{"orders/1", "orders/2"}},
+		{name: "reanuda todo", action: consumer.ResumeAll},
+	}
+
+	for _, test := range tests {
+		test.action()
+
+		if paused := rebalance(); !reflect.DeepEqual(paused, test.expected) {
+			t.Errorf("%s: particiones pausadas tras el rebalanceo, se esperaba %v, se obtuvo %v", test.name, test.expected, paused)
+		}
+
+		paused := len(test.expected) > 0
+		if consumer.Paused() != paused || (readiness.Health() != nil) != paused {
+			t.Errorf("%s: se esperaba pausado %v, se obtuvo %v (readiness %v)", test.name, paused, consumer.Paused(), readiness.Health())
+		}
+
+		if expected := map[bool]float64{true: 1, false: 0}[paused]; gauge.current() != expected {
+			t.Errorf("%s: gauge de pausa, se esperaba %v, se obtuvo %v", test.name, expected, gauge.current())
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package kafka_toolkit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	// StartEarliest inicia desde el offset mas antiguo disponible
+	StartEarliest = "earliest"
+	// StartLatest inicia desde el final de la particion
+	StartLatest = "latest"
+	// StartTimestamp inicia desde el primer mensaje con timestamp mayor o igual al indicado
+	StartTimestamp = "timestamp"
+	// StartTail inicia N mensajes antes del final de cada particion
+	StartTail = "tail"
+	// StartOffsets inicia desde un offset explicito por particion
+	StartOffsets = "offsets"
+)
+
+// InvalidStartPositionKind posicion inicial invalida
+var InvalidStartPositionKind = "Posicion inicial invalida, debe ser earliest, latest, timestamp:<RFC3339|unix ms>, tail:<N> u offsets:<particion>=<offset>,..."
+
+// StartPosition posicion inicial del consumer. Por defecto solo se aplica a particiones sin offset
+// comprometido por el grupo. Con Force se aplica en la primera sesion del proceso aunque exista offset
+// comprometido; las particiones asignadas en rebalanceos posteriores solo se mueven si no tienen offset
+// comprometido, para no retroceder los offsets que comprometieron otros miembros.
+type StartPosition struct {
+	Mode      string
+	Timestamp time.Time
+	Tail      int64
+	Offsets   map[int32]int64
+	Force     bool
+}
+
+// ParseStartPosition interpreta earliest, latest, timestamp:<RFC3339|unix ms>, tail:<N> u offsets:<particion>=<offset>,...
+func ParseStartPosition(value string, force bool) (*StartPosition, error) {
+	mode, arg := value, ""
+	if idx := strings.Index(value, ":"); idx >= 0 {
+		mode, arg = value[:idx], value[idx+1:]
+	}
+
+	position := &StartPosition{Mode: strings.ToLower(strings.TrimSpace(mode)), Force: force}
+	arg = strings.TrimSpace(arg)
+
+	switch position.Mode {
+	case StartEarliest, StartLatest:
+		return position, nil
+	case StartTimestamp:
+		if ms, err := strconv.ParseInt(arg, 10, 64); err == nil {
+			position.Timestamp = time.Unix(0, ms*int64(time.Millisecond))
+			return position, nil
+		}
+
+		ts, err := time.Parse(time.RFC3339, arg)
+		if err != nil {
+			return nil, errors.New(InvalidStartPositionKind)
+		}
+		position.Timestamp = ts
+
+		return position, nil
+	case StartTail:
+		tail, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || tail < 0 {
+			return nil, errors.New(InvalidStartPositionKind)
+		}
+		position.Tail = tail
+
+		return position, nil
+	case StartOffsets:
+		position.Offsets = make(map[int32]int64)
+
+		for _, item := range splitList(arg) {
+			parts := strings.SplitN(item, "=", 2)
+			if len(parts) != 2 {
+				return nil, errors.New(InvalidStartPositionKind)
+			}
+
+			partition, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 32)
+			if err != nil {
+				return nil, errors.New(InvalidStartPositionKind)
+			}
+
+			offset, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+			if err != nil || offset < 0 {
+				return nil, errors.New(InvalidStartPositionKind)
+			}
+
+			position.Offsets[int32(partition)] = offset
+		}
+
+		if len(position.Offsets) == 0 {
+			return nil, errors.New(InvalidStartPositionKind)
+		}
+
+		return position, nil
+	default:
+		return nil, errors.New(InvalidStartPositionKind)
+	}
+}
+
+// needsResolver indica si la posicion no puede expresarse solo con Consumer.Offsets.Initial
+func (p *StartPosition) needsResolver() bool {
+	return p.Force || (p.Mode != StartEarliest && p.Mode != StartLatest)
+}
+
+// startPositionResolver aplica la posicion inicial en el Setup de cada sesion
+type startPositionResolver struct {
+	position *StartPosition
+	group    string
+	client   sarama.Client
+
+	mu     sync.Mutex
+	forced bool
+}
+
+func newStartPositionResolver(position *StartPosition, group string, client sarama.Client) *startPositionResolver {
+	return &startPositionResolver{
+		position: position,
+		group:    group,
+		client:   client,
+	}
+}
+
+// apply mueve el offset de las particiones asignadas sin offset comprometido, o de todas en la primera sesion
+// con Force, y compromete los offsets resueltos antes de que la sesion inicie el consumo
+func (r *startPositionResolver) apply(session sarama.ConsumerGroupSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	force := r.position.Force && !r.forced
+
+	claims := session.Claims()
+	if len(claims) == 0 {
+		r.forced = true
+		return nil
+	}
+
+	committed := make(map[string]map[int32]int64)
+	if !force {
+		var err error
+		if committed, err = r.committedOffsets(claims); err != nil {
+			return err
+		}
+	}
+
+	moved := false
+	for topic, partitions := range claims {
+		for _, partition := range partitions {
+			if offset, ok := committed[topic][partition]; ok && offset >= 0 {
+				continue
+			}
+
+			offset, ok, err := r.resolveOffset(topic, partition)
+			if err != nil {
+				return err
+			}
+
+			if ok {
+				// MarkOffset solo avanza y ResetOffset solo retrocede el offset de la sesion, en ese orden
+				// dejan el offset resuelto tanto en grupos nuevos como hacia adelante o hacia atras
+				session.MarkOffset(topic, partition, offset, "")
+				session.ResetOffset(topic, partition, offset, "")
+				moved = true
+
+				Log.Info(
+					"message", "Posicion inicial aplicada",
+					"topic", topic,
+					"partition", partition,
+					"offset", offset,
+					"mode", r.position.Mode,
+					"force", force)
+			}
+		}
+	}
+
+	if moved {
+		session.Commit()
+	}
+
+	r.forced = true
+
+	return nil
+}
+
+// resolveOffset retorna el offset para la particion, ok en false si no hay posicion para la particion
+func (r *startPositionResolver) resolveOffset(topic string, partition int32) (int64, bool, error) {
+	switch r.position.Mode {
+	case StartEarliest:
+		offset, err := r.client.GetOffset(topic, partition, sarama.OffsetOldest)
+		return offset, err == nil, err
+	case StartLatest:
+		offset, err := r.client.GetOffset(topic, partition, sarama.OffsetNewest)
+		return offset, err == nil, err
+	case StartTimestamp:
+		offset, err := r.client.GetOffset(topic, partition, r.position.Timestamp.UnixNano()/int64(time.Millisecond))
+		if err != nil {
+			return 0, false, err
+		}
+
+		// Sin mensajes posteriores al timestamp se inicia desde el final
+		if offset < 0 {
+			offset, err = r.client.GetOffset(topic, partition, sarama.OffsetNewest)
+		}
+
+		return offset, err == nil, err
+	case StartTail:
+		newest, err := r.client.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return 0, false, err
+		}
+
+		oldest, err := r.client.GetOffset(topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return 0, false, err
+		}
+
+		offset := newest - r.position.Tail
+		if offset < oldest {
+			offset = oldest
+		}
+
+		return offset, true, nil
+	case StartOffsets:
+		offset, ok := r.position.Offsets[partition]
+		return offset, ok, nil
+	default:
+		return 0, false, fmt.Errorf("%s: %s", InvalidStartPositionKind, r.position.Mode)
+	}
+}
+
+// committedOffsets obtiene los offsets comprometidos por el grupo, -1 indica que no hay offset
+func (r *startPositionResolver) committedOffsets(claims map[string][]int32) (map[string]map[int32]int64, error) {
+	coordinator, err := r.client.Coordinator(r.group)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &sarama.OffsetFetchRequest{Version: 1, ConsumerGroup: r.group}
+	for topic, partitions := range claims {
+		for _, partition := range partitions {
+			req.AddPartition(topic, partition)
+		}
+	}
+
+	resp, err := coordinator.FetchOffset(req)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make(map[string]map[int32]int64)
+	for topic, partitions := range claims {
+		offsets[topic] = make(map[int32]int64)
+
+		for _, partition := range partitions {
+			block := resp.GetBlock(topic, partition)
+			if block == nil {
+				offsets[topic][partition] = -1
+				continue
+			}
+
+			if block.Err != sarama.ErrNoError {
+				return nil, block.Err
+			}
+
+			offsets[topic][partition] = block.Offset
+		}
+	}
+
+	return offsets, nil
+}
@@ -0,0 +1,203 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+func TestStartPositionNewGroup(t *testing.T) {
+	cluster := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{"start": 1}})
+	cluster.SetMessages("start", 0, "0", "1", "2", "3", "4")
+
+	input := cluster.ConsumerInput("start", "start-new")
+	input.StartFrom = "tail:2"
+
+	offsets := consumeStartPosition(t, input, 4)
+
+	if offsets[0] != 3 {
+		t.Errorf("primer offset consumido: se esperaba 3, se obtuvo %v", offsets)
+	}
+
+	if offset, ok := cluster.Committed("start-new", "start", 0); !ok || offset != 5 {
+		t.Errorf("offset comprometido: se esperaba 5, se obtuvo %d (comprometido %v)", offset, ok)
+	}
+}
+
+func TestStartPositionForcedForward(t *testing.T) {
+	cluster := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{"start": 1}})
+	cluster.SetMessages("start", 0, "0", "1", "2", "3", "4")
+
+	input := cluster.ConsumerInput("start", "start-forward")
+	cluster.SetCommitted("start-forward", "start", 0, 1)
+	input.StartFrom = "offsets:0=3"
+	input.ForceStartFrom = true
+
+	offsets := consumeStartPosition(t, input, 4)
+
+	if offsets[0] != 3 {
+		t.Errorf("primer offset consumido: se esperaba 3, se obtuvo %v", offsets)
+	}
+}
+
+func TestStartPositionForcedBackward(t *testing.T) {
+	cluster := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{"start": 1}})
+	cluster.SetMessages("start", 0, "0", "1", "2", "3", "4")
+
+	input := cluster.ConsumerInput("start", "start-backward")
+	cluster.SetCommitted("start-backward", "start", 0, 4)
+	input.StartFrom = "offsets:0=1"
+	input.ForceStartFrom = true
+
+	offsets := consumeStartPosition(t, input, 4)
+
+	if offsets[0] != 1 || len(offsets) != 4 {
+		t.Errorf("offsets consumidos: se esperaba [1 2 3 4], se obtuvo %v", offsets)
+	}
+}
+
+func TestStartPositionKeepsCommittedOffset(t *testing.T) {
+	cluster := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{"start": 1}})
+	cluster.SetMessages("start", 0, "0", "1", "2", "3", "4")
+
+	input := cluster.ConsumerInput("start", "start-committed")
+	cluster.SetCommitted("start-committed", "start", 0, 2)
+	input.StartFrom = "tail:1"
+
+	offsets := consumeStartPosition(t, input, 4)
+
+	if offsets[0] != 2 {
+		t.Errorf("primer offset consumido: se esperaba 2, se obtuvo %v", offsets)
+	}
+}
+
+// consumeStartPosition ejecuta un consumer del builder hasta consumir el offset last y retorna los offsets consumidos
+func consumeStartPosition(t *testing.T, input kafka.ConsumerGroupInput, last int64) []int64 {
+	t.Helper()
+
+	var (
+		mu      sync.Mutex
+		offsets []int64
+	)
+	reached := make(chan struct{})
+
+	handler := kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		offsets = append(offsets, inMsg.Offset)
+		if inMsg.Offset == last {
+			close(reached)
+		}
+
+		return nil
+	})
+
+	consumer, err := kafka.MakeSaramaConsumerBuilder(input, handler).Build()
+	if err != nil {
+		t.Fatalf("error creando consumer: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan error, 1)
+	go func() {
+		finished <- consumer.(kafka.KafkaConsumerRunner).Run(ctx)
+	}()
+
+	select {
+	case <-reached:
+	case <-time.After(kafkatest.DefaultTimeout):
+		t.Errorf("no se consumio el offset %d dentro del tiempo maximo", last)
+	}
+
+	cancel()
+	if err := <-finished; err != nil {
+		t.Fatalf("error de consumer: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(offsets) == 0 {
+		t.Fatalf("no se consumieron mensajes")
+	}
+
+	return offsets
+}
+
+func TestStartPositionForcedOnlyInFirstSession(t *testing.T) {
+	cluster := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{"start": 1}})
+	cluster.SetMessages("start", 0, "0", "1", "2", "3", "4")
+
+	input := cluster.ConsumerInput("start", "start-once")
+	cluster.SetCommitted("start-once", "start", 0, 4)
+	input.StartFrom = "offsets:0=1"
+	input.ForceStartFrom = true
+
+	var (
+		mu        sync.Mutex
+		offsets   []int64
+		restarted bool
+	)
+	reached := make(chan struct{})
+
+	// el offset 3 termina la primera sesion sin marcarse, la siguiente sesion no debe volver al offset 1
+	handler := kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if inMsg.Offset == 3 && !restarted {
+			restarted = true
+			// el broker de prueba no registra los commits, se simula el commit de la primera sesion
+			cluster.SetCommitted("start-once", "start", 0, 3)
+			return kafka.ErrSessionClosed
+		}
+
+		offsets = append(offsets, inMsg.Offset)
+		if inMsg.Offset == 4 {
+			close(reached)
+		}
+
+		return nil
+	})
+
+	consumer, err := kafka.MakeSaramaConsumerBuilder(input, handler).Build()
+	if err != nil {
+		t.Fatalf("error creando consumer: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan error, 1)
+	go func() {
+		finished <- consumer.(kafka.KafkaConsumerRunner).Run(ctx)
+	}()
+
+	select {
+	case <-reached:
+	case <-time.After(kafkatest.DefaultTimeout):
+		t.Errorf("no se consumio el offset 4 dentro del tiempo maximo")
+	}
+
+	cancel()
+	if err := <-finished; err != nil {
+		t.Fatalf("error de consumer: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	expected := []int64{1, 2, 3, 4}
+	if len(offsets) != len(expected) {
+		t.Fatalf("offsets consumidos: se esperaba %v, se obtuvo %v", expected, offsets)
+	}
+
+	for i := range expected {
+		if offsets[i] != expected[i] {
+			t.Fatalf("offsets consumidos: se esperaba %v, se obtuvo %v", expected, offsets)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package kafka_toolkit
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	// PodNameEnv variable de entorno con el nombre del pod (Kubernetes downward API)
+	PodNameEnv = "POD_NAME"
+
+	hostnamePlaceholder = "{hostname}"
+	groupPlaceholder    = "{group}"
+)
+
+var groupInstanceIDRegexp = regexp.MustCompile(`^[0-9a-zA-Z\._\-]+$`)
+
+// ResolveGroupInstanceID resuelve el group.instance.id a partir del template del input,
+// retorna vacio si no se utiliza static membership
+func ResolveGroupInstanceID(input ConsumerGroupInput) (string, error) {
+	template := input.GroupInstanceID
+
+	if template == "" {
+		if !input.StaticMembership {
+			return "", nil
+		}
+
+		template = hostnamePlaceholder
+		if os.Getenv(PodNameEnv) != "" {
+			template = "${" + PodNameEnv + "}"
+		}
+	}
+
+	instanceID := os.ExpandEnv(template)
+
+	if strings.Contains(instanceID, hostnamePlaceholder) {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return "", err
+		}
+
+		instanceID = strings.ReplaceAll(instanceID, hostnamePlaceholder, hostname)
+	}
+
+	instanceID = strings.ReplaceAll(instanceID, groupPlaceholder, input.Group)
+
+	if instanceID == "" || instanceID == "." || instanceID == ".." || !groupInstanceIDRegexp.MatchString(instanceID) {
+		return "", errors.New(InvalidGroupInstanceIDKind)
+	}
+
+	return instanceID, nil
+}
+
+// validateStaticMembership valida que la version de Kafka soporte static membership y fetch por rack
+func validateStaticMembership(version sarama.KafkaVersion, instanceID, rackID string) error {
+	if instanceID != "" && !version.IsAtLeast(sarama.V2_3_0_0) {
+		return errors.New(InvalidStaticMembershipKind)
+	}
+
+	if rackID != "" && !version.IsAtLeast(sarama.V2_4_0_0) {
+		return errors.New(InvalidRackIDKind)
+	}
+
+	return nil
+}
+
+func configStaticMembership(saramaConf *sarama.Config, input ConsumerGroupInput) error {
+	instanceID, err := ResolveGroupInstanceID(input)
+	if err != nil {
+		return err
+	}
+
+	if err := validateStaticMembership(saramaConf.Version, instanceID, input.RackID); err != nil {
+		return err
+	}
+
+	saramaConf.Consumer.Group.InstanceId = instanceID
+	saramaConf.RackID = input.RackID
+
+	if instanceID != "" {
+		Log.Info(
+			"message", "Static membership habilitado",
+			"group_instance_id", instanceID)
+	}
+
+	return nil
+}
@@ -1,14 +1,23 @@
 package kafka_toolkit
 
-import "context"
+import (
+	"context"
+	"errors"
+)
 
 const (
 	// ContextOffsetKey key de offset en context
 	ContextOffsetKey = "OFFSET"
 	// ContextPartitionKey key de offset en context
 	ContextPartitionKey = "PARTITION"
+	// ContextSessionDoneKey key del canal de termino de sesion del consumer group en context
+	ContextSessionDoneKey = "SESSION_DONE"
 )
 
+// ErrSessionClosed error retornado por middlewares que dejan de esperar porque la sesion del consumer termino,
+// el mensaje no se marca como procesado y se vuelve a entregar luego del rebalanceo
+var ErrSessionClosed = errors.New("Sesion de consumer group terminada")
+
 // ContextWithOffset agrega el offset al context
 func ContextWithOffset(ctx context.Context, offset int64) context.Context {
 	return context.WithValue(ctx, ContextOffsetKey, offset)
@@ -28,3 +37,15 @@ func OffsetFromContext(ctx context.Context) int64 {
 func PartitionFromContext(ctx context.Context) int32 {
 	return ctx.Value(ContextPartitionKey).(int32)
 }
+
+// ContextWithSessionDone agrega al context el canal de termino de la sesion del consumer group,
+// no cancela el context para no interrumpir el procesamiento en curso
+func ContextWithSessionDone(ctx context.Context, done <-chan struct{}) context.Context {
+	return context.WithValue(ctx, ContextSessionDoneKey, done)
+}
+
+// SessionDoneFromContext obtiene el canal de termino de sesion, nil si el mensaje no viene de un consumer group
+func SessionDoneFromContext(ctx context.Context) <-chan struct{} {
+	done, _ := ctx.Value(ContextSessionDoneKey).(<-chan struct{})
+	return done
+}
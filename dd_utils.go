@@ -11,6 +11,10 @@ import (
 func GetDatadogTraceAndSpanFromContext(ctx context.Context) (ddTraceId string, ddSpanId string) {
 
 	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return "", ""
+	}
+
 	{
 		spanCtx := span.Context()
 		ddSpanCtx, isDatadogContext := spanCtx.(ddtrace.SpanContext)
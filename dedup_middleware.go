@@ -0,0 +1,138 @@
+package kafka_toolkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	// DedupIDHeader header con el id del mensaje que utiliza la deduplicacion por defecto
+	DedupIDHeader = "x-message-id"
+
+	defaultDedupTTL = 24 * time.Hour
+)
+
+// DedupStore almacen de ids de mensajes procesados con expiracion
+type DedupStore interface {
+	// Seen indica si el id fue registrado y no ha expirado
+	Seen(ctx context.Context, id string) (bool, error)
+	// Record registra el id como procesado durante ttl
+	Record(ctx context.Context, id string, ttl time.Duration) error
+}
+
+// DedupIDFunc obtiene el id de un mensaje, vacio indica que el mensaje no se deduplica
+type DedupIDFunc func(inMsg *ConsumerMessage) string
+
+// DedupByHeader id de mensaje desde un header
+func DedupByHeader(header string) DedupIDFunc {
+	return func(inMsg *ConsumerMessage) string {
+		return inMsg.Headers[header]
+	}
+}
+
+// DedupByKey id de mensaje desde la key
+func DedupByKey() DedupIDFunc {
+	return func(inMsg *ConsumerMessage) string {
+		return string(inMsg.Key)
+	}
+}
+
+// DedupByContentHash id de mensaje desde el hash sha256 de topico, key y contenido. Solo es seguro si el contenido
+// incluye un identificador unico: dos eventos legitimos con la misma key y el mismo contenido se consideran duplicados
+func DedupByContentHash() DedupIDFunc {
+	return func(inMsg *ConsumerMessage) string {
+		hash := sha256.New()
+		hash.Write([]byte(inMsg.Topic))
+		hash.Write([]byte{0})
+		hash.Write(inMsg.Key)
+		hash.Write([]byte{0})
+		hash.Write(inMsg.Msg)
+
+		return hex.EncodeToString(hash.Sum(nil))
+	}
+}
+
+// DedupConfig configuracion de middleware de deduplicacion
+type DedupConfig struct {
+	// Store almacen de ids procesados
+	Store DedupStore
+	// IDFunc obtiene el id del mensaje, por defecto el header DedupIDHeader. Los mensajes sin id no se deduplican
+	IDFunc DedupIDFunc
+	// TTL tiempo que se recuerda un id, por defecto 24 horas
+	TTL time.Duration
+	// Duplicates contador de duplicados descartados por topico, opcional
+	Duplicates metrics.Counter
+}
+
+type dedupMessageHandler struct {
+	next   MessageHandler
+	config DedupConfig
+}
+
+// MakeDedupMessageHandlerMiddleware message handler middleware que descarta mensajes ya procesados.
+// El id se registra solo cuando el handler finaliza sin error, ante errores del store se procesa el mensaje.
+// La consulta y el registro del id no son atomicos: dos entregas concurrentes del mismo id (por ejemplo en
+// particiones distintas o en dos miembros durante un rebalanceo) pueden procesarse ambas, por lo que el
+// handler debe seguir siendo idempotente.
+func MakeDedupMessageHandlerMiddleware(config DedupConfig) MessageHandlerMiddleware {
+	if config.IDFunc == nil {
+		config.IDFunc = DedupByHeader(DedupIDHeader)
+	}
+
+	if config.TTL <= 0 {
+		config.TTL = defaultDedupTTL
+	}
+
+	return func(next MessageHandler) MessageHandler {
+		return &dedupMessageHandler{next: next, config: config}
+	}
+}
+
+func (h *dedupMessageHandler) HandleMessage(ctx context.Context, inMsg *ConsumerMessage) error {
+	id := h.config.IDFunc(inMsg)
+	if id == "" {
+		return h.next.HandleMessage(ctx, inMsg)
+	}
+
+	seen, err := h.config.Store.Seen(ctx, id)
+	if err != nil {
+		Log.Error(
+			"errorMessage", "Error consultando dedup store, se procesa el mensaje",
+			"topic", inMsg.Topic,
+			"id", id,
+			"error", err)
+	}
+
+	if seen {
+		if h.config.Duplicates != nil {
+			h.config.Duplicates.With("topic", inMsg.Topic).Add(1)
+		}
+
+		Log.Debug(
+			"message", "Mensaje duplicado descartado",
+			"topic", inMsg.Topic,
+			"partition", inMsg.Partition,
+			"offset", inMsg.Offset,
+			"id", id)
+
+		return nil
+	}
+
+	if err := h.next.HandleMessage(ctx, inMsg); err != nil {
+		return err
+	}
+
+	if err := h.config.Store.Record(ctx, id, h.config.TTL); err != nil {
+		Log.Error(
+			"errorMessage", "Error registrando id en dedup store",
+			"topic", inMsg.Topic,
+			"id", id,
+			"error", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"testing"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+func TestDedupDefaultsToMessageIDHeader(t *testing.T) {
+	var handled []int64
+	handler := kafka.MakeDedupMessageHandlerMiddleware(kafka.DedupConfig{Store: kafka.NewMemoryDedupStore(100)})(
+		kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+			handled = append(handled, inMsg.Offset)
+			return nil
+		}))
+
+	errorHandler := kafkatest.NewRecordingErrorHandler()
+	consumer := kafka.NewBaseConsumer(handler, errorHandler)
+
+	session, err := kafkatest.ConsumeMessages(&consumer, "payments", 0,
+		// eventos legitimos con igual key y contenido, sin id
+		kafkatest.Message(0, "cuenta-1", `{"amount":10}`, nil),
+		kafkatest.Message(1, "cuenta-1", `{"amount":10}`, nil),
+		// reentrega del mismo evento
+		kafkatest.Message(2, "cuenta-1", `{"amount":20}`, map[string]string{kafka.DedupIDHeader: "evt-1"}),
+		kafkatest.Message(3, "cuenta-1", `{"amount":20}`, map[string]string{kafka.DedupIDHeader: "evt-1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handled) != 3 || handled[0] != 0 || handled[1] != 1 || handled[2] != 2 {
+		t.Errorf("offsets procesados: se esperaba [0 1 2], se obtuvo %v", handled)
+	}
+
+	kafkatest.AssertNoErrors(t, errorHandler)
+	kafkatest.AssertMarked(t, session, "payments", 0, 4)
+}
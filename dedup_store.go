@@ -0,0 +1,295 @@
+package kafka_toolkit
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDedupCapacity     = 100000
+	dedupCompactMinimumLines = 1000
+)
+
+// MemoryDedupStore dedup store en memoria con capacidad limitada, descarta los ids menos usados
+type MemoryDedupStore struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type dedupEntry struct {
+	id      string
+	expires time.Time
+}
+
+// NewMemoryDedupStore constructor de MemoryDedupStore, capacity por defecto 100000
+func NewMemoryDedupStore(capacity int) *MemoryDedupStore {
+	if capacity <= 0 {
+		capacity = defaultDedupCapacity
+	}
+
+	return &MemoryDedupStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Seen implementa DedupStore
+func (s *MemoryDedupStore) Seen(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[id]
+	if !ok {
+		return false, nil
+	}
+
+	if time.Now().After(element.Value.(*dedupEntry).expires) {
+		s.order.Remove(element)
+		delete(s.entries, id)
+		return false, nil
+	}
+
+	s.order.MoveToFront(element)
+
+	return true, nil
+}
+
+// Record implementa DedupStore
+func (s *MemoryDedupStore) Record(ctx context.Context, id string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.record(id, time.Now().Add(ttl))
+
+	return nil
+}
+
+// Len cantidad de ids registrados, incluye expirados aun no descartados
+func (s *MemoryDedupStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.order.Len()
+}
+
+func (s *MemoryDedupStore) record(id string, expires time.Time) {
+	if element, ok := s.entries[id]; ok {
+		element.Value.(*dedupEntry).expires = expires
+		s.order.MoveToFront(element)
+		return
+	}
+
+	s.entries[id] = s.order.PushFront(&dedupEntry{id: id, expires: expires})
+
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*dedupEntry).id)
+	}
+}
+
+func (s *MemoryDedupStore) snapshot(now time.Time) []dedupRecord {
+	records := make([]dedupRecord, 0, s.order.Len())
+
+	for element := s.order.Back(); element != nil; element = element.Prev() {
+		entry := element.Value.(*dedupEntry)
+		if entry.expires.After(now) {
+			records = append(records, dedupRecord{ID: entry.id, Expires: entry.expires.UnixNano() / int64(time.Millisecond)})
+		}
+	}
+
+	return records
+}
+
+// FileDedupStore dedup store respaldado en un archivo local que sobrevive reinicios.
+// Los ids se agregan al final del archivo y se compacta descartando expirados al superar el doble de ids vigentes.
+type FileDedupStore struct {
+	memory *MemoryDedupStore
+	path   string
+	sync   bool
+
+	mu    sync.Mutex
+	file  *os.File
+	lines int
+}
+
+type dedupRecord struct {
+	ID      string `json:"id"`
+	Expires int64  `json:"expires"`
+}
+
+// NewFileDedupStore abre o crea el archivo de ids, capacity limita los ids en memoria (por defecto 100000)
+// y syncWrites realiza fsync por cada id registrado
+func NewFileDedupStore(path string, capacity int, syncWrites bool) (*FileDedupStore, error) {
+	store := &FileDedupStore{
+		memory: NewMemoryDedupStore(capacity),
+		path:   path,
+		sync:   syncWrites,
+	}
+
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	if err := store.compact(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Seen implementa DedupStore
+func (s *FileDedupStore) Seen(ctx context.Context, id string) (bool, error) {
+	return s.memory.Seen(ctx, id)
+}
+
+// Record implementa DedupStore
+func (s *FileDedupStore) Record(ctx context.Context, id string, ttl time.Duration) error {
+	expires := time.Now().Add(ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line, err := json.Marshal(dedupRecord{ID: id, Expires: expires.UnixNano() / int64(time.Millisecond)})
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	if s.sync {
+		if err := s.file.Sync(); err != nil {
+			return err
+		}
+	}
+
+	s.memory.mu.Lock()
+	s.memory.record(id, expires)
+	live := s.memory.order.Len()
+	s.memory.mu.Unlock()
+
+	s.lines++
+	if s.lines > dedupCompactMinimumLines && s.lines > 2*live {
+		return s.compactLocked()
+	}
+
+	return nil
+}
+
+// Close cierra el archivo del store
+func (s *FileDedupStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+func (s *FileDedupStore) load() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var record dedupRecord
+		// Una linea incompleta por una caida durante la escritura se descarta
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+
+		expires := time.Unix(0, record.Expires*int64(time.Millisecond))
+		if expires.After(now) {
+			s.memory.record(record.ID, expires)
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (s *FileDedupStore) compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.compactLocked()
+}
+
+// compactLocked reescribe el archivo con los ids vigentes y lo reemplaza de forma atomica
+func (s *FileDedupStore) compactLocked() error {
+	s.memory.mu.Lock()
+	records := s.memory.snapshot(time.Now())
+	s.memory.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".compact-*")
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// El archivo se abre antes de reemplazar el anterior, si falla se conserva el archivo y el handle actuales
+	file, err := os.OpenFile(tmp.Name(), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		file.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+
+	s.file = file
+	s.lines = len(records)
+
+	return nil
+}
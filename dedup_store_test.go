@@ -0,0 +1,119 @@
+package kafka_toolkit_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+func openDedupStore(t *testing.T, path string) *kafka.FileDedupStore {
+	t.Helper()
+
+	store, err := kafka.NewFileDedupStore(path, 0, false)
+	if err != nil {
+		t.Fatalf("error abriendo dedup store: %v", err)
+	}
+
+	return store
+}
+
+func assertSeen(t *testing.T, store kafka.DedupStore, id string, expected bool) {
+	t.Helper()
+
+	seen, err := store.Seen(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if seen != expected {
+		t.Errorf("id %s: se esperaba visto %v, se obtuvo %v", id, expected, seen)
+	}
+}
+
+func TestFileDedupStoreSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.log")
+
+	store := openDedupStore(t, path)
+	if err := store.Record(context.Background(), "evt-1", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// una linea incompleta por una caida durante la escritura se descarta
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"id":"evt-2","exp`)
+	file.Close()
+
+	store = openDedupStore(t, path)
+	defer store.Close()
+
+	assertSeen(t, store, "evt-1", true)
+	assertSeen(t, store, "evt-2", false)
+}
+
+func TestFileDedupStoreExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.log")
+
+	store := openDedupStore(t, path)
+	store.Record(context.Background(), "corto", 50*time.Millisecond)
+	store.Record(context.Background(), "largo", time.Hour)
+
+	assertSeen(t, store, "corto", true)
+
+	time.Sleep(100 * time.Millisecond)
+
+	assertSeen(t, store, "corto", false)
+	assertSeen(t, store, "largo", true)
+	store.Close()
+
+	store = openDedupStore(t, path)
+	defer store.Close()
+
+	assertSeen(t, store, "corto", false)
+	assertSeen(t, store, "largo", true)
+}
+
+func TestFileDedupStoreCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.log")
+
+	store := openDedupStore(t, path)
+
+	// el mismo id registrado muchas veces deja un solo id vigente y fuerza la compactacion
+	for i := 0; i < 1500; i++ {
+		if err := store.Record(context.Background(), "repetido", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.Record(context.Background(), "posterior", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := bytes.Count(content, []byte("\n")); lines > 1000 {
+		t.Errorf("se esperaba el archivo compactado, tiene %d lineas", lines)
+	}
+
+	store.Close()
+
+	// los ids registrados despues de compactar se escriben en el archivo nuevo
+	store = openDedupStore(t, path)
+	defer store.Close()
+
+	assertSeen(t, store, "repetido", true)
+	assertSeen(t, store, "posterior", true)
+}
@@ -0,0 +1,562 @@
+package kafka_toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	// DLQOriginalTopicHeader header con el topico original del mensaje fallido
+	DLQOriginalTopicHeader = "x-original-topic"
+	// DLQOriginalPartitionHeader header con la particion original del mensaje fallido
+	DLQOriginalPartitionHeader = "x-original-partition"
+	// DLQOriginalOffsetHeader header con el offset original del mensaje fallido
+	DLQOriginalOffsetHeader = "x-original-offset"
+	// DLQErrorHeader header con el texto del error
+	DLQErrorHeader = "x-error"
+	// DLQFailedAtHeader header con la fecha del error en RFC3339 o unix ms
+	DLQFailedAtHeader = "x-failed-at"
+)
+
+const defaultReplayIdleTimeout = 10 * time.Second
+
+// InvalidReplayCheckpointKind checkpoint de otro topico
+var InvalidReplayCheckpointKind = "Checkpoint de replay invalido, corresponde a otro topico"
+
+// DLQReplayFilter filtros de mensajes a reenviar, los filtros vacios no se aplican y todos deben cumplirse
+type DLQReplayFilter struct {
+	// ErrorContains texto contenido en el header de error
+	ErrorContains string
+	// OriginalPartitions particiones originales
+	OriginalPartitions []int32
+	// From y To rango de fecha del error (header de fecha o timestamp del mensaje), To exclusivo
+	From time.Time
+	To   time.Time
+	// Keys keys de mensaje
+	Keys []string
+	// Headers valores exactos de headers
+	Headers map[string]string
+}
+
+// DLQReplayHeaders nombres de los headers de metadata del dead-letter topic
+type DLQReplayHeaders struct {
+	OriginalTopic     string
+	OriginalPartition string
+	Error             string
+	FailedAt          string
+}
+
+// DLQReplayRecord mensaje leido del dead-letter topic y su destino, Target es nil si el mensaje se omite
+type DLQReplayRecord struct {
+	Source *ConsumerMessage
+	Target *ProducerMessage
+	Reason string
+}
+
+// DLQReplayConfig configuracion del replay de un dead-letter topic
+type DLQReplayConfig struct {
+	// TargetTopic topico de destino, vacio utiliza el header de topico original
+	TargetTopic string
+	// Headers nombres de headers de metadata, por defecto DLQOriginalTopicHeader, DLQOriginalPartitionHeader, etc.
+	Headers DLQReplayHeaders
+	Filter  DLQReplayFilter
+	// SetHeaders headers agregados o reemplazados en los mensajes reenviados
+	SetHeaders map[string]string
+	// RemoveHeaders headers eliminados de los mensajes reenviados
+	RemoveHeaders []string
+	// StripMetadataHeaders elimina los headers de metadata del dead-letter topic
+	StripMetadataHeaders bool
+	// Rate mensajes por segundo reenviados, 0 sin limite
+	Rate float64
+	// DryRun informa los mensajes que se reenviarian sin producirlos ni avanzar el checkpoint
+	DryRun bool
+	// Checkpoint offsets procesados por particion, permite retomar un replay interrumpido sin duplicados
+	Checkpoint ReplayCheckpoint
+	// Observer recibe cada mensaje leido, por ejemplo para listar el resultado de un dry-run
+	Observer func(DLQReplayRecord)
+	// IdleTimeout tiempo sin recibir mensajes tras el cual una particion se da por terminada aunque no se alcance
+	// el high-water mark, por ejemplo cuando los ultimos offsets son marcadores de transaccion. Por defecto 10 segundos
+	IdleTimeout time.Duration
+}
+
+// DLQReplaySummary resumen de un replay
+type DLQReplaySummary struct {
+	Read     int64
+	Replayed int64
+	Skipped  int64
+	// ByTopic mensajes reenviados (o a reenviar en dry-run) por topico de destino
+	ByTopic map[string]int64
+	// IdlePartitions particiones terminadas por IdleTimeout antes de alcanzar el high-water mark
+	IdlePartitions []int32
+	// Completed en false si el replay se interrumpio o alguna particion termino por inactividad antes de
+	// alcanzar el final del dead-letter topic
+	Completed bool
+}
+
+// ReplayCheckpoint almacena el proximo offset a procesar por particion de un topico
+type ReplayCheckpoint interface {
+	Load(topic string) (map[int32]int64, error)
+	Save(topic string, offsets map[int32]int64) error
+}
+
+// DLQReplayer reenvia los mensajes de un dead-letter topic hasta el high-water mark capturado al iniciar
+type DLQReplayer interface {
+	Run(ctx context.Context) (*DLQReplaySummary, error)
+}
+
+type dlqReplayer struct {
+	source         *ConsumerGroupConfig
+	client         sarama.Client
+	saramaProducer sarama.SyncProducer
+	producer       MessageProducer
+	limiter        *RateLimiter
+	config         DLQReplayConfig
+}
+
+// NewDLQReplayer crea el replayer, source indica el dead-letter topic y target la conexion del producer.
+// El producer no se crea en DryRun. Run cierra el cliente y el producer, por lo que el replayer se ejecuta una vez.
+func NewDLQReplayer(source ConsumerGroupInput, target BaseProducerConfigInput, config DLQReplayConfig) (DLQReplayer, error) {
+	if config.Headers.OriginalTopic == "" {
+		config.Headers.OriginalTopic = DLQOriginalTopicHeader
+	}
+
+	if config.Headers.OriginalPartition == "" {
+		config.Headers.OriginalPartition = DLQOriginalPartitionHeader
+	}
+
+	if config.Headers.Error == "" {
+		config.Headers.Error = DLQErrorHeader
+	}
+
+	if config.Headers.FailedAt == "" {
+		config.Headers.FailedAt = DLQFailedAtHeader
+	}
+
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaultReplayIdleTimeout
+	}
+
+	conf, err := NewSaramaConsumerConfigurer(NewBalanceStrategyResolver()).GenerateConfig(source)
+	if err != nil {
+		return nil, err
+	}
+
+	replayer := &dlqReplayer{source: conf, config: config}
+
+	if config.Rate > 0 {
+		replayer.limiter = NewRateLimiter(RateLimitConfig{Rate: config.Rate, Burst: 1})
+	}
+
+	if !config.DryRun {
+		if replayer.saramaProducer, err = newProducer(target); err != nil {
+			return nil, err
+		}
+
+		replayer.producer = NewBaseSaramaProducer(target.Topic, replayer.saramaProducer)
+	}
+
+	if replayer.client, err = sarama.NewClient(conf.Brokers, conf.SaramaConfig); err != nil {
+		replayer.closeProducer()
+		return nil, err
+	}
+
+	return replayer, nil
+}
+
+// Run procesa cada particion en orden de offset. Un error de envio detiene el replay, el checkpoint
+// queda en el mensaje fallido para reintentarlo en la siguiente ejecucion.
+func (r *dlqReplayer) Run(ctx context.Context) (*DLQReplaySummary, error) {
+	defer r.client.Close()
+	defer r.closeProducer()
+
+	summary := &DLQReplaySummary{ByTopic: make(map[string]int64)}
+	topic := r.source.Topic
+
+	offsets := make(map[int32]int64)
+	if r.config.Checkpoint != nil {
+		loaded, err := r.config.Checkpoint.Load(topic)
+		if err != nil {
+			return summary, err
+		}
+
+		for partition, offset := range loaded {
+			offsets[partition] = offset
+		}
+	}
+
+	partitions, err := r.client.Partitions(topic)
+	if err != nil {
+		return summary, err
+	}
+
+	endOffsets := make(map[int32]int64, len(partitions))
+	for _, partition := range partitions {
+		if endOffsets[partition], err = r.client.GetOffset(topic, partition, sarama.OffsetNewest); err != nil {
+			return summary, err
+		}
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(r.client)
+	if err != nil {
+		return summary, err
+	}
+	defer consumer.Close()
+
+	for _, partition := range partitions {
+		idle, err := r.replayPartition(ctx, consumer, partition, endOffsets[partition], offsets, summary)
+		if err != nil {
+			return summary, err
+		}
+
+		if idle {
+			summary.IdlePartitions = append(summary.IdlePartitions, partition)
+		}
+	}
+
+	summary.Completed = len(summary.IdlePartitions) == 0
+
+	Log.Info(
+		"message", "Replay de dead-letter topic finalizado",
+		"topic", topic,
+		"read", summary.Read,
+		"replayed", summary.Replayed,
+		"skipped", summary.Skipped,
+		"idle_partitions", summary.IdlePartitions,
+		"dry_run", r.config.DryRun)
+
+	return summary, nil
+}
+
+// replayPartition reenvia la particion hasta end, retorna true si termino por IdleTimeout antes de alcanzarlo
+func (r *dlqReplayer) replayPartition(ctx context.Context, consumer sarama.Consumer, partition int32, end int64, offsets map[int32]int64, summary *DLQReplaySummary) (bool, error) {
+	topic := r.source.Topic
+
+	start, err := r.client.GetOffset(topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return false, err
+	}
+
+	if checkpoint, ok := offsets[partition]; ok && checkpoint > start {
+		start = checkpoint
+	}
+
+	if start >= end {
+		return false, nil
+	}
+
+	partitionConsumer, err := consumer.ConsumePartition(topic, partition, start)
+	if err != nil {
+		return false, err
+	}
+	defer partitionConsumer.AsyncClose()
+
+	idle := time.NewTimer(r.config.IdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-idle.C:
+			// Los ultimos offsets pueden no existir (por ejemplo marcadores de transaccion),
+			// el checkpoint no avanza para no omitir mensajes si la inactividad se debe al broker
+			Log.Warn(
+				"message", "Replay de particion finalizado por inactividad",
+				"topic", topic,
+				"partition", partition,
+				"offset", offsets[partition],
+				"end", end)
+			return true, nil
+		case saramaMessage, ok := <-partitionConsumer.Messages():
+			if !ok {
+				return false, fmt.Errorf("particion %d cerrada antes del offset %d", partition, end)
+			}
+
+			if err := r.replayMessage(ctx, saramaToGenericMessage(saramaMessage), summary); err != nil {
+				return false, err
+			}
+
+			offsets[partition] = saramaMessage.Offset + 1
+			if !r.config.DryRun && r.config.Checkpoint != nil {
+				if err := r.config.Checkpoint.Save(topic, offsets); err != nil {
+					return false, err
+				}
+			}
+
+			if saramaMessage.Offset >= end-1 {
+				return false, nil
+			}
+
+			resetTimer(idle, r.config.IdleTimeout)
+		}
+	}
+}
+
+func (r *dlqReplayer) closeProducer() {
+	if r.saramaProducer == nil {
+		return
+	}
+
+	if err := r.saramaProducer.Close(); err != nil {
+		Log.Error(
+			"errorMessage", "Error cerrando producer de replay",
+			"error", err)
+	}
+}
+
+func (r *dlqReplayer) replayMessage(ctx context.Context, msg *ConsumerMessage, summary *DLQReplaySummary) error {
+	summary.Read++
+
+	record := DLQReplayRecord{Source: msg}
+	defer func() {
+		if r.config.Observer != nil {
+			r.config.Observer(record)
+		}
+	}()
+
+	if reason := r.filter(msg); reason != "" {
+		record.Reason = reason
+		summary.Skipped++
+		return nil
+	}
+
+	target := r.config.TargetTopic
+	if target == "" {
+		target = msg.Headers[r.config.Headers.OriginalTopic]
+	}
+
+	if target == "" {
+		Log.Warn(
+			"message", "Mensaje de dead-letter topic sin topico de destino",
+			"topic", msg.Topic,
+			"partition", msg.Partition,
+			"offset", msg.Offset)
+
+		record.Reason = "sin topico de destino"
+		summary.Skipped++
+		return nil
+	}
+
+	record.Target = &ProducerMessage{
+		Headers: r.rewriteHeaders(msg.Headers),
+		Key:     msg.Key,
+		Msg:     msg.Msg,
+		Topic:   target,
+	}
+
+	if !r.config.DryRun {
+		if r.limiter != nil {
+			if err := r.limiter.Wait(ctx, msg); err != nil {
+				return err
+			}
+		}
+
+		if err := r.producer.SendMessage(ctx, record.Target); err != nil {
+			return fmt.Errorf("error reenviando %s/%d@%d a %s: %v", msg.Topic, msg.Partition, msg.Offset, target, err)
+		}
+	}
+
+	summary.Replayed++
+	summary.ByTopic[target]++
+
+	return nil
+}
+
+// filter retorna el motivo por el que el mensaje se omite, vacio si cumple todos los filtros
+func (r *dlqReplayer) filter(msg *ConsumerMessage) string {
+	filter := r.config.Filter
+
+	if filter.ErrorContains != "" && !strings.Contains(msg.Headers[r.config.Headers.Error], filter.ErrorContains) {
+		return "error no coincide"
+	}
+
+	if len(filter.OriginalPartitions) > 0 {
+		partition, err := strconv.ParseInt(msg.Headers[r.config.Headers.OriginalPartition], 10, 32)
+		if err != nil || !containsPartition(filter.OriginalPartitions, int32(partition)) {
+			return "particion original no coincide"
+		}
+	}
+
+	if !filter.From.IsZero() || !filter.To.IsZero() {
+		failedAt := r.failedAt(msg)
+		if (!filter.From.IsZero() && failedAt.Before(filter.From)) || (!filter.To.IsZero() && !failedAt.Before(filter.To)) {
+			return "fuera del rango de fechas"
+		}
+	}
+
+	if len(filter.Keys) > 0 && !containsString(filter.Keys, string(msg.Key)) {
+		return "key no coincide"
+	}
+
+	for header, value := range filter.Headers {
+		if msg.Headers[header] != value {
+			return fmt.Sprintf("header %s no coincide", header)
+		}
+	}
+
+	return ""
+}
+
+// failedAt fecha del error desde el header, si no viene o es invalido se utiliza el timestamp del mensaje
+func (r *dlqReplayer) failedAt(msg *ConsumerMessage) time.Time {
+	value := msg.Headers[r.config.Headers.FailedAt]
+
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, ms*int64(time.Millisecond))
+	}
+
+	if ts, err := time.Parse(time.RFC3339, value); err == nil {
+		return ts
+	}
+
+	return msg.Timestamp
+}
+
+func (r *dlqReplayer) rewriteHeaders(headers map[string]string) map[string]string {
+	rewritten := make(map[string]string, len(headers)+len(r.config.SetHeaders))
+	for k, v := range headers {
+		rewritten[k] = v
+	}
+
+	if r.config.StripMetadataHeaders {
+		for _, header := range []string{r.config.Headers.OriginalTopic, r.config.Headers.OriginalPartition,
+			DLQOriginalOffsetHeader, r.config.Headers.Error, r.config.Headers.FailedAt} {
+			delete(rewritten, header)
+		}
+	}
+
+	for _, header := range r.config.RemoveHeaders {
+		delete(rewritten, header)
+	}
+
+	for k, v := range r.config.SetHeaders {
+		rewritten[k] = v
+	}
+
+	return rewritten
+}
+
+// fileReplayCheckpoint checkpoint en archivo JSON, cada Save reemplaza el archivo de forma atomica
+type fileReplayCheckpoint struct {
+	mu   sync.Mutex
+	path string
+}
+
+type replayCheckpointFile struct {
+	Topic   string           `json:"topic"`
+	Offsets map[string]int64 `json:"offsets"`
+}
+
+// NewFileReplayCheckpoint checkpoint en archivo, si el archivo no existe el replay inicia desde el principio
+func NewFileReplayCheckpoint(path string) ReplayCheckpoint {
+	return &fileReplayCheckpoint{path: path}
+}
+
+func (c *fileReplayCheckpoint) Load(topic string) (map[int32]int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	content, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return map[int32]int64{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file replayCheckpointFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+
+	if file.Topic != topic {
+		return nil, errors.New(InvalidReplayCheckpointKind)
+	}
+
+	offsets := make(map[int32]int64, len(file.Offsets))
+	for key, offset := range file.Offsets {
+		partition, err := strconv.ParseInt(key, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		offsets[int32(partition)] = offset
+	}
+
+	return offsets, nil
+}
+
+func (c *fileReplayCheckpoint) Save(topic string, offsets map[int32]int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	file := replayCheckpointFile{Topic: topic, Offsets: make(map[string]int64, len(offsets))}
+	for partition, offset := range offsets {
+		file.Offsets[strconv.Itoa(int(partition))] = offset
+	}
+
+	content, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(c.path, content)
+}
+
+// writeFileAtomic escribe en un archivo temporal del mismo directorio, sincroniza y lo renombra
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func containsPartition(partitions []int32, partition int32) bool {
+	for _, p := range partitions {
+		if p == partition {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
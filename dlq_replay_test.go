@@ -0,0 +1,277 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+var dlqBaseTime = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+func newDLQCluster(t *testing.T, records ...kafkatest.MockRecord) *kafkatest.MockCluster {
+	t.Helper()
+
+	cluster := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{
+		"payments-dlq": 1,
+		"payments":     1,
+		"refunds":      1,
+	}})
+	cluster.SetRecords("payments-dlq", 0, records...)
+
+	return cluster
+}
+
+// dlqRecord mensaje de dead-letter topic, headers vacios no se agregan
+func dlqRecord(key string, timestamp time.Time, headers map[string]string) kafkatest.MockRecord {
+	record := kafkatest.MockRecord{
+		Key:       []byte(key),
+		Value:     []byte("value-" + key),
+		Headers:   make(map[string]string),
+		Timestamp: timestamp,
+	}
+
+	for name, value := range headers {
+		if value != "" {
+			record.Headers[name] = value
+		}
+	}
+
+	return record
+}
+
+// runDLQReplay ejecuta el replay y retorna el resumen y los registros informados al observer
+func runDLQReplay(t *testing.T, cluster *kafkatest.MockCluster, config kafka.DLQReplayConfig) (*kafka.DLQReplaySummary, []kafka.DLQReplayRecord, error) {
+	t.Helper()
+
+	var records []kafka.DLQReplayRecord
+	config.Observer = func(record kafka.DLQReplayRecord) {
+		records = append(records, record)
+	}
+
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = kafkatest.DefaultTimeout
+	}
+
+	replayer, err := kafka.NewDLQReplayer(cluster.ConsumerInput("payments-dlq", "replay"), cluster.ProducerInput(""), config)
+	if err != nil {
+		t.Fatalf("error creando replayer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kafkatest.DefaultTimeout)
+	defer cancel()
+
+	summary, err := replayer.Run(ctx)
+
+	return summary, records, err
+}
+
+func replayedKeys(records []kafka.DLQReplayRecord) []string {
+	keys := []string{}
+	for _, record := range records {
+		if record.Target != nil {
+			keys = append(keys, string(record.Target.Key))
+		}
+	}
+
+	return keys
+}
+
+func TestDLQReplayFilters(t *testing.T) {
+	records := []kafkatest.MockRecord{
+		dlqRecord("k0", dlqBaseTime, map[string]string{
+			kafka.DLQOriginalTopicHeader:     "payments",
+			kafka.DLQOriginalPartitionHeader: "0",
+			kafka.DLQErrorHeader:             "timeout llamando api",
+			kafka.DLQFailedAtHeader:          dlqBaseTime.Format(time.RFC3339),
+			"tenant":                         "a",
+		}),
+		dlqRecord("k1", dlqBaseTime, map[string]string{
+			kafka.DLQOriginalTopicHeader:     "payments",
+			kafka.DLQOriginalPartitionHeader: "1",
+			kafka.DLQErrorHeader:             "payload invalido",
+			kafka.DLQFailedAtHeader:          strconv.FormatInt(dlqBaseTime.Add(24*time.Hour).UnixNano()/int64(time.Millisecond), 10),
+			"tenant":                         "b",
+		}),
+		// sin header de fecha se utiliza el timestamp del mensaje
+		dlqRecord("k2", dlqBaseTime.Add(50*time.Hour), map[string]string{
+			kafka.DLQOriginalTopicHeader:     "payments",
+			kafka.DLQOriginalPartitionHeader: "1",
+			kafka.DLQErrorHeader:             "timeout",
+			"tenant":                         "a",
+		}),
+		// sin topico de destino se omite
+		dlqRecord("k3", dlqBaseTime, map[string]string{
+			kafka.DLQOriginalPartitionHeader: "0",
+			kafka.DLQErrorHeader:             "timeout",
+			kafka.DLQFailedAtHeader:          dlqBaseTime.Format(time.RFC3339),
+			"tenant":                         "a",
+		}),
+	}
+
+	tests := []struct {
+		name     string
+		filter   kafka.DLQReplayFilter
+		expected []string
+	}{
+		{name: "sin filtros", expected: []string{"k0", "k1", "k2"}},
+		{name: "error", filter: kafka.DLQReplayFilter{ErrorContains: "timeout"}, expected: []string{"k0", "k2"}},
+		{name: "particion original", filter: kafka.DLQReplayFilter{OriginalPartitions: []int32{1}}, expected: []string{"k1", "k2"}},
+		{name: "rango de fechas", filter: kafka.DLQReplayFilter{From: dlqBaseTime.Add(time.Hour), To: dlqBaseTime.Add(50 * time.Hour)}, expected: []string{"k1"}},
+		{name: "keys", filter: kafka.DLQReplayFilter{Keys: []string{"k0", "k1"}}, expected: []string{"k0", "k1"}},
+		{name: "headers", filter: kafka.DLQReplayFilter{Headers: map[string]string{"tenant": "a"}}, expected: []string{"k0", "k2"}},
+		{name: "combinados", filter: kafka.DLQReplayFilter{ErrorContains: "timeout", OriginalPartitions: []int32{1}}, expected: []string{"k2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cluster := newDLQCluster(t, records...)
+
+			summary, observed, err := runDLQReplay(t, cluster, kafka.DLQReplayConfig{Filter: test.filter, DryRun: true})
+			if err != nil {
+				t.Fatalf("error de replay: %v", err)
+			}
+
+			if keys := replayedKeys(observed); !reflect.DeepEqual(keys, test.expected) {
+				t.Errorf("keys a reenviar: se esperaba %v, se obtuvo %v", test.expected, keys)
+			}
+
+			if summary.Read != 4 || summary.Replayed != int64(len(test.expected)) || summary.Skipped != int64(4-len(test.expected)) {
+				t.Errorf("resumen: %+v", summary)
+			}
+		})
+	}
+}
+
+func TestDLQReplayRewritesHeaders(t *testing.T) {
+	cluster := newDLQCluster(t, dlqRecord("k0", dlqBaseTime, map[string]string{
+		kafka.DLQOriginalTopicHeader:     "payments",
+		kafka.DLQOriginalPartitionHeader: "0",
+		kafka.DLQOriginalOffsetHeader:    "10",
+		kafka.DLQErrorHeader:             "timeout",
+		kafka.DLQFailedAtHeader:          dlqBaseTime.Format(time.RFC3339),
+		"tenant":                         "a",
+		"trace":                          "abc",
+		"attempt":                        "1",
+	}))
+
+	_, observed, err := runDLQReplay(t, cluster, kafka.DLQReplayConfig{
+		TargetTopic:          "refunds",
+		SetHeaders:           map[string]string{"x-replayed": "true", "attempt": "2"},
+		RemoveHeaders:        []string{"tenant"},
+		StripMetadataHeaders: true,
+		DryRun:               true,
+	})
+	if err != nil {
+		t.Fatalf("error de replay: %v", err)
+	}
+
+	if len(observed) != 1 || observed[0].Target == nil {
+		t.Fatalf("se esperaba un mensaje a reenviar, se obtuvo %+v", observed)
+	}
+
+	target := observed[0].Target
+	expected := map[string]string{"trace": "abc", "attempt": "2", "x-replayed": "true"}
+
+	if target.Topic != "refunds" || !reflect.DeepEqual(target.Headers, expected) {
+		t.Errorf("destino: se esperaba refunds con headers %v, se obtuvo %s con %v", expected, target.Topic, target.Headers)
+	}
+}
+
+func TestDLQReplayResumesFromCheckpoint(t *testing.T) {
+	headers := func(topic string) map[string]string {
+		return map[string]string{kafka.DLQOriginalTopicHeader: topic}
+	}
+
+	cluster := newDLQCluster(t,
+		dlqRecord("k0", dlqBaseTime, headers("payments")),
+		dlqRecord("k1", dlqBaseTime, headers("payments")),
+		dlqRecord("k2", dlqBaseTime, headers("refunds")),
+		dlqRecord("k3", dlqBaseTime, headers("refunds")))
+	cluster.SetProduceError("refunds", 0, sarama.ErrMessageSizeTooLarge)
+
+	checkpoint := kafka.NewFileReplayCheckpoint(filepath.Join(t.TempDir(), "checkpoint"))
+
+	summary, _, err := runDLQReplay(t, cluster, kafka.DLQReplayConfig{Checkpoint: checkpoint})
+	if err == nil {
+		t.Fatalf("se esperaba error de envio a refunds")
+	}
+
+	if summary.Completed || summary.Replayed != 2 {
+		t.Errorf("primer replay: se esperaban 2 mensajes reenviados sin completar, se obtuvo %+v", summary)
+	}
+
+	offsets, err := checkpoint.Load("payments-dlq")
+	if err != nil || offsets[0] != 2 {
+		t.Fatalf("checkpoint: se esperaba el offset 2, se obtuvo %v (%v)", offsets, err)
+	}
+
+	cluster.SetProduceError("refunds", 0, sarama.ErrNoError)
+
+	summary, observed, err := runDLQReplay(t, cluster, kafka.DLQReplayConfig{Checkpoint: checkpoint})
+	if err != nil {
+		t.Fatalf("error de replay: %v", err)
+	}
+
+	if keys := replayedKeys(observed); !reflect.DeepEqual(keys, []string{"k2", "k3"}) {
+		t.Errorf("segundo replay: se esperaba reenviar [k2 k3], se obtuvo %v", keys)
+	}
+
+	if !summary.Completed || summary.Read != 2 || summary.ByTopic["refunds"] != 2 {
+		t.Errorf("segundo replay: %+v", summary)
+	}
+}
+
+func TestDLQReplayRate(t *testing.T) {
+	headers := map[string]string{kafka.DLQOriginalTopicHeader: "payments"}
+	cluster := newDLQCluster(t,
+		dlqRecord("k0", dlqBaseTime, headers),
+		dlqRecord("k1", dlqBaseTime, headers),
+		dlqRecord("k2", dlqBaseTime, headers),
+		dlqRecord("k3", dlqBaseTime, headers))
+
+	begin := time.Now()
+
+	summary, _, err := runDLQReplay(t, cluster, kafka.DLQReplayConfig{Rate: 20})
+	if err != nil {
+		t.Fatalf("error de replay: %v", err)
+	}
+
+	// 4 mensajes a 20 por segundo sin rafaga requieren al menos 150ms
+	if elapsed := time.Since(begin); elapsed < 140*time.Millisecond {
+		t.Errorf("el replay no respeto el rate: %v", elapsed)
+	}
+
+	if summary.Replayed != 4 {
+		t.Errorf("se esperaban 4 mensajes reenviados, se obtuvo %+v", summary)
+	}
+}
+
+func TestDLQReplayReportsIdlePartitions(t *testing.T) {
+	cluster := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{"payments-dlq": 1}})
+	cluster.SetMessages("payments-dlq", 0, "a", "b")
+	cluster.SetHighWaterMark("payments-dlq", 0, 3)
+
+	summary, records, err := runDLQReplay(t, cluster, kafka.DLQReplayConfig{
+		TargetTopic: "payments",
+		DryRun:      true,
+		IdleTimeout: 500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("el replay no termino con marcadores al final de la particion: %v", err)
+	}
+
+	if summary.Read != 2 || len(records) != 2 {
+		t.Errorf("resumen: se esperaban 2 mensajes leidos, se obtuvo %+v", summary)
+	}
+
+	if summary.Completed || !reflect.DeepEqual(summary.IdlePartitions, []int32{0}) {
+		t.Errorf("se esperaba la particion 0 terminada por inactividad sin completar, se obtuvo %+v", summary)
+	}
+}
@@ -18,4 +18,6 @@ type ProducerMessage struct {
 	Headers map[string]string
 	Key     []byte
 	Msg     []byte
+	// Topic topico de destino, vacio utiliza el topico del producer
+	Topic string
 }
@@ -21,4 +21,18 @@ const (
 	InvalidProducerInputConfigKind = "Configuracion de Producer invalida"
 	//InvalidConsumerInputConfigKind Configuracion de producer invalida
 	InvalidConsumerInputConfigKind = "Configuracion de Consumer invalida"
+	//InvalidStaticMembershipKind static membership requiere version de Kafka 2.3 o superior
+	InvalidStaticMembershipKind = "Static membership (group.instance.id) requiere Kafka 2.3 o superior"
+	//InvalidGroupInstanceIDKind group instance id con caracteres invalidos
+	InvalidGroupInstanceIDKind = "Group instance id invalido, solo se permiten caracteres alfanumericos, '.', '_' y '-'"
+	//InvalidRackIDKind fetch desde replica mas cercana requiere version de Kafka 2.4 o superior
+	InvalidRackIDKind = "Rack ID (client.rack) requiere Kafka 2.4 o superior"
+	//CircuitOpenErrorKind error retornado mientras el circuit breaker esta abierto
+	CircuitOpenErrorKind = "Circuit breaker abierto"
+	//HandlerPanicErrorKind panic recuperado en message handler
+	HandlerPanicErrorKind = "Panic en message handler"
+	//HandlerTimeoutErrorKind message handler excedio el tiempo maximo de procesamiento
+	HandlerTimeoutErrorKind = "Tiempo maximo de procesamiento de mensaje excedido"
+	//HandlerAbandonedErrorKind message handler sin finalizar luego del tiempo maximo y la espera adicional
+	HandlerAbandonedErrorKind = "Message handler no finalizo luego del tiempo maximo de procesamiento"
 )
@@ -0,0 +1,19 @@
+package kafka_toolkit
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/go-kit/kit/metrics"
+)
+
+// ResolveResetOffset expone resolveResetOffset para los tests del paquete kafka_toolkit_test
+var ResolveResetOffset = resolveResetOffset
+
+// NewTestPausableConsumer consumer pausable sobre group como lo construye MakeSaramaConsumerBuilder, junto al
+// handler de sesion que comparte su estado de pausa para simular los claims posteriores a un rebalanceo
+func NewTestPausableConsumer(group sarama.ConsumerGroup, gauge metrics.Gauge) (PausableKafkaConsumer, sarama.ConsumerGroupHandler) {
+	consumer := NewBaseConsumer(nil, nil)
+	consumer.group = group
+	consumer.pause.gauge = gauge
+
+	return &saramaKafkaConsumer{consumer: consumer, client: group}, &consumer
+}
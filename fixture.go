@@ -0,0 +1,292 @@
+package kafka_toolkit
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// FixtureEncodingText contenido como texto UTF-8
+	FixtureEncodingText = "text"
+	// FixtureEncodingBase64 contenido binario en base64
+	FixtureEncodingBase64 = "base64"
+)
+
+// FixtureRecord registro de un fixture en formato JSON Lines, un registro por linea
+type FixtureRecord struct {
+	Key           string            `json:"key,omitempty"`
+	KeyEncoding   string            `json:"key_encoding,omitempty"`
+	Value         string            `json:"value"`
+	ValueEncoding string            `json:"value_encoding,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Timestamp     time.Time         `json:"timestamp"`
+	Topic         string            `json:"topic"`
+	Partition     int32             `json:"partition"`
+	Offset        int64             `json:"offset"`
+}
+
+// NewFixtureRecord convierte el mensaje a registro de fixture, key y valor que no son UTF-8 se codifican en base64
+func NewFixtureRecord(msg *ConsumerMessage) FixtureRecord {
+	key, keyEncoding := EncodeFixtureBytes(msg.Key)
+	value, valueEncoding := EncodeFixtureBytes(msg.Msg)
+
+	return FixtureRecord{
+		Key:           key,
+		KeyEncoding:   keyEncoding,
+		Value:         value,
+		ValueEncoding: valueEncoding,
+		Headers:       msg.Headers,
+		Timestamp:     msg.Timestamp,
+		Topic:         msg.Topic,
+		Partition:     msg.Partition,
+		Offset:        msg.Offset,
+	}
+}
+
+// ConsumerMessage convierte el registro a mensaje consumido
+func (r FixtureRecord) ConsumerMessage() (*ConsumerMessage, error) {
+	key, err := DecodeFixtureBytes(r.Key, r.KeyEncoding)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := DecodeFixtureBytes(r.Value, r.ValueEncoding)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := r.Headers
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+
+	return &ConsumerMessage{
+		Headers:   headers,
+		Timestamp: r.Timestamp,
+		Key:       key,
+		Msg:       value,
+		Topic:     r.Topic,
+		Partition: r.Partition,
+		Offset:    r.Offset,
+	}, nil
+}
+
+// EncodeFixtureBytes codifica el contenido como texto si es UTF-8 valido o en base64 en caso contrario
+func EncodeFixtureBytes(content []byte) (string, string) {
+	if content == nil {
+		return "", ""
+	}
+
+	if utf8.Valid(content) {
+		return string(content), FixtureEncodingText
+	}
+
+	return base64.StdEncoding.EncodeToString(content), FixtureEncodingBase64
+}
+
+// DecodeFixtureBytes decodifica el contenido segun su encoding, sin encoding se interpreta como texto
+func DecodeFixtureBytes(content string, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		if content == "" {
+			return nil, nil
+		}
+		return []byte(content), nil
+	case FixtureEncodingText:
+		return []byte(content), nil
+	case FixtureEncodingBase64:
+		return base64.StdEncoding.DecodeString(content)
+	default:
+		return nil, fmt.Errorf("encoding de fixture desconocido: %s", encoding)
+	}
+}
+
+// ReadFixture lee los mensajes de un fixture JSON Lines, las lineas vacias se ignoran
+func ReadFixture(reader io.Reader) ([]*ConsumerMessage, error) {
+	var messages []*ConsumerMessage
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record FixtureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("fixture linea %d: %v", line, err)
+		}
+
+		message, err := record.ConsumerMessage()
+		if err != nil {
+			return nil, fmt.Errorf("fixture linea %d: %v", line, err)
+		}
+
+		messages = append(messages, message)
+	}
+
+	return messages, scanner.Err()
+}
+
+// ReadFixtureFile lee los mensajes de un archivo de fixture
+func ReadFixtureFile(path string) ([]*ConsumerMessage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadFixture(file)
+}
+
+// FixtureRecorderConfig configuracion del recorder de fixtures
+type FixtureRecorderConfig struct {
+	// Path archivo JSON Lines donde se agregan los mensajes
+	Path string
+	// SampleRate fraccion de mensajes a registrar entre 0 y 1, por defecto 1
+	SampleRate float64
+	// MaxRecords cantidad maxima de mensajes a registrar, 0 sin limite
+	MaxRecords int
+	// RedactHeaders headers que no se registran, por ejemplo credenciales
+	RedactHeaders []string
+}
+
+// FixtureRecorder registra una muestra de los mensajes consumidos en un archivo de fixture
+type FixtureRecorder struct {
+	mu       sync.Mutex
+	config   FixtureRecorderConfig
+	file     *os.File
+	random   *rand.Rand
+	recorded int
+}
+
+// NewFixtureRecorder abre el archivo de fixture, los mensajes se agregan al final
+func NewFixtureRecorder(config FixtureRecorderConfig) (*FixtureRecorder, error) {
+	if config.SampleRate <= 0 || config.SampleRate > 1 {
+		config.SampleRate = 1
+	}
+
+	file, err := os.OpenFile(config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FixtureRecorder{
+		config: config,
+		file:   file,
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// Record registra el mensaje si corresponde a la muestra
+func (r *FixtureRecorder) Record(msg *ConsumerMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+
+	if r.config.MaxRecords > 0 && r.recorded >= r.config.MaxRecords {
+		return nil
+	}
+
+	if r.config.SampleRate < 1 && r.random.Float64() >= r.config.SampleRate {
+		return nil
+	}
+
+	record := NewFixtureRecord(msg)
+	if len(r.config.RedactHeaders) > 0 && len(record.Headers) > 0 {
+		record.Headers = redactHeaders(record.Headers, r.config.RedactHeaders)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	r.recorded++
+
+	return nil
+}
+
+// Recorded cantidad de mensajes registrados
+func (r *FixtureRecorder) Recorded() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.recorded
+}
+
+// Close cierra el archivo de fixture, los mensajes posteriores no se registran
+func (r *FixtureRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+
+	return err
+}
+
+func redactHeaders(headers map[string]string, redacted []string) map[string]string {
+	copied := make(map[string]string, len(headers))
+	for k, v := range headers {
+		copied[k] = v
+	}
+
+	for _, header := range redacted {
+		delete(copied, header)
+	}
+
+	return copied
+}
+
+type fixtureRecorderMessageHandler struct {
+	next     MessageHandler
+	recorder *FixtureRecorder
+}
+
+// MakeFixtureRecorderMessageHandlerMiddleware registra en el fixture una muestra de los mensajes recibidos antes de
+// procesarlos, un error al registrar se informa en log y no afecta el procesamiento
+func MakeFixtureRecorderMessageHandlerMiddleware(recorder *FixtureRecorder) MessageHandlerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		return &fixtureRecorderMessageHandler{
+			next:     next,
+			recorder: recorder,
+		}
+	}
+}
+
+func (h *fixtureRecorderMessageHandler) HandleMessage(ctx context.Context, msg *ConsumerMessage) error {
+	if err := h.recorder.Record(msg); err != nil {
+		Log.Error(
+			"errorMessage", "Error registrando mensaje en fixture",
+			"topic", msg.Topic,
+			"partition", msg.Partition,
+			"offset", msg.Offset,
+			"error", err)
+	}
+
+	return h.next.HandleMessage(ctx, msg)
+}
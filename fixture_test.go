@@ -0,0 +1,205 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+func fixtureMessage(offset int64, headers map[string]string) *kafka.ConsumerMessage {
+	return &kafka.ConsumerMessage{
+		Topic:     "orders",
+		Partition: 1,
+		Offset:    offset,
+		Key:       []byte("key"),
+		Msg:       []byte("value"),
+		Headers:   headers,
+		Timestamp: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestFixtureRecordRoundTrip(t *testing.T) {
+	tests := []struct {
+		name          string
+		key           []byte
+		value         []byte
+		keyEncoding   string
+		valueEncoding string
+	}{
+		{name: "texto", key: []byte("o-1"), value: []byte(`{"id":1}`), keyEncoding: kafka.FixtureEncodingText, valueEncoding: kafka.FixtureEncodingText},
+		{name: "binario", key: []byte("o-1"), value: []byte{0xff, 0xfe, 0x00}, keyEncoding: kafka.FixtureEncodingText, valueEncoding: kafka.FixtureEncodingBase64},
+		{name: "sin key", value: []byte("v"), valueEncoding: kafka.FixtureEncodingText},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := fixtureMessage(7, map[string]string{"tenant": "a"})
+			msg.Key = test.key
+			msg.Msg = test.value
+
+			record := kafka.NewFixtureRecord(msg)
+			if record.KeyEncoding != test.keyEncoding || record.ValueEncoding != test.valueEncoding {
+				t.Errorf("encodings: se esperaba %q/%q, se obtuvo %q/%q", test.keyEncoding, test.valueEncoding,
+					record.KeyEncoding, record.ValueEncoding)
+			}
+
+			line, err := json.Marshal(record)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var decoded kafka.FixtureRecord
+			if err := json.Unmarshal(line, &decoded); err != nil {
+				t.Fatal(err)
+			}
+
+			restored, err := decoded.ConsumerMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(restored, msg) {
+				t.Errorf("se esperaba %+v, se obtuvo %+v", msg, restored)
+			}
+		})
+	}
+}
+
+func TestReadFixture(t *testing.T) {
+	fixture := `{"key":"a","value":"1","timestamp":"2024-01-01T10:00:00Z","topic":"orders","partition":0,"offset":1}
+
+{"value":"//4=","value_encoding":"base64","timestamp":"2024-01-01T10:00:00Z","topic":"orders","partition":0,"offset":2}
+`
+
+	msgs, err := kafka.ReadFixture(strings.NewReader(fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msgs) != 2 || string(msgs[0].Key) != "a" || msgs[1].Key != nil || !reflect.DeepEqual(msgs[1].Msg, []byte{0xff, 0xfe}) {
+		t.Errorf("mensajes leidos: %+v", msgs)
+	}
+
+	_, err = kafka.ReadFixture(strings.NewReader(fixture + `{"value":"x","value_encoding":"hex"}` + "\n"))
+	if err == nil || !strings.Contains(err.Error(), "linea 4") {
+		t.Errorf("se esperaba error en la linea 4, se obtuvo %v", err)
+	}
+}
+
+func TestFixtureRecorderMaxRecordsAndRedaction(t *testing.T) {
+	kafkatest.EnsureLogger()
+
+	path := filepath.Join(t.TempDir(), "fixture.jsonl")
+	recorder, err := kafka.NewFixtureRecorder(kafka.FixtureRecorderConfig{
+		Path:          path,
+		MaxRecords:    2,
+		RedactHeaders: []string{"authorization"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handled := 0
+	handler := kafka.MakeFixtureRecorderMessageHandlerMiddleware(recorder)(kafkatest.HandlerFunc(
+		func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+			handled++
+			return nil
+		}))
+
+	headers := map[string]string{"authorization": "Bearer secreto", "tenant": "a"}
+	for offset := int64(0); offset < 3; offset++ {
+		if err := handler.HandleMessage(context.Background(), fixtureMessage(offset, headers)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if handled != 3 || recorder.Recorded() != 2 {
+		t.Errorf("se esperaban 3 mensajes procesados y 2 registrados, se obtuvo %d y %d", handled, recorder.Recorded())
+	}
+
+	if headers["authorization"] == "" {
+		t.Errorf("se modificaron los headers del mensaje original")
+	}
+
+	msgs, err := kafka.ReadFixtureFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msgs) != 2 || msgs[0].Offset != 0 || msgs[1].Offset != 1 {
+		t.Fatalf("fixture: se esperaban los offsets 0 y 1, se obtuvo %+v", msgs)
+	}
+
+	for _, msg := range msgs {
+		if !reflect.DeepEqual(msg.Headers, map[string]string{"tenant": "a"}) {
+			t.Errorf("headers registrados: %v", msg.Headers)
+		}
+	}
+}
+
+func TestFixtureRecorderSampling(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampleRate float64
+		min        int
+		max        int
+	}{
+		{name: "por defecto registra todo", sampleRate: 0, min: 1000, max: 1000},
+		{name: "mitad", sampleRate: 0.5, min: 400, max: 600},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder, err := kafka.NewFixtureRecorder(kafka.FixtureRecorderConfig{
+				Path:       filepath.Join(t.TempDir(), "fixture.jsonl"),
+				SampleRate: test.sampleRate,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer recorder.Close()
+
+			for offset := int64(0); offset < 1000; offset++ {
+				if err := recorder.Record(fixtureMessage(offset, nil)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := recorder.Recorded(); got < test.min || got > test.max {
+				t.Errorf("registrados: se esperaba entre %d y %d, se obtuvo %d", test.min, test.max, got)
+			}
+		})
+	}
+}
+
+func TestFixtureRecorderIgnoresMessagesAfterClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixture.jsonl")
+	recorder, err := kafka.NewFixtureRecorder(kafka.FixtureRecorderConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := recorder.Record(fixtureMessage(0, nil)); err != nil || recorder.Recorded() != 0 {
+		t.Errorf("se esperaba ignorar el mensaje, se obtuvo %v con %d registrados", err, recorder.Recorded())
+	}
+
+	if content, err := os.ReadFile(path); err != nil || len(content) != 0 {
+		t.Errorf("fixture: se esperaba vacio, se obtuvo %q (%v)", content, err)
+	}
+}
@@ -8,6 +8,7 @@ require (
 	github.com/go-kit/kit v0.12.0
 	github.com/go-kit/log v0.2.0
 	github.com/go-playground/validator/v10 v10.5.0 // indirect
+	github.com/klauspost/compress v1.15.6
 	github.com/leodido/go-urn v1.2.1 // indirect
 	github.com/oklog/run v1.1.0 // indirect
 	github.com/opentracing/opentracing-go v1.2.0
@@ -16,4 +17,5 @@ require (
 	github.com/validatecl/go-microservices-commons v1.0.13
 	github.com/xdg-go/scram v1.1.1
 	gopkg.in/DataDog/dd-trace-go.v1 v1.35.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -2,44 +2,108 @@ package kafka_toolkit
 
 import (
 	"crypto/tls"
-	"crypto/x509"
 	"errors"
-	"io/ioutil"
+	"time"
 
 	"github.com/Shopify/sarama"
 )
 
 var (
 	InvalidUsernamePassword = "Usuario o Contraseña viene sin información"
+	InvalidCaFile           = "CA file no contiene certificados PEM validos"
+	InvalidClientCertKey    = "Certificado y llave de cliente deben venir ambos con información"
+	InvalidTLSMinVersion    = "Version minima de TLS invalida, debe ser una de: 1.0, 1.1, 1.2, 1.3"
 )
 
+// KafkaSASLSecurity configuracion SASL, CaFile se mantiene por compatibilidad con SaramaSASLConfig
 type KafkaSASLSecurity struct {
 	Username      string
 	Password      string
 	CaFile        string
 	MechanismSASL string
+	// Campos de OAUTHBEARER, con OAuthTokenURL Username y Password se usan como client id y secret
+	TokenProvider  TokenProvider
+	OAuthTokenURL  string
+	OAuthScopes    []string
+	OAuthTokenFile string
 }
 
-// SaramaTLSConfig retorna TLS config
+// KafkaTLSSecurity configuracion TLS independiente de SASL
+type KafkaTLSSecurity struct {
+	// CaFile bundle PEM de CAs, si viene vacio se utilizan las CAs del sistema
+	CaFile string
+	// CertFile y KeyFile certificado de cliente para mutual TLS
+	CertFile string
+	KeyFile  string
+	// ServerName sobreescribe el nombre de servidor a verificar
+	ServerName string
+	// MinVersion version minima de TLS (1.0, 1.1, 1.2, 1.3), por defecto 1.2
+	MinVersion string
+	// InsecureSkipVerify desactiva la verificacion del certificado del broker
+	InsecureSkipVerify bool
+	// ReloadInterval frecuencia con la que se revisa si los archivos en disco cambiaron, 0 desactiva recarga
+	ReloadInterval time.Duration
+}
+
+// KafkaSecurity configuracion de seguridad, TLS y SASL son opcionales e independientes
+type KafkaSecurity struct {
+	TLS  *KafkaTLSSecurity
+	SASL *KafkaSASLSecurity
+}
+
+// SaramaTLSConfig retorna TLS config verificando el certificado del broker contra caFile
 func SaramaTLSConfig(caFile string) (*tls.Config, error) {
-	ca, err := ioutil.ReadFile(caFile)
-	if err != nil {
-		return nil, err
-	}
-	certPool := x509.NewCertPool()
-	certPool.AppendCertsFromPEM(ca)
-	tlsConfig := new(tls.Config)
-	tlsConfig.RootCAs = certPool
-	tlsConfig.InsecureSkipVerify = true
-	return tlsConfig, nil
+	return NewTLSConfig(KafkaTLSSecurity{CaFile: caFile})
 }
 
+// SaramaSASLConfig retorna configuracion SASL sobre TLS utilizando el CaFile del input
 func SaramaSASLConfig(input KafkaSASLSecurity) (*sarama.Config, error) {
-	var err error
+	return SaramaSecurityConfig(KafkaSecurity{
+		SASL: &input,
+		TLS:  &KafkaTLSSecurity{CaFile: input.CaFile},
+	})
+}
+
+// SaramaSecurityConfig retorna configuracion sarama con TLS y/o SASL habilitados segun input
+func SaramaSecurityConfig(input KafkaSecurity) (*sarama.Config, error) {
 	saramaConf := sarama.NewConfig()
 
+	if input.SASL != nil {
+		if err := configSASL(saramaConf, *input.SASL); err != nil {
+			return nil, err
+		}
+	}
+
+	if input.TLS != nil {
+		tlsConfig, err := NewTLSConfig(*input.TLS)
+		if err != nil {
+			return nil, err
+		}
+
+		saramaConf.Net.TLS.Enable = true
+		saramaConf.Net.TLS.Config = tlsConfig
+	}
+
+	return saramaConf, nil
+}
+
+func configSASL(saramaConf *sarama.Config, input KafkaSASLSecurity) error {
+	if input.MechanismSASL == OAuthBearer {
+		provider, err := tokenProviderFromInput(input)
+		if err != nil {
+			return err
+		}
+
+		saramaConf.Net.SASL.Enable = true
+		saramaConf.Net.SASL.Mechanism = sarama.SASLTypeOAuth
+		saramaConf.Net.SASL.Version = sarama.SASLHandshakeV1
+		saramaConf.Net.SASL.TokenProvider = provider
+
+		return nil
+	}
+
 	if input.Username == "" || input.Password == "" {
-		return nil, errors.New(InvalidUsernamePassword)
+		return errors.New(InvalidUsernamePassword)
 	}
 
 	if input.MechanismSASL == "" {
@@ -59,10 +123,39 @@ func SaramaSASLConfig(input KafkaSASLSecurity) (*sarama.Config, error) {
 
 	saramaConf.Net.SASL.User = input.Username
 	saramaConf.Net.SASL.Password = input.Password
-	saramaConf.Net.TLS.Enable = true
-	saramaConf.Net.TLS.Config, err = SaramaTLSConfig(input.CaFile)
+
+	return nil
+}
+
+// applySecurityConfig copia la configuracion de red de seguridad en la configuracion sarama
+func applySecurityConfig(saramaConf *sarama.Config, security *KafkaSecurity) error {
+	if security == nil {
+		return nil
+	}
+
+	securityConf, err := SaramaSecurityConfig(*security)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return saramaConf, nil
+
+	saramaConf.Net.SASL = securityConf.Net.SASL
+	saramaConf.Net.TLS = securityConf.Net.TLS
+
+	return nil
+}
+
+// securityFromInput arma la configuracion de seguridad a partir de los campos comunes de consumer y producer.
+// security habilita SASL sobre TLS (comportamiento historico), tlsEnabled habilita solo TLS.
+func securityFromInput(security, tlsEnabled bool, sasl KafkaSASLSecurity, tlsInput KafkaTLSSecurity) *KafkaSecurity {
+	if !security && !tlsEnabled {
+		return nil
+	}
+
+	result := &KafkaSecurity{TLS: &tlsInput}
+
+	if security {
+		result.SASL = &sasl
+	}
+
+	return result
 }
@@ -0,0 +1,222 @@
+package kafka_toolkit
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// NewTLSConfig crea un tls.Config a partir de KafkaTLSSecurity, si ReloadInterval es mayor a 0
+// el CA bundle y el certificado de cliente se recargan cuando cambian los archivos en disco
+func NewTLSConfig(input KafkaTLSSecurity) (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(input.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if (input.CertFile == "") != (input.KeyFile == "") {
+		return nil, errors.New(InvalidClientCertKey)
+	}
+
+	reloader := &tlsFilesReloader{input: input}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         minVersion,
+		ServerName:         input.ServerName,
+		InsecureSkipVerify: input.InsecureSkipVerify,
+	}
+
+	if input.ReloadInterval <= 0 {
+		tlsConfig.RootCAs = reloader.roots
+		if reloader.cert != nil {
+			tlsConfig.Certificates = []tls.Certificate{*reloader.cert}
+		}
+
+		return tlsConfig, nil
+	}
+
+	if input.CertFile != "" {
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return reloader.certificate(), nil
+		}
+	}
+
+	if input.CaFile != "" && !input.InsecureSkipVerify {
+		// La verificacion estandar no permite cambiar RootCAs luego de crear la conexion,
+		// por lo que se verifica manualmente contra el pool recargable
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = reloader.verifyConnection
+	}
+
+	return tlsConfig, nil
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, errors.New(InvalidTLSMinVersion)
+	}
+}
+
+type tlsFilesReloader struct {
+	input KafkaTLSSecurity
+
+	mu        sync.RWMutex
+	roots     *x509.CertPool
+	cert      *tls.Certificate
+	modTimes  map[string]time.Time
+	lastCheck time.Time
+}
+
+func (r *tlsFilesReloader) files() []string {
+	files := make([]string, 0, 3)
+
+	for _, file := range []string{r.input.CaFile, r.input.CertFile, r.input.KeyFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+func (r *tlsFilesReloader) load() error {
+	var roots *x509.CertPool
+	var cert *tls.Certificate
+
+	if r.input.CaFile != "" {
+		ca, err := ioutil.ReadFile(r.input.CaFile)
+		if err != nil {
+			return err
+		}
+
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(ca) {
+			return errors.New(InvalidCaFile)
+		}
+	}
+
+	if r.input.CertFile != "" {
+		pair, err := tls.LoadX509KeyPair(r.input.CertFile, r.input.KeyFile)
+		if err != nil {
+			return err
+		}
+
+		cert = &pair
+	}
+
+	modTimes := make(map[string]time.Time)
+	for _, file := range r.files() {
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+	}
+
+	r.mu.Lock()
+	r.roots = roots
+	r.cert = cert
+	r.modTimes = modTimes
+	r.lastCheck = time.Now()
+	r.mu.Unlock()
+
+	return nil
+}
+
+// reloadIfChanged recarga los archivos si paso ReloadInterval y alguno cambio, en caso de error se mantienen los anteriores
+func (r *tlsFilesReloader) reloadIfChanged() {
+	r.mu.RLock()
+	due := time.Since(r.lastCheck) >= r.input.ReloadInterval
+	modTimes := r.modTimes
+	r.mu.RUnlock()
+
+	if !due {
+		return
+	}
+
+	changed := false
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(modTimes[file]) {
+			changed = true
+			break
+		}
+	}
+
+	if !changed {
+		r.mu.Lock()
+		r.lastCheck = time.Now()
+		r.mu.Unlock()
+		return
+	}
+
+	if err := r.load(); err != nil {
+		Log.Warn(
+			"message", "Error recargando certificados TLS, se mantienen los anteriores",
+			"error", err)
+
+		r.mu.Lock()
+		r.lastCheck = time.Now()
+		r.mu.Unlock()
+		return
+	}
+
+	Log.Info("message", "Certificados TLS recargados")
+}
+
+func (r *tlsFilesReloader) certificate() *tls.Certificate {
+	r.reloadIfChanged()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.cert == nil {
+		return &tls.Certificate{}
+	}
+
+	return r.cert
+}
+
+func (r *tlsFilesReloader) verifyConnection(state tls.ConnectionState) error {
+	r.reloadIfChanged()
+
+	r.mu.RLock()
+	roots := r.roots
+	r.mu.RUnlock()
+
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("broker no presento certificado")
+	}
+
+	serverName := r.input.ServerName
+	if serverName == "" {
+		serverName = state.ServerName
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+
+	return err
+}
@@ -0,0 +1,344 @@
+package kafka_toolkit_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+// testCA autoridad de certificacion de prueba
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue emite un certificado de servidor para localhost y 127.0.0.1 o de cliente, retorna certificado y llave en PEM
+func (ca *testCA) issue(t *testing.T, commonName string, server bool) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	if server {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.DNSNames = []string{"localhost"}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeTLSFile escribe el archivo con una fecha de modificacion posterior a la anterior, para detectar el cambio
+func writeTLSFile(t *testing.T, path string, content []byte) {
+	t.Helper()
+
+	modTime := time.Now()
+	if info, err := os.Stat(path); err == nil && !info.ModTime().Before(modTime) {
+		modTime = info.ModTime().Add(time.Second)
+	}
+
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tlsBroker servidor TLS que responde ok a cada conexion y reporta el CN del certificado de cliente
+type tlsBroker struct {
+	listener net.Listener
+	clients  chan string
+}
+
+func newTLSBroker(t *testing.T, ca *testCA, clientCAs *testCA) *tlsBroker {
+	t.Helper()
+
+	certPEM, keyPEM := ca.issue(t, "broker", true)
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &tls.Config{Certificates: []tls.Certificate{certificate}}
+	if clientCAs != nil {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = x509.NewCertPool()
+		config.ClientCAs.AddCert(clientCAs.cert)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	broker := &tlsBroker{listener: listener, clients: make(chan string, 10)}
+	go broker.serve()
+
+	return broker
+}
+
+func (b *tlsBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+
+			tlsConn := conn.(*tls.Conn)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+
+			client := ""
+			if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+				client = certs[0].Subject.CommonName
+			}
+
+			tlsConn.Write([]byte("ok"))
+			b.clients <- client
+		}()
+	}
+}
+
+// connect abre una conexion con la configuracion y retorna el CN informado por el broker
+func (b *tlsBroker) connect(config *tls.Config) (string, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: kafkatest.DefaultTimeout}, "tcp", b.listener.Addr().String(), config)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	// con TLS 1.3 el rechazo del certificado de cliente se informa recien al leer
+	conn.SetDeadline(time.Now().Add(kafkatest.DefaultTimeout))
+	if _, err := conn.Read(make([]byte, 2)); err != nil {
+		return "", err
+	}
+
+	return <-b.clients, nil
+}
+
+func TestNewTLSConfigValidation(t *testing.T) {
+	dir := t.TempDir()
+	invalidCA := filepath.Join(dir, "ca.pem")
+	writeTLSFile(t, invalidCA, []byte("no es un certificado"))
+
+	tests := []struct {
+		name     string
+		input    kafka.KafkaTLSSecurity
+		expected string
+	}{
+		{name: "version minima", input: kafka.KafkaTLSSecurity{MinVersion: "1.4"}, expected: kafka.InvalidTLSMinVersion},
+		{name: "certificado sin llave", input: kafka.KafkaTLSSecurity{CertFile: "client.pem"}, expected: kafka.InvalidClientCertKey},
+		{name: "ca invalida", input: kafka.KafkaTLSSecurity{CaFile: invalidCA}, expected: kafka.InvalidCaFile},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := kafka.NewTLSConfig(test.input); err == nil || err.Error() != test.expected {
+				t.Errorf("se esperaba %q, se obtuvo %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestTLSConfigStrict(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	broker := newTLSBroker(t, ca, nil)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	writeTLSFile(t, caFile, ca.pem)
+	otherCAFile := filepath.Join(dir, "other-ca.pem")
+	writeTLSFile(t, otherCAFile, newTestCA(t, "other").pem)
+
+	tests := []struct {
+		name  string
+		input kafka.KafkaTLSSecurity
+		ok    bool
+	}{
+		{name: "ca del broker", input: kafka.KafkaTLSSecurity{CaFile: caFile}, ok: true},
+		{name: "ca del broker con recarga", input: kafka.KafkaTLSSecurity{CaFile: caFile, ReloadInterval: time.Minute}, ok: true},
+		{name: "otra ca", input: kafka.KafkaTLSSecurity{CaFile: otherCAFile}},
+		{name: "otra ca con recarga", input: kafka.KafkaTLSSecurity{CaFile: otherCAFile, ReloadInterval: time.Minute}},
+		{name: "nombre de servidor distinto", input: kafka.KafkaTLSSecurity{CaFile: caFile, ServerName: "kafka.example.com"}},
+		{name: "nombre de servidor distinto con recarga", input: kafka.KafkaTLSSecurity{CaFile: caFile, ServerName: "kafka.example.com", ReloadInterval: time.Minute}},
+		{name: "sin verificacion", input: kafka.KafkaTLSSecurity{CaFile: otherCAFile, InsecureSkipVerify: true}, ok: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := kafka.NewTLSConfig(test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := broker.connect(config); (err == nil) != test.ok {
+				t.Errorf("se esperaba conexion exitosa %v, se obtuvo %v", test.ok, err)
+			}
+		})
+	}
+}
+
+func TestTLSConfigMutual(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	broker := newTLSBroker(t, ca, ca)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	certPEM, keyPEM := ca.issue(t, "client-1", false)
+	writeTLSFile(t, caFile, ca.pem)
+	writeTLSFile(t, certFile, certPEM)
+	writeTLSFile(t, keyFile, keyPEM)
+
+	for _, reload := range []time.Duration{0, time.Minute} {
+		withoutCert, err := kafka.NewTLSConfig(kafka.KafkaTLSSecurity{CaFile: caFile, ReloadInterval: reload})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := broker.connect(withoutCert); err == nil {
+			t.Errorf("recarga %v: se esperaba rechazo sin certificado de cliente", reload)
+		}
+
+		withCert, err := kafka.NewTLSConfig(kafka.KafkaTLSSecurity{CaFile: caFile, CertFile: certFile, KeyFile: keyFile, ReloadInterval: reload})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if client, err := broker.connect(withCert); err != nil || client != "client-1" {
+			t.Errorf("recarga %v: se esperaba conectar como client-1, se obtuvo %q (%v)", reload, client, err)
+		}
+	}
+}
+
+func TestTLSConfigReloadsCertificates(t *testing.T) {
+	kafkatest.EnsureLogger()
+
+	oldCA := newTestCA(t, "old-ca")
+	newCA := newTestCA(t, "new-ca")
+	// el broker rota a un certificado de la nueva CA y acepta clientes de la anterior
+	broker := newTLSBroker(t, newCA, oldCA)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	certPEM, keyPEM := oldCA.issue(t, "client-1", false)
+	writeTLSFile(t, caFile, oldCA.pem)
+	writeTLSFile(t, certFile, certPEM)
+	writeTLSFile(t, keyFile, keyPEM)
+
+	config, err := kafka.NewTLSConfig(kafka.KafkaTLSSecurity{
+		CaFile:         caFile,
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ReloadInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := broker.connect(config); err == nil {
+		t.Fatal("se esperaba rechazar el broker firmado por una CA desconocida")
+	}
+
+	writeTLSFile(t, caFile, newCA.pem)
+	time.Sleep(20 * time.Millisecond)
+
+	if client, err := broker.connect(config); err != nil || client != "client-1" {
+		t.Fatalf("se esperaba conectar con la CA recargada como client-1, se obtuvo %q (%v)", client, err)
+	}
+
+	// un archivo invalido no reemplaza los certificados cargados
+	writeTLSFile(t, caFile, []byte("no es un certificado"))
+	certPEM, keyPEM = oldCA.issue(t, "client-2", false)
+	writeTLSFile(t, certFile, certPEM)
+	writeTLSFile(t, keyFile, keyPEM)
+	time.Sleep(20 * time.Millisecond)
+
+	if client, err := broker.connect(config); err != nil || client != "client-1" {
+		t.Fatalf("se esperaba mantener client-1 ante un CA invalido, se obtuvo %q (%v)", client, err)
+	}
+
+	writeTLSFile(t, caFile, newCA.pem)
+	time.Sleep(20 * time.Millisecond)
+
+	if client, err := broker.connect(config); err != nil || client != "client-2" {
+		t.Errorf("se esperaba conectar con el certificado de cliente recargado client-2, se obtuvo %q (%v)", client, err)
+	}
+}
@@ -0,0 +1,318 @@
+package kafka_toolkit
+
+import (
+	"context"
+	"errors"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	defaultBatchMaxMessages  = 500
+	defaultBatchMaxWait      = time.Second
+	defaultBatchRetryBackoff = time.Second
+)
+
+// BatchConfig tamaño maximo y tiempo maximo de espera de un lote
+type BatchConfig struct {
+	// MaxMessages cantidad maxima de mensajes por lote, por defecto 500
+	MaxMessages int
+	// MaxWait tiempo maximo desde el primer mensaje del lote hasta procesarlo, por defecto 1s
+	MaxWait time.Duration
+	// RetryBackoff espera entre reintentos de un lote fallido, por defecto 1s
+	RetryBackoff time.Duration
+	// MaxRetries reintentos antes de enviar el lote al error handler y marcarlo,
+	// por defecto 0: se reintenta hasta que el handler tenga exito o termine la sesion
+	MaxRetries int
+}
+
+// BatchConsumerBuilder builder de consumer por lotes
+type BatchConsumerBuilder interface {
+	WithErrorHandler(ConsumerErrorHandler) BatchConsumerBuilder
+	WithRebalanceListener(RebalanceListener) BatchConsumerBuilder
+	Build() (KafkaConsumer, error)
+}
+
+type batchConsumerBuilder struct {
+	consumerCfg       ConsumerGroupInput
+	handler           BatchMessageHandler
+	batch             BatchConfig
+	errorHandler      ConsumerErrorHandler
+	rebalanceListener RebalanceListener
+}
+
+// MakeBatchConsumerBuilder builder de consumer que entrega los mensajes de cada particion en lotes.
+// Los offsets se marcan solo cuando el handler procesa el lote sin error. Un lote fallido se reintenta
+// y, si se configura MaxRetries, al agotar los reintentos se envia al error handler y se marca.
+// El handler se ejecuta con la recuperacion de panics y el HandlerTimeout del consumer.
+func MakeBatchConsumerBuilder(cfg ConsumerGroupInput, handler BatchMessageHandler, batch BatchConfig) BatchConsumerBuilder {
+	return &batchConsumerBuilder{
+		consumerCfg:  cfg,
+		handler:      handler,
+		batch:        batch.withDefaults(),
+		errorHandler: NewLoggingConsumerErrorHandler(),
+	}
+}
+
+// withDefaults aplica los valores por defecto a los campos sin configurar
+func (batch BatchConfig) withDefaults() BatchConfig {
+	if batch.MaxMessages <= 0 {
+		batch.MaxMessages = defaultBatchMaxMessages
+	}
+
+	if batch.MaxWait <= 0 {
+		batch.MaxWait = defaultBatchMaxWait
+	}
+
+	if batch.RetryBackoff <= 0 {
+		batch.RetryBackoff = defaultBatchRetryBackoff
+	}
+
+	return batch
+}
+
+func (b *batchConsumerBuilder) WithErrorHandler(errorHandler ConsumerErrorHandler) BatchConsumerBuilder {
+	b.errorHandler = errorHandler
+	return b
+}
+
+func (b *batchConsumerBuilder) WithRebalanceListener(listener RebalanceListener) BatchConsumerBuilder {
+	b.rebalanceListener = listener
+	return b
+}
+
+func (b *batchConsumerBuilder) Build() (KafkaConsumer, error) {
+	consumer, err := newBatchKafkaConsumer(b.consumerCfg, nil, b.handler, b.batch, b.errorHandler, b.rebalanceListener)
+	if err != nil {
+		return nil, err
+	}
+
+	return consumer, nil
+}
+
+// newBatchKafkaConsumer crea el consumer por lotes, topics vacio consume el topico del input
+func newBatchKafkaConsumer(cfg ConsumerGroupInput, topics []string, handler BatchMessageHandler, batch BatchConfig,
+	errorHandler ConsumerErrorHandler, listener RebalanceListener) (*batchKafkaConsumer, error) {
+	conf, consumer, err := createBaseConsumer(cfg, nil, errorHandler)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(topics) == 0 {
+		topics = []string{conf.Topic}
+	}
+
+	consumer.RebalanceListener = listener
+
+	saramaClient, err := sarama.NewClient(conf.Brokers, conf.SaramaConfig)
+	if err != nil {
+		Log.Error("Error creando cliente sarama:", err)
+		return nil, err
+	}
+
+	group, err := sarama.NewConsumerGroupFromClient(conf.Group, saramaClient)
+	if err != nil {
+		Log.Error("Error creando cliente para consumer group:", err)
+		saramaClient.Close()
+		return nil, err
+	}
+
+	if conf.StartPosition != nil {
+		consumer.startPosition = newStartPositionResolver(conf.StartPosition, conf.Group, saramaClient)
+	}
+
+	consumer.group = group
+
+	return &batchKafkaConsumer{
+		topics:       topics,
+		handler:      &batchConsumer{BaseConsumer: consumer, handler: handler, batch: batch},
+		group:        group,
+		saramaClient: saramaClient,
+	}, nil
+}
+
+// batchConsumer reutiliza Setup, Cleanup y rebalanceo de BaseConsumer y reemplaza el loop de consumo
+type batchConsumer struct {
+	BaseConsumer
+	handler BatchMessageHandler
+	batch   BatchConfig
+}
+
+// ConsumeClaim acumula mensajes hasta completar el lote o vencer MaxWait, al terminar la sesion procesa el lote pendiente.
+// Un lote sin procesar detiene el claim para no marcar los siguientes, la sesion se reinicia y el lote se vuelve a entregar.
+func (c *batchConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	c.reapplyPause(claim)
+	c.awaitAbandoned(session, claim.Topic(), claim.Partition())
+
+	batch := make([]*sarama.ConsumerMessage, 0, c.batch.MaxMessages)
+	timer := time.NewTimer(c.batch.MaxWait)
+	timer.Stop()
+	defer timer.Stop()
+
+	flush := func() error {
+		timer.Stop()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err := c.handleBatch(session, batch)
+		batch = batch[:0]
+
+		return err
+	}
+
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return flush()
+			}
+
+			if message == nil {
+				continue
+			}
+
+			if len(batch) == 0 {
+				timer.Reset(c.batch.MaxWait)
+			}
+
+			batch = append(batch, message)
+			if len(batch) >= c.batch.MaxMessages {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-timer.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		case <-session.Context().Done():
+			flush()
+			return nil
+		}
+	}
+}
+
+// handleBatch procesa el lote reintentando mientras falle y lo marca al tener exito. Retorna ErrSessionClosed
+// o ErrHandlerAbandoned si el lote quedo sin procesar y no se marco.
+func (c *batchConsumer) handleBatch(session sarama.ConsumerGroupSession, batch []*sarama.ConsumerMessage) error {
+	msgs := make([]*ConsumerMessage, 0, len(batch))
+	for _, message := range batch {
+		msgs = append(msgs, saramaToGenericMessage(message))
+	}
+
+	ctx := ContextWithSessionDone(context.Background(), session.Context().Done())
+	handle := func(ctx context.Context) error {
+		return c.handler.HandleMessages(ctx, msgs)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := c.guard(ctx, msgs[0], handle)
+		if err == nil {
+			break
+		}
+
+		if errors.Is(err, ErrSessionClosed) {
+			return err
+		}
+
+		if c.batch.MaxRetries > 0 && attempt > c.batch.MaxRetries {
+			for _, msg := range msgs {
+				c.ErrorHandler.HandleError(msg.Msg, err)
+			}
+			break
+		}
+
+		Log.Warn(
+			"message", "Error procesando lote, se reintenta",
+			"topic", msgs[0].Topic,
+			"partition", msgs[0].Partition,
+			"first_offset", msgs[0].Offset,
+			"messages", len(msgs),
+			"attempt", attempt,
+			"error", err)
+
+		retry := time.NewTimer(c.batch.RetryBackoff)
+		select {
+		case <-retry.C:
+		case <-session.Context().Done():
+			retry.Stop()
+			return ErrSessionClosed
+		}
+	}
+
+	for _, message := range batch {
+		session.MarkMessage(message, "")
+	}
+
+	return nil
+}
+
+type batchKafkaConsumer struct {
+	topics       []string
+	handler      *batchConsumer
+	group        sarama.ConsumerGroup
+	saramaClient sarama.Client
+}
+
+// Start consume hasta recibir SIGINT o SIGTERM
+func (s *batchKafkaConsumer) Start() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return s.Run(ctx)
+}
+
+// Run consume hasta que se cancela el contexto y cierra los clientes
+func (s *batchKafkaConsumer) Run(parent context.Context) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			if err := s.group.Consume(ctx, s.topics, s.handler); err != nil {
+				Log.Error(
+					"errorMessage", "Error de consumer",
+					"error", err.Error())
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+			s.handler.Ready = make(chan bool)
+		}
+	}()
+
+	select {
+	case <-s.handler.Ready:
+		Log.Info("message", "Sarama batch consumer inicializado!")
+	case <-ctx.Done():
+	}
+
+	<-ctx.Done()
+	Log.Info("message", "Terminando: Contexto cancelado")
+
+	cancel()
+	wg.Wait()
+	s.handler.Close()
+	if err := s.group.Close(); err != nil {
+		Log.Error(
+			"errorMessage", "Error cerrando cliente",
+			"error", err)
+	}
+
+	if err := s.saramaClient.Close(); err != nil && err != sarama.ErrClosedClient {
+		Log.Error(
+			"errorMessage", "Error cerrando cliente sarama",
+			"error", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+type flakyBatchHandler struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	handled  chan []int64
+}
+
+func (h *flakyBatchHandler) HandleMessages(ctx context.Context, inMsgs []*kafka.ConsumerMessage) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.attempts++
+	if h.attempts <= h.failures {
+		return errors.New("sink no disponible")
+	}
+
+	offsets := make([]int64, 0, len(inMsgs))
+	for _, msg := range inMsgs {
+		offsets = append(offsets, msg.Offset)
+	}
+	h.handled <- offsets
+
+	return nil
+}
+
+func TestBatchConsumerRetriesFailedBatch(t *testing.T) {
+	cluster := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{"batch": 1}})
+	cluster.SetMessages("batch", 0, "0", "1", "2")
+
+	handler := &flakyBatchHandler{failures: 2, handled: make(chan []int64, 1)}
+	errorHandler := kafkatest.NewRecordingErrorHandler()
+
+	consumer, err := kafka.MakeBatchConsumerBuilder(cluster.ConsumerInput("batch", "batch-retry"), handler, kafka.BatchConfig{
+		MaxMessages:  3,
+		MaxWait:      time.Second,
+		RetryBackoff: 10 * time.Millisecond,
+	}).WithErrorHandler(errorHandler).Build()
+	if err != nil {
+		t.Fatalf("error creando consumer: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan error, 1)
+	go func() {
+		finished <- consumer.(kafka.KafkaConsumerRunner).Run(ctx)
+	}()
+
+	select {
+	case offsets := <-handler.handled:
+		if len(offsets) != 3 || offsets[0] != 0 {
+			t.Errorf("lote procesado: se esperaba [0 1 2], se obtuvo %v", offsets)
+		}
+	case <-time.After(kafkatest.DefaultTimeout):
+		t.Errorf("el lote no se proceso dentro del tiempo maximo")
+	}
+
+	cancel()
+	if err := <-finished; err != nil {
+		t.Fatal(err)
+	}
+
+	if handler.attempts != 3 {
+		t.Errorf("intentos: se esperaban 3, se obtuvo %d", handler.attempts)
+	}
+
+	kafkatest.AssertNoErrors(t, errorHandler)
+
+	if offset, ok := cluster.Committed("batch-retry", "batch", 0); !ok || offset != 3 {
+		t.Errorf("offset comprometido: se esperaba 3, se obtuvo %d (comprometido %v)", offset, ok)
+	}
+}
@@ -0,0 +1,509 @@
+package kafka_toolkit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const defaultBoundedIdleTimeout = 10 * time.Second
+
+// BoundedConsumerSummary resumen de una ejecucion acotada
+type BoundedConsumerSummary struct {
+	Messages int64
+	Errors   int64
+	Duration time.Duration
+	// EndOffsets high-water mark por particion capturado al iniciar
+	EndOffsets map[int32]int64
+	// IdlePartitions particiones finalizadas por inactividad antes de alcanzar el high-water mark
+	IdlePartitions []int32
+	// Completed en true solo si todas las particiones alcanzaron el high-water mark, en false si la ejecucion
+	// se detuvo antes (por ejemplo por signal) o alguna particion termino por inactividad
+	Completed bool
+}
+
+// BoundedKafkaConsumer consumer que lee hasta el high-water mark capturado al iniciar y termina
+type BoundedKafkaConsumer interface {
+	KafkaConsumer
+	Run() (*BoundedConsumerSummary, error)
+}
+
+// BoundedConsumerBuilder builder de consumer acotado
+type BoundedConsumerBuilder interface {
+	WithErrorHandler(ConsumerErrorHandler) BoundedConsumerBuilder
+	// WithConsumerGroup consume a traves del consumer group comprometiendo offsets,
+	// por defecto se usan partition consumers sin comprometer offsets
+	WithConsumerGroup(bool) BoundedConsumerBuilder
+	// WithIdleTimeout tiempo sin recibir mensajes tras el cual una particion se da por terminada aunque no se
+	// alcance el high-water mark, por ejemplo cuando los ultimos offsets son marcadores de transaccion.
+	// Por defecto 10 segundos
+	WithIdleTimeout(time.Duration) BoundedConsumerBuilder
+	Build() (BoundedKafkaConsumer, error)
+}
+
+type boundedConsumerBuilder struct {
+	consumerCfg  ConsumerGroupInput
+	msgHandler   MessageHandler
+	errorHandler ConsumerErrorHandler
+	useGroup     bool
+	idleTimeout  time.Duration
+}
+
+// MakeBoundedConsumerBuilder builder de consumer acotado, util para backfills y jobs de reconciliacion
+func MakeBoundedConsumerBuilder(cfg ConsumerGroupInput, handler MessageHandler) BoundedConsumerBuilder {
+	return &boundedConsumerBuilder{
+		consumerCfg:  cfg,
+		msgHandler:   handler,
+		errorHandler: NewLoggingConsumerErrorHandler(),
+		idleTimeout:  defaultBoundedIdleTimeout,
+	}
+}
+
+func (b *boundedConsumerBuilder) WithErrorHandler(errorHandler ConsumerErrorHandler) BoundedConsumerBuilder {
+	b.errorHandler = errorHandler
+	return b
+}
+
+func (b *boundedConsumerBuilder) WithConsumerGroup(useGroup bool) BoundedConsumerBuilder {
+	b.useGroup = useGroup
+	return b
+}
+
+func (b *boundedConsumerBuilder) WithIdleTimeout(idleTimeout time.Duration) BoundedConsumerBuilder {
+	if idleTimeout > 0 {
+		b.idleTimeout = idleTimeout
+	}
+	return b
+}
+
+func (b *boundedConsumerBuilder) Build() (BoundedKafkaConsumer, error) {
+	conf, consumer, err := createBaseConsumer(b.consumerCfg, b.msgHandler, b.errorHandler)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sarama.NewClient(conf.Brokers, conf.SaramaConfig)
+	if err != nil {
+		Log.Error("Error creando cliente sarama:", err)
+		return nil, err
+	}
+
+	if conf.StartPosition != nil {
+		consumer.startPosition = newStartPositionResolver(conf.StartPosition, conf.Group, client)
+	}
+
+	return &boundedKafkaConsumer{
+		conf:        conf,
+		consumer:    consumer,
+		client:      client,
+		useGroup:    b.useGroup,
+		idleTimeout: b.idleTimeout,
+		done:        make(map[int32]bool),
+		idle:        make(map[int32]bool),
+	}, nil
+}
+
+type boundedKafkaConsumer struct {
+	conf        *ConsumerGroupConfig
+	consumer    BaseConsumer
+	client      sarama.Client
+	useGroup    bool
+	idleTimeout time.Duration
+
+	endOffsets map[int32]int64
+	messages   int64
+	errors     int64
+
+	mu     sync.Mutex
+	done   map[int32]bool
+	idle   map[int32]bool
+	cancel context.CancelFunc
+}
+
+// Start ejecuta el consumo acotado, el resumen queda registrado en el log
+func (b *boundedKafkaConsumer) Start() error {
+	_, err := b.Run()
+	return err
+}
+
+// Run consume cada particion hasta el high-water mark capturado al iniciar y retorna un resumen
+func (b *boundedKafkaConsumer) Run() (*BoundedConsumerSummary, error) {
+	begin := time.Now()
+
+	defer func() {
+		if err := b.client.Close(); err != nil && err != sarama.ErrClosedClient {
+			Log.Error(
+				"errorMessage", "Error cerrando cliente",
+				"error", err)
+		}
+	}()
+
+	endOffsets, err := b.snapshotEndOffsets()
+	if err != nil {
+		return nil, err
+	}
+	b.endOffsets = endOffsets
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.cancel = cancel
+
+	sigterm := make(chan os.Signal, 1)
+	signal.Notify(sigterm, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigterm)
+
+	go func() {
+		select {
+		case <-sigterm:
+			Log.Warn("message", "Terminando consumo acotado: por signal")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	Log.Info(
+		"message", "Iniciando consumo acotado",
+		"topic", b.conf.Topic,
+		"end_offsets", endOffsets,
+		"consumer_group", b.useGroup)
+
+	if b.useGroup {
+		err = b.runGroup(ctx)
+	} else {
+		err = b.runPartitions(ctx)
+	}
+
+	summary := &BoundedConsumerSummary{
+		Messages:   atomic.LoadInt64(&b.messages),
+		Errors:     atomic.LoadInt64(&b.errors),
+		Duration:   time.Since(begin),
+		EndOffsets: endOffsets,
+	}
+	summary.IdlePartitions, summary.Completed = b.completion()
+
+	Log.Info(
+		"message", "Consumo acotado finalizado",
+		"topic", b.conf.Topic,
+		"messages", summary.Messages,
+		"errors", summary.Errors,
+		"duration", summary.Duration.String(),
+		"idle_partitions", summary.IdlePartitions,
+		"completed", summary.Completed)
+
+	return summary, err
+}
+
+func (b *boundedKafkaConsumer) snapshotEndOffsets() (map[int32]int64, error) {
+	partitions, err := b.client.Partitions(b.conf.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	endOffsets := make(map[int32]int64, len(partitions))
+	for _, partition := range partitions {
+		offset, err := b.client.GetOffset(b.conf.Topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+
+		endOffsets[partition] = offset
+	}
+
+	return endOffsets, nil
+}
+
+func (b *boundedKafkaConsumer) startOffset(partition int32) (int64, error) {
+	if b.consumer.startPosition != nil {
+		offset, ok, err := b.consumer.startPosition.resolveOffset(b.conf.Topic, partition)
+		if err != nil || ok {
+			return offset, err
+		}
+	}
+
+	return b.client.GetOffset(b.conf.Topic, partition, b.conf.SaramaConfig.Consumer.Offsets.Initial)
+}
+
+func (b *boundedKafkaConsumer) runPartitions(ctx context.Context) error {
+	consumer, err := sarama.NewConsumerFromClient(b.client)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	wg := &sync.WaitGroup{}
+
+	var abortErr error
+	abortOnce := &sync.Once{}
+	abort := func(err error) {
+		abortOnce.Do(func() { abortErr = err })
+		b.cancel()
+	}
+
+	for partition, end := range b.endOffsets {
+		start, err := b.startOffset(partition)
+		if err != nil {
+			abort(err)
+			wg.Wait()
+			return err
+		}
+
+		if start >= end {
+			b.markDone(partition)
+			continue
+		}
+
+		partitionConsumer, err := consumer.ConsumePartition(b.conf.Topic, partition, start)
+		if err != nil {
+			abort(err)
+			wg.Wait()
+			return err
+		}
+
+		wg.Add(1)
+		go func(partition int32, end int64, partitionConsumer sarama.PartitionConsumer) {
+			defer wg.Done()
+			defer partitionConsumer.AsyncClose()
+
+			idle := time.NewTimer(b.idleTimeout)
+			defer idle.Stop()
+
+			for {
+				select {
+				case message, ok := <-partitionConsumer.Messages():
+					if !ok {
+						return
+					}
+
+					finished, err := b.processUntil(ctx, message, end)
+					if err != nil {
+						// el handler sigue en ejecucion, se detiene el consumo para no procesar en paralelo
+						abort(err)
+						return
+					}
+
+					if finished {
+						b.markDone(partition)
+						return
+					}
+
+					resetTimer(idle, b.idleTimeout)
+				case <-idle.C:
+					b.idleDone(partition, end)
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(partition, end, partitionConsumer)
+	}
+
+	wg.Wait()
+
+	if abortErr != nil {
+		return abortErr
+	}
+
+	// ctx solo se cancela por signal o por un error, al terminar todas las particiones no se cancela
+	return ctx.Err()
+}
+
+func (b *boundedKafkaConsumer) runGroup(ctx context.Context) error {
+	group, err := sarama.NewConsumerGroupFromClient(b.conf.Group, b.client)
+	if err != nil {
+		return err
+	}
+	defer group.Close()
+
+	for {
+		if err := group.Consume(ctx, []string{b.conf.Topic}, b); err != nil {
+			Log.Error(
+				"errorMessage", "Error de consumer",
+				"error", err.Error())
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		b.consumer.Ready = make(chan bool)
+	}
+}
+
+// Setup implementa sarama.ConsumerGroupHandler. Un miembro sin particiones asignadas termina, de lo contrario
+// esperaria indefinidamente a que sus claims alcancen el final
+func (b *boundedKafkaConsumer) Setup(session sarama.ConsumerGroupSession) error {
+	if err := b.consumer.Setup(session); err != nil {
+		return err
+	}
+
+	if len(session.Claims()[b.conf.Topic]) == 0 {
+		Log.Warn(
+			"message", "Terminando consumo acotado: sin particiones asignadas",
+			"topic", b.conf.Topic,
+			"group", b.conf.Group)
+		b.cancel()
+	}
+
+	return nil
+}
+
+// Cleanup implementa sarama.ConsumerGroupHandler
+func (b *boundedKafkaConsumer) Cleanup(session sarama.ConsumerGroupSession) error {
+	return b.consumer.Cleanup(session)
+}
+
+// ConsumeClaim consume hasta el high-water mark y luego espera el fin de la sesion,
+// retornar antes cancelaria la sesion de las demas particiones
+func (b *boundedKafkaConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	b.consumer.awaitAbandoned(session, claim.Topic(), claim.Partition())
+
+	end := b.endOffsets[claim.Partition()]
+	ctx := ContextWithSessionDone(context.Background(), session.Context().Done())
+
+	if claim.InitialOffset() < end && !b.isDone(claim.Partition()) {
+		idle := time.NewTimer(b.idleTimeout)
+		defer idle.Stop()
+
+	loop:
+		for {
+			select {
+			case message, ok := <-claim.Messages():
+				if !ok {
+					return nil
+				}
+
+				finished, err := b.processUntil(ctx, message, end)
+				if err != nil {
+					return err
+				}
+
+				// Con la sesion terminada el mensaje pudo quedar sin procesar, se vuelve a entregar en la siguiente
+				if message.Offset < end && session.Context().Err() == nil {
+					session.MarkMessage(message, "")
+				}
+
+				if finished {
+					break loop
+				}
+
+				resetTimer(idle, b.idleTimeout)
+			case <-idle.C:
+				b.idleDone(claim.Partition(), end)
+				break loop
+			case <-session.Context().Done():
+				return nil
+			}
+		}
+	}
+
+	b.markDone(claim.Partition())
+
+	if b.claimsDone(session.Claims()) {
+		b.cancel()
+	}
+
+	<-session.Context().Done()
+	return nil
+}
+
+// processUntil procesa el mensaje si esta antes de end y retorna true si la particion alcanzo el final.
+// Retorna error si el mensaje quedo sin procesar (sesion terminada o handler abandonado).
+func (b *boundedKafkaConsumer) processUntil(ctx context.Context, message *sarama.ConsumerMessage, end int64) (bool, error) {
+	if message.Offset >= end {
+		return true, nil
+	}
+
+	atomic.AddInt64(&b.messages, 1)
+	if err := b.consumer.processSaramaMessage(ctx, message); err != nil {
+		atomic.AddInt64(&b.errors, 1)
+
+		if errors.Is(err, ErrSessionClosed) {
+			return false, err
+		}
+	}
+
+	return message.Offset >= end-1, nil
+}
+
+// idleDone da por terminada una particion sin mensajes durante idleTimeout,
+// los ultimos offsets pueden no existir (por ejemplo marcadores de transaccion)
+func (b *boundedKafkaConsumer) idleDone(partition int32, end int64) {
+	Log.Warn(
+		"message", "Particion finalizada por inactividad antes del high-water mark",
+		"topic", b.conf.Topic,
+		"partition", partition,
+		"end", end)
+
+	b.mu.Lock()
+	b.idle[partition] = true
+	b.mu.Unlock()
+
+	b.markDone(partition)
+}
+
+// resetTimer reinicia un timer cuyo canal no fue leido
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		<-timer.C
+	}
+	timer.Reset(d)
+}
+
+func (b *boundedKafkaConsumer) markDone(partition int32) {
+	b.mu.Lock()
+	b.done[partition] = true
+	b.mu.Unlock()
+}
+
+func (b *boundedKafkaConsumer) isDone(partition int32) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.done[partition]
+}
+
+func (b *boundedKafkaConsumer) claimsDone(claims map[string][]int32) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, partitions := range claims {
+		for _, partition := range partitions {
+			if !b.done[partition] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// completion retorna las particiones finalizadas por inactividad y si todas alcanzaron el high-water mark
+func (b *boundedKafkaConsumer) completion() ([]int32, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var idle []int32
+	completed := true
+
+	for partition := range b.endOffsets {
+		if b.idle[partition] {
+			idle = append(idle, partition)
+		}
+
+		if !b.done[partition] || b.idle[partition] {
+			completed = false
+		}
+	}
+
+	sort.Slice(idle, func(i, j int) bool { return idle[i] < idle[j] })
+
+	return idle, completed
+}
@@ -0,0 +1,144 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+func TestBoundedConsumerFinishesWithTrailingMarkers(t *testing.T) {
+	for name, useGroup := range map[string]bool{"particiones": false, "consumer-group": true} {
+		t.Run(name, func(t *testing.T) {
+			cluster := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{"bounded": 1}})
+			cluster.SetMessages("bounded", 0, "a", "b")
+			// el ultimo offset corresponde a un marcador de transaccion que no se entrega
+			cluster.SetHighWaterMark("bounded", 0, 3)
+
+			input := cluster.ConsumerInput("bounded", "bounded-group")
+			input.StartFrom = kafka.StartEarliest
+
+			handled := int32(0)
+			handler := kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+				atomic.AddInt32(&handled, 1)
+				return nil
+			})
+
+			consumer, err := kafka.MakeBoundedConsumerBuilder(input, handler).
+				WithConsumerGroup(useGroup).
+				WithIdleTimeout(500 * time.Millisecond).
+				Build()
+			if err != nil {
+				t.Fatalf("error creando consumer: %v", err)
+			}
+
+			finished := make(chan *kafka.BoundedConsumerSummary, 1)
+			go func() {
+				summary, err := consumer.Run()
+				if err != nil {
+					t.Error(err)
+				}
+				finished <- summary
+			}()
+
+			select {
+			case summary := <-finished:
+				if summary == nil || summary.Completed || summary.Messages != 2 {
+					t.Errorf("resumen: se esperaban 2 mensajes y ejecucion incompleta, se obtuvo %+v", summary)
+				} else if len(summary.IdlePartitions) != 1 || summary.IdlePartitions[0] != 0 {
+					t.Errorf("se esperaba la particion 0 finalizada por inactividad, se obtuvo %v", summary.IdlePartitions)
+				}
+			case <-time.After(kafkatest.DefaultTimeout):
+				t.Fatalf("el consumo acotado no termino con marcadores al final de la particion")
+			}
+
+			if count := atomic.LoadInt32(&handled); count != 2 {
+				t.Errorf("mensajes procesados: se esperaban 2, se obtuvo %d", count)
+			}
+		})
+	}
+}
+
+func TestBoundedConsumerCompletesAtHighWaterMark(t *testing.T) {
+	for name, useGroup := range map[string]bool{"particiones": false, "consumer-group": true} {
+		t.Run(name, func(t *testing.T) {
+			cluster := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{"bounded": 2}})
+			cluster.SetMessages("bounded", 0, "a", "b")
+			cluster.SetMessages("bounded", 1, "c")
+
+			input := cluster.ConsumerInput("bounded", "bounded-group")
+			input.StartFrom = kafka.StartEarliest
+
+			consumer, err := kafka.MakeBoundedConsumerBuilder(input, kafkatest.HandlerFunc(
+				func(ctx context.Context, inMsg *kafka.ConsumerMessage) error { return nil })).
+				WithConsumerGroup(useGroup).
+				Build()
+			if err != nil {
+				t.Fatalf("error creando consumer: %v", err)
+			}
+
+			finished := make(chan *kafka.BoundedConsumerSummary, 1)
+			go func() {
+				summary, err := consumer.Run()
+				if err != nil {
+					t.Error(err)
+				}
+				finished <- summary
+			}()
+
+			select {
+			case summary := <-finished:
+				if summary == nil || !summary.Completed || summary.Messages != 3 || len(summary.IdlePartitions) != 0 {
+					t.Errorf("resumen: se esperaban 3 mensajes y ejecucion completa, se obtuvo %+v", summary)
+				}
+			case <-time.After(kafkatest.DefaultTimeout):
+				t.Fatalf("el consumo acotado no termino al alcanzar el high-water mark")
+			}
+		})
+	}
+}
+
+func TestBoundedConsumerReturnsAbortError(t *testing.T) {
+	cluster := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{"bounded": 1}})
+	cluster.SetMessages("bounded", 0, "a", "b")
+
+	input := cluster.ConsumerInput("bounded", "bounded-group")
+	input.StartFrom = kafka.StartEarliest
+	input.HandlerTimeoutMillis = 50
+
+	release := make(chan struct{})
+	defer close(release)
+
+	// el handler ignora la cancelacion y queda abandonado
+	handler := kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		<-release
+		return nil
+	})
+
+	consumer, err := kafka.MakeBoundedConsumerBuilder(input, handler).Build()
+	if err != nil {
+		t.Fatalf("error creando consumer: %v", err)
+	}
+
+	finished := make(chan error, 1)
+	go func() {
+		summary, err := consumer.Run()
+		if summary != nil && summary.Completed {
+			t.Errorf("no se esperaba ejecucion completa, se obtuvo %+v", summary)
+		}
+		finished <- err
+	}()
+
+	select {
+	case err := <-finished:
+		if !errors.Is(err, kafka.ErrHandlerAbandoned) {
+			t.Errorf("se esperaba ErrHandlerAbandoned, se obtuvo %v", err)
+		}
+	case <-time.After(kafkatest.DefaultTimeout):
+		t.Fatalf("el consumo acotado no termino al abandonar el handler")
+	}
+}
@@ -2,12 +2,12 @@ package kafka_toolkit
 
 import (
 	"context"
-	"os"
 	"os/signal"
 	"sync"
 	"syscall"
 
 	"github.com/Shopify/sarama"
+	"github.com/go-kit/kit/metrics"
 )
 
 // KafkaConsumer interfaz para iniciar kafka consumer
@@ -15,16 +15,30 @@ type KafkaConsumer interface {
 	Start() error
 }
 
+// KafkaConsumerRunner consumer que ademas de Start puede detenerse cancelando el contexto
+type KafkaConsumerRunner interface {
+	KafkaConsumer
+	Run(ctx context.Context) error
+}
+
 // SaramaConsumerBuilder builder de sarama consumer
 type SaramaConsumerBuilder interface {
 	WithErrorHandler(ConsumerErrorHandler) SaramaConsumerBuilder
+	WithRebalanceListener(RebalanceListener) SaramaConsumerBuilder
+	WithBackpressure(*BackpressureController) SaramaConsumerBuilder
+	WithPauseMetrics(metrics.Gauge) SaramaConsumerBuilder
+	WithHandlerGuardMetrics(*HandlerGuardMetrics) SaramaConsumerBuilder
 	Build() (KafkaConsumer, error)
 }
 
 type saramaConsumerBuilder struct {
-	consumerCfg  ConsumerGroupInput
-	msgHandler   MessageHandler
-	errorHandler ConsumerErrorHandler
+	consumerCfg       ConsumerGroupInput
+	msgHandler        MessageHandler
+	errorHandler      ConsumerErrorHandler
+	rebalanceListener RebalanceListener
+	backpressure      *BackpressureController
+	pauseGauge        metrics.Gauge
+	guardMetrics      *HandlerGuardMetrics
 }
 
 // MakeSaramaConsumerBuilder consumer builder
@@ -41,36 +55,99 @@ func (b *saramaConsumerBuilder) WithErrorHandler(errorHandler ConsumerErrorHandl
 	return b
 }
 
+func (b *saramaConsumerBuilder) WithRebalanceListener(listener RebalanceListener) SaramaConsumerBuilder {
+	b.rebalanceListener = listener
+	return b
+}
+
+// WithBackpressure pausa el consumer automaticamente segun el controlador de backpressure
+func (b *saramaConsumerBuilder) WithBackpressure(controller *BackpressureController) SaramaConsumerBuilder {
+	b.backpressure = controller
+	return b
+}
+
+// WithPauseMetrics gauge con valor 1 mientras el consumer tenga particiones pausadas
+func (b *saramaConsumerBuilder) WithPauseMetrics(gauge metrics.Gauge) SaramaConsumerBuilder {
+	b.pauseGauge = gauge
+	return b
+}
+
+// WithHandlerGuardMetrics metricas de panics y timeouts del message handler
+func (b *saramaConsumerBuilder) WithHandlerGuardMetrics(guardMetrics *HandlerGuardMetrics) SaramaConsumerBuilder {
+	b.guardMetrics = guardMetrics
+	return b
+}
+
 func (b *saramaConsumerBuilder) Build() (KafkaConsumer, error) {
-	conf, consumer, err := createBaseConsumer(b.consumerCfg, b.msgHandler, b.errorHandler)
+	msgHandler := b.msgHandler
+	if b.backpressure != nil {
+		msgHandler = b.backpressure.Middleware()(msgHandler)
+	}
+
+	conf, consumer, err := createBaseConsumer(b.consumerCfg, msgHandler, b.errorHandler)
 	if err != nil {
 		Log.Error("Error generando configuracion:", err)
 		return nil, err
 	}
 
-	client, err := sarama.NewConsumerGroup(conf.Brokers, conf.Group, conf.SaramaConfig)
+	consumer.RebalanceListener = b.rebalanceListener
+
+	saramaClient, err := sarama.NewClient(conf.Brokers, conf.SaramaConfig)
+	if err != nil {
+		Log.Error("Error creando cliente sarama:", err)
+		return nil, err
+	}
+
+	client, err := sarama.NewConsumerGroupFromClient(conf.Group, saramaClient)
 	if err != nil {
 		Log.Error("Error creando cliente para consumer group:", err)
+		saramaClient.Close()
 		return nil, err
 	}
 
-	return &saramaKafkaConsumer{
-		conf:     conf,
-		consumer: consumer,
-		client:   client,
-	}, nil
+	if conf.StartPosition != nil {
+		consumer.startPosition = newStartPositionResolver(conf.StartPosition, conf.Group, saramaClient)
+	}
+
+	consumer.group = client
+	consumer.pause.gauge = b.pauseGauge
+	consumer.HandlerMetrics = b.guardMetrics
+
+	kafkaConsumer := &saramaKafkaConsumer{
+		conf:         conf,
+		consumer:     consumer,
+		client:       client,
+		saramaClient: saramaClient,
+		backpressure: b.backpressure,
+	}
+
+	if b.backpressure != nil {
+		b.backpressure.Attach(kafkaConsumer)
+	}
+
+	return kafkaConsumer, nil
 }
 
 type saramaKafkaConsumer struct {
-	conf     *ConsumerGroupConfig
-	consumer BaseConsumer
-	client   sarama.ConsumerGroup
+	conf         *ConsumerGroupConfig
+	consumer     BaseConsumer
+	client       sarama.ConsumerGroup
+	saramaClient sarama.Client
+	backpressure *BackpressureController
 }
 
 //StartConsumer Inicializa consumo de topico Kafka
 func (s *saramaKafkaConsumer) Start() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return s.Run(ctx)
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
+// Run consume hasta que se cancela el contexto y cierra los clientes
+func (s *saramaKafkaConsumer) Run(parent context.Context) error {
+
+	ctx, cancel := context.WithCancel(parent)
 
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
@@ -90,27 +167,35 @@ func (s *saramaKafkaConsumer) Start() error {
 		}
 	}()
 
-	<-s.consumer.Ready // Esperamos a que el consumer este configurado
-	Log.Info("message", "Sarama Consumer inicializado!")
-
-	sigterm := make(chan os.Signal, 1)
-	signal.Notify(sigterm, syscall.SIGINT, syscall.SIGTERM)
-
+	// Esperamos a que el consumer este configurado
 	select {
+	case <-s.consumer.Ready:
+		Log.Info("message", "Sarama Consumer inicializado!")
 	case <-ctx.Done():
-		Log.Info("message", "Terminando: Contexto cancelado")
-	case <-sigterm:
-		Log.Warn("message", "Terminando: por signal")
 	}
 
+	if s.backpressure != nil {
+		go s.backpressure.Run(ctx)
+	}
+
+	<-ctx.Done()
+	Log.Info("message", "Terminando: Contexto cancelado")
+
 	cancel()
 	wg.Wait()
+	s.consumer.Close()
 	if err := s.client.Close(); err != nil {
 		Log.Error(
 			"errorMessage", "Error cerrando cliente",
 			"error", err)
 	}
 
+	if err := s.saramaClient.Close(); err != nil && err != sarama.ErrClosedClient {
+		Log.Error(
+			"errorMessage", "Error cerrando cliente sarama",
+			"error", err)
+	}
+
 	return nil
 }
 
@@ -135,6 +220,7 @@ func createBaseConsumer(consumerCfg ConsumerGroupInput, msgHandler MessageHandle
 	}
 
 	consumer := NewBaseConsumer(msgHandler, errorHandler)
+	consumer.HandlerTimeout = conf.HandlerTimeout
 
 	return conf, consumer, err
 }
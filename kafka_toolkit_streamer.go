@@ -2,21 +2,31 @@ package kafka_toolkit
 
 // MakeStreamer crea un consumer de tipo streamer
 func MakeStreamerBuilder(consumerCfg ConsumerGroupInput, processor StreamProcessor, producerCfg BaseProducerConfigInput, asyncProduce bool) (builder SaramaConsumerBuilder, err error) {
-	var producer MessageProducer
-
-	if asyncProduce {
-		producer, err = NewSimpleAsyncProducer(producerCfg)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		producer, err = NewSimpleSyncProducer(producerCfg)
-		if err != nil {
-			return nil, err
-		}
+	producer, err := newStreamerProducer(producerCfg, asyncProduce)
+	if err != nil {
+		return nil, err
 	}
 
 	handler := NewStreamHandler(producer, processor)
 
 	return MakeSaramaConsumerBuilder(consumerCfg, handler), nil
 }
+
+// MakeFanOutStreamerBuilder crea un consumer de tipo streamer que puede enviar cero, uno o varios mensajes
+// por mensaje de entrada, el topico del producer se utiliza para los mensajes sin topico de destino
+func MakeFanOutStreamerBuilder(consumerCfg ConsumerGroupInput, processor FanOutStreamProcessor, producerCfg BaseProducerConfigInput, asyncProduce bool) (builder SaramaConsumerBuilder, err error) {
+	producer, err := newStreamerProducer(producerCfg, asyncProduce)
+	if err != nil {
+		return nil, err
+	}
+
+	return MakeSaramaConsumerBuilder(consumerCfg, NewFanOutStreamHandler(producer, processor)), nil
+}
+
+func newStreamerProducer(producerCfg BaseProducerConfigInput, asyncProduce bool) (MessageProducer, error) {
+	if asyncProduce {
+		return NewSimpleAsyncProducer(producerCfg)
+	}
+
+	return NewSimpleSyncProducer(producerCfg)
+}
@@ -0,0 +1,141 @@
+package kafkatest
+
+import (
+	"strings"
+	"testing"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+// AssertProducedCount verifica la cantidad de mensajes enviados al topico
+func AssertProducedCount(t testing.TB, producer *RecordingProducer, topic string, expected int) {
+	t.Helper()
+
+	if produced := len(producer.MessagesTo(topic)); produced != expected {
+		t.Errorf("kafkatest: se esperaban %d mensajes en %s, se enviaron %d", expected, topic, produced)
+	}
+}
+
+// AssertProducedValues verifica en orden los valores de los mensajes enviados al topico
+func AssertProducedValues(t testing.TB, producer *RecordingProducer, topic string, expected ...string) {
+	t.Helper()
+
+	assertValues(t, topic, producer.MessagesTo(topic), expected)
+}
+
+// AssertProducedKeys verifica en orden las keys de los mensajes enviados al topico
+func AssertProducedKeys(t testing.TB, producer *RecordingProducer, topic string, expected ...string) {
+	t.Helper()
+
+	messages := producer.MessagesTo(topic)
+	if len(messages) != len(expected) {
+		t.Errorf("kafkatest: se esperaban %d mensajes en %s, se enviaron %d", len(expected), topic, len(messages))
+		return
+	}
+
+	for i, message := range messages {
+		if string(message.Key) != expected[i] {
+			t.Errorf("kafkatest: key del mensaje %d en %s: se esperaba %q, se obtuvo %q", i, topic, expected[i], string(message.Key))
+		}
+	}
+}
+
+// AssertProducedHeader verifica el header de todos los mensajes enviados al topico
+func AssertProducedHeader(t testing.TB, producer *RecordingProducer, topic string, header string, expected string) {
+	t.Helper()
+
+	for i, message := range producer.MessagesTo(topic) {
+		if value := message.Headers[header]; value != expected {
+			t.Errorf("kafkatest: header %s del mensaje %d en %s: se esperaba %q, se obtuvo %q", header, i, topic, expected, value)
+		}
+	}
+}
+
+// AssertTopicValues verifica en orden los valores de los mensajes del topico en el cluster
+func AssertTopicValues(t testing.TB, cluster *Cluster, topic string, expected ...string) {
+	t.Helper()
+
+	messages := cluster.Messages(topic)
+	producerMessages := make([]*kafka.ProducerMessage, len(messages))
+	for i, message := range messages {
+		producerMessages[i] = &kafka.ProducerMessage{Key: message.Key, Msg: message.Msg, Headers: message.Headers, Topic: topic}
+	}
+
+	assertValues(t, topic, producerMessages, expected)
+}
+
+// AssertMarked verifica el offset marcado en la sesion, el siguiente offset a consumir
+func AssertMarked(t testing.TB, session *FakeConsumerGroupSession, topic string, partition int32, expected int64) {
+	t.Helper()
+
+	offset, ok := session.Offset(topic, partition)
+	if !ok {
+		t.Errorf("kafkatest: sin offset marcado en %s/%d, se esperaba %d", topic, partition, expected)
+		return
+	}
+
+	if offset != expected {
+		t.Errorf("kafkatest: offset marcado en %s/%d: se esperaba %d, se obtuvo %d", topic, partition, expected, offset)
+	}
+}
+
+// AssertCommitted verifica el offset comprometido por el consumer group en el cluster
+func AssertCommitted(t testing.TB, cluster *Cluster, group string, topic string, partition int32, expected int64) {
+	t.Helper()
+
+	offset, ok := cluster.Committed(group, topic, partition)
+	if !ok {
+		t.Errorf("kafkatest: grupo %s sin offset comprometido en %s/%d, se esperaba %d", group, topic, partition, expected)
+		return
+	}
+
+	if offset != expected {
+		t.Errorf("kafkatest: offset comprometido por %s en %s/%d: se esperaba %d, se obtuvo %d", group, topic, partition, expected, offset)
+	}
+}
+
+// AssertErrorCount verifica la cantidad de llamadas al error handler
+func AssertErrorCount(t testing.TB, handler *RecordingErrorHandler, expected int) {
+	t.Helper()
+
+	if calls := len(handler.Calls()); calls != expected {
+		t.Errorf("kafkatest: se esperaban %d llamadas al error handler, se obtuvieron %d", expected, calls)
+	}
+}
+
+// AssertNoErrors verifica que el error handler no fue llamado
+func AssertNoErrors(t testing.TB, handler *RecordingErrorHandler) {
+	t.Helper()
+
+	for _, call := range handler.Calls() {
+		t.Errorf("kafkatest: llamada inesperada al error handler: %v (mensaje %q)", call.Err, string(call.Message))
+	}
+}
+
+// AssertErrorContains verifica que alguna llamada al error handler contenga el texto en el error
+func AssertErrorContains(t testing.TB, handler *RecordingErrorHandler, substr string) {
+	t.Helper()
+
+	for _, call := range handler.Calls() {
+		if call.Err != nil && strings.Contains(call.Err.Error(), substr) {
+			return
+		}
+	}
+
+	t.Errorf("kafkatest: ninguna llamada al error handler contiene %q", substr)
+}
+
+func assertValues(t testing.TB, topic string, messages []*kafka.ProducerMessage, expected []string) {
+	t.Helper()
+
+	if len(messages) != len(expected) {
+		t.Errorf("kafkatest: se esperaban %d mensajes en %s, se obtuvieron %d", len(expected), topic, len(messages))
+		return
+	}
+
+	for i, message := range messages {
+		if string(message.Msg) != expected[i] {
+			t.Errorf("kafkatest: valor del mensaje %d en %s: se esperaba %q, se obtuvo %q", i, topic, expected[i], string(message.Msg))
+		}
+	}
+}
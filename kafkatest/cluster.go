@@ -0,0 +1,286 @@
+package kafkatest
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+// DefaultPartitions particiones de los topicos creados automaticamente
+var DefaultPartitions int32 = 1
+
+// Cluster log en memoria de topicos y particiones con offsets comprometidos por consumer group
+type Cluster struct {
+	mu        sync.Mutex
+	topics    map[string][][]*sarama.ConsumerMessage
+	committed map[string]map[string]map[int32]int64
+	next      int32
+}
+
+// NewCluster constructor de Cluster
+func NewCluster() *Cluster {
+	EnsureLogger()
+
+	return &Cluster{
+		topics:    make(map[string][][]*sarama.ConsumerMessage),
+		committed: make(map[string]map[string]map[int32]int64),
+	}
+}
+
+// CreateTopic crea el topico con la cantidad de particiones indicada, no modifica un topico existente
+func (c *Cluster) CreateTopic(topic string, partitions int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.createTopicLocked(topic, partitions)
+}
+
+// Append agrega un mensaje al final de la particion y retorna su offset, el topico se crea si no existe
+func (c *Cluster) Append(topic string, partition int32, key []byte, value []byte, headers map[string]string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.appendLocked(topic, partition, key, value, headers, time.Now())
+}
+
+// Records mensajes de la particion desde el offset indicado
+func (c *Cluster) Records(topic string, partition int32, from int64) []*sarama.ConsumerMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	partitions := c.topics[topic]
+	if int(partition) >= len(partitions) || from >= int64(len(partitions[partition])) {
+		return nil
+	}
+
+	if from < 0 {
+		from = 0
+	}
+
+	return append([]*sarama.ConsumerMessage(nil), partitions[partition][from:]...)
+}
+
+// Messages todos los mensajes del topico convertidos a kafka.ConsumerMessage, ordenados por particion y offset
+func (c *Cluster) Messages(topic string) []*kafka.ConsumerMessage {
+	var messages []*kafka.ConsumerMessage
+
+	for partition := int32(0); partition < c.Partitions(topic); partition++ {
+		for _, record := range c.Records(topic, partition, 0) {
+			messages = append(messages, toConsumerMessage(record))
+		}
+	}
+
+	return messages
+}
+
+// Partitions cantidad de particiones del topico, 0 si no existe
+func (c *Cluster) Partitions(topic string) int32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return int32(len(c.topics[topic]))
+}
+
+// HighWaterMark offset siguiente al ultimo mensaje de la particion
+func (c *Cluster) HighWaterMark(topic string, partition int32) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	partitions := c.topics[topic]
+	if int(partition) >= len(partitions) {
+		return 0
+	}
+
+	return int64(len(partitions[partition]))
+}
+
+// Committed offset comprometido por el consumer group en la particion
+func (c *Cluster) Committed(group string, topic string, partition int32) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	offset, ok := c.committed[group][topic][partition]
+
+	return offset, ok
+}
+
+// Commit compromete el offset del consumer group en la particion
+func (c *Cluster) Commit(group string, topic string, partition int32, offset int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.committed[group] == nil {
+		c.committed[group] = make(map[string]map[int32]int64)
+	}
+
+	if c.committed[group][topic] == nil {
+		c.committed[group][topic] = make(map[int32]int64)
+	}
+
+	c.committed[group][topic][partition] = offset
+}
+
+// Producer crea un kafka.MessageProducer que escribe en el cluster. Los mensajes con key se asignan a una
+// particion por hash de la key y los mensajes sin key en round robin.
+func (c *Cluster) Producer(topic string) kafka.MessageProducer {
+	return &clusterProducer{cluster: c, topic: topic}
+}
+
+// Consumer crea un consumer del topico para el consumer group, implementa kafka.KafkaConsumer. Procesa con un
+// BaseConsumer propio, para probar consumers construidos con los builders del toolkit se utiliza MockCluster
+// con RunConsumer.
+func (c *Cluster) Consumer(group string, topic string, handler kafka.MessageHandler, errorHandler kafka.ConsumerErrorHandler) *Consumer {
+	if errorHandler == nil {
+		errorHandler = NewRecordingErrorHandler()
+	}
+
+	base := kafka.NewBaseConsumer(handler, errorHandler)
+
+	return &Consumer{cluster: c, group: group, topic: topic, base: &base}
+}
+
+func (c *Cluster) createTopicLocked(topic string, partitions int32) {
+	if _, ok := c.topics[topic]; ok {
+		return
+	}
+
+	if partitions <= 0 {
+		partitions = DefaultPartitions
+	}
+
+	c.topics[topic] = make([][]*sarama.ConsumerMessage, partitions)
+}
+
+func (c *Cluster) appendLocked(topic string, partition int32, key []byte, value []byte, headers map[string]string, timestamp time.Time) (int64, error) {
+	c.createTopicLocked(topic, DefaultPartitions)
+
+	partitions := c.topics[topic]
+	if partition < 0 || int(partition) >= len(partitions) {
+		return 0, fmt.Errorf("kafkatest: particion %d invalida para topico %s", partition, topic)
+	}
+
+	message := &sarama.ConsumerMessage{
+		Topic:     topic,
+		Partition: partition,
+		Offset:    int64(len(partitions[partition])),
+		Key:       key,
+		Value:     value,
+		Timestamp: timestamp,
+	}
+
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		message.Headers = append(message.Headers, &sarama.RecordHeader{Key: []byte(k), Value: []byte(headers[k])})
+	}
+
+	partitions[partition] = append(partitions[partition], message)
+
+	return message.Offset, nil
+}
+
+type clusterProducer struct {
+	cluster *Cluster
+	topic   string
+}
+
+func (p *clusterProducer) SendMessage(ctx context.Context, msg *kafka.ProducerMessage) error {
+	topic := msg.Topic
+	if topic == "" {
+		topic = p.topic
+	}
+
+	p.cluster.mu.Lock()
+	defer p.cluster.mu.Unlock()
+
+	p.cluster.createTopicLocked(topic, DefaultPartitions)
+	partitions := int32(len(p.cluster.topics[topic]))
+
+	var partition int32
+	if msg.Key != nil {
+		hash := fnv.New32a()
+		hash.Write(msg.Key)
+		partition = int32(hash.Sum32() % uint32(partitions))
+	} else {
+		partition = p.cluster.next % partitions
+		p.cluster.next++
+	}
+
+	_, err := p.cluster.appendLocked(topic, partition, msg.Key, msg.Msg, msg.Headers, time.Now())
+
+	return err
+}
+
+// Consumer consumer en memoria de un topico del cluster. Start procesa los mensajes disponibles desde el
+// offset comprometido del grupo a traves de BaseConsumer.ConsumeClaim y compromete los offsets marcados.
+type Consumer struct {
+	cluster *Cluster
+	group   string
+	topic   string
+	base    *kafka.BaseConsumer
+}
+
+// Base consumer base, permite configurar por ejemplo HandlerTimeout
+func (c *Consumer) Base() *kafka.BaseConsumer {
+	return c.base
+}
+
+// Start implementa kafka.KafkaConsumer, procesa los mensajes disponibles y retorna
+func (c *Consumer) Start() error {
+	for partition := int32(0); partition < c.cluster.Partitions(c.topic); partition++ {
+		from, _ := c.cluster.Committed(c.group, c.topic, partition)
+
+		records := c.cluster.Records(c.topic, partition, from)
+		if len(records) == 0 {
+			continue
+		}
+
+		messages := make([]*sarama.ConsumerMessage, len(records))
+		for i, record := range records {
+			copied := *record
+			messages[i] = &copied
+		}
+
+		session := NewFakeConsumerGroupSession(map[string][]int32{c.topic: {partition}})
+		claim := NewFakeConsumerGroupClaim(c.topic, partition, from, messages...)
+
+		err := ConsumeClaim(c.base, session, claim)
+
+		if offset, ok := session.Offset(c.topic, partition); ok {
+			c.cluster.Commit(c.group, c.topic, partition, offset)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func toConsumerMessage(record *sarama.ConsumerMessage) *kafka.ConsumerMessage {
+	headers := make(map[string]string, len(record.Headers))
+	for _, header := range record.Headers {
+		headers[string(header.Key)] = string(header.Value)
+	}
+
+	return &kafka.ConsumerMessage{
+		Headers:   headers,
+		Timestamp: record.Timestamp,
+		Key:       record.Key,
+		Msg:       record.Value,
+		Topic:     record.Topic,
+		Partition: record.Partition,
+		Offset:    record.Offset,
+	}
+}
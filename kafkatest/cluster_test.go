@@ -0,0 +1,91 @@
+package kafkatest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+func TestClusterProducerPartitionsByKey(t *testing.T) {
+	cluster := kafkatest.NewCluster()
+	cluster.CreateTopic("orders", 3)
+
+	producer := cluster.Producer("orders")
+	for _, value := range []string{"uno", "dos", "tres"} {
+		if err := producer.SendMessage(context.Background(), &kafka.ProducerMessage{Key: []byte("cliente-1"), Msg: []byte(value)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kafkatest.AssertTopicValues(t, cluster, "orders", "uno", "dos", "tres")
+
+	partitions := map[int32]bool{}
+	for _, message := range cluster.Messages("orders") {
+		partitions[message.Partition] = true
+	}
+
+	if len(partitions) != 1 {
+		t.Errorf("los mensajes con la misma key deben quedar en una particion, se obtuvo %v", partitions)
+	}
+}
+
+func TestClusterConsumerResumesFromCommittedOffset(t *testing.T) {
+	cluster := kafkatest.NewCluster()
+	cluster.CreateTopic("orders", 1)
+
+	for _, value := range []string{"uno", "dos"} {
+		if _, err := cluster.Append("orders", 0, nil, []byte(value), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var handled []string
+	handler := kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		handled = append(handled, string(inMsg.Msg))
+		return nil
+	})
+
+	consumer := cluster.Consumer("billing", "orders", handler, nil)
+	if err := consumer.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	kafkatest.AssertCommitted(t, cluster, "billing", "orders", 0, 2)
+
+	if _, err := cluster.Append("orders", 0, nil, []byte("tres"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := consumer.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	kafkatest.AssertCommitted(t, cluster, "billing", "orders", 0, 3)
+
+	if len(handled) != 3 || handled[2] != "tres" {
+		t.Errorf("mensajes procesados: se esperaba [uno dos tres] sin repetir, se obtuvo %v", handled)
+	}
+}
+
+func TestClusterConsumerReportsHandlerErrors(t *testing.T) {
+	cluster := kafkatest.NewCluster()
+	if _, err := cluster.Append("orders", 0, []byte("key"), []byte("invalido"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	errorHandler := kafkatest.NewRecordingErrorHandler()
+	handler := kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		return errors.New("mensaje invalido")
+	})
+
+	if err := cluster.Consumer("billing", "orders", handler, errorHandler).Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	kafkatest.AssertErrorCount(t, errorHandler, 1)
+	kafkatest.AssertErrorContains(t, errorHandler, "mensaje invalido")
+	kafkatest.AssertCommitted(t, cluster, "billing", "orders", 0, 1)
+}
@@ -0,0 +1,429 @@
+package kafkatest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+const (
+	// MockKafkaVersion version de Kafka que anuncian los inputs generados por MockCluster
+	MockKafkaVersion = "2.1.0"
+
+	mockLeaderID = "kafkatest-leader"
+	// mockProduceVersion version de ProduceRequest que utiliza sarama con MockKafkaVersion
+	mockProduceVersion = 3
+	// mockFetchVersion version de FetchRequest que utiliza sarama con MockKafkaVersion
+	mockFetchVersion = 10
+)
+
+// MockRecord registro publicado con SetRecords, Value nil representa un tombstone
+type MockRecord struct {
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+	Timestamp time.Time
+}
+
+// MockClusterConfig configuracion de MockCluster
+type MockClusterConfig struct {
+	// Topics particiones por topico
+	Topics map[string]int32
+	// Users usuarios y passwords SCRAM, habilita SASL/SCRAM sobre TLS en el broker
+	Users map[string]string
+	// Mechanism mecanismo SCRAM de los inputs generados, por defecto SCRAM-SHA-512
+	Mechanism string
+}
+
+// MockCluster broker en proceso construido sobre sarama.MockBroker, responde metadata, produce, fetch,
+// consumer groups, commit de offsets y handshake SASL. Con usuarios configurados acepta solo conexiones
+// TLS autenticadas con SCRAM, verificadas con un servidor SCRAM real.
+type MockCluster struct {
+	Broker *sarama.MockBroker
+
+	t             testing.TB
+	config        MockClusterConfig
+	caFile        string
+	authenticator *scramAuthenticator
+
+	mu          sync.Mutex
+	handlers    map[string]sarama.MockResponse
+	records     map[string]map[int32][]MockRecord
+	fetch       *sarama.MockFetchResponse
+	produce     *sarama.MockProduceResponse
+	offsets     *sarama.MockOffsetResponse
+	offsetFetch *sarama.MockOffsetFetchResponse
+	coordinator *sarama.MockFindCoordinatorResponse
+	metadata    *sarama.MockMetadataResponse
+	closeOnce   sync.Once
+}
+
+// NewMockCluster inicia el broker, se cierra automaticamente al terminar el test
+func NewMockCluster(t testing.TB, config MockClusterConfig) *MockCluster {
+	t.Helper()
+	EnsureLogger()
+
+	if config.Mechanism == "" {
+		config.Mechanism = sarama.SASLTypeSCRAMSHA512
+	}
+
+	cluster := &MockCluster{
+		t:      t,
+		config: config,
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("kafkatest: error iniciando listener: %v", err)
+	}
+
+	if len(config.Users) > 0 {
+		listener = cluster.secureListener(listener)
+	}
+
+	cluster.Broker = sarama.NewMockBrokerListener(t, 1, listener)
+	t.Cleanup(cluster.Close)
+
+	cluster.metadata = sarama.NewMockMetadataResponse(t).
+		SetBroker(cluster.Broker.Addr(), cluster.Broker.BrokerID()).
+		SetController(cluster.Broker.BrokerID())
+	cluster.fetch = sarama.NewMockFetchResponse(t, 100)
+	cluster.produce = sarama.NewMockProduceResponse(t).SetVersion(mockProduceVersion)
+	cluster.offsets = sarama.NewMockOffsetResponse(t)
+	cluster.offsetFetch = sarama.NewMockOffsetFetchResponse(t)
+	cluster.coordinator = sarama.NewMockFindCoordinatorResponse(t)
+
+	for topic, partitions := range config.Topics {
+		for partition := int32(0); partition < partitions; partition++ {
+			cluster.metadata.SetLeader(topic, partition, cluster.Broker.BrokerID())
+			cluster.setNewest(topic, partition, 0)
+		}
+	}
+
+	cluster.handlers = map[string]sarama.MockResponse{
+		"MetadataRequest":        cluster.metadata,
+		"ProduceRequest":         cluster.produce,
+		"FetchRequest":           cluster.fetch,
+		"OffsetRequest":          cluster.offsets,
+		"FindCoordinatorRequest": cluster.coordinator,
+		"JoinGroupRequest": sarama.NewMockJoinGroupResponse(t).
+			SetGenerationId(1).
+			SetGroupProtocol(sarama.RangeBalanceStrategyName).
+			SetMemberId("kafkatest-member").
+			SetLeaderId(mockLeaderID),
+		"SyncGroupRequest":     sarama.NewMockSyncGroupResponse(t).SetMemberAssignment(cluster.assignment()),
+		"HeartbeatRequest":     sarama.NewMockHeartbeatResponse(t),
+		"OffsetFetchRequest":   cluster.offsetFetch,
+		"OffsetCommitRequest":  sarama.NewMockOffsetCommitResponse(t),
+		"LeaveGroupRequest":    sarama.NewMockLeaveGroupResponse(t),
+		"SaslHandshakeRequest": sarama.NewMockSaslHandshakeResponse(t).SetEnabledMechanisms([]string{sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512}),
+	}
+	cluster.Broker.SetHandlerByMap(cluster.handlers)
+
+	return cluster
+}
+
+// Close detiene el broker, puede llamarse mas de una vez
+func (c *MockCluster) Close() {
+	c.closeOnce.Do(c.Broker.Close)
+}
+
+// Addr direccion del broker
+func (c *MockCluster) Addr() string {
+	return c.Broker.Addr()
+}
+
+// SetMessages publica valores consecutivos en la particion desde el offset 0, disponibles para fetch
+func (c *MockCluster) SetMessages(topic string, partition int32, values ...string) {
+	for offset, value := range values {
+		c.fetch.SetMessage(topic, partition, int64(offset), sarama.StringEncoder(value))
+	}
+
+	c.fetch.SetHighWaterMark(topic, partition, int64(len(values)))
+	c.setNewest(topic, partition, int64(len(values)))
+}
+
+// SetRecords publica registros con key, headers y timestamp en la particion desde el offset 0. Desde la primera
+// llamada el fetch responde solo los registros de SetRecords, por lo que no se combina con SetMessages.
+func (c *MockCluster) SetRecords(topic string, partition int32, records ...MockRecord) {
+	c.mu.Lock()
+	if c.records == nil {
+		c.records = make(map[string]map[int32][]MockRecord)
+	}
+	if c.records[topic] == nil {
+		c.records[topic] = make(map[int32][]MockRecord)
+	}
+	c.records[topic][partition] = records
+
+	// El broker lee el mapa de handlers sin lock, se reemplaza por una copia
+	handlers := make(map[string]sarama.MockResponse, len(c.handlers))
+	for request, response := range c.handlers {
+		handlers[request] = response
+	}
+	handlers["FetchRequest"] = sarama.NewMockWrapper(c.fetchResponseLocked())
+	c.handlers = handlers
+	c.Broker.SetHandlerByMap(handlers)
+	c.mu.Unlock()
+
+	c.setNewest(topic, partition, int64(len(records)))
+}
+
+// fetchResponseLocked respuesta de fetch con todos los registros de SetRecords, sarama descarta los offsets
+// anteriores al solicitado
+func (c *MockCluster) fetchResponseLocked() *sarama.FetchResponse {
+	response := &sarama.FetchResponse{Version: mockFetchVersion}
+
+	for topic, partitions := range c.records {
+		for partition, records := range partitions {
+			for offset, record := range records {
+				var key, value sarama.Encoder
+				if record.Key != nil {
+					key = sarama.ByteEncoder(record.Key)
+				}
+				if record.Value != nil {
+					value = sarama.ByteEncoder(record.Value)
+				}
+
+				response.AddRecordWithTimestamp(topic, partition, key, value, int64(offset), record.Timestamp)
+
+				batch := response.GetBlock(topic, partition).RecordsSet[0].RecordBatch
+				added := batch.Records[len(batch.Records)-1]
+
+				names := make([]string, 0, len(record.Headers))
+				for name := range record.Headers {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				for _, name := range names {
+					added.Headers = append(added.Headers, &sarama.RecordHeader{Key: []byte(name), Value: []byte(record.Headers[name])})
+				}
+			}
+
+			if len(records) > 0 {
+				response.SetLastOffsetDelta(topic, partition, int32(len(records)-1))
+				response.GetBlock(topic, partition).HighWaterMarkOffset = int64(len(records))
+			}
+		}
+	}
+
+	return response
+}
+
+// SetHighWaterMark mueve el final de la particion sin publicar mensajes, simula offsets finales que no se
+// entregan al consumer (por ejemplo marcadores de transaccion)
+func (c *MockCluster) SetHighWaterMark(topic string, partition int32, offset int64) {
+	c.fetch.SetHighWaterMark(topic, partition, offset)
+	c.setNewest(topic, partition, offset)
+}
+
+// ConsumerInput configuracion de consumer del toolkit apuntando al broker, con SCRAM y TLS si hay usuarios.
+// El grupo inicia sin offsets comprometidos en el topico.
+func (c *MockCluster) ConsumerInput(topic string, group string) kafka.ConsumerGroupInput {
+	c.coordinator.SetCoordinator(sarama.CoordinatorGroup, group, c.Broker)
+	for partition := int32(0); partition < c.config.Topics[topic]; partition++ {
+		c.offsetFetch.SetOffset(group, topic, partition, -1, "", sarama.ErrNoError)
+	}
+
+	input := kafka.ConsumerGroupInput{
+		Brokers:         c.Addr(),
+		Topic:           topic,
+		Group:           group,
+		BalanceStrategy: kafka.Range,
+		Version:         MockKafkaVersion,
+		StartFrom:       "earliest",
+	}
+
+	if username, password, ok := c.firstUser(); ok {
+		input.Security = true
+		input.Username = username
+		input.Password = password
+		input.Mechanism = c.config.Mechanism
+		input.CaFile = c.caFile
+	}
+
+	return input
+}
+
+// SetCommitted define el offset comprometido por el grupo que retorna el broker al iniciar la sesion,
+// se debe invocar despues de ConsumerInput
+func (c *MockCluster) SetCommitted(group string, topic string, partition int32, offset int64) {
+	c.offsetFetch.SetOffset(group, topic, partition, offset, "", sarama.ErrNoError)
+}
+
+// SetProduceError hace fallar con kerror las solicitudes de produce a la particion, se debe invocar antes de producir
+func (c *MockCluster) SetProduceError(topic string, partition int32, kerror sarama.KError) {
+	c.produce.SetError(topic, partition, kerror)
+}
+
+// ProducerInput configuracion de producer del toolkit apuntando al broker, con SCRAM y TLS si hay usuarios
+func (c *MockCluster) ProducerInput(topic string) kafka.BaseProducerConfigInput {
+	input := kafka.BaseProducerConfigInput{
+		Brokers: c.Addr(),
+		Topic:   topic,
+		Ack:     int16(sarama.WaitForLocal),
+		Version: MockKafkaVersion,
+	}
+
+	if username, password, ok := c.firstUser(); ok {
+		input.Security = true
+		input.Username = username
+		input.Password = password
+		input.Mechanism = c.config.Mechanism
+		input.CaFile = c.caFile
+	}
+
+	return input
+}
+
+// ProduceRequests cantidad de solicitudes de produce recibidas
+func (c *MockCluster) ProduceRequests() int {
+	count := 0
+	for _, exchange := range c.Broker.History() {
+		if _, ok := exchange.Request.(*sarama.ProduceRequest); ok {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Committed ultimo offset comprometido por el consumer group en la particion
+func (c *MockCluster) Committed(group string, topic string, partition int32) (int64, bool) {
+	var committed int64
+	found := false
+
+	for _, exchange := range c.Broker.History() {
+		request, ok := exchange.Request.(*sarama.OffsetCommitRequest)
+		if !ok || request.ConsumerGroup != group {
+			continue
+		}
+
+		if offset, _, err := request.Offset(topic, partition); err == nil {
+			committed = offset
+			found = true
+		}
+	}
+
+	return committed, found
+}
+
+// Authentications cantidad de autenticaciones SCRAM exitosas y fallidas
+func (c *MockCluster) Authentications() (int, int) {
+	if c.authenticator == nil {
+		return 0, 0
+	}
+
+	return c.authenticator.counts()
+}
+
+func (c *MockCluster) setNewest(topic string, partition int32, offset int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.offsets.SetOffset(topic, partition, sarama.OffsetOldest, 0)
+	c.offsets.SetOffset(topic, partition, sarama.OffsetNewest, offset)
+}
+
+// assignment asigna todas las particiones de los topicos configurados al unico miembro del grupo
+func (c *MockCluster) assignment() *sarama.ConsumerGroupMemberAssignment {
+	assignment := &sarama.ConsumerGroupMemberAssignment{Topics: make(map[string][]int32)}
+
+	for topic, partitions := range c.config.Topics {
+		for partition := int32(0); partition < partitions; partition++ {
+			assignment.Topics[topic] = append(assignment.Topics[topic], partition)
+		}
+	}
+
+	return assignment
+}
+
+func (c *MockCluster) firstUser() (string, string, bool) {
+	if len(c.config.Users) == 0 {
+		return "", "", false
+	}
+
+	usernames := make([]string, 0, len(c.config.Users))
+	for username := range c.config.Users {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	return usernames[0], c.config.Users[usernames[0]], true
+}
+
+// secureListener genera un certificado autofirmado para 127.0.0.1, escribe el CA para los inputs y
+// envuelve el listener con TLS y autenticacion SCRAM
+func (c *MockCluster) secureListener(listener net.Listener) net.Listener {
+	authenticator, err := newScramAuthenticator(c.config.Users)
+	if err != nil {
+		c.t.Fatalf("kafkatest: error configurando SCRAM: %v", err)
+	}
+	c.authenticator = authenticator
+
+	certificate, caPEM, err := selfSignedCertificate()
+	if err != nil {
+		c.t.Fatalf("kafkatest: error generando certificado: %v", err)
+	}
+
+	c.caFile = filepath.Join(c.t.TempDir(), "ca.pem")
+	if err := os.WriteFile(c.caFile, caPEM, 0600); err != nil {
+		c.t.Fatalf("kafkatest: error escribiendo CA: %v", err)
+	}
+
+	tlsListener := tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{certificate}})
+
+	return &saslListener{Listener: tlsListener, authenticator: authenticator}
+}
+
+func selfSignedCertificate() (tls.Certificate, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "kafkatest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+
+	return certificate, certPEM, err
+}
@@ -0,0 +1,323 @@
+package kafkatest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/xdg-go/scram"
+)
+
+const (
+	apiKeySaslHandshake    int16 = 17
+	apiKeySaslAuthenticate int16 = 36
+
+	scramSalt       = "kafkatest-salt"
+	scramIterations = 4096
+)
+
+// scramAuthenticator servidor SCRAM real para los usuarios configurados, sarama.MockBroker solo
+// permite respuestas SASL fijas y SCRAM requiere responder al nonce de cada cliente
+type scramAuthenticator struct {
+	mu        sync.Mutex
+	servers   map[string]*scram.Server
+	succeeded int
+	failed    int
+}
+
+func newScramAuthenticator(users map[string]string) (*scramAuthenticator, error) {
+	authenticator := &scramAuthenticator{servers: make(map[string]*scram.Server)}
+
+	for mechanism, hashGenerator := range map[string]scram.HashGeneratorFcn{
+		sarama.SASLTypeSCRAMSHA256: kafka.SHA256,
+		sarama.SASLTypeSCRAMSHA512: kafka.SHA512,
+	} {
+		credentials := make(map[string]scram.StoredCredentials, len(users))
+		for username, password := range users {
+			client, err := hashGenerator.NewClient(username, password, "")
+			if err != nil {
+				return nil, err
+			}
+
+			credentials[username] = client.GetStoredCredentials(scram.KeyFactors{Salt: scramSalt, Iters: scramIterations})
+		}
+
+		server, err := hashGenerator.NewServer(func(username string) (scram.StoredCredentials, error) {
+			stored, ok := credentials[username]
+			if !ok {
+				return scram.StoredCredentials{}, fmt.Errorf("usuario desconocido %s", username)
+			}
+
+			return stored, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		authenticator.servers[mechanism] = server
+	}
+
+	return authenticator, nil
+}
+
+func (a *scramAuthenticator) conversation(mechanism string) *scram.ServerConversation {
+	server, ok := a.servers[mechanism]
+	if !ok {
+		return nil
+	}
+
+	return server.NewConversation()
+}
+
+func (a *scramAuthenticator) record(valid bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if valid {
+		a.succeeded++
+	} else {
+		a.failed++
+	}
+}
+
+func (a *scramAuthenticator) counts() (int, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.succeeded, a.failed
+}
+
+// saslListener entrega al MockBroker las conexiones aceptadas, resolviendo localmente el intercambio SCRAM
+type saslListener struct {
+	net.Listener
+	authenticator *scramAuthenticator
+}
+
+func (l *saslListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &saslConn{Conn: conn, reader: bufio.NewReader(conn), authenticator: l.authenticator}, nil
+}
+
+// saslConn conexion que intercepta SaslAuthenticate (handshake v1) y los frames SCRAM crudos (handshake v0),
+// el resto de las solicitudes llegan sin cambios al MockBroker
+type saslConn struct {
+	net.Conn
+	reader        *bufio.Reader
+	authenticator *scramAuthenticator
+
+	writeMu      sync.Mutex
+	pending      []byte
+	rawHandshake bool
+	conversation *scram.ServerConversation
+}
+
+func (c *saslConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		frame, err := c.readFrame()
+		if err != nil {
+			return 0, err
+		}
+
+		intercepted, err := c.intercept(frame)
+		if err != nil {
+			return 0, err
+		}
+
+		if !intercepted {
+			c.pending = frame
+		}
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+
+	return n, nil
+}
+
+func (c *saslConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.Conn.Write(p)
+}
+
+func (c *saslConn) readFrame() ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, 4+binary.BigEndian.Uint32(header))
+	copy(frame, header)
+	if _, err := io.ReadFull(c.reader, frame[4:]); err != nil {
+		return nil, err
+	}
+
+	return frame, nil
+}
+
+// intercept resuelve el frame si corresponde a la autenticacion SCRAM, retorna false para reenviarlo al broker
+func (c *saslConn) intercept(frame []byte) (bool, error) {
+	if c.rawHandshake && c.conversation != nil {
+		return true, c.stepRaw(frame[4:])
+	}
+
+	if len(frame) < 12 {
+		return false, nil
+	}
+
+	apiKey := int16(binary.BigEndian.Uint16(frame[4:6]))
+	apiVersion := int16(binary.BigEndian.Uint16(frame[6:8]))
+	correlationID := frame[8:12]
+
+	body, ok := skipClientID(frame[12:])
+	if !ok {
+		return false, nil
+	}
+
+	switch apiKey {
+	case apiKeySaslHandshake:
+		mechanism, _ := readString(body)
+		c.conversation = c.authenticator.conversation(mechanism)
+		c.rawHandshake = apiVersion == 0 && strings.HasPrefix(mechanism, "SCRAM")
+		return false, nil
+	case apiKeySaslAuthenticate:
+		if c.conversation == nil {
+			return false, nil
+		}
+
+		return true, c.stepAuthenticate(apiVersion, correlationID, body)
+	}
+
+	return false, nil
+}
+
+func (c *saslConn) stepRaw(challenge []byte) error {
+	response, err := c.conversation.Step(string(challenge))
+	if err != nil {
+		// Sin respuesta de error en el protocolo v0, el broker cierra la conexion
+		c.finish(false)
+		c.Conn.Close()
+		return io.EOF
+	}
+
+	frame := make([]byte, 4+len(response))
+	binary.BigEndian.PutUint32(frame, uint32(len(response)))
+	copy(frame[4:], response)
+
+	if _, err := c.Write(frame); err != nil {
+		return err
+	}
+
+	if c.conversation.Done() {
+		c.finish(c.conversation.Valid())
+	}
+
+	return nil
+}
+
+func (c *saslConn) stepAuthenticate(apiVersion int16, correlationID []byte, body []byte) error {
+	if len(body) < 4 {
+		return errors.New("kafkatest: SaslAuthenticate invalido")
+	}
+
+	authBytes := body[4:]
+	if length := int(binary.BigEndian.Uint32(body[:4])); length <= len(authBytes) {
+		authBytes = authBytes[:length]
+	}
+
+	response, err := c.conversation.Step(string(authBytes))
+
+	res := make([]byte, 0, 64+len(response))
+	res = append(res, 0, 0, 0, 0)
+	res = append(res, correlationID...)
+
+	if err != nil {
+		res = appendInt16(res, int16(sarama.ErrSASLAuthenticationFailed))
+		res = appendString(res, err.Error())
+		res = appendInt32(res, -1)
+		c.finish(false)
+	} else {
+		res = appendInt16(res, int16(sarama.ErrNoError))
+		res = appendInt16(res, -1)
+		res = appendInt32(res, int32(len(response)))
+		res = append(res, response...)
+	}
+
+	if apiVersion >= 1 {
+		res = append(res, 0, 0, 0, 0, 0, 0, 0, 0)
+	}
+
+	binary.BigEndian.PutUint32(res, uint32(len(res)-4))
+
+	if _, err := c.Write(res); err != nil {
+		return err
+	}
+
+	if err == nil && c.conversation.Done() {
+		c.finish(c.conversation.Valid())
+	}
+
+	return nil
+}
+
+func (c *saslConn) finish(valid bool) {
+	c.authenticator.record(valid)
+	c.conversation = nil
+	c.rawHandshake = false
+}
+
+func skipClientID(data []byte) ([]byte, bool) {
+	if len(data) < 2 {
+		return nil, false
+	}
+
+	length := int(int16(binary.BigEndian.Uint16(data[:2])))
+	if length < 0 {
+		return data[2:], true
+	}
+
+	if len(data) < 2+length {
+		return nil, false
+	}
+
+	return data[2+length:], true
+}
+
+func readString(data []byte) (string, bool) {
+	if len(data) < 2 {
+		return "", false
+	}
+
+	length := int(binary.BigEndian.Uint16(data[:2]))
+	if len(data) < 2+length {
+		return "", false
+	}
+
+	return string(data[2 : 2+length]), true
+}
+
+func appendInt16(b []byte, v int16) []byte {
+	return append(b, byte(uint16(v)>>8), byte(uint16(v)))
+}
+
+func appendInt32(b []byte, v int32) []byte {
+	u := uint32(v)
+	return append(b, byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendInt16(b, int16(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,129 @@
+package kafkatest
+
+import (
+	"context"
+	"sync"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+// RecordingProducer implementa kafka.MessageProducer y registra los mensajes enviados
+type RecordingProducer struct {
+	mu       sync.Mutex
+	topic    string
+	messages []*kafka.ProducerMessage
+	err      error
+}
+
+// NewRecordingProducer constructor de RecordingProducer, topic se utiliza para los mensajes sin topico de destino
+func NewRecordingProducer(topic string) *RecordingProducer {
+	return &RecordingProducer{topic: topic}
+}
+
+// SendMessage implementa kafka.MessageProducer
+func (p *RecordingProducer) SendMessage(ctx context.Context, msg *kafka.ProducerMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+
+	recorded := *msg
+	if recorded.Topic == "" {
+		recorded.Topic = p.topic
+	}
+	p.messages = append(p.messages, &recorded)
+
+	return nil
+}
+
+// FailWith hace que los envios siguientes retornen err, nil vuelve a aceptar mensajes
+func (p *RecordingProducer) FailWith(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.err = err
+}
+
+// Messages mensajes enviados en orden
+func (p *RecordingProducer) Messages() []*kafka.ProducerMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*kafka.ProducerMessage(nil), p.messages...)
+}
+
+// MessagesTo mensajes enviados al topico en orden
+func (p *RecordingProducer) MessagesTo(topic string) []*kafka.ProducerMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var messages []*kafka.ProducerMessage
+	for _, message := range p.messages {
+		if message.Topic == topic {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages
+}
+
+// Reset descarta los mensajes registrados
+func (p *RecordingProducer) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messages = nil
+}
+
+// ErrorCall llamada registrada a un error handler
+type ErrorCall struct {
+	Message []byte
+	Err     error
+}
+
+// RecordingErrorHandler implementa kafka.ConsumerErrorHandler y registra las llamadas
+type RecordingErrorHandler struct {
+	mu    sync.Mutex
+	calls []ErrorCall
+}
+
+// NewRecordingErrorHandler constructor de RecordingErrorHandler
+func NewRecordingErrorHandler() *RecordingErrorHandler {
+	return &RecordingErrorHandler{}
+}
+
+// HandleError implementa kafka.ConsumerErrorHandler
+func (h *RecordingErrorHandler) HandleError(messageVal []byte, err error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.calls = append(h.calls, ErrorCall{Message: messageVal, Err: err})
+
+	return nil
+}
+
+// Calls llamadas registradas en orden
+func (h *RecordingErrorHandler) Calls() []ErrorCall {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]ErrorCall(nil), h.calls...)
+}
+
+// Reset descarta las llamadas registradas
+func (h *RecordingErrorHandler) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.calls = nil
+}
+
+// HandlerFunc adapta una funcion a kafka.MessageHandler
+type HandlerFunc func(ctx context.Context, inMsg *kafka.ConsumerMessage) error
+
+// HandleMessage implementa kafka.MessageHandler
+func (f HandlerFunc) HandleMessage(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+	return f(ctx, inMsg)
+}
@@ -0,0 +1,210 @@
+package kafkatest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+// update regenera los golden files en lugar de compararlos: go test ./... -kafkatest.update
+var update = flag.Bool("kafkatest.update", false, "regenera los golden files de kafkatest en lugar de compararlos")
+
+// GoldenOutput mensaje producido a partir de un registro del fixture
+type GoldenOutput struct {
+	Topic         string            `json:"topic,omitempty"`
+	Key           string            `json:"key,omitempty"`
+	KeyEncoding   string            `json:"key_encoding,omitempty"`
+	Value         string            `json:"value"`
+	ValueEncoding string            `json:"value_encoding,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+}
+
+// GoldenRecord resultado esperado para un registro del fixture, una linea por registro en el golden file
+type GoldenRecord struct {
+	Input     int            `json:"input"`
+	Topic     string         `json:"topic"`
+	Partition int32          `json:"partition"`
+	Offset    int64          `json:"offset"`
+	Outputs   []GoldenOutput `json:"outputs"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// ReplayStreamProcessor procesa cada registro del fixture con processor y compara las salidas contra el golden file
+func ReplayStreamProcessor(t testing.TB, fixturePath string, goldenPath string, processor kafka.StreamProcessor) {
+	t.Helper()
+
+	ReplayFanOutStreamProcessor(t, fixturePath, goldenPath, kafka.FanOut(processor))
+}
+
+// ReplayFanOutStreamProcessor procesa cada registro del fixture con processor y compara las salidas contra el golden file
+func ReplayFanOutStreamProcessor(t testing.TB, fixturePath string, goldenPath string, processor kafka.FanOutStreamProcessor) {
+	t.Helper()
+	EnsureLogger()
+
+	messages := readFixture(t, fixturePath)
+
+	records := make([]GoldenRecord, 0, len(messages))
+	for i, message := range messages {
+		outMsgs, err := processor(context.Background(), message)
+		records = append(records, newGoldenRecord(i, message, outMsgs, err))
+	}
+
+	compareGolden(t, goldenPath, records)
+}
+
+// ReplayMessageHandler procesa cada registro del fixture con handler y compara contra el golden file los mensajes
+// enviados a producer durante cada registro, producer se reinicia antes de cada uno
+func ReplayMessageHandler(t testing.TB, fixturePath string, goldenPath string, handler kafka.MessageHandler, producer *RecordingProducer) {
+	t.Helper()
+	EnsureLogger()
+
+	messages := readFixture(t, fixturePath)
+
+	records := make([]GoldenRecord, 0, len(messages))
+	for i, message := range messages {
+		if producer != nil {
+			producer.Reset()
+		}
+
+		err := handler.HandleMessage(context.Background(), message)
+
+		var outMsgs []*kafka.ProducerMessage
+		if producer != nil {
+			outMsgs = producer.Messages()
+		}
+
+		records = append(records, newGoldenRecord(i, message, outMsgs, err))
+	}
+
+	compareGolden(t, goldenPath, records)
+}
+
+func readFixture(t testing.TB, fixturePath string) []*kafka.ConsumerMessage {
+	t.Helper()
+
+	messages, err := kafka.ReadFixtureFile(fixturePath)
+	if err != nil {
+		t.Fatalf("kafkatest: error leyendo fixture %s: %v", fixturePath, err)
+	}
+
+	return messages
+}
+
+func newGoldenRecord(input int, inMsg *kafka.ConsumerMessage, outMsgs []*kafka.ProducerMessage, err error) GoldenRecord {
+	record := GoldenRecord{
+		Input:     input,
+		Topic:     inMsg.Topic,
+		Partition: inMsg.Partition,
+		Offset:    inMsg.Offset,
+		Outputs:   make([]GoldenOutput, 0, len(outMsgs)),
+	}
+
+	for _, outMsg := range outMsgs {
+		key, keyEncoding := kafka.EncodeFixtureBytes(outMsg.Key)
+		value, valueEncoding := kafka.EncodeFixtureBytes(outMsg.Msg)
+
+		headers := outMsg.Headers
+		if len(headers) == 0 {
+			headers = nil
+		}
+
+		record.Outputs = append(record.Outputs, GoldenOutput{
+			Topic:         outMsg.Topic,
+			Key:           key,
+			KeyEncoding:   keyEncoding,
+			Value:         value,
+			ValueEncoding: valueEncoding,
+			Headers:       headers,
+		})
+	}
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	return record
+}
+
+// compareGolden compara los resultados contra el golden file o lo regenera con -kafkatest.update
+func compareGolden(t testing.TB, goldenPath string, records []GoldenRecord) {
+	t.Helper()
+
+	var actual bytes.Buffer
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			t.Fatalf("kafkatest: error serializando resultado: %v", err)
+		}
+		actual.Write(line)
+		actual.WriteByte('\n')
+	}
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(goldenPath), 0755); err != nil {
+			t.Fatalf("kafkatest: error creando directorio de golden file: %v", err)
+		}
+
+		if err := os.WriteFile(goldenPath, actual.Bytes(), 0644); err != nil {
+			t.Fatalf("kafkatest: error escribiendo golden file %s: %v", goldenPath, err)
+		}
+
+		return
+	}
+
+	expected, err := os.ReadFile(goldenPath)
+	if os.IsNotExist(err) {
+		t.Fatalf("kafkatest: golden file %s no existe, ejecutar go test con -kafkatest.update para generarlo", goldenPath)
+	}
+	if err != nil {
+		t.Fatalf("kafkatest: error leyendo golden file %s: %v", goldenPath, err)
+	}
+
+	if diff := diffLines(string(expected), actual.String()); diff != "" {
+		t.Errorf("kafkatest: la salida no coincide con %s (-esperado +obtenido):\n%s", goldenPath, diff)
+	}
+}
+
+// diffLines diferencia linea a linea, las lineas iguales se omiten
+func diffLines(expected string, actual string) string {
+	expectedLines := strings.Split(strings.TrimRight(expected, "\n"), "\n")
+	actualLines := strings.Split(strings.TrimRight(actual, "\n"), "\n")
+
+	total := len(expectedLines)
+	if len(actualLines) > total {
+		total = len(actualLines)
+	}
+
+	var diff strings.Builder
+	for i := 0; i < total; i++ {
+		var expectedLine, actualLine string
+		if i < len(expectedLines) {
+			expectedLine = expectedLines[i]
+		}
+		if i < len(actualLines) {
+			actualLine = actualLines[i]
+		}
+
+		if expectedLine == actualLine {
+			continue
+		}
+
+		if i < len(expectedLines) {
+			fmt.Fprintf(&diff, "linea %d\n- %s\n", i+1, expectedLine)
+		} else {
+			fmt.Fprintf(&diff, "linea %d\n", i+1)
+		}
+		if i < len(actualLines) {
+			fmt.Fprintf(&diff, "+ %s\n", actualLine)
+		}
+	}
+
+	return diff.String()
+}
@@ -0,0 +1,144 @@
+package kafkatest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+const (
+	replayFixture = "testdata/orders.jsonl"
+	replayGolden  = "testdata/orders.golden.jsonl"
+)
+
+// ordersProcessor agrega un header, descarta la key skip y falla con el valor bad
+func ordersProcessor(ctx context.Context, inMsg *kafka.ConsumerMessage) (*kafka.ProducerMessage, error) {
+	switch {
+	case string(inMsg.Key) == "skip":
+		return nil, nil
+	case string(inMsg.Msg) == "bad":
+		return nil, errors.New("valor invalido")
+	}
+
+	return &kafka.ProducerMessage{
+		Topic:   "orders-enriched",
+		Key:     inMsg.Key,
+		Msg:     inMsg.Msg,
+		Headers: map[string]string{"source": fmt.Sprintf("%s/%d", inMsg.Topic, inMsg.Partition)},
+	}, nil
+}
+
+// recordingTB registra los errores del replay en lugar de fallar el test, Fatalf termina el goroutine
+type recordingTB struct {
+	testing.TB
+	mu     sync.Mutex
+	errors []string
+}
+
+func (tb *recordingTB) Errorf(format string, args ...interface{}) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func (tb *recordingTB) Fatalf(format string, args ...interface{}) {
+	tb.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// replayErrors ejecuta el replay con un recordingTB y retorna los errores informados
+func replayErrors(t *testing.T, goldenPath string, processor kafka.StreamProcessor) []string {
+	t.Helper()
+
+	tb := &recordingTB{TB: t}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		kafkatest.ReplayStreamProcessor(tb, replayFixture, goldenPath, processor)
+	}()
+	<-done
+
+	return tb.errors
+}
+
+// setUpdate activa -kafkatest.update durante el test
+func setUpdate(t *testing.T) {
+	t.Helper()
+
+	if err := flag.Set("kafkatest.update", "true"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		flag.Set("kafkatest.update", "false")
+	})
+}
+
+func TestReplayStreamProcessorMatchesGolden(t *testing.T) {
+	if errs := replayErrors(t, replayGolden, ordersProcessor); len(errs) != 0 {
+		t.Errorf("no se esperaban diferencias con el golden file: %v", errs)
+	}
+}
+
+func TestReplayStreamProcessorReportsDiff(t *testing.T) {
+	changed := func(ctx context.Context, inMsg *kafka.ConsumerMessage) (*kafka.ProducerMessage, error) {
+		outMsg, err := ordersProcessor(ctx, inMsg)
+		if outMsg != nil && inMsg.Offset == 4 {
+			outMsg.Topic = "orders-other"
+		}
+
+		return outMsg, err
+	}
+
+	errs := replayErrors(t, replayGolden, changed)
+	if len(errs) != 1 {
+		t.Fatalf("se esperaba una diferencia, se obtuvo %v", errs)
+	}
+
+	// solo se informa la linea del registro modificado
+	if !strings.Contains(errs[0], "linea 3\n") || strings.Contains(errs[0], "linea 1\n") || !strings.Contains(errs[0], "orders-other") {
+		t.Errorf("diferencia: %s", errs[0])
+	}
+}
+
+func TestReplayStreamProcessorMissingGolden(t *testing.T) {
+	errs := replayErrors(t, filepath.Join(t.TempDir(), "missing.jsonl"), ordersProcessor)
+	if len(errs) != 1 || !strings.Contains(errs[0], "-kafkatest.update") {
+		t.Errorf("se esperaba indicar -kafkatest.update, se obtuvo %v", errs)
+	}
+}
+
+func TestReplayStreamProcessorUpdatesGolden(t *testing.T) {
+	setUpdate(t)
+
+	goldenPath := filepath.Join(t.TempDir(), "nested", "orders.golden.jsonl")
+	if errs := replayErrors(t, goldenPath, ordersProcessor); len(errs) != 0 {
+		t.Fatalf("no se esperaban errores al regenerar: %v", errs)
+	}
+
+	generated, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("no se genero el golden file: %v", err)
+	}
+
+	expected, err := os.ReadFile(replayGolden)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(generated, expected) {
+		t.Errorf("golden generado:\n%s\nse esperaba:\n%s", generated, expected)
+	}
+}
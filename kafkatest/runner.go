@@ -0,0 +1,55 @@
+package kafkatest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+// ErrConsumerStopped el consumer termino antes de cumplirse la condicion de RunConsumer
+var ErrConsumerStopped = errors.New("kafkatest: consumer detenido antes de cumplir la condicion")
+
+// RunConsumer ejecuta un consumer construido con los builders del toolkit (MakeSaramaConsumerBuilder,
+// MakeBatchConsumerBuilder, etc.), por ejemplo con la configuracion de MockCluster.ConsumerInput, hasta que done
+// se cumple. Luego cancela el contexto y espera que el consumer se detenga, comprometiendo los offsets marcados.
+// El consumer debe implementar kafka.KafkaConsumerRunner. Retorna ErrTimeout si done no se cumple dentro de
+// DefaultTimeout.
+func RunConsumer(consumer kafka.KafkaConsumer, done func() bool) error {
+	EnsureLogger()
+
+	runner, ok := consumer.(kafka.KafkaConsumerRunner)
+	if !ok {
+		return fmt.Errorf("kafkatest: %T no implementa kafka.KafkaConsumerRunner", consumer)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	finished := make(chan error, 1)
+	go func() {
+		finished <- runner.Run(ctx)
+	}()
+
+	deadline := time.After(DefaultTimeout)
+	for !done() {
+		select {
+		case err := <-finished:
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrConsumerStopped, err)
+			}
+			return ErrConsumerStopped
+		case <-deadline:
+			cancel()
+			<-finished
+			return ErrTimeout
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	cancel()
+
+	return <-finished
+}
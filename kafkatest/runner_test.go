@@ -0,0 +1,52 @@
+package kafkatest_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+func TestRunConsumerDrivesBuilderConsumer(t *testing.T) {
+	cluster := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{"orders": 1}})
+	cluster.SetMessages("orders", 0, "uno", "dos", "tres")
+
+	handled := int32(0)
+	handler := kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		atomic.AddInt32(&handled, 1)
+		return nil
+	})
+
+	errorHandler := kafkatest.NewRecordingErrorHandler()
+	consumer, err := kafka.MakeSaramaConsumerBuilder(cluster.ConsumerInput("orders", "billing"), handler).
+		WithErrorHandler(errorHandler).
+		Build()
+	if err != nil {
+		t.Fatalf("error creando consumer: %v", err)
+	}
+
+	if err := kafkatest.RunConsumer(consumer, func() bool { return atomic.LoadInt32(&handled) == 3 }); err != nil {
+		t.Fatal(err)
+	}
+
+	kafkatest.AssertNoErrors(t, errorHandler)
+
+	if offset, ok := cluster.Committed("billing", "orders", 0); !ok || offset != 3 {
+		t.Errorf("offset comprometido: se esperaba 3, se obtuvo %d (comprometido %v)", offset, ok)
+	}
+}
+
+type startOnlyConsumer struct{}
+
+func (startOnlyConsumer) Start() error {
+	return errors.New("no se debe iniciar")
+}
+
+func TestRunConsumerRequiresRunner(t *testing.T) {
+	if err := kafkatest.RunConsumer(startOnlyConsumer{}, func() bool { return true }); err == nil {
+		t.Errorf("se esperaba error para un consumer sin Run")
+	}
+}
@@ -0,0 +1,298 @@
+// Package kafkatest utilidades para probar handlers, processors y consumers del toolkit sin broker
+package kafkatest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	kitlog "github.com/go-kit/log"
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+// DefaultTimeout tiempo maximo de espera para procesar los mensajes de un claim
+var DefaultTimeout = 5 * time.Second
+
+// ErrTimeout los mensajes del claim no se procesaron dentro del tiempo maximo
+var ErrTimeout = errors.New("kafkatest: mensajes no procesados dentro del tiempo maximo")
+
+// FakeConsumerGroupSession implementa sarama.ConsumerGroupSession en memoria y registra los offsets marcados
+type FakeConsumerGroupSession struct {
+	mu       sync.Mutex
+	claims   map[string][]int32
+	offsets  map[string]map[int32]int64
+	commits  int
+	ctx      context.Context
+	cancel   context.CancelFunc
+	marked   chan struct{}
+	memberID string
+}
+
+// NewFakeConsumerGroupSession constructor de FakeConsumerGroupSession con las particiones asignadas
+func NewFakeConsumerGroupSession(claims map[string][]int32) *FakeConsumerGroupSession {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &FakeConsumerGroupSession{
+		claims:   claims,
+		offsets:  make(map[string]map[int32]int64),
+		ctx:      ctx,
+		cancel:   cancel,
+		marked:   make(chan struct{}, 1),
+		memberID: "kafkatest-member",
+	}
+}
+
+// Claims implementa sarama.ConsumerGroupSession
+func (s *FakeConsumerGroupSession) Claims() map[string][]int32 {
+	return s.claims
+}
+
+// MemberID implementa sarama.ConsumerGroupSession
+func (s *FakeConsumerGroupSession) MemberID() string {
+	return s.memberID
+}
+
+// GenerationID implementa sarama.ConsumerGroupSession
+func (s *FakeConsumerGroupSession) GenerationID() int32 {
+	return 1
+}
+
+// MarkOffset implementa sarama.ConsumerGroupSession, solo avanza el offset
+func (s *FakeConsumerGroupSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.offsets[topic][partition]; ok && current >= offset {
+		return
+	}
+
+	s.setOffsetLocked(topic, partition, offset)
+}
+
+// ResetOffset implementa sarama.ConsumerGroupSession
+func (s *FakeConsumerGroupSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setOffsetLocked(topic, partition, offset)
+}
+
+// MarkMessage implementa sarama.ConsumerGroupSession, marca el offset siguiente al mensaje
+func (s *FakeConsumerGroupSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+// Commit implementa sarama.ConsumerGroupSession
+func (s *FakeConsumerGroupSession) Commit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.commits++
+}
+
+// Context implementa sarama.ConsumerGroupSession
+func (s *FakeConsumerGroupSession) Context() context.Context {
+	return s.ctx
+}
+
+// Close termina la sesion, equivalente a un rebalance o al cierre del consumer group
+func (s *FakeConsumerGroupSession) Close() {
+	s.cancel()
+}
+
+// Offset offset marcado de la particion, el siguiente offset a consumir
+func (s *FakeConsumerGroupSession) Offset(topic string, partition int32) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offset, ok := s.offsets[topic][partition]
+
+	return offset, ok
+}
+
+// Offsets copia de los offsets marcados por topico y particion
+func (s *FakeConsumerGroupSession) Offsets() map[string]map[int32]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offsets := make(map[string]map[int32]int64, len(s.offsets))
+	for topic, partitions := range s.offsets {
+		offsets[topic] = make(map[int32]int64, len(partitions))
+		for partition, offset := range partitions {
+			offsets[topic][partition] = offset
+		}
+	}
+
+	return offsets
+}
+
+// Commits cantidad de llamadas a Commit
+func (s *FakeConsumerGroupSession) Commits() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.commits
+}
+
+func (s *FakeConsumerGroupSession) setOffsetLocked(topic string, partition int32, offset int64) {
+	if s.offsets[topic] == nil {
+		s.offsets[topic] = make(map[int32]int64)
+	}
+	s.offsets[topic][partition] = offset
+
+	select {
+	case s.marked <- struct{}{}:
+	default:
+	}
+}
+
+// FakeConsumerGroupClaim implementa sarama.ConsumerGroupClaim con mensajes en memoria
+type FakeConsumerGroupClaim struct {
+	topic         string
+	partition     int32
+	initialOffset int64
+	highWaterMark int64
+	messages      chan *sarama.ConsumerMessage
+}
+
+// NewFakeConsumerGroupClaim constructor de FakeConsumerGroupClaim, los mensajes quedan disponibles en Messages
+func NewFakeConsumerGroupClaim(topic string, partition int32, initialOffset int64, messages ...*sarama.ConsumerMessage) *FakeConsumerGroupClaim {
+	claim := &FakeConsumerGroupClaim{
+		topic:         topic,
+		partition:     partition,
+		initialOffset: initialOffset,
+		highWaterMark: initialOffset,
+		messages:      make(chan *sarama.ConsumerMessage, len(messages)),
+	}
+
+	for _, message := range messages {
+		claim.messages <- message
+		if message.Offset >= claim.highWaterMark {
+			claim.highWaterMark = message.Offset + 1
+		}
+	}
+
+	return claim
+}
+
+// Topic implementa sarama.ConsumerGroupClaim
+func (c *FakeConsumerGroupClaim) Topic() string {
+	return c.topic
+}
+
+// Partition implementa sarama.ConsumerGroupClaim
+func (c *FakeConsumerGroupClaim) Partition() int32 {
+	return c.partition
+}
+
+// InitialOffset implementa sarama.ConsumerGroupClaim
+func (c *FakeConsumerGroupClaim) InitialOffset() int64 {
+	return c.initialOffset
+}
+
+// HighWaterMarkOffset implementa sarama.ConsumerGroupClaim
+func (c *FakeConsumerGroupClaim) HighWaterMarkOffset() int64 {
+	return c.highWaterMark
+}
+
+// Messages implementa sarama.ConsumerGroupClaim
+func (c *FakeConsumerGroupClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+// ConsumeClaim ejecuta consumer.ConsumeClaim hasta que se marcan todos los mensajes del claim y luego cierra la sesion.
+// Retorna ErrTimeout si los mensajes no se marcan dentro de DefaultTimeout, por ejemplo si el handler se bloquea.
+func ConsumeClaim(consumer *kafka.BaseConsumer, session *FakeConsumerGroupSession, claim *FakeConsumerGroupClaim) error {
+	EnsureLogger()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- consumer.ConsumeClaim(session, claim)
+	}()
+
+	timeout := time.NewTimer(DefaultTimeout)
+	defer timeout.Stop()
+
+	var err error
+	for err == nil && !claimConsumed(session, claim) {
+		select {
+		case <-session.marked:
+		case err = <-done:
+			session.Close()
+			return err
+		case <-timeout.C:
+			err = ErrTimeout
+		}
+	}
+
+	session.Close()
+	<-done
+
+	return err
+}
+
+// ConsumeMessages procesa los mensajes con el consumer en una sesion con una unica particion, retorna la sesion
+// para verificar los offsets marcados
+func ConsumeMessages(consumer *kafka.BaseConsumer, topic string, partition int32, messages ...*sarama.ConsumerMessage) (*FakeConsumerGroupSession, error) {
+	var initialOffset int64
+	for i, message := range messages {
+		if message.Topic == "" {
+			message.Topic = topic
+		}
+		message.Partition = partition
+
+		if i == 0 {
+			initialOffset = message.Offset
+		}
+	}
+
+	session := NewFakeConsumerGroupSession(map[string][]int32{topic: {partition}})
+	claim := NewFakeConsumerGroupClaim(topic, partition, initialOffset, messages...)
+
+	return session, ConsumeClaim(consumer, session, claim)
+}
+
+// Message crea un mensaje sarama con key, valor y headers
+func Message(offset int64, key string, value string, headers map[string]string) *sarama.ConsumerMessage {
+	message := &sarama.ConsumerMessage{
+		Key:       []byte(key),
+		Value:     []byte(value),
+		Offset:    offset,
+		Timestamp: time.Now(),
+	}
+
+	for k, v := range headers {
+		message.Headers = append(message.Headers, &sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+
+	return message
+}
+
+// loggerMu sincroniza EnsureLogger entre tests en paralelo
+var loggerMu sync.Mutex
+
+// EnsureLogger configura un logger que descarta los logs si el servicio no configuro kafka.Log. Es seguro
+// invocarlo desde tests en paralelo; kafka.Log debe configurarse antes de iniciar los tests que lo utilizan.
+func EnsureLogger() {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+
+	if kafka.Log == nil {
+		kafka.NewBaseLogger(kitlog.NewNopLogger())
+	}
+}
+
+func claimConsumed(session *FakeConsumerGroupSession, claim *FakeConsumerGroupClaim) bool {
+	if len(claim.messages) > 0 {
+		return false
+	}
+
+	offset, ok := session.Offset(claim.topic, claim.partition)
+	if !ok {
+		return claim.highWaterMark <= claim.initialOffset
+	}
+
+	return offset >= claim.highWaterMark
+}
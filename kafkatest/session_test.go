@@ -0,0 +1,86 @@
+package kafkatest_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+func TestConsumeMessagesMarksProcessedMessages(t *testing.T) {
+	var headers []string
+	handler := kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		headers = append(headers, inMsg.Headers["origin"])
+		return nil
+	})
+
+	consumer := kafka.NewBaseConsumer(handler, kafkatest.NewRecordingErrorHandler())
+
+	session, err := kafkatest.ConsumeMessages(&consumer, "orders", 2,
+		kafkatest.Message(5, "a", "uno", map[string]string{"origin": "web"}),
+		kafkatest.Message(6, "b", "dos", map[string]string{"origin": "app"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kafkatest.AssertMarked(t, session, "orders", 2, 7)
+
+	if len(headers) != 2 || headers[0] != "web" || headers[1] != "app" {
+		t.Errorf("headers recibidos: se esperaba [web app], se obtuvo %v", headers)
+	}
+}
+
+func TestConsumeMessagesTimesOutOnBlockedHandler(t *testing.T) {
+	timeout := kafkatest.DefaultTimeout
+	kafkatest.DefaultTimeout = 50 * time.Millisecond
+	defer func() { kafkatest.DefaultTimeout = timeout }()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	handler := kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		select {
+		case <-release:
+			return nil
+		case <-kafka.SessionDoneFromContext(ctx):
+			return kafka.ErrSessionClosed
+		}
+	})
+
+	consumer := kafka.NewBaseConsumer(handler, kafkatest.NewRecordingErrorHandler())
+
+	if _, err := kafkatest.ConsumeMessages(&consumer, "orders", 0, kafkatest.Message(0, "a", "uno", nil)); !errors.Is(err, kafkatest.ErrTimeout) {
+		t.Errorf("se esperaba ErrTimeout, se obtuvo %v", err)
+	}
+}
+
+func TestFakeSessionMarkOffsetOnlyAdvances(t *testing.T) {
+	session := kafkatest.NewFakeConsumerGroupSession(map[string][]int32{"orders": {0}})
+
+	session.MarkOffset("orders", 0, 5, "")
+	session.MarkOffset("orders", 0, 3, "")
+	kafkatest.AssertMarked(t, session, "orders", 0, 5)
+
+	session.ResetOffset("orders", 0, 3, "")
+	kafkatest.AssertMarked(t, session, "orders", 0, 3)
+}
+
+func TestEnsureLoggerConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			kafkatest.EnsureLogger()
+		}()
+	}
+	wg.Wait()
+
+	if kafka.Log == nil {
+		t.Errorf("se esperaba logger configurado")
+	}
+}
@@ -0,0 +1,152 @@
+package kafkatest
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+// RunIntegrationSuite ejecuta de extremo a extremo, contra un MockCluster en proceso, las configuraciones generadas
+// por el toolkit: produce, consumo en grupo con commit de offsets, autenticacion SCRAM sobre TLS y health check.
+// Pensado para invocarse desde un test del servicio, por ejemplo:
+//
+//	func TestKafkaIntegration(t *testing.T) { kafkatest.RunIntegrationSuite(t) }
+func RunIntegrationSuite(t *testing.T) {
+	t.Run("produce", testProduce)
+	t.Run("consumer-group", testConsumerGroup)
+	t.Run("scram", testSCRAM)
+	t.Run("scram-invalid-password", testSCRAMInvalidPassword)
+	t.Run("health", testHealth)
+}
+
+func testProduce(t *testing.T) {
+	cluster := NewMockCluster(t, MockClusterConfig{Topics: map[string]int32{"produce": 1}})
+
+	producer, err := kafka.NewSimpleSyncProducer(cluster.ProducerInput("produce"))
+	if err != nil {
+		t.Fatalf("error creando producer: %v", err)
+	}
+
+	err = producer.SendMessage(context.Background(), &kafka.ProducerMessage{
+		Key:     []byte("key"),
+		Msg:     []byte("value"),
+		Headers: map[string]string{"origin": "kafkatest"},
+	})
+	if err != nil {
+		t.Fatalf("error enviando mensaje: %v", err)
+	}
+
+	if cluster.ProduceRequests() == 0 {
+		t.Errorf("el broker no recibio solicitudes de produce")
+	}
+}
+
+func testConsumerGroup(t *testing.T) {
+	cluster := NewMockCluster(t, MockClusterConfig{Topics: map[string]int32{"consume": 1}})
+	cluster.SetMessages("consume", 0, "uno", "dos", "tres")
+
+	handled := int32(0)
+	handler := HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		atomic.AddInt32(&handled, 1)
+		return nil
+	})
+
+	errorHandler := NewRecordingErrorHandler()
+	if err := consumeGroup(t, cluster.ConsumerInput("consume", "kafkatest-group"), handler, errorHandler, func() bool {
+		return atomic.LoadInt32(&handled) == 3
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	AssertNoErrors(t, errorHandler)
+
+	if offset, ok := cluster.Committed("kafkatest-group", "consume", 0); !ok || offset != 3 {
+		t.Errorf("offset comprometido: se esperaba 3, se obtuvo %d (comprometido %v)", offset, ok)
+	}
+}
+
+func testSCRAM(t *testing.T) {
+	cluster := NewMockCluster(t, MockClusterConfig{
+		Topics: map[string]int32{"secure": 1},
+		Users:  map[string]string{"kafkatest": "kafkatest-secret"},
+	})
+
+	producer, err := kafka.NewSimpleSyncProducer(cluster.ProducerInput("secure"))
+	if err != nil {
+		t.Fatalf("error creando producer autenticado: %v", err)
+	}
+
+	if err := producer.SendMessage(context.Background(), &kafka.ProducerMessage{Msg: []byte("value")}); err != nil {
+		t.Fatalf("error enviando mensaje autenticado: %v", err)
+	}
+
+	if succeeded, failed := cluster.Authentications(); succeeded == 0 || failed != 0 {
+		t.Errorf("autenticaciones SCRAM: exitosas %d, fallidas %d", succeeded, failed)
+	}
+
+	health := consumerHealthCheck(t, cluster.ConsumerInput("secure", "kafkatest-secure"))
+	if err := health.Health(); err != nil {
+		t.Errorf("health check autenticado: %v", err)
+	}
+}
+
+func testSCRAMInvalidPassword(t *testing.T) {
+	cluster := NewMockCluster(t, MockClusterConfig{
+		Topics: map[string]int32{"secure": 1},
+		Users:  map[string]string{"kafkatest": "kafkatest-secret"},
+	})
+
+	input := cluster.ProducerInput("secure")
+	input.Password = "invalid"
+
+	if _, err := kafka.NewSimpleSyncProducer(input); err == nil {
+		t.Fatalf("se esperaba error de autenticacion")
+	}
+
+	if _, failed := cluster.Authentications(); failed == 0 {
+		t.Errorf("el broker no registro la autenticacion fallida")
+	}
+}
+
+func testHealth(t *testing.T) {
+	cluster := NewMockCluster(t, MockClusterConfig{Topics: map[string]int32{"health": 1}})
+
+	health := consumerHealthCheck(t, cluster.ConsumerInput("health", "kafkatest-health"))
+	if err := health.Health(); err != nil {
+		t.Fatalf("health check: %v", err)
+	}
+
+	cluster.Close()
+
+	if err := health.Health(); err == nil {
+		t.Errorf("se esperaba error de health check con el broker detenido")
+	}
+}
+
+func consumerHealthCheck(t *testing.T, input kafka.ConsumerGroupInput) kafka.HealthCheck {
+	t.Helper()
+
+	conf, err := kafka.NewSaramaConsumerConfigurer(kafka.NewBalanceStrategyResolver()).GenerateConfig(input)
+	if err != nil {
+		t.Fatalf("error generando configuracion: %v", err)
+	}
+
+	conf.SaramaConfig.Metadata.Retry.Max = 0
+
+	return kafka.NewHealthCheck(conf.Brokers, conf.SaramaConfig)
+}
+
+// consumeGroup ejecuta un consumer construido con MakeSaramaConsumerBuilder hasta que done se cumple,
+// al detenerse se comprometen los offsets marcados
+func consumeGroup(t *testing.T, input kafka.ConsumerGroupInput, handler kafka.MessageHandler, errorHandler kafka.ConsumerErrorHandler, done func() bool) error {
+	t.Helper()
+
+	consumer, err := kafka.MakeSaramaConsumerBuilder(input, handler).WithErrorHandler(errorHandler).Build()
+	if err != nil {
+		return err
+	}
+
+	return RunConsumer(consumer, done)
+}
@@ -0,0 +1,11 @@
+package kafkatest_test
+
+import (
+	"testing"
+
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+func TestIntegrationSuite(t *testing.T) {
+	kafkatest.RunIntegrationSuite(t)
+}
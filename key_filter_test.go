@@ -0,0 +1,53 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"testing"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+func TestKeyFilterMessageHandlerRejectsOtherKeys(t *testing.T) {
+	var handled []string
+	handler := kafka.MakeKeyFilterMessageHandlerMiddleware([]string{"permitida"})(
+		kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+			handled = append(handled, string(inMsg.Key))
+			return nil
+		}))
+
+	errorHandler := kafkatest.NewRecordingErrorHandler()
+	consumer := kafka.NewBaseConsumer(handler, errorHandler)
+
+	session, err := kafkatest.ConsumeMessages(&consumer, "keys", 0,
+		kafkatest.Message(0, "otra", "a", nil),
+		kafkatest.Message(1, "permitida", "b", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handled) != 1 || handled[0] != "permitida" {
+		t.Errorf("keys procesadas: se esperaba [permitida], se obtuvo %v", handled)
+	}
+
+	kafkatest.AssertErrorCount(t, errorHandler, 1)
+	kafkatest.AssertErrorContains(t, errorHandler, "Key no soportada otra")
+	kafkatest.AssertMarked(t, session, "keys", 0, 2)
+}
+
+func TestKeyFilterStreamMiddlewareFiltersOtherKeys(t *testing.T) {
+	processor := kafka.MakeKeyFilterStreamMiddleware([]string{"permitida"})(
+		func(ctx context.Context, inMsg *kafka.ConsumerMessage) (*kafka.ProducerMessage, error) {
+			return &kafka.ProducerMessage{Key: inMsg.Key, Msg: inMsg.Msg}, nil
+		})
+
+	outMsg, err := processor(context.Background(), &kafka.ConsumerMessage{Key: []byte("otra")})
+	if err != nil || outMsg != nil {
+		t.Errorf("key filtrada: se esperaba mensaje nil sin error, se obtuvo %+v (%v)", outMsg, err)
+	}
+
+	outMsg, err = processor(context.Background(), &kafka.ConsumerMessage{Key: []byte("permitida")})
+	if err != nil || outMsg == nil || string(outMsg.Key) != "permitida" {
+		t.Errorf("key permitida: se esperaba mensaje de salida, se obtuvo %+v (%v)", outMsg, err)
+	}
+}
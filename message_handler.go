@@ -8,3 +8,9 @@ import (
 type MessageHandler interface {
 	HandleMessage(ctx context.Context, inMsg *ConsumerMessage) error
 }
+
+// BatchMessageHandler interfaz para manejo de lotes de mensajes de una misma particion, los offsets
+// del lote se marcan solo despues de que el handler retorna
+type BatchMessageHandler interface {
+	HandleMessages(ctx context.Context, inMsgs []*ConsumerMessage) error
+}
@@ -2,7 +2,9 @@ package kafka_toolkit
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/go-kit/kit/metrics"
 	"github.com/go-kit/kit/metrics/prometheus"
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
 	commons "github.com/validatecl/go-microservices-commons"
@@ -61,3 +63,143 @@ func MakeKafkaProducerMetrics(serviceName string, producerName string) *commons.
 		}, []string{"operation", "status"}),
 	}
 }
+
+// MakeKafkaConsumerPauseGauge gauge con valor 1 mientras el consumer este pausado
+func MakeKafkaConsumerPauseGauge(serviceName string, consumerName string) metrics.Gauge {
+	return prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: serviceName,
+		Subsystem: kafkaHandlerSubsystem,
+		Name:      fmt.Sprintf("consumer_%s_paused", consumerName),
+		Help:      "Indica si el consumer esta pausado (1) o consumiendo (0)",
+	}, []string{})
+}
+
+// MakeDedupDuplicatesCounter contador de mensajes duplicados descartados por topico
+func MakeDedupDuplicatesCounter(serviceName string, consumerName string) metrics.Counter {
+	return prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: serviceName,
+		Subsystem: kafkaHandlerSubsystem,
+		Name:      fmt.Sprintf("consumer_%s_duplicate_count", consumerName),
+		Help:      "Contador de mensajes duplicados descartados",
+	}, []string{"topic"})
+}
+
+// MakeFanOutRecordsCounter contador de mensajes de salida de una stream por operacion y topico de destino
+func MakeFanOutRecordsCounter(serviceName string, streamName string) metrics.Counter {
+	return prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: serviceName,
+		Subsystem: kafkaHandlerSubsystem,
+		Name:      fmt.Sprintf("stream_%s_output_count", streamName),
+		Help:      "Contador de mensajes de salida por topico de destino",
+	}, []string{"operation", "topic"})
+}
+
+// HandlerGuardMetrics metricas de panics y timeouts de message handler
+type HandlerGuardMetrics struct {
+	// Panics contador de panics recuperados por topico
+	Panics metrics.Counter
+	// Timeouts contador de mensajes que excedieron el tiempo maximo de procesamiento por topico
+	Timeouts metrics.Counter
+	// Overdue duracion en segundos de los handlers vencidos hasta su finalizacion
+	Overdue metrics.Histogram
+}
+
+// MakeHandlerGuardMetrics metricas de panics y timeouts de message handler
+func MakeHandlerGuardMetrics(serviceName string, consumerName string) *HandlerGuardMetrics {
+	return &HandlerGuardMetrics{
+		Panics: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: serviceName,
+			Subsystem: kafkaHandlerSubsystem,
+			Name:      fmt.Sprintf("consumer_%s_panic_count", consumerName),
+			Help:      "Contador de panics recuperados en message handler",
+		}, []string{"topic"}),
+		Timeouts: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: serviceName,
+			Subsystem: kafkaHandlerSubsystem,
+			Name:      fmt.Sprintf("consumer_%s_timeout_count", consumerName),
+			Help:      "Contador de mensajes que excedieron el tiempo maximo de procesamiento",
+		}, []string{"topic"}),
+		Overdue: prometheus.NewSummaryFrom(stdprometheus.SummaryOpts{
+			Namespace: serviceName,
+			Subsystem: kafkaHandlerSubsystem,
+			Name:      fmt.Sprintf("consumer_%s_overdue_duration_seconds", consumerName),
+			Help:      "Duracion total en segundos de handlers que excedieron el tiempo maximo",
+		}, []string{"topic"}),
+	}
+}
+
+func (m *HandlerGuardMetrics) panic(topic string) {
+	if m == nil || m.Panics == nil {
+		return
+	}
+
+	m.Panics.With("topic", topic).Add(1)
+}
+
+func (m *HandlerGuardMetrics) timeout(topic string) {
+	if m == nil || m.Timeouts == nil {
+		return
+	}
+
+	m.Timeouts.With("topic", topic).Add(1)
+}
+
+func (m *HandlerGuardMetrics) overdue(topic string, elapsed time.Duration) {
+	if m == nil || m.Overdue == nil {
+		return
+	}
+
+	m.Overdue.With("topic", topic).Observe(elapsed.Seconds())
+}
+
+// CircuitBreakerMetrics metricas de circuit breaker
+type CircuitBreakerMetrics struct {
+	// State estado por breaker: 0 closed, 1 half-open, 2 open
+	State metrics.Gauge
+	// Transitions contador de transiciones por breaker, estado origen y destino
+	Transitions metrics.Counter
+}
+
+// MakeCircuitBreakerMetrics metricas de circuit breaker
+func MakeCircuitBreakerMetrics(serviceName string) *CircuitBreakerMetrics {
+	return &CircuitBreakerMetrics{
+		State: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: serviceName,
+			Subsystem: kafkaHandlerSubsystem,
+			Name:      "circuit_breaker_state",
+			Help:      "Estado de circuit breaker: 0 closed, 1 half-open, 2 open",
+		}, []string{"breaker"}),
+		Transitions: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: serviceName,
+			Subsystem: kafkaHandlerSubsystem,
+			Name:      "circuit_breaker_transitions_count",
+			Help:      "Contador de transiciones de circuit breaker",
+		}, []string{"breaker", "from", "to"}),
+	}
+}
+
+func (m *CircuitBreakerMetrics) setState(name, state string) {
+	if m == nil || m.State == nil {
+		return
+	}
+
+	value := 0.0
+	switch state {
+	case CircuitHalfOpen:
+		value = 1
+	case CircuitOpen:
+		value = 2
+	}
+
+	m.State.With("breaker", name).Set(value)
+}
+
+func (m *CircuitBreakerMetrics) transition(name, from, to string) {
+	m.setState(name, to)
+
+	if m == nil || m.Transitions == nil {
+		return
+	}
+
+	m.Transitions.With("breaker", name, "from", from, "to", to).Add(1)
+}
@@ -22,6 +22,19 @@ func MakeHealthHandlerBuilder(logger kitlog.Logger, service HealthCheck) commons
 	return commons.MakeHTTPHandlerBuilder(logger, endpointCfgs)
 }
 
+// MakeHealthReadinessHandlerBuilder Crea Handler builder para health check (/healthz) y readiness (/readyz),
+// readiness puede ser por ejemplo NewPauseReadinessCheck para reflejar la pausa del consumer
+func MakeHealthReadinessHandlerBuilder(logger kitlog.Logger, health HealthCheck, readiness HealthCheck) commons.HTTPHandlerBuilder {
+	decoder := func(context.Context, *http.Request) (request interface{}, err error) { return nil, nil }
+
+	endpointCfgs := []commons.EndpointConfig{
+		commons.GET("/healthz", "HEALTHZ", MakeServiceHealthCheckEndpoint(health), decoder, EncodeResponse),
+		commons.GET("/readyz", "READYZ", MakeServiceHealthCheckEndpoint(readiness), decoder, EncodeResponse),
+	}
+
+	return commons.MakeHTTPHandlerBuilder(logger, endpointCfgs)
+}
+
 // MakeServiceHealthCheckEndpoint Registra la URI /healthz para el healthckeck
 func MakeServiceHealthCheckEndpoint(service HealthCheck) endpoint.Endpoint {
 	return func(_ context.Context, _ interface{}) (interface{}, error) {
@@ -0,0 +1,601 @@
+package kafka_toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	// MirrorProvenanceHeader header por defecto con los clusters por los que paso el mensaje, separados por coma
+	MirrorProvenanceHeader = "x-mirror-provenance"
+
+	// MirrorPartitionPreserve produce en la misma particion del origen, el destino debe tener al menos las mismas particiones
+	MirrorPartitionPreserve = "preserve"
+	// MirrorPartitionHash produce en la particion que corresponde al hash de la key en el destino
+	MirrorPartitionHash = "hash"
+
+	defaultMirrorCheckpointInterval = 10 * time.Second
+	// mirrorOffsetHistory puntos de traduccion conservados por particion de origen
+	mirrorOffsetHistory = 32
+)
+
+var (
+	// InvalidMirrorConfigKind configuracion de mirror incompleta
+	InvalidMirrorConfigKind = "Configuracion de mirror invalida, se requieren SourceCluster, TargetCluster y al menos un topico"
+	// InvalidMirrorPartitionModeKind modo de particion no soportado
+	InvalidMirrorPartitionModeKind = "Modo de particion de mirror invalido, debe ser preserve o hash"
+	// MissingOffsetTranslationKind la particion no tiene puntos de traduccion
+	MissingOffsetTranslationKind = "No existe traduccion de offset para la particion"
+	// MirrorHashTranslationKind en modo hash una particion de origen se reparte en varias particiones de destino
+	MirrorHashTranslationKind = "La traduccion de offsets requiere PartitionMode preserve"
+)
+
+// MirrorRenameRule regla de renombre de topicos, From termina en * para renombrar por prefijo: "orders.*" -> "dr.orders.*"
+type MirrorRenameRule struct {
+	From string
+	To   string
+}
+
+// MirrorConfig configuracion del mirror entre clusters
+type MirrorConfig struct {
+	// Source consumer group en el cluster de origen
+	Source ConsumerGroupInput
+	// Target configuracion de producer del cluster de destino
+	Target BaseProducerConfigInput
+	// Topics topicos a replicar, vacio utiliza Source.Topic separado por coma
+	Topics []string
+	// Rename reglas de renombre, se aplica la primera que coincide y sin coincidencia se conserva el nombre
+	Rename []MirrorRenameRule
+	// SourceCluster nombre del cluster de origen, se agrega al header de procedencia
+	SourceCluster string
+	// TargetCluster nombre del cluster de destino, los mensajes que ya pasaron por el se descartan para evitar loops
+	TargetCluster string
+	// ProvenanceHeader header de procedencia, por defecto x-mirror-provenance
+	ProvenanceHeader string
+	// PartitionMode MirrorPartitionPreserve (por defecto) o MirrorPartitionHash. En modo hash no se registran
+	// puntos de traduccion de offsets, por lo que no admite Checkpoint ni FailoverConsumerGroup
+	PartitionMode string
+	// Batch tamaño de lote y espera maxima del consumer
+	Batch BatchConfig
+	// Checkpoint persiste el mapa de traduccion de offsets, nil lo mantiene solo en memoria
+	Checkpoint MirrorCheckpoint
+	// CheckpointInterval frecuencia de guardado del checkpoint, por defecto 10s
+	CheckpointInterval time.Duration
+	// ErrorHandler recibe los mensajes de un lote que no pudo producirse luego de Batch.MaxRetries reintentos,
+	// por defecto registra el error en el log. Con MaxRetries en 0 un lote fallido se reintenta sin limite
+	ErrorHandler ConsumerErrorHandler
+}
+
+// MirrorOffsetPoint ultimo mensaje de origen replicado y su posicion en el destino
+type MirrorOffsetPoint struct {
+	SourceOffset    int64  `json:"source_offset"`
+	TargetTopic     string `json:"target_topic"`
+	TargetPartition int32  `json:"target_partition"`
+	TargetOffset    int64  `json:"target_offset"`
+}
+
+// MirrorOffsetMap puntos de traduccion por topico y particion de origen, ordenados por offset
+type MirrorOffsetMap map[string]map[int32][]MirrorOffsetPoint
+
+// Translate traduce el offset comprometido de un grupo en el origen (proximo mensaje a leer) al offset en el destino.
+// Se utiliza el ultimo punto anterior al offset, por lo que en el destino se pueden releer mensajes pero no se pierden.
+func (m MirrorOffsetMap) Translate(topic string, partition int32, offset int64) (MirrorOffsetPoint, bool) {
+	points := m[topic][partition]
+
+	idx := sort.Search(len(points), func(i int) bool {
+		return points[i].SourceOffset >= offset
+	})
+	if idx == 0 {
+		return MirrorOffsetPoint{}, false
+	}
+
+	point := points[idx-1]
+	return MirrorOffsetPoint{
+		SourceOffset:    offset,
+		TargetTopic:     point.TargetTopic,
+		TargetPartition: point.TargetPartition,
+		TargetOffset:    point.TargetOffset + 1,
+	}, true
+}
+
+// translateOldest estima la posicion en el destino de un offset anterior al punto mas antiguo conservado, restando
+// al punto la distancia en el origen. En ese tramo el destino no recibe mas mensajes que los del origen, por lo que
+// la estimacion puede releer mensajes pero no pierde ninguno.
+func (m MirrorOffsetMap) translateOldest(topic string, partition int32, offset int64) (MirrorOffsetPoint, bool) {
+	points := m[topic][partition]
+	if len(points) == 0 || offset > points[0].SourceOffset {
+		return MirrorOffsetPoint{}, false
+	}
+
+	oldest := points[0]
+	target := oldest.TargetOffset + 1 - (oldest.SourceOffset + 1 - offset)
+	if target < 0 {
+		target = 0
+	}
+
+	return MirrorOffsetPoint{
+		SourceOffset:    offset,
+		TargetTopic:     oldest.TargetTopic,
+		TargetPartition: oldest.TargetPartition,
+		TargetOffset:    target,
+	}, true
+}
+
+// copy copia profunda para guardar el checkpoint fuera del lock
+func (m MirrorOffsetMap) copy() MirrorOffsetMap {
+	result := make(MirrorOffsetMap, len(m))
+	for topic, partitions := range m {
+		result[topic] = make(map[int32][]MirrorOffsetPoint, len(partitions))
+		for partition, points := range partitions {
+			result[topic][partition] = append([]MirrorOffsetPoint{}, points...)
+		}
+	}
+
+	return result
+}
+
+// MirrorCheckpoint persistencia del mapa de traduccion de offsets
+type MirrorCheckpoint interface {
+	Load() (MirrorOffsetMap, error)
+	Save(offsets MirrorOffsetMap) error
+}
+
+type fileMirrorCheckpoint struct {
+	path string
+}
+
+// NewFileMirrorCheckpoint checkpoint en un archivo JSON, se reemplaza de forma atomica en cada guardado
+func NewFileMirrorCheckpoint(path string) MirrorCheckpoint {
+	return &fileMirrorCheckpoint{path: path}
+}
+
+func (c *fileMirrorCheckpoint) Load() (MirrorOffsetMap, error) {
+	content, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return MirrorOffsetMap{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := MirrorOffsetMap{}
+	if err := json.Unmarshal(content, &offsets); err != nil {
+		return nil, err
+	}
+
+	return offsets, nil
+}
+
+func (c *fileMirrorCheckpoint) Save(offsets MirrorOffsetMap) error {
+	content, err := json.Marshal(offsets)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(c.path, content)
+}
+
+// Mirror replica topicos de un cluster a otro conservando key, headers, timestamp y particion. Cada lote se
+// produce en forma sincronica y los offsets de origen se marcan solo si todo el lote se produjo; un lote con
+// fallas se reintenta. En modo preserve se registra la posicion de destino del ultimo mensaje producido de cada
+// particion para traducir offsets de consumer groups con FailoverConsumerGroup.
+type Mirror struct {
+	config   MirrorConfig
+	consumer *batchKafkaConsumer
+	client   sarama.Client
+	producer sarama.SyncProducer
+
+	mu      sync.Mutex
+	offsets MirrorOffsetMap
+	// sealed particiones cuyo ultimo punto ya se guardo, la proxima actualizacion agrega un punto nuevo
+	sealed map[topicPartition]bool
+}
+
+// NewMirror crea el consumer de origen y el producer de destino, el mapa de offsets se carga desde el checkpoint
+func NewMirror(config MirrorConfig) (*Mirror, error) {
+	if len(config.Topics) == 0 {
+		config.Topics = splitList(config.Source.Topic)
+	}
+
+	if config.SourceCluster == "" || config.TargetCluster == "" || len(config.Topics) == 0 {
+		return nil, errors.New(InvalidMirrorConfigKind)
+	}
+
+	if config.Source.Topic == "" {
+		config.Source.Topic = strings.Join(config.Topics, ",")
+	}
+
+	if config.ProvenanceHeader == "" {
+		config.ProvenanceHeader = MirrorProvenanceHeader
+	}
+
+	if config.PartitionMode == "" {
+		config.PartitionMode = MirrorPartitionPreserve
+	}
+
+	if config.PartitionMode != MirrorPartitionPreserve && config.PartitionMode != MirrorPartitionHash {
+		return nil, errors.New(InvalidMirrorPartitionModeKind)
+	}
+
+	if config.PartitionMode == MirrorPartitionHash && config.Checkpoint != nil {
+		return nil, errors.New(MirrorHashTranslationKind)
+	}
+
+	if config.CheckpointInterval <= 0 {
+		config.CheckpointInterval = defaultMirrorCheckpointInterval
+	}
+
+	config.Batch = config.Batch.withDefaults()
+
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = NewLoggingConsumerErrorHandler()
+	}
+
+	offsets := MirrorOffsetMap{}
+	if config.Checkpoint != nil {
+		var err error
+		if offsets, err = config.Checkpoint.Load(); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &Mirror{
+		config:  config,
+		offsets: offsets,
+		sealed:  make(map[topicPartition]bool),
+	}
+
+	// los puntos cargados del checkpoint no se modifican
+	for topic, partitions := range offsets {
+		for partition := range partitions {
+			m.sealed[topicPartition{topic: topic, partition: partition}] = true
+		}
+	}
+
+	conf, err := NewBaseProducerConfigurer().GenerateConfig(config.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	conf.SaramaConfig.Producer.Partitioner = sarama.NewHashPartitioner
+	if config.PartitionMode == MirrorPartitionPreserve {
+		conf.SaramaConfig.Producer.Partitioner = sarama.NewManualPartitioner
+	}
+
+	if m.client, err = sarama.NewClient(conf.Brokers, conf.SaramaConfig); err != nil {
+		return nil, err
+	}
+
+	if m.producer, err = sarama.NewSyncProducerFromClient(m.client); err != nil {
+		m.client.Close()
+		return nil, err
+	}
+
+	m.consumer, err = newBatchKafkaConsumer(config.Source, config.Topics, &mirrorHandler{mirror: m}, config.Batch,
+		config.ErrorHandler, nil)
+	if err != nil {
+		m.producer.Close()
+		m.client.Close()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Start replica hasta recibir SIGINT o SIGTERM
+func (m *Mirror) Start() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return m.Run(ctx)
+}
+
+// Run replica hasta que se cancela el contexto, al terminar guarda el checkpoint y cierra los clientes
+func (m *Mirror) Run(ctx context.Context) error {
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.checkpointLoop(done)
+	}()
+
+	err := m.consumer.Run(ctx)
+
+	close(done)
+	wg.Wait()
+
+	if checkpointErr := m.saveCheckpoint(); checkpointErr != nil && err == nil {
+		err = checkpointErr
+	}
+
+	if closeErr := m.producer.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+
+	if closeErr := m.client.Close(); closeErr != nil && closeErr != sarama.ErrClosedClient && err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Offsets copia del mapa de traduccion de offsets, vacio en modo hash
+func (m *Mirror) Offsets() MirrorOffsetMap {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.offsets.copy()
+}
+
+// TargetTopic topico de destino segun las reglas de renombre
+func (m *Mirror) TargetTopic(topic string) string {
+	return mirrorTargetTopic(m.config.Rename, topic)
+}
+
+func (m *Mirror) checkpointLoop(done chan struct{}) {
+	ticker := time.NewTicker(m.config.CheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := m.saveCheckpoint(); err != nil {
+				Log.Error(
+					"errorMessage", "Error guardando checkpoint de mirror",
+					"error", err)
+			}
+		}
+	}
+}
+
+// saveCheckpoint guarda el mapa y sella el ultimo punto de cada particion
+func (m *Mirror) saveCheckpoint() error {
+	if m.config.Checkpoint == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	offsets := m.offsets.copy()
+	for topic, partitions := range offsets {
+		for partition := range partitions {
+			m.sealed[topicPartition{topic: topic, partition: partition}] = true
+		}
+	}
+	m.mu.Unlock()
+
+	return m.config.Checkpoint.Save(offsets)
+}
+
+// record actualiza el punto de traduccion de la particion de origen, agrega uno nuevo si el ultimo ya se guardo
+func (m *Mirror) record(topic string, partition int32, point MirrorOffsetPoint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.offsets[topic] == nil {
+		m.offsets[topic] = make(map[int32][]MirrorOffsetPoint)
+	}
+
+	key := topicPartition{topic: topic, partition: partition}
+	points := m.offsets[topic][partition]
+
+	if len(points) == 0 || m.sealed[key] {
+		points = append(points, point)
+		if len(points) > mirrorOffsetHistory {
+			points = points[len(points)-mirrorOffsetHistory:]
+		}
+		m.sealed[key] = false
+	} else {
+		points[len(points)-1] = point
+	}
+
+	m.offsets[topic][partition] = points
+}
+
+// mirrorHandler produce cada lote en el cluster de destino
+type mirrorHandler struct {
+	mirror *Mirror
+}
+
+func (h *mirrorHandler) HandleMessages(ctx context.Context, inMsgs []*ConsumerMessage) error {
+	m := h.mirror
+
+	sources := make([]*ConsumerMessage, 0, len(inMsgs))
+	batch := make([]*sarama.ProducerMessage, 0, len(inMsgs))
+
+	for _, inMsg := range inMsgs {
+		provenance := inMsg.Headers[m.config.ProvenanceHeader]
+		if containsString(splitList(provenance), m.config.TargetCluster) {
+			Log.Debug(
+				"message", "Mensaje omitido, ya paso por el cluster de destino",
+				"topic", inMsg.Topic,
+				"partition", inMsg.Partition,
+				"offset", inMsg.Offset)
+			continue
+		}
+
+		sources = append(sources, inMsg)
+		batch = append(batch, m.producerMessage(inMsg, provenance))
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := m.producer.SendMessages(batch)
+
+	// en modo hash una particion de origen se reparte en varias de destino y no hay un punto unico
+	if m.config.PartitionMode == MirrorPartitionHash {
+		return err
+	}
+
+	failed := make(map[*sarama.ProducerMessage]bool)
+	var producerErrors sarama.ProducerErrors
+	if errors.As(err, &producerErrors) {
+		for _, producerErr := range producerErrors {
+			failed[producerErr.Msg] = true
+		}
+	} else if err != nil {
+		return err
+	}
+
+	// el ultimo mensaje producido de cada particion de origen define su punto de traduccion, despues de una
+	// falla la particion no avanza aunque se hayan producido mensajes posteriores
+	stopped := make(map[topicPartition]bool)
+	for i, msg := range batch {
+		source := sources[i]
+		key := topicPartition{topic: source.Topic, partition: source.Partition}
+
+		if failed[msg] {
+			stopped[key] = true
+		}
+
+		if stopped[key] {
+			continue
+		}
+
+		m.record(source.Topic, source.Partition, MirrorOffsetPoint{
+			SourceOffset:    source.Offset,
+			TargetTopic:     msg.Topic,
+			TargetPartition: msg.Partition,
+			TargetOffset:    msg.Offset,
+		})
+	}
+
+	return err
+}
+
+// producerMessage mensaje de destino con key, headers, timestamp y particion del origen
+func (m *Mirror) producerMessage(inMsg *ConsumerMessage, provenance string) *sarama.ProducerMessage {
+	headers := make(map[string]string, len(inMsg.Headers)+1)
+	for k, v := range inMsg.Headers {
+		headers[k] = v
+	}
+
+	if provenance == "" {
+		headers[m.config.ProvenanceHeader] = m.config.SourceCluster
+	} else if !containsString(splitList(provenance), m.config.SourceCluster) {
+		headers[m.config.ProvenanceHeader] = provenance + "," + m.config.SourceCluster
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic:     mirrorTargetTopic(m.config.Rename, inMsg.Topic),
+		Partition: inMsg.Partition,
+		Headers:   encodeHeaders(headers),
+		Timestamp: inMsg.Timestamp,
+	}
+
+	if inMsg.Key != nil {
+		msg.Key = sarama.ByteEncoder(inMsg.Key)
+	}
+
+	// un valor nil se conserva como tombstone
+	if inMsg.Msg != nil {
+		msg.Value = sarama.ByteEncoder(inMsg.Msg)
+	}
+
+	return msg
+}
+
+// mirrorTargetTopic aplica la primera regla que coincide con el topico
+func mirrorTargetTopic(rules []MirrorRenameRule, topic string) string {
+	for _, rule := range rules {
+		if strings.HasSuffix(rule.From, "*") {
+			prefix := strings.TrimSuffix(rule.From, "*")
+			if strings.HasPrefix(topic, prefix) {
+				return strings.TrimSuffix(rule.To, "*") + strings.TrimPrefix(topic, prefix)
+			}
+			continue
+		}
+
+		if rule.From == topic {
+			return rule.To
+		}
+	}
+
+	return topic
+}
+
+// FailoverConsumerGroup traduce los offsets comprometidos del grupo en el cluster de origen con el mapa del mirror y
+// los compromete en el cluster de destino. El grupo no debe tener miembros activos en el destino. Con dryRun solo
+// retorna los planes de reset por topico de destino. Requiere un mapa de un mirror en modo preserve, cada punto
+// debe apuntar a la misma particion del origen. Un grupo atrasado respecto del punto mas antiguo conservado se
+// traduce con translateOldest y se registra un warning, porque puede reprocesar mensajes en el destino.
+func FailoverConsumerGroup(source ConsumerGroupAdmin, target ConsumerGroupAdmin, group string, offsets MirrorOffsetMap,
+	dryRun bool) ([]*OffsetResetPlan, error) {
+	description, err := source.Describe(group)
+	if err != nil {
+		return nil, err
+	}
+
+	translated := make(map[string]map[int32]int64)
+	for _, partition := range description.Partitions {
+		if partition.Committed < 0 || offsets[partition.Topic] == nil {
+			continue
+		}
+
+		point, ok := offsets.Translate(partition.Topic, partition.Partition, partition.Committed)
+		if !ok {
+			if point, ok = offsets.translateOldest(partition.Topic, partition.Partition, partition.Committed); ok {
+				Log.Warn(
+					"message", "Offset comprometido anterior al punto de traduccion mas antiguo, el grupo puede reprocesar mensajes",
+					"group", group,
+					"topic", partition.Topic,
+					"partition", partition.Partition,
+					"committed", partition.Committed,
+					"target_offset", point.TargetOffset)
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s: %s/%d offset %d", MissingOffsetTranslationKind, partition.Topic,
+				partition.Partition, partition.Committed)
+		}
+
+		if point.TargetPartition != partition.Partition {
+			return nil, fmt.Errorf("%s: %s/%d apunta a la particion %d", MirrorHashTranslationKind, partition.Topic,
+				partition.Partition, point.TargetPartition)
+		}
+
+		if translated[point.TargetTopic] == nil {
+			translated[point.TargetTopic] = make(map[int32]int64)
+		}
+		translated[point.TargetTopic][point.TargetPartition] = point.TargetOffset
+	}
+
+	topics := make([]string, 0, len(translated))
+	for topic := range translated {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	plans := make([]*OffsetResetPlan, 0, len(topics))
+	for _, topic := range topics {
+		plan, err := target.ResetOffsets(OffsetResetInput{
+			Group:  group,
+			Topic:  topic,
+			Target: &OffsetResetTarget{Mode: StartOffsets, Offsets: translated[topic]},
+			DryRun: dryRun,
+		})
+		if err != nil {
+			return plans, err
+		}
+
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
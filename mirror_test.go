@@ -0,0 +1,195 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+func TestMirrorDoesNotCommitFailedPartition(t *testing.T) {
+	source := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{"src": 2}})
+	source.SetMessages("src", 0, "a", "b")
+	source.SetMessages("src", 1, "c", "d")
+
+	target := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{"dst": 2}})
+	target.SetProduceError("dst", 1, sarama.ErrMessageSizeTooLarge)
+
+	mirror, err := kafka.NewMirror(kafka.MirrorConfig{
+		Source:        source.ConsumerInput("src", "mirror-group"),
+		Target:        target.ProducerInput("dst"),
+		Rename:        []kafka.MirrorRenameRule{{From: "src", To: "dst"}},
+		SourceCluster: "east",
+		TargetCluster: "west",
+		Batch:         kafka.BatchConfig{MaxWait: 20 * time.Millisecond, RetryBackoff: 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("error creando mirror: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan error, 1)
+	go func() {
+		finished <- mirror.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(kafkatest.DefaultTimeout)
+	for {
+		if offset, ok := source.Committed("mirror-group", "src", 0); ok && offset == 2 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("la particion 0 no se replico dentro del tiempo maximo")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// la particion 1 sigue reintentando mientras el destino la rechaza
+	time.Sleep(100 * time.Millisecond)
+
+	cancel()
+	if err := <-finished; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := mirror.Offsets().Translate("src", 0, 2); !ok {
+		t.Errorf("se esperaba punto de traduccion para la particion replicada")
+	}
+
+	if _, ok := mirror.Offsets().Translate("src", 1, 2); ok {
+		t.Errorf("no se esperaba punto de traduccion para la particion rechazada")
+	}
+
+	if offset, ok := source.Committed("mirror-group", "src", 0); !ok || offset != 2 {
+		t.Errorf("offset comprometido de la particion 0: se esperaba 2, se obtuvo %d (comprometido %v)", offset, ok)
+	}
+
+	if offset, ok := source.Committed("mirror-group", "src", 1); ok && offset > 0 {
+		t.Errorf("no se esperaba offset comprometido para la particion rechazada, se obtuvo %d", offset)
+	}
+}
+
+func TestMirrorRejectsCheckpointInHashMode(t *testing.T) {
+	_, err := kafka.NewMirror(kafka.MirrorConfig{
+		Source:        kafka.ConsumerGroupInput{Topic: "src"},
+		SourceCluster: "east",
+		TargetCluster: "west",
+		PartitionMode: kafka.MirrorPartitionHash,
+		Checkpoint:    kafka.NewFileMirrorCheckpoint(t.TempDir() + "/offsets.json"),
+	})
+
+	if err == nil || err.Error() != kafka.MirrorHashTranslationKind {
+		t.Errorf("se esperaba %q, se obtuvo %v", kafka.MirrorHashTranslationKind, err)
+	}
+}
+
+type fakeGroupAdmin struct {
+	description *kafka.ConsumerGroupDescription
+	resets      []kafka.OffsetResetInput
+}
+
+func (a *fakeGroupAdmin) Describe(group string) (*kafka.ConsumerGroupDescription, error) {
+	return a.description, nil
+}
+
+func (a *fakeGroupAdmin) ResetOffsets(input kafka.OffsetResetInput) (*kafka.OffsetResetPlan, error) {
+	a.resets = append(a.resets, input)
+	return &kafka.OffsetResetPlan{Group: input.Group, DryRun: input.DryRun}, nil
+}
+
+func (a *fakeGroupAdmin) Delete(group string) error {
+	return errors.New("no implementado")
+}
+
+func (a *fakeGroupAdmin) Close() error {
+	return nil
+}
+
+func TestFailoverConsumerGroup(t *testing.T) {
+	source := &fakeGroupAdmin{description: &kafka.ConsumerGroupDescription{
+		Partitions: []kafka.ConsumerGroupPartition{{Topic: "orders", Partition: 1, Committed: 11}},
+	}}
+
+	offsets := kafka.MirrorOffsetMap{"orders": {1: {
+		{SourceOffset: 4, TargetTopic: "dr.orders", TargetPartition: 1, TargetOffset: 40},
+		{SourceOffset: 12, TargetTopic: "dr.orders", TargetPartition: 1, TargetOffset: 48},
+	}}}
+
+	target := &fakeGroupAdmin{}
+	if _, err := kafka.FailoverConsumerGroup(source, target, "billing", offsets, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(target.resets) != 1 || target.resets[0].Topic != "dr.orders" || target.resets[0].Target.Offsets[1] != 41 {
+		t.Errorf("reset en destino: se esperaba dr.orders particion 1 offset 41, se obtuvo %+v", target.resets)
+	}
+}
+
+func TestFailoverConsumerGroupRejectsHashedOffsets(t *testing.T) {
+	source := &fakeGroupAdmin{description: &kafka.ConsumerGroupDescription{
+		Partitions: []kafka.ConsumerGroupPartition{{Topic: "orders", Partition: 0, Committed: 5}},
+	}}
+
+	offsets := kafka.MirrorOffsetMap{"orders": {0: {
+		{SourceOffset: 4, TargetTopic: "orders", TargetPartition: 2, TargetOffset: 40},
+	}}}
+
+	target := &fakeGroupAdmin{}
+	_, err := kafka.FailoverConsumerGroup(source, target, "billing", offsets, true)
+	if err == nil || !strings.HasPrefix(err.Error(), kafka.MirrorHashTranslationKind) {
+		t.Errorf("se esperaba %q, se obtuvo %v", kafka.MirrorHashTranslationKind, err)
+	}
+
+	if len(target.resets) != 0 {
+		t.Errorf("no se esperaban resets en destino, se obtuvo %+v", target.resets)
+	}
+}
+
+func TestFailoverConsumerGroupLaggingGroup(t *testing.T) {
+	kafkatest.EnsureLogger()
+
+	offsets := kafka.MirrorOffsetMap{"orders": {
+		0: {{SourceOffset: 4, TargetTopic: "dr.orders", TargetPartition: 0, TargetOffset: 40}},
+		1: {{SourceOffset: 100, TargetTopic: "dr.orders", TargetPartition: 1, TargetOffset: 10}},
+	}}
+
+	// el offset 2 es anterior al punto mas antiguo, se estima restando la distancia en el origen
+	source := &fakeGroupAdmin{description: &kafka.ConsumerGroupDescription{
+		Partitions: []kafka.ConsumerGroupPartition{
+			{Topic: "orders", Partition: 0, Committed: 2},
+			{Topic: "orders", Partition: 1, Committed: 50},
+		},
+	}}
+
+	target := &fakeGroupAdmin{}
+	if _, err := kafka.FailoverConsumerGroup(source, target, "billing", offsets, true); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[int32]int64{0: 38, 1: 0}
+	if len(target.resets) != 1 || !reflect.DeepEqual(target.resets[0].Target.Offsets, expected) {
+		t.Errorf("reset en destino: se esperaba %v, se obtuvo %+v", expected, target.resets)
+	}
+}
+
+func TestFailoverConsumerGroupWithoutPoints(t *testing.T) {
+	source := &fakeGroupAdmin{description: &kafka.ConsumerGroupDescription{
+		Partitions: []kafka.ConsumerGroupPartition{{Topic: "orders", Partition: 3, Committed: 5}},
+	}}
+
+	offsets := kafka.MirrorOffsetMap{"orders": {0: {
+		{SourceOffset: 4, TargetTopic: "orders", TargetPartition: 0, TargetOffset: 40},
+	}}}
+
+	_, err := kafka.FailoverConsumerGroup(source, &fakeGroupAdmin{}, "billing", offsets, true)
+	if err == nil || !strings.HasPrefix(err.Error(), kafka.MissingOffsetTranslationKind) {
+		t.Errorf("se esperaba %q, se obtuvo %v", kafka.MissingOffsetTranslationKind, err)
+	}
+}
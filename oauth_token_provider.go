@@ -0,0 +1,231 @@
+package kafka_toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	// OAuthBearer mecanismo SASL/OAUTHBEARER
+	OAuthBearer = sarama.SASLTypeOAuth
+
+	defaultTokenRefreshBefore = 30 * time.Second
+	defaultTokenHTTPTimeout   = 10 * time.Second
+)
+
+var (
+	InvalidOAuthConfig = "Configuracion OAUTHBEARER invalida, se requiere TokenProvider, OAuthTokenFile u OAuthTokenURL con cliente y secreto"
+	InvalidOAuthToken  = "Token OAuth viene sin información"
+)
+
+// TokenProvider provee tokens para autenticacion SASL/OAUTHBEARER, compatible con sarama.AccessTokenProvider
+type TokenProvider interface {
+	Token() (*sarama.AccessToken, error)
+}
+
+// ClientCredentialsConfig configuracion de token provider OAuth client credentials
+type ClientCredentialsConfig struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Extensions extensiones SASL enviadas junto al token
+	Extensions map[string]string
+	// RefreshBefore margen antes de la expiracion en el que se solicita un nuevo token, por defecto 30 segundos.
+	// Si la vigencia del token no supera el margen se renueva a la mitad de su vigencia
+	RefreshBefore time.Duration
+	HTTPClient    *http.Client
+}
+
+type clientCredentialsTokenProvider struct {
+	config ClientCredentialsConfig
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+}
+
+// NewClientCredentialsTokenProvider crea un token provider OAuth client credentials con cache de token
+func NewClientCredentialsTokenProvider(config ClientCredentialsConfig) TokenProvider {
+	if config.RefreshBefore <= 0 {
+		config.RefreshBefore = defaultTokenRefreshBefore
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: defaultTokenHTTPTimeout}
+	}
+
+	return &clientCredentialsTokenProvider{config: config}
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Token retorna el token en cache o solicita uno nuevo si esta pronto a expirar
+func (p *clientCredentialsTokenProvider) Token() (*sarama.AccessToken, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && time.Now().Before(p.refreshAt) {
+		return &sarama.AccessToken{Token: p.token, Extensions: p.config.Extensions}, nil
+	}
+
+	token, refreshAt, err := p.requestToken()
+	if err != nil {
+		return nil, err
+	}
+
+	p.token = token
+	p.refreshAt = refreshAt
+
+	return &sarama.AccessToken{Token: p.token, Extensions: p.config.Extensions}, nil
+}
+
+// requestToken solicita un token y retorna el momento en que debe renovarse
+func (p *clientCredentialsTokenProvider) requestToken() (string, time.Time, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+
+	if len(p.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(p.config.Scopes, " "))
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	requestedAt := time.Now()
+
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("Error obteniendo token OAuth: status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResp tokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return "", time.Time{}, err
+	}
+
+	if tokenResp.AccessToken == "" {
+		return "", time.Time{}, errors.New(InvalidOAuthToken)
+	}
+
+	lifetime := time.Duration(tokenResp.ExpiresIn) * time.Second
+	expires := requestedAt.Add(lifetime)
+
+	Log.Debug(
+		"message", "Token OAuth obtenido",
+		"expires", expires)
+
+	return tokenResp.AccessToken, refreshTime(requestedAt, lifetime, p.config.RefreshBefore), nil
+}
+
+// refreshTime momento de renovacion del token, RefreshBefore antes de expirar o a la mitad de la vigencia si
+// esta no supera el margen. Un token sin vigencia (expires_in ausente) no se guarda en cache
+func refreshTime(requestedAt time.Time, lifetime time.Duration, refreshBefore time.Duration) time.Time {
+	if lifetime <= refreshBefore {
+		return requestedAt.Add(lifetime / 2)
+	}
+
+	return requestedAt.Add(lifetime - refreshBefore)
+}
+
+type staticTokenProvider struct {
+	token string
+}
+
+// NewStaticTokenProvider crea un token provider que siempre retorna el mismo token, util para pruebas locales
+func NewStaticTokenProvider(token string) TokenProvider {
+	return &staticTokenProvider{token: token}
+}
+
+func (p *staticTokenProvider) Token() (*sarama.AccessToken, error) {
+	if p.token == "" {
+		return nil, errors.New(InvalidOAuthToken)
+	}
+
+	return &sarama.AccessToken{Token: p.token}, nil
+}
+
+type fileTokenProvider struct {
+	path string
+}
+
+// NewFileTokenProvider crea un token provider que lee el token desde un archivo en cada autenticacion,
+// permitiendo rotar el token sin reiniciar
+func NewFileTokenProvider(path string) TokenProvider {
+	return &fileTokenProvider{path: path}
+}
+
+func (p *fileTokenProvider) Token() (*sarama.AccessToken, error) {
+	content, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return nil, errors.New(InvalidOAuthToken)
+	}
+
+	return &sarama.AccessToken{Token: token}, nil
+}
+
+// tokenProviderFromInput resuelve el token provider de OAUTHBEARER, Username y Password se usan como cliente y secreto
+func tokenProviderFromInput(input KafkaSASLSecurity) (TokenProvider, error) {
+	switch {
+	case input.TokenProvider != nil:
+		return input.TokenProvider, nil
+	case input.OAuthTokenFile != "":
+		return NewFileTokenProvider(input.OAuthTokenFile), nil
+	case input.OAuthTokenURL != "" && input.Username != "" && input.Password != "":
+		return NewClientCredentialsTokenProvider(ClientCredentialsConfig{
+			TokenURL:     input.OAuthTokenURL,
+			ClientID:     input.Username,
+			ClientSecret: input.Password,
+			Scopes:       input.OAuthScopes,
+		}), nil
+	default:
+		return nil, errors.New(InvalidOAuthConfig)
+	}
+}
+
+// splitList separa una lista separada por coma omitiendo elementos vacios
+func splitList(list string) []string {
+	items := make([]string, 0)
+
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
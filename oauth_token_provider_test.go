@@ -0,0 +1,143 @@
+package kafka_toolkit_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+// newTokenServer levanta un IdP que emite tokens numerados con la vigencia indicada
+func newTokenServer(t *testing.T, expiresIn int64) (*httptest.Server, *int32) {
+	t.Helper()
+	kafkatest.EnsureLogger()
+
+	requests := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count := atomic.AddInt32(&requests, 1)
+
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "client" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "kafka read" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d}`, count, expiresIn)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func newClientCredentialsProvider(url string, refreshBefore time.Duration) kafka.TokenProvider {
+	return kafka.NewClientCredentialsTokenProvider(kafka.ClientCredentialsConfig{
+		TokenURL:      url,
+		ClientID:      "client",
+		ClientSecret:  "secret",
+		Scopes:        []string{"kafka", "read"},
+		Extensions:    map[string]string{"logicalCluster": "lkc-1"},
+		RefreshBefore: refreshBefore,
+	})
+}
+
+func TestClientCredentialsTokenProviderCachesToken(t *testing.T) {
+	server, requests := newTokenServer(t, 3600)
+	provider := newClientCredentialsProvider(server.URL, 0)
+
+	for i := 0; i < 3; i++ {
+		token, err := provider.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token.Token != "token-1" || token.Extensions["logicalCluster"] != "lkc-1" {
+			t.Errorf("token: se esperaba token-1 con extensiones, se obtuvo %+v", token)
+		}
+	}
+
+	if count := atomic.LoadInt32(requests); count != 1 {
+		t.Errorf("solicitudes al IdP: se esperaba 1, se obtuvo %d", count)
+	}
+}
+
+func TestClientCredentialsTokenProviderRefreshesBeforeExpiry(t *testing.T) {
+	server, requests := newTokenServer(t, 2)
+	provider := newClientCredentialsProvider(server.URL, 1800*time.Millisecond)
+
+	if token, err := provider.Token(); err != nil || token.Token != "token-1" {
+		t.Fatalf("se esperaba token-1, se obtuvo %+v (%v)", token, err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if token, err := provider.Token(); err != nil || token.Token != "token-2" {
+		t.Fatalf("se esperaba token renovado token-2, se obtuvo %+v (%v)", token, err)
+	}
+
+	if count := atomic.LoadInt32(requests); count != 2 {
+		t.Errorf("solicitudes al IdP: se esperaban 2, se obtuvo %d", count)
+	}
+}
+
+func TestClientCredentialsTokenProviderShortLivedToken(t *testing.T) {
+	// la vigencia de 1 segundo no supera el margen por defecto de 30 segundos
+	server, requests := newTokenServer(t, 1)
+	provider := newClientCredentialsProvider(server.URL, 0)
+
+	for i := 0; i < 3; i++ {
+		if _, err := provider.Token(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count := atomic.LoadInt32(requests); count != 1 {
+		t.Errorf("solicitudes al IdP antes de la mitad de la vigencia: se esperaba 1, se obtuvo %d", count)
+	}
+
+	time.Sleep(600 * time.Millisecond)
+
+	if token, err := provider.Token(); err != nil || token.Token != "token-2" {
+		t.Fatalf("se esperaba token renovado token-2, se obtuvo %+v (%v)", token, err)
+	}
+}
+
+func TestClientCredentialsTokenProviderErrorResponses(t *testing.T) {
+	kafkatest.EnsureLogger()
+
+	cases := map[string]struct {
+		status   int
+		body     string
+		expected string
+	}{
+		"status":        {status: http.StatusUnauthorized, body: `{"error":"invalid_client"}`, expected: "status 401"},
+		"sin token":     {status: http.StatusOK, body: `{"token_type":"Bearer","expires_in":3600}`, expected: kafka.InvalidOAuthToken},
+		"json invalido": {status: http.StatusOK, body: `no es json`, expected: "invalid character"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				fmt.Fprint(w, tc.body)
+			}))
+			defer server.Close()
+
+			token, err := newClientCredentialsProvider(server.URL, 0).Token()
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("se esperaba error con %q, se obtuvo %+v (%v)", tc.expected, token, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package kafka_toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRateLimitMaxKeys       = 10000
+	defaultRateLimitMinRatio      = 0.1
+	defaultRateLimitDecreaseRatio = 0.5
+	defaultRateLimitIncreaseStep  = 0.01
+)
+
+// RateLimitKeyFunc obtiene la clave de cuota de un mensaje, vacio aplica solo el limite global
+type RateLimitKeyFunc func(inMsg *ConsumerMessage) string
+
+// RateLimitByKey cuota por key del mensaje
+func RateLimitByKey() RateLimitKeyFunc {
+	return func(inMsg *ConsumerMessage) string {
+		return string(inMsg.Key)
+	}
+}
+
+// RateLimitByHeader cuota por valor de header, por ejemplo el id de comercio
+func RateLimitByHeader(header string) RateLimitKeyFunc {
+	return func(inMsg *ConsumerMessage) string {
+		return inMsg.Headers[header]
+	}
+}
+
+// RateLimitConfig configuracion de rate limiter, los rates se expresan en mensajes por segundo
+type RateLimitConfig struct {
+	// Rate limite global, 0 sin limite global
+	Rate float64
+	// Burst tamaño del bucket global, por defecto el entero superior de Rate
+	Burst int
+	// KeyFunc obtiene la clave de cuota del mensaje, nil desactiva los limites por clave
+	KeyFunc RateLimitKeyFunc
+	// KeyRate limite por clave, 0 sin limite salvo que la clave este en KeyQuotas
+	KeyRate float64
+	// KeyBurst tamaño del bucket por clave, por defecto el entero superior del rate de la clave
+	KeyBurst int
+	// KeyQuotas limites especificos por valor de clave, tienen prioridad sobre KeyRate
+	KeyQuotas map[string]float64
+	// MaxKeys cantidad maxima de buckets por clave, por defecto 10000. Al alcanzarla se descartan los que estan llenos
+	// y, si todos estan en uso, el mas cercano a llenarse
+	MaxKeys int
+	// Adaptive reduce los rates ante errores del handler y los recupera gradualmente con cada exito
+	Adaptive bool
+	// MinRatio proporcion minima del rate configurado en modo adaptativo, por defecto 0.1
+	MinRatio float64
+	// DecreaseRatio factor aplicado al rate ante cada error en modo adaptativo, por defecto 0.5
+	DecreaseRatio float64
+	// IncreaseStep proporcion del rate configurado que se recupera con cada exito en modo adaptativo, por defecto 0.01
+	IncreaseStep float64
+	// IsFailure indica si un error reduce el rate en modo adaptativo, por defecto todo error
+	IsFailure func(error) bool
+}
+
+// RateLimiter rate limiter de token bucket con limite global y por clave
+type RateLimiter struct {
+	config RateLimitConfig
+
+	mu     sync.Mutex
+	ratio  float64
+	global *tokenBucket
+	keys   map[string]*tokenBucket
+}
+
+// NewRateLimiter constructor de RateLimiter
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	if config.MaxKeys <= 0 {
+		config.MaxKeys = defaultRateLimitMaxKeys
+	}
+
+	if config.MinRatio <= 0 || config.MinRatio > 1 {
+		config.MinRatio = defaultRateLimitMinRatio
+	}
+
+	if config.DecreaseRatio <= 0 || config.DecreaseRatio >= 1 {
+		config.DecreaseRatio = defaultRateLimitDecreaseRatio
+	}
+
+	if config.IncreaseStep <= 0 {
+		config.IncreaseStep = defaultRateLimitIncreaseStep
+	}
+
+	if config.IsFailure == nil {
+		config.IsFailure = func(err error) bool { return err != nil }
+	}
+
+	limiter := &RateLimiter{
+		config: config,
+		ratio:  1,
+		keys:   make(map[string]*tokenBucket),
+	}
+
+	if config.Rate > 0 {
+		limiter.global = newTokenBucket(config.Rate, config.Burst, time.Now())
+	}
+
+	return limiter
+}
+
+// Wait espera hasta que el mensaje pueda procesarse. Si termina la sesion del consumer group o se cancela el
+// context (por ejemplo por HandlerTimeout) retorna un error que envuelve ErrSessionClosed, para no bloquear
+// el rebalanceo ni marcar el mensaje sin procesar.
+func (l *RateLimiter) Wait(ctx context.Context, inMsg *ConsumerMessage) error {
+	delay, cancel := l.reserve(inMsg, time.Now())
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-SessionDoneFromContext(ctx):
+		cancel()
+		return ErrSessionClosed
+	case <-ctx.Done():
+		cancel()
+		return fmt.Errorf("%v: %w", ctx.Err(), ErrSessionClosed)
+	}
+}
+
+// Observe registra el resultado del procesamiento, en modo adaptativo ajusta el rate
+func (l *RateLimiter) Observe(err error) {
+	if !l.config.Adaptive || errors.Is(err, ErrSessionClosed) || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	previous := l.ratio
+
+	if l.config.IsFailure(err) {
+		l.ratio = math.Max(l.config.MinRatio, l.ratio*l.config.DecreaseRatio)
+	} else {
+		l.ratio = math.Min(1, l.ratio+l.config.IncreaseStep)
+	}
+
+	if l.ratio < previous {
+		Log.Warn(
+			"message", "Rate limiter: reduciendo rate por error",
+			"ratio", l.ratio)
+	}
+}
+
+// Ratio proporcion actual del rate configurado, siempre 1 fuera del modo adaptativo
+func (l *RateLimiter) Ratio() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.ratio
+}
+
+// reserve toma un token del bucket global y del bucket de la clave, retorna la espera necesaria
+// y una funcion que devuelve los tokens si la espera se cancela
+func (l *RateLimiter) reserve(inMsg *ConsumerMessage, now time.Time) (time.Duration, func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var reserved []*tokenBucket
+	var delay time.Duration
+
+	if l.global != nil {
+		l.global.setRate(l.config.Rate*l.ratio, now)
+		delay = l.global.reserve(now)
+		reserved = append(reserved, l.global)
+	}
+
+	if bucket := l.keyBucket(inMsg, now); bucket != nil {
+		if wait := bucket.reserve(now); wait > delay {
+			delay = wait
+		}
+		reserved = append(reserved, bucket)
+	}
+
+	return delay, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		for _, bucket := range reserved {
+			bucket.cancel()
+		}
+	}
+}
+
+func (l *RateLimiter) keyBucket(inMsg *ConsumerMessage, now time.Time) *tokenBucket {
+	if l.config.KeyFunc == nil {
+		return nil
+	}
+
+	key := l.config.KeyFunc(inMsg)
+	if key == "" {
+		return nil
+	}
+
+	rate, ok := l.config.KeyQuotas[key]
+	if !ok {
+		rate = l.config.KeyRate
+	}
+
+	if rate <= 0 {
+		return nil
+	}
+
+	bucket, ok := l.keys[key]
+	if !ok {
+		if len(l.keys) >= l.config.MaxKeys {
+			l.evict(now)
+		}
+
+		bucket = newTokenBucket(rate, l.config.KeyBurst, now)
+		l.keys[key] = bucket
+	}
+
+	bucket.setRate(rate*l.ratio, now)
+
+	return bucket
+}
+
+// evict descarta los buckets llenos, equivalentes a un bucket nuevo. Si ninguno esta lleno descarta el que tiene
+// mayor proporcion de tokens disponibles, para no superar MaxKeys
+func (l *RateLimiter) evict(now time.Time) {
+	fullest := ""
+	fullestRatio := math.Inf(-1)
+
+	for key, bucket := range l.keys {
+		bucket.advance(now)
+		if bucket.tokens >= bucket.burst {
+			delete(l.keys, key)
+			continue
+		}
+
+		if ratio := bucket.tokens / bucket.burst; ratio > fullestRatio {
+			fullest, fullestRatio = key, ratio
+		}
+	}
+
+	if len(l.keys) >= l.config.MaxKeys {
+		delete(l.keys, fullest)
+	}
+}
+
+// tokenBucket bucket de tokens, los tokens pueden quedar negativos representando reservas en espera
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+func (b *tokenBucket) advance(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+func (b *tokenBucket) setRate(rate float64, now time.Time) {
+	if rate == b.rate {
+		return
+	}
+
+	b.advance(now)
+	b.rate = rate
+}
+
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.advance(now)
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) cancel() {
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+type rateLimitMessageHandler struct {
+	next    MessageHandler
+	limiter *RateLimiter
+}
+
+// MakeRateLimitMessageHandlerMiddleware message handler middleware con rate limit
+func MakeRateLimitMessageHandlerMiddleware(limiter *RateLimiter) MessageHandlerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		return &rateLimitMessageHandler{next: next, limiter: limiter}
+	}
+}
+
+func (h *rateLimitMessageHandler) HandleMessage(ctx context.Context, inMsg *ConsumerMessage) error {
+	if err := h.limiter.Wait(ctx, inMsg); err != nil {
+		return err
+	}
+
+	err := h.next.HandleMessage(ctx, inMsg)
+	h.limiter.Observe(err)
+
+	return err
+}
+
+// MakeRateLimitStreamProcessorMiddleware stream processor middleware con rate limit
+func MakeRateLimitStreamProcessorMiddleware(limiter *RateLimiter) StreamProcessorMiddleware {
+	return func(next StreamProcessor) StreamProcessor {
+		return func(ctx context.Context, inMsg *ConsumerMessage) (*ProducerMessage, error) {
+			if err := limiter.Wait(ctx, inMsg); err != nil {
+				return nil, err
+			}
+
+			outMsg, err := next(ctx, inMsg)
+			limiter.Observe(err)
+
+			return outMsg, err
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+// waitsWithin retorna el tiempo que tomo Wait y falla si retorna error
+func waitsWithin(t *testing.T, limiter *kafka.RateLimiter, key string) time.Duration {
+	t.Helper()
+
+	start := time.Now()
+	if err := limiter.Wait(context.Background(), &kafka.ConsumerMessage{Key: []byte(key)}); err != nil {
+		t.Fatalf("no se esperaba error, se obtuvo %v", err)
+	}
+
+	return time.Since(start)
+}
+
+func TestRateLimiterGlobalRate(t *testing.T) {
+	limiter := kafka.NewRateLimiter(kafka.RateLimitConfig{Rate: 20, Burst: 1})
+
+	if elapsed := waitsWithin(t, limiter, ""); elapsed > 20*time.Millisecond {
+		t.Errorf("el primer mensaje no debia esperar, espero %s", elapsed)
+	}
+
+	start := time.Now()
+	waitsWithin(t, limiter, "")
+	waitsWithin(t, limiter, "")
+
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("se esperaban al menos 100ms para 2 mensajes a 20/s, se obtuvo %s", elapsed)
+	}
+}
+
+func TestRateLimiterKeyRate(t *testing.T) {
+	limiter := kafka.NewRateLimiter(kafka.RateLimitConfig{
+		KeyFunc:   kafka.RateLimitByKey(),
+		KeyRate:   5,
+		KeyBurst:  1,
+		KeyQuotas: map[string]float64{"grande": 1000},
+	})
+
+	waitsWithin(t, limiter, "a")
+
+	// otra clave tiene su propio bucket
+	if elapsed := waitsWithin(t, limiter, "b"); elapsed > 20*time.Millisecond {
+		t.Errorf("una clave distinta no debia esperar, espero %s", elapsed)
+	}
+
+	if elapsed := waitsWithin(t, limiter, "a"); elapsed < 150*time.Millisecond {
+		t.Errorf("se esperaban 200ms para la clave a 5/s, se obtuvo %s", elapsed)
+	}
+
+	// la cuota de la clave tiene prioridad sobre KeyRate
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		waitsWithin(t, limiter, "grande")
+	}
+
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("la clave con cuota 1000/s no debia esperar, espero %s", elapsed)
+	}
+
+	// los mensajes sin clave solo aplican el limite global
+	if elapsed := waitsWithin(t, limiter, ""); elapsed > 20*time.Millisecond {
+		t.Errorf("un mensaje sin clave no debia esperar, espero %s", elapsed)
+	}
+}
+
+func TestRateLimiterMaxKeys(t *testing.T) {
+	limiter := kafka.NewRateLimiter(kafka.RateLimitConfig{
+		KeyFunc:  kafka.RateLimitByKey(),
+		KeyRate:  1,
+		KeyBurst: 1,
+		MaxKeys:  1,
+	})
+
+	waitsWithin(t, limiter, "a")
+
+	// con MaxKeys 1 la clave b descarta el bucket de a aunque este en uso
+	waitsWithin(t, limiter, "b")
+
+	if elapsed := waitsWithin(t, limiter, "a"); elapsed > 100*time.Millisecond {
+		t.Errorf("se esperaba un bucket nuevo para la clave a, espero %s", elapsed)
+	}
+}
+
+func TestRateLimiterCancelledWait(t *testing.T) {
+	kafkatest.EnsureLogger()
+
+	limiter := kafka.NewRateLimiter(kafka.RateLimitConfig{Rate: 1, Burst: 1})
+	waitsWithin(t, limiter, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := limiter.Wait(ctx, &kafka.ConsumerMessage{})
+	if !errors.Is(err, kafka.ErrSessionClosed) {
+		t.Errorf("se esperaba un error que envuelva ErrSessionClosed, se obtuvo %v", err)
+	}
+
+	done := make(chan struct{})
+	close(done)
+
+	err = limiter.Wait(kafka.ContextWithSessionDone(context.Background(), done), &kafka.ConsumerMessage{})
+	if !errors.Is(err, kafka.ErrSessionClosed) {
+		t.Errorf("se esperaba ErrSessionClosed al terminar la sesion, se obtuvo %v", err)
+	}
+}
+
+func TestRateLimitMiddlewareTimeoutNotMarked(t *testing.T) {
+	kafkatest.EnsureLogger()
+
+	limiter := kafka.NewRateLimiter(kafka.RateLimitConfig{Rate: 1, Burst: 1})
+	handler := kafka.MakeRateLimitMessageHandlerMiddleware(limiter)(kafkatest.HandlerFunc(
+		func(ctx context.Context, inMsg *kafka.ConsumerMessage) error { return nil }))
+
+	if err := handler.HandleMessage(context.Background(), &kafka.ConsumerMessage{}); err != nil {
+		t.Fatalf("no se esperaba error, se obtuvo %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := handler.HandleMessage(ctx, &kafka.ConsumerMessage{}); !errors.Is(err, kafka.ErrSessionClosed) {
+		t.Errorf("un timeout durante la espera no debe marcar el mensaje, se obtuvo %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package kafka_toolkit
+
+import (
+	"sort"
+	"sync"
+)
+
+// RebalanceListener recibe notificaciones cuando el consumer group asigna o revoca particiones.
+// Cada rebalanceo es eager: al terminar la sesion se revocan todas las particiones y al iniciar la
+// siguiente se asignan las nuevas, incluso con la estrategia sticky.
+type RebalanceListener interface {
+	PartitionsAssigned(topic string, partitions []int32)
+	PartitionsRevoked(topic string, partitions []int32)
+}
+
+// partitionAssignment particiones asignadas actualmente al consumer, compartida entre copias de BaseConsumer
+type partitionAssignment struct {
+	mu    sync.Mutex
+	owned map[string]map[int32]bool
+}
+
+func newPartitionAssignment() *partitionAssignment {
+	return &partitionAssignment{owned: make(map[string]map[int32]bool)}
+}
+
+// update reemplaza la asignacion actual y retorna particiones agregadas, revocadas y retenidas
+func (a *partitionAssignment) update(claims map[string][]int32) (added, revoked, retained map[string][]int32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	added = make(map[string][]int32)
+	revoked = make(map[string][]int32)
+	retained = make(map[string][]int32)
+
+	next := make(map[string]map[int32]bool, len(claims))
+	for topic, partitions := range claims {
+		next[topic] = make(map[int32]bool, len(partitions))
+
+		for _, partition := range partitions {
+			next[topic][partition] = true
+
+			if a.owned[topic][partition] {
+				retained[topic] = append(retained[topic], partition)
+			} else {
+				added[topic] = append(added[topic], partition)
+			}
+		}
+	}
+
+	for topic, partitions := range a.owned {
+		for partition := range partitions {
+			if !next[topic][partition] {
+				revoked[topic] = append(revoked[topic], partition)
+			}
+		}
+	}
+
+	a.owned = next
+
+	return sortPartitions(added), sortPartitions(revoked), sortPartitions(retained)
+}
+
+// snapshot retorna las particiones asignadas actualmente
+func (a *partitionAssignment) snapshot() map[string][]int32 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	claims := make(map[string][]int32, len(a.owned))
+	for topic, partitions := range a.owned {
+		for partition := range partitions {
+			claims[topic] = append(claims[topic], partition)
+		}
+	}
+
+	return sortPartitions(claims)
+}
+
+func sortPartitions(partitions map[string][]int32) map[string][]int32 {
+	for _, list := range partitions {
+		sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	}
+
+	return partitions
+}
+
+// assignPartitions registra la asignacion al inicio de una sesion y notifica las particiones asignadas
+func (consumer *BaseConsumer) assignPartitions(claims map[string][]int32) {
+	if consumer.assignment == nil {
+		consumer.assignment = newPartitionAssignment()
+	}
+
+	added, revoked, retained := consumer.assignment.update(claims)
+
+	Log.Info(
+		"message", "Particiones asignadas",
+		"added", added,
+		"revoked", revoked,
+		"retained", retained)
+
+	if consumer.RebalanceListener == nil {
+		return
+	}
+
+	for topic, partitions := range revoked {
+		consumer.RebalanceListener.PartitionsRevoked(topic, partitions)
+	}
+
+	for topic, partitions := range added {
+		consumer.RebalanceListener.PartitionsAssigned(topic, partitions)
+	}
+}
+
+// revokeAllPartitions revoca todas las particiones, se utiliza al terminar cada sesion y al detener el consumer
+func (consumer *BaseConsumer) revokeAllPartitions() {
+	if consumer.assignment == nil {
+		return
+	}
+
+	_, revoked, _ := consumer.assignment.update(nil)
+
+	if consumer.RebalanceListener == nil {
+		return
+	}
+
+	for topic, partitions := range revoked {
+		consumer.RebalanceListener.PartitionsRevoked(topic, partitions)
+	}
+}
@@ -0,0 +1,75 @@
+package kafka_toolkit_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+type recordingRebalanceListener struct {
+	events []string
+}
+
+func (l *recordingRebalanceListener) PartitionsAssigned(topic string, partitions []int32) {
+	for _, partition := range partitions {
+		l.events = append(l.events, fmt.Sprintf("assigned %s %d", topic, partition))
+	}
+}
+
+func (l *recordingRebalanceListener) PartitionsRevoked(topic string, partitions []int32) {
+	for _, partition := range partitions {
+		l.events = append(l.events, fmt.Sprintf("revoked %s %d", topic, partition))
+	}
+}
+
+func TestCleanupRevokesAllPartitions(t *testing.T) {
+	kafkatest.EnsureLogger()
+
+	listener := &recordingRebalanceListener{}
+	consumer := kafka.NewBaseConsumer(kafkatest.HandlerFunc(nil), kafkatest.NewRecordingErrorHandler())
+	consumer.RebalanceListener = listener
+
+	first := kafkatest.NewFakeConsumerGroupSession(map[string][]int32{"orders": {0, 1}})
+	if err := consumer.Setup(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := consumer.Cleanup(first); err != nil {
+		t.Fatal(err)
+	}
+
+	consumer.Ready = make(chan bool)
+	second := kafkatest.NewFakeConsumerGroupSession(map[string][]int32{"orders": {1}})
+	if err := consumer.Setup(second); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"assigned orders 0", "assigned orders 1",
+		"revoked orders 0", "revoked orders 1",
+		"assigned orders 1",
+	}
+	if !reflect.DeepEqual(listener.events, expected) {
+		t.Errorf("eventos de rebalanceo: se esperaba %v, se obtuvo %v", expected, listener.events)
+	}
+}
+
+func TestBalanceStrategyResolverPicksFirstSupported(t *testing.T) {
+	resolver := kafka.NewBalanceStrategyResolver()
+
+	strategy, err := resolver.Resolve("cooperative-sticky, sticky, range")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strategy != sarama.BalanceStrategySticky {
+		t.Errorf("se esperaba estrategia sticky, se obtuvo %v", strategy.Name())
+	}
+
+	if _, err := resolver.Resolve("cooperative-sticky"); err == nil {
+		t.Errorf("se esperaba error para cooperative-sticky, no soportado por sarama")
+	}
+}
@@ -0,0 +1,101 @@
+package kafka_toolkit
+
+import (
+	"context"
+	"sync"
+)
+
+// ContextStateStorePrefix prefijo de key de state store en context, se completa con el nombre del store
+const ContextStateStorePrefix = "STATE_STORE:"
+
+// KeyValueStore store clave-valor local utilizado por processors con estado
+type KeyValueStore interface {
+	// Get retorna el valor de la clave, found en false si no existe
+	Get(key []byte) (value []byte, found bool, err error)
+	Put(key []byte, value []byte) error
+	Delete(key []byte) error
+	// Range recorre las claves sin orden definido hasta que fn retorne error
+	Range(fn func(key []byte, value []byte) error) error
+}
+
+// StateStoreFromContext obtiene el store de la particion del mensaje en proceso, nil si no esta disponible
+func StateStoreFromContext(ctx context.Context, name string) KeyValueStore {
+	store, _ := ctx.Value(ContextStateStorePrefix + name).(KeyValueStore)
+	return store
+}
+
+func contextWithStateStore(ctx context.Context, name string, store KeyValueStore) context.Context {
+	return context.WithValue(ctx, ContextStateStorePrefix+name, store)
+}
+
+// MemoryKeyValueStore store clave-valor en memoria
+type MemoryKeyValueStore struct {
+	mu     sync.RWMutex
+	values map[string][]byte
+}
+
+// NewMemoryKeyValueStore constructor de MemoryKeyValueStore
+func NewMemoryKeyValueStore() *MemoryKeyValueStore {
+	return &MemoryKeyValueStore{values: make(map[string][]byte)}
+}
+
+// Get implementa KeyValueStore
+func (s *MemoryKeyValueStore) Get(key []byte) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.values[string(key)]
+
+	return value, ok, nil
+}
+
+// Put implementa KeyValueStore
+func (s *MemoryKeyValueStore) Put(key []byte, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[string(key)] = append([]byte(nil), value...)
+
+	return nil
+}
+
+// Delete implementa KeyValueStore
+func (s *MemoryKeyValueStore) Delete(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.values, string(key))
+
+	return nil
+}
+
+// Range implementa KeyValueStore
+func (s *MemoryKeyValueStore) Range(fn func(key []byte, value []byte) error) error {
+	s.mu.RLock()
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	s.mu.RUnlock()
+
+	for _, key := range keys {
+		value, ok, _ := s.Get([]byte(key))
+		if !ok {
+			continue
+		}
+
+		if err := fn([]byte(key), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Len cantidad de claves en el store
+func (s *MemoryKeyValueStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.values)
+}
@@ -0,0 +1,540 @@
+package kafka_toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	defaultRestoreIdleTimeout = 10 * time.Second
+	defaultChangelogSuffix    = "-changelog"
+)
+
+// StateStoreUnavailableErrorKind el store de la particion no pudo abrirse o restaurarse
+var StateStoreUnavailableErrorKind = "State store no disponible"
+
+// StateStoreBackend crea el store local de una particion
+type StateStoreBackend func(name string, partition int32) (KeyValueStore, error)
+
+// MemoryStoreBackend backend en memoria, el estado se restaura completo desde el changelog al asignar una particion
+// que no estaba asignada
+func MemoryStoreBackend() StateStoreBackend {
+	return func(name string, partition int32) (KeyValueStore, error) {
+		return NewMemoryKeyValueStore(), nil
+	}
+}
+
+// DiskStoreBackend backend embebido en disco bajo dir/<nombre>/<particion>. Al terminar la restauracion y al
+// revocar la particion se registra un checkpoint, y la siguiente apertura solo restaura los cambios posteriores.
+func DiskStoreBackend(dir string) StateStoreBackend {
+	return func(name string, partition int32) (KeyValueStore, error) {
+		return OpenDiskKeyValueStore(filepath.Join(dir, name, strconv.Itoa(int(partition))))
+	}
+}
+
+// checkpointedStore store que conserva su estado entre aperturas
+type checkpointedStore interface {
+	readCheckpoint() (int64, bool)
+	writeCheckpoint(offset int64) error
+	clear() error
+}
+
+// StateStoreConfig configuracion de state store respaldado en un topico changelog compactado
+type StateStoreConfig struct {
+	// Name nombre del store, utilizado para obtenerlo desde el context con StateStoreFromContext
+	Name string
+	// ChangelogTopic topico compactado con los cambios del store, por defecto <Name>-changelog.
+	// Debe tener al menos tantas particiones como el topico de entrada.
+	ChangelogTopic string
+	// Backend store local por particion, por defecto MemoryStoreBackend
+	Backend StateStoreBackend
+	// Producer brokers y seguridad del cluster del changelog, Topic se ignora
+	Producer BaseProducerConfigInput
+	// CreateChangelog crea el topico changelog compactado si no existe, con tantas particiones como el topico de entrada
+	CreateChangelog bool
+	// ReplicationFactor replicacion del changelog al crearlo, por defecto 1
+	ReplicationFactor int16
+	// RestoreIdleTimeout tiempo sin recibir registros tras el cual se da por terminada la restauracion, por defecto 10 segundos
+	RestoreIdleTimeout time.Duration
+}
+
+// StateStore state store particionado igual que el topico de entrada. Cada escritura se registra en la misma
+// particion del changelog que la del mensaje en proceso, de modo que al rebalancear el estado se mueve con la particion.
+// Se debe registrar como RebalanceListener del consumer para restaurar el store al asignar particiones.
+// Los stores de las particiones revocadas se conservan abiertos: si la siguiente asignacion las incluye solo se
+// aplican los cambios posteriores del changelog, y si no las incluye se cierran.
+type StateStore struct {
+	config   StateStoreConfig
+	client   sarama.Client
+	producer sarama.SyncProducer
+
+	mu          sync.Mutex
+	partitions  map[int32]*partitionStore
+	suspended   map[int32]*partitionStore
+	changelogOK bool
+}
+
+type partitionStore struct {
+	store     KeyValueStore
+	changelog *changelogStore
+	// next offset siguiente del changelog ya aplicado al store
+	next int64
+}
+
+// NewStateStore crea el state store y el cliente del changelog
+func NewStateStore(config StateStoreConfig) (*StateStore, error) {
+	if config.Name == "" {
+		return nil, errors.New("Nombre de state store requerido")
+	}
+
+	if config.ChangelogTopic == "" {
+		config.ChangelogTopic = config.Name + defaultChangelogSuffix
+	}
+
+	if config.Backend == nil {
+		config.Backend = MemoryStoreBackend()
+	}
+
+	if config.ReplicationFactor <= 0 {
+		config.ReplicationFactor = 1
+	}
+
+	if config.RestoreIdleTimeout <= 0 {
+		config.RestoreIdleTimeout = defaultRestoreIdleTimeout
+	}
+
+	conf, err := NewBaseProducerConfigurer().GenerateConfig(config.Producer)
+	if err != nil {
+		return nil, err
+	}
+
+	conf.SaramaConfig.Producer.Partitioner = sarama.NewManualPartitioner
+	// El changelog debe crearse compactado, no por auto creacion del broker
+	conf.SaramaConfig.Metadata.AllowAutoTopicCreation = false
+
+	client, err := sarama.NewClient(conf.Brokers, conf.SaramaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &StateStore{
+		config:     config,
+		client:     client,
+		producer:   producer,
+		partitions: make(map[int32]*partitionStore),
+		suspended:  make(map[int32]*partitionStore),
+	}, nil
+}
+
+// Name nombre del store
+func (s *StateStore) Name() string {
+	return s.config.Name
+}
+
+// PartitionsAssigned implementa RebalanceListener, restaura el store de cada particion asignada y cierra los
+// stores conservados de particiones que no se volvieron a asignar
+func (s *StateStore) PartitionsAssigned(topic string, partitions []int32) {
+	s.mu.Lock()
+	assigned := make(map[int32]bool, len(partitions))
+	for _, partition := range partitions {
+		assigned[partition] = true
+	}
+
+	for partition, ps := range s.suspended {
+		if !assigned[partition] {
+			delete(s.suspended, partition)
+			s.closeStoreLocked(partition, ps)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, partition := range partitions {
+		if _, err := s.partition(topic, partition); err != nil {
+			Log.Error(
+				"errorMessage", "Error restaurando state store",
+				"store", s.config.Name,
+				"partition", partition,
+				"error", err)
+		}
+	}
+}
+
+// PartitionsRevoked implementa RebalanceListener, conserva el store de cada particion revocada hasta la
+// siguiente asignacion, ya que cada rebalanceo revoca todas las particiones
+func (s *StateStore) PartitionsRevoked(topic string, partitions []int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, partition := range partitions {
+		ps, ok := s.partitions[partition]
+		if !ok {
+			continue
+		}
+
+		delete(s.partitions, partition)
+		s.suspended[partition] = ps
+		s.checkpointLocked(partition, ps)
+	}
+}
+
+// Store obtiene el store de una particion, lo restaura si aun no esta abierto
+func (s *StateStore) Store(topic string, partition int32) (KeyValueStore, error) {
+	ps, err := s.partition(topic, partition)
+	if err != nil {
+		return nil, err
+	}
+
+	return ps.changelog, nil
+}
+
+// StreamProcessorMiddleware agrega al context el store de la particion del mensaje
+func (s *StateStore) StreamProcessorMiddleware() StreamProcessorMiddleware {
+	return func(next StreamProcessor) StreamProcessor {
+		return func(ctx context.Context, inMsg *ConsumerMessage) (*ProducerMessage, error) {
+			store, err := s.Store(inMsg.Topic, inMsg.Partition)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", StateStoreUnavailableErrorKind, err)
+			}
+
+			return next(contextWithStateStore(ctx, s.config.Name, store), inMsg)
+		}
+	}
+}
+
+// MessageHandlerMiddleware agrega al context el store de la particion del mensaje
+func (s *StateStore) MessageHandlerMiddleware() MessageHandlerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		return &stateStoreMessageHandler{next: next, stateStore: s}
+	}
+}
+
+// Close cierra los stores abiertos, el producer y el cliente del changelog
+func (s *StateStore) Close() error {
+	s.mu.Lock()
+	for partition, ps := range s.partitions {
+		delete(s.partitions, partition)
+		s.closeStoreLocked(partition, ps)
+	}
+	for partition, ps := range s.suspended {
+		delete(s.suspended, partition)
+		s.closeStoreLocked(partition, ps)
+	}
+	s.mu.Unlock()
+
+	if err := s.producer.Close(); err != nil {
+		return err
+	}
+
+	if err := s.client.Close(); err != nil && err != sarama.ErrClosedClient {
+		return err
+	}
+
+	return nil
+}
+
+func (s *StateStore) partition(topic string, partition int32) (*partitionStore, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ps, ok := s.partitions[partition]; ok {
+		return ps, nil
+	}
+
+	if err := s.ensureChangelogLocked(topic); err != nil {
+		return nil, err
+	}
+
+	ps, retained := s.suspended[partition]
+	delete(s.suspended, partition)
+
+	if !retained {
+		store, err := s.config.Backend(s.config.Name, partition)
+		if err != nil {
+			return nil, err
+		}
+
+		ps = &partitionStore{store: store}
+		ps.changelog = &changelogStore{owner: s, partition: partition, state: ps}
+	}
+
+	begin := time.Now()
+	restored, err := s.restore(partition, ps, retained)
+	if err != nil {
+		closeStore(ps.store)
+		return nil, err
+	}
+
+	s.checkpointLocked(partition, ps)
+
+	Log.Info(
+		"message", "State store restaurado",
+		"store", s.config.Name,
+		"changelog", s.config.ChangelogTopic,
+		"partition", partition,
+		"retained", retained,
+		"records", restored,
+		"duration", time.Since(begin).String())
+
+	s.partitions[partition] = ps
+
+	return ps, nil
+}
+
+// checkpointLocked registra el offset del changelog aplicado al store, si el backend conserva su estado
+func (s *StateStore) checkpointLocked(partition int32, ps *partitionStore) {
+	checkpointed, ok := ps.store.(checkpointedStore)
+	if !ok {
+		return
+	}
+
+	if err := checkpointed.writeCheckpoint(atomic.LoadInt64(&ps.next)); err != nil {
+		Log.Error(
+			"errorMessage", "Error registrando checkpoint de state store",
+			"store", s.config.Name,
+			"partition", partition,
+			"error", err)
+	}
+}
+
+func (s *StateStore) closeStoreLocked(partition int32, ps *partitionStore) {
+	s.checkpointLocked(partition, ps)
+	closeStore(ps.store)
+}
+
+// restore aplica el changelog hasta el high-water mark. Un store conservado de la asignacion anterior continua
+// desde su ultimo offset aplicado, uno nuevo desde su checkpoint o desde el inicio.
+func (s *StateStore) restore(partition int32, ps *partitionStore, retained bool) (int64, error) {
+	topic := s.config.ChangelogTopic
+
+	oldest, err := s.client.GetOffset(topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, err
+	}
+
+	end, err := s.client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, err
+	}
+
+	start := oldest
+	checkpointed, isCheckpointed := ps.store.(checkpointedStore)
+
+	switch {
+	case retained && ps.next >= oldest && ps.next <= end:
+		start = ps.next
+	case retained && !isCheckpointed:
+		// El store conservado quedo fuera del rango del changelog, se reemplaza por uno vacio
+		closeStore(ps.store)
+		if ps.store, err = s.config.Backend(s.config.Name, partition); err != nil {
+			return 0, err
+		}
+	case isCheckpointed:
+		checkpoint, found := checkpointed.readCheckpoint()
+
+		if !retained && found && checkpoint >= oldest && checkpoint <= end {
+			start = checkpoint
+		} else if err := checkpointed.clear(); err != nil {
+			return 0, err
+		}
+	}
+
+	ps.next = start
+	if start >= end {
+		ps.next = end
+		return 0, nil
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(s.client)
+	if err != nil {
+		return 0, err
+	}
+	defer consumer.Close()
+
+	partitionConsumer, err := consumer.ConsumePartition(topic, partition, start)
+	if err != nil {
+		return 0, err
+	}
+	defer partitionConsumer.AsyncClose()
+
+	var restored int64
+	idle := time.NewTimer(s.config.RestoreIdleTimeout)
+	defer idle.Stop()
+
+	for ps.next < end {
+		select {
+		case message, ok := <-partitionConsumer.Messages():
+			if !ok {
+				return restored, errors.New("Restauracion de changelog interrumpida")
+			}
+
+			if message.Value == nil {
+				err = ps.store.Delete(message.Key)
+			} else {
+				err = ps.store.Put(message.Key, message.Value)
+			}
+
+			if err != nil {
+				return restored, err
+			}
+
+			restored++
+			ps.next = message.Offset + 1
+
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(s.config.RestoreIdleTimeout)
+		case <-idle.C:
+			// Los ultimos offsets pueden no existir (por ejemplo marcadores de transaccion)
+			Log.Warn(
+				"message", "Restauracion de changelog finalizada por inactividad",
+				"store", s.config.Name,
+				"partition", partition,
+				"offset", ps.next,
+				"end", end)
+			ps.next = end
+		}
+	}
+
+	return restored, nil
+}
+
+// ensureChangelogLocked verifica el changelog y lo crea compactado si corresponde
+func (s *StateStore) ensureChangelogLocked(inputTopic string) error {
+	if s.changelogOK {
+		return nil
+	}
+
+	if _, err := s.client.Partitions(s.config.ChangelogTopic); err == nil {
+		s.changelogOK = true
+		return nil
+	}
+
+	if !s.config.CreateChangelog {
+		return fmt.Errorf("Topico changelog %s no existe", s.config.ChangelogTopic)
+	}
+
+	partitions, err := s.client.Partitions(inputTopic)
+	if err != nil {
+		return err
+	}
+
+	admin, err := sarama.NewClusterAdminFromClient(s.client)
+	if err != nil {
+		return err
+	}
+
+	compact := "compact"
+	err = admin.CreateTopic(s.config.ChangelogTopic, &sarama.TopicDetail{
+		NumPartitions:     int32(len(partitions)),
+		ReplicationFactor: s.config.ReplicationFactor,
+		ConfigEntries:     map[string]*string{"cleanup.policy": &compact},
+	}, false)
+
+	var topicErr *sarama.TopicError
+	if err != nil && !(errors.As(err, &topicErr) && topicErr.Err == sarama.ErrTopicAlreadyExists) {
+		return err
+	}
+
+	Log.Info(
+		"message", "Topico changelog creado",
+		"store", s.config.Name,
+		"changelog", s.config.ChangelogTopic,
+		"partitions", len(partitions))
+
+	s.changelogOK = true
+
+	return s.client.RefreshMetadata(s.config.ChangelogTopic)
+}
+
+func closeStore(store KeyValueStore) {
+	if closer, ok := store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			Log.Error(
+				"errorMessage", "Error cerrando store",
+				"error", err)
+		}
+	}
+}
+
+// changelogStore store de una particion que registra cada escritura en el changelog antes de aplicarla
+type changelogStore struct {
+	owner     *StateStore
+	partition int32
+	state     *partitionStore
+}
+
+func (c *changelogStore) Get(key []byte) ([]byte, bool, error) {
+	return c.state.store.Get(key)
+}
+
+func (c *changelogStore) Put(key []byte, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+
+	if err := c.log(key, sarama.ByteEncoder(value)); err != nil {
+		return err
+	}
+
+	return c.state.store.Put(key, value)
+}
+
+func (c *changelogStore) Delete(key []byte) error {
+	if err := c.log(key, nil); err != nil {
+		return err
+	}
+
+	return c.state.store.Delete(key)
+}
+
+func (c *changelogStore) Range(fn func(key []byte, value []byte) error) error {
+	return c.state.store.Range(fn)
+}
+
+func (c *changelogStore) log(key []byte, value sarama.Encoder) error {
+	// Value nil produce un tombstone
+	_, offset, err := c.owner.producer.SendMessage(&sarama.ProducerMessage{
+		Topic:     c.owner.config.ChangelogTopic,
+		Partition: c.partition,
+		Key:       sarama.ByteEncoder(key),
+		Value:     value,
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %q", SaramaProducerErrorKind, err.Error())
+	}
+
+	atomic.StoreInt64(&c.state.next, offset+1)
+
+	return nil
+}
+
+type stateStoreMessageHandler struct {
+	next       MessageHandler
+	stateStore *StateStore
+}
+
+func (h *stateStoreMessageHandler) HandleMessage(ctx context.Context, inMsg *ConsumerMessage) error {
+	store, err := h.stateStore.Store(inMsg.Topic, inMsg.Partition)
+	if err != nil {
+		return fmt.Errorf("%s: %v", StateStoreUnavailableErrorKind, err)
+	}
+
+	return h.next.HandleMessage(contextWithStateStore(ctx, h.stateStore.config.Name, store), inMsg)
+}
@@ -0,0 +1,355 @@
+package kafka_toolkit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	diskStoreDataFile       = "data.log"
+	diskStoreCheckpointFile = "checkpoint"
+	diskStoreHeaderSize     = 9
+	diskStoreCompactMinSize = 4 * 1024 * 1024
+
+	diskStoreOpPut    byte = 1
+	diskStoreOpDelete byte = 2
+)
+
+// diskValue posicion de un valor dentro del archivo de datos
+type diskValue struct {
+	offset int64
+	length uint32
+}
+
+// DiskKeyValueStore store clave-valor embebido en disco. Los registros se agregan al final de un archivo
+// de datos y se mantiene en memoria solo el indice de posiciones, por lo que soporta estados mayores a la memoria.
+// El archivo se compacta al superar el doble del tamaño de los registros vigentes.
+type DiskKeyValueStore struct {
+	mu    sync.RWMutex
+	dir   string
+	file  *os.File
+	size  int64
+	live  int64
+	index map[string]diskValue
+}
+
+// OpenDiskKeyValueStore abre o crea un store en el directorio indicado
+func OpenDiskKeyValueStore(dir string) (*DiskKeyValueStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	store := &DiskKeyValueStore{dir: dir}
+	if err := store.open(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Get implementa KeyValueStore
+func (s *DiskKeyValueStore) Get(key []byte) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	position, ok := s.index[string(key)]
+	if !ok {
+		return nil, false, nil
+	}
+
+	value := make([]byte, position.length)
+	if _, err := s.file.ReadAt(value, position.offset); err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+// Put implementa KeyValueStore
+func (s *DiskKeyValueStore) Put(key []byte, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offset, err := s.append(diskStoreOpPut, key, value)
+	if err != nil {
+		return err
+	}
+
+	if previous, ok := s.index[string(key)]; ok {
+		s.live -= diskStoreHeaderSize + int64(len(key)) + int64(previous.length)
+	}
+
+	s.index[string(key)] = diskValue{offset: offset, length: uint32(len(value))}
+	s.live += diskStoreHeaderSize + int64(len(key)) + int64(len(value))
+
+	return s.maybeCompact()
+}
+
+// Delete implementa KeyValueStore
+func (s *DiskKeyValueStore) Delete(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.index[string(key)]
+	if !ok {
+		return nil
+	}
+
+	if _, err := s.append(diskStoreOpDelete, key, nil); err != nil {
+		return err
+	}
+
+	delete(s.index, string(key))
+	s.live -= diskStoreHeaderSize + int64(len(key)) + int64(previous.length)
+
+	return s.maybeCompact()
+}
+
+// Range implementa KeyValueStore
+func (s *DiskKeyValueStore) Range(fn func(key []byte, value []byte) error) error {
+	s.mu.RLock()
+	keys := make([]string, 0, len(s.index))
+	for key := range s.index {
+		keys = append(keys, key)
+	}
+	s.mu.RUnlock()
+
+	for _, key := range keys {
+		value, ok, err := s.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := fn([]byte(key), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Len cantidad de claves en el store
+func (s *DiskKeyValueStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.index)
+}
+
+// Close sincroniza y cierra el archivo de datos
+func (s *DiskKeyValueStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.file.Sync(); err != nil {
+		s.file.Close()
+		return err
+	}
+
+	return s.file.Close()
+}
+
+// readCheckpoint offset del changelog hasta el cual el store esta actualizado, escrito al restaurar y al revocar
+// la particion. Las escrituras posteriores ya estan en el changelog, por lo que se vuelven a aplicar al restaurar.
+func (s *DiskKeyValueStore) readCheckpoint() (int64, bool) {
+	content, err := os.ReadFile(filepath.Join(s.dir, diskStoreCheckpointFile))
+	if err != nil {
+		return 0, false
+	}
+
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return offset, true
+}
+
+func (s *DiskKeyValueStore) writeCheckpoint(offset int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.dir, diskStoreCheckpointFile)
+	if err := os.WriteFile(path+".tmp", []byte(strconv.FormatInt(offset, 10)), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// clear elimina todas las claves del store
+func (s *DiskKeyValueStore) clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.file.Truncate(0); err != nil {
+		return err
+	}
+
+	s.size = 0
+	s.live = 0
+	s.index = make(map[string]diskValue)
+
+	return nil
+}
+
+func (s *DiskKeyValueStore) open() error {
+	file, err := os.OpenFile(filepath.Join(s.dir, diskStoreDataFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	s.file = file
+	s.index = make(map[string]diskValue)
+	s.size = 0
+	s.live = 0
+
+	return s.load()
+}
+
+// load reconstruye el indice, un registro incompleto al final por una caida se descarta
+func (s *DiskKeyValueStore) load() error {
+	reader := bufio.NewReader(io.NewSectionReader(s.file, 0, 1<<62))
+	header := make([]byte, diskStoreHeaderSize)
+	var offset int64
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			break
+		}
+
+		op := header[0]
+		keyLength := binary.BigEndian.Uint32(header[1:5])
+		valueLength := binary.BigEndian.Uint32(header[5:9])
+
+		key := make([]byte, keyLength)
+		if _, err := io.ReadFull(reader, key); err != nil {
+			break
+		}
+
+		if _, err := reader.Discard(int(valueLength)); err != nil {
+			break
+		}
+
+		recordSize := diskStoreHeaderSize + int64(keyLength) + int64(valueLength)
+
+		if previous, ok := s.index[string(key)]; ok {
+			s.live -= diskStoreHeaderSize + int64(keyLength) + int64(previous.length)
+			delete(s.index, string(key))
+		}
+
+		switch op {
+		case diskStoreOpPut:
+			s.index[string(key)] = diskValue{offset: offset + diskStoreHeaderSize + int64(keyLength), length: valueLength}
+			s.live += recordSize
+		case diskStoreOpDelete:
+		default:
+			return fmt.Errorf("registro invalido en %s offset %d", s.dir, offset)
+		}
+
+		offset += recordSize
+	}
+
+	s.size = offset
+
+	return s.file.Truncate(offset)
+}
+
+func (s *DiskKeyValueStore) append(op byte, key []byte, value []byte) (int64, error) {
+	record := make([]byte, diskStoreHeaderSize+len(key)+len(value))
+	record[0] = op
+	binary.BigEndian.PutUint32(record[1:5], uint32(len(key)))
+	binary.BigEndian.PutUint32(record[5:9], uint32(len(value)))
+	copy(record[diskStoreHeaderSize:], key)
+	copy(record[diskStoreHeaderSize+len(key):], value)
+
+	if _, err := s.file.WriteAt(record, s.size); err != nil {
+		return 0, err
+	}
+
+	valueOffset := s.size + diskStoreHeaderSize + int64(len(key))
+	s.size += int64(len(record))
+
+	return valueOffset, nil
+}
+
+func (s *DiskKeyValueStore) maybeCompact() error {
+	if s.size < diskStoreCompactMinSize || s.size < 2*s.live {
+		return nil
+	}
+
+	return s.compact()
+}
+
+// compact reescribe los registros vigentes en un nuevo archivo y lo reemplaza de forma atomica
+func (s *DiskKeyValueStore) compact() error {
+	path := filepath.Join(s.dir, diskStoreDataFile)
+
+	tmp, err := os.Create(path + ".compact")
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(tmp)
+	header := make([]byte, diskStoreHeaderSize)
+
+	for key, position := range s.index {
+		value := make([]byte, position.length)
+		if _, err := s.file.ReadAt(value, position.offset); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+
+		header[0] = diskStoreOpPut
+		binary.BigEndian.PutUint32(header[1:5], uint32(len(key)))
+		binary.BigEndian.PutUint32(header[5:9], position.length)
+
+		writer.Write(header)
+		writer.WriteString(key)
+		writer.Write(value)
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	tmp.Close()
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	s.file.Close()
+
+	if err := s.open(); err != nil {
+		return errors.New("Error reabriendo store compactado: " + err.Error())
+	}
+
+	return nil
+}
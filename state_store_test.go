@@ -0,0 +1,288 @@
+package kafka_toolkit_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+const stateStoreChangelog = "counts-changelog"
+
+// changelogRecord registro del changelog de prueba, Value nil representa un tombstone
+type changelogRecord struct {
+	Key   string
+	Value *string
+}
+
+func changelogValue(value string) *string {
+	return &value
+}
+
+// newChangelogBroker broker con el changelog de dos particiones, el fetch entrega los registros con key
+func newChangelogBroker(t *testing.T, records map[int32][]changelogRecord) *sarama.MockBroker {
+	t.Helper()
+	kafkatest.EnsureLogger()
+
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+
+	metadata := sarama.NewMockMetadataResponse(t).
+		SetBroker(broker.Addr(), broker.BrokerID()).
+		SetController(broker.BrokerID())
+	offsets := sarama.NewMockOffsetResponse(t)
+	fetch := &sarama.FetchResponse{Version: 10}
+
+	for partition := int32(0); partition < 2; partition++ {
+		metadata.SetLeader(stateStoreChangelog, partition, broker.BrokerID())
+		metadata.SetLeader("counts", partition, broker.BrokerID())
+		offsets.SetOffset(stateStoreChangelog, partition, sarama.OffsetOldest, 0)
+		offsets.SetOffset(stateStoreChangelog, partition, sarama.OffsetNewest, int64(len(records[partition])))
+
+		for offset, record := range records[partition] {
+			var value sarama.Encoder
+			if record.Value != nil {
+				value = sarama.StringEncoder(*record.Value)
+			}
+
+			fetch.AddRecord(stateStoreChangelog, partition, sarama.StringEncoder(record.Key), value, int64(offset))
+		}
+
+		if len(records[partition]) > 0 {
+			fetch.SetLastOffsetDelta(stateStoreChangelog, partition, int32(len(records[partition])-1))
+			fetch.GetBlock(stateStoreChangelog, partition).HighWaterMarkOffset = int64(len(records[partition]))
+		}
+	}
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": metadata,
+		"OffsetRequest":   offsets,
+		"FetchRequest":    sarama.NewMockWrapper(fetch),
+		"ProduceRequest":  sarama.NewMockProduceResponse(t).SetVersion(3),
+	})
+
+	return broker
+}
+
+func newTestStateStore(t *testing.T, broker *sarama.MockBroker, backend kafka.StateStoreBackend) *kafka.StateStore {
+	t.Helper()
+
+	store, err := kafka.NewStateStore(kafka.StateStoreConfig{
+		Name:               "counts",
+		Backend:            backend,
+		RestoreIdleTimeout: kafkatest.DefaultTimeout,
+		Producer: kafka.BaseProducerConfigInput{
+			Brokers: broker.Addr(),
+			Ack:     int16(sarama.WaitForLocal),
+			Version: kafkatest.MockKafkaVersion,
+		},
+	})
+	if err != nil {
+		t.Fatalf("error creando state store: %v", err)
+	}
+
+	return store
+}
+
+func fetchRequests(broker *sarama.MockBroker) int {
+	count := 0
+	for _, exchange := range broker.History() {
+		if _, ok := exchange.Request.(*sarama.FetchRequest); ok {
+			count++
+		}
+	}
+
+	return count
+}
+
+func assertStoreValue(t *testing.T, store kafka.KeyValueStore, key string, expected *string) {
+	t.Helper()
+
+	value, found, err := store.Get([]byte(key))
+	if err != nil {
+		t.Fatalf("error leyendo %s: %v", key, err)
+	}
+
+	switch {
+	case expected == nil && found:
+		t.Errorf("%s: se esperaba eliminada, se obtuvo %q", key, value)
+	case expected != nil && !found:
+		t.Errorf("%s: se esperaba %q, no existe", key, *expected)
+	case expected != nil && string(value) != *expected:
+		t.Errorf("%s: se esperaba %q, se obtuvo %q", key, *expected, value)
+	}
+}
+
+func TestStateStoreRestoresChangelog(t *testing.T) {
+	broker := newChangelogBroker(t, map[int32][]changelogRecord{
+		0: {
+			{Key: "a", Value: changelogValue("1")},
+			{Key: "b", Value: changelogValue("1")},
+			{Key: "a", Value: changelogValue("2")},
+			{Key: "b"},
+		},
+	})
+
+	stateStore := newTestStateStore(t, broker, kafka.MemoryStoreBackend())
+	defer stateStore.Close()
+
+	stateStore.PartitionsAssigned("counts", []int32{0})
+
+	store, err := stateStore.Store("counts", 0)
+	if err != nil {
+		t.Fatalf("error obteniendo store: %v", err)
+	}
+
+	assertStoreValue(t, store, "a", changelogValue("2"))
+	assertStoreValue(t, store, "b", nil)
+}
+
+func TestStateStoreLogsWrites(t *testing.T) {
+	broker := newChangelogBroker(t, nil)
+
+	stateStore := newTestStateStore(t, broker, kafka.MemoryStoreBackend())
+	defer stateStore.Close()
+
+	store, err := stateStore.Store("counts", 1)
+	if err != nil {
+		t.Fatalf("error obteniendo store: %v", err)
+	}
+
+	if err := store.Put([]byte("a"), []byte("1")); err != nil {
+		t.Fatalf("error escribiendo: %v", err)
+	}
+
+	if err := store.Delete([]byte("a")); err != nil {
+		t.Fatalf("error eliminando: %v", err)
+	}
+
+	var produced []*sarama.ProduceRequest
+	for _, exchange := range broker.History() {
+		if request, ok := exchange.Request.(*sarama.ProduceRequest); ok {
+			produced = append(produced, request)
+		}
+	}
+
+	if len(produced) != 2 {
+		t.Fatalf("solicitudes de produce: se esperaba 2, se obtuvo %d", len(produced))
+	}
+
+	assertStoreValue(t, store, "a", nil)
+}
+
+func TestStateStoreKeepsStateOfReassignedPartitions(t *testing.T) {
+	broker := newChangelogBroker(t, map[int32][]changelogRecord{
+		0: {{Key: "a", Value: changelogValue("1")}},
+		1: {{Key: "b", Value: changelogValue("1")}},
+	})
+
+	stateStore := newTestStateStore(t, broker, kafka.MemoryStoreBackend())
+	defer stateStore.Close()
+
+	stateStore.PartitionsAssigned("counts", []int32{0})
+
+	store, err := stateStore.Store("counts", 0)
+	if err != nil {
+		t.Fatalf("error obteniendo store: %v", err)
+	}
+
+	// el broker de prueba no agrega la escritura al changelog, solo el store conservado la mantiene
+	if err := store.Put([]byte("local"), []byte("1")); err != nil {
+		t.Fatalf("error escribiendo: %v", err)
+	}
+
+	fetches := fetchRequests(broker)
+
+	stateStore.PartitionsRevoked("counts", []int32{0})
+	stateStore.PartitionsAssigned("counts", []int32{0, 1})
+
+	if got := fetchRequests(broker); got == fetches {
+		t.Errorf("la particion 1 nueva no se restauro desde el changelog")
+	}
+
+	store, err = stateStore.Store("counts", 0)
+	if err != nil {
+		t.Fatalf("error obteniendo store: %v", err)
+	}
+
+	assertStoreValue(t, store, "a", changelogValue("1"))
+	assertStoreValue(t, store, "local", changelogValue("1"))
+
+	restored, err := stateStore.Store("counts", 1)
+	if err != nil {
+		t.Fatalf("error obteniendo store: %v", err)
+	}
+
+	assertStoreValue(t, restored, "b", changelogValue("1"))
+
+	// la particion 0 no se vuelve a asignar, su store se cierra y la siguiente asignacion lo restaura completo
+	stateStore.PartitionsRevoked("counts", []int32{0, 1})
+	stateStore.PartitionsAssigned("counts", []int32{1})
+	stateStore.PartitionsRevoked("counts", []int32{1})
+	stateStore.PartitionsAssigned("counts", []int32{0, 1})
+
+	store, err = stateStore.Store("counts", 0)
+	if err != nil {
+		t.Fatalf("error obteniendo store: %v", err)
+	}
+
+	assertStoreValue(t, store, "a", changelogValue("1"))
+	assertStoreValue(t, store, "local", nil)
+}
+
+func TestStateStoreDiskCheckpoint(t *testing.T) {
+	broker := newChangelogBroker(t, map[int32][]changelogRecord{
+		0: {
+			{Key: "a", Value: changelogValue("1")},
+			{Key: "a", Value: changelogValue("2")},
+			{Key: "b", Value: changelogValue("1")},
+		},
+	})
+	dir := t.TempDir()
+
+	stateStore := newTestStateStore(t, broker, kafka.DiskStoreBackend(dir))
+	stateStore.PartitionsAssigned("counts", []int32{0})
+
+	checkpoint, err := os.ReadFile(filepath.Join(dir, "counts", "0", "checkpoint"))
+	if err != nil {
+		t.Fatalf("no se registro el checkpoint al restaurar: %v", err)
+	}
+
+	if strings.TrimSpace(string(checkpoint)) != "3" {
+		t.Errorf("checkpoint: se esperaba 3, se obtuvo %s", checkpoint)
+	}
+
+	if err := stateStore.Close(); err != nil {
+		t.Fatalf("error cerrando state store: %v", err)
+	}
+
+	// al reabrir el store en disco desde su checkpoint no se vuelve a leer el changelog
+	other := newChangelogBroker(t, map[int32][]changelogRecord{
+		0: {
+			{Key: "a", Value: changelogValue("x")},
+			{Key: "a", Value: changelogValue("x")},
+			{Key: "b", Value: changelogValue("x")},
+		},
+	})
+
+	reopened := newTestStateStore(t, other, kafka.DiskStoreBackend(dir))
+	defer reopened.Close()
+
+	reopened.PartitionsAssigned("counts", []int32{0})
+
+	if got := fetchRequests(other); got != 0 {
+		t.Errorf("se leyo el changelog al reabrir desde el checkpoint: %d fetch", got)
+	}
+
+	store, err := reopened.Store("counts", 0)
+	if err != nil {
+		t.Fatalf("error obteniendo store: %v", err)
+	}
+
+	assertStoreValue(t, store, "a", changelogValue("2"))
+	assertStoreValue(t, store, "b", changelogValue("1"))
+}
@@ -0,0 +1,145 @@
+package kafka_toolkit
+
+import (
+	"context"
+)
+
+// FanOutStreamProcessor processor que genera cero, uno o varios mensajes de salida por mensaje de entrada.
+// Cada mensaje puede indicar su topico de destino en ProducerMessage.Topic.
+type FanOutStreamProcessor func(ctx context.Context, inMsg *ConsumerMessage) ([]*ProducerMessage, error)
+
+// FanOutStreamProcessorMiddleware middleware de FanOutStreamProcessor
+type FanOutStreamProcessorMiddleware func(FanOutStreamProcessor) FanOutStreamProcessor
+
+// StreamPredicate indica si un mensaje de entrada continua en la stream
+type StreamPredicate func(ctx context.Context, inMsg *ConsumerMessage) bool
+
+// StreamBranchPredicate indica si un mensaje de salida corresponde a una rama
+type StreamBranchPredicate func(ctx context.Context, inMsg *ConsumerMessage, outMsg *ProducerMessage) bool
+
+// StreamBranch rama de una stream, los mensajes que cumplen Predicate se envian a Topic.
+// Predicate nil corresponde a la rama por defecto.
+type StreamBranch struct {
+	Name      string
+	Predicate StreamBranchPredicate
+	Topic     string
+}
+
+// FanOut adapta un StreamProcessor, un mensaje de salida nil sin error se considera filtrado
+func FanOut(process StreamProcessor) FanOutStreamProcessor {
+	return func(ctx context.Context, inMsg *ConsumerMessage) ([]*ProducerMessage, error) {
+		outMsg, err := process(ctx, inMsg)
+		if err != nil || outMsg == nil {
+			return nil, err
+		}
+
+		return []*ProducerMessage{outMsg}, nil
+	}
+}
+
+// MakeFilterStreamProcessorMiddleware descarta los mensajes que no cumplen el predicado. Los mensajes
+// filtrados no son errores: se comprometen y se miden como exitosos.
+func MakeFilterStreamProcessorMiddleware(predicate StreamPredicate) StreamProcessorMiddleware {
+	return func(next StreamProcessor) StreamProcessor {
+		return func(ctx context.Context, inMsg *ConsumerMessage) (*ProducerMessage, error) {
+			if !predicate(ctx, inMsg) {
+				return nil, nil
+			}
+
+			return next(ctx, inMsg)
+		}
+	}
+}
+
+// MakeBranchStreamProcessorMiddleware envia cada mensaje de salida al topico de la primera rama cuyo predicado
+// se cumple, los mensajes que no corresponden a ninguna rama se descartan
+func MakeBranchStreamProcessorMiddleware(branches ...StreamBranch) FanOutStreamProcessorMiddleware {
+	return func(next FanOutStreamProcessor) FanOutStreamProcessor {
+		return func(ctx context.Context, inMsg *ConsumerMessage) ([]*ProducerMessage, error) {
+			outMsgs, err := next(ctx, inMsg)
+			if err != nil {
+				return nil, err
+			}
+
+			routed := make([]*ProducerMessage, 0, len(outMsgs))
+			for _, outMsg := range outMsgs {
+				for _, branch := range branches {
+					if branch.Predicate != nil && !branch.Predicate(ctx, inMsg, outMsg) {
+						continue
+					}
+
+					if branch.Topic != "" {
+						outMsg.Topic = branch.Topic
+					}
+					routed = append(routed, outMsg)
+
+					break
+				}
+			}
+
+			return routed, nil
+		}
+	}
+}
+
+type fanOutStreamHandler struct {
+	producer MessageProducer
+	process  FanOutStreamProcessor
+	// log logger inyectado, nil utiliza el logger global
+	log BaseLogger
+}
+
+// NewFanOutStreamHandler message handler que envia todos los mensajes generados por el processor.
+// Sin mensajes de salida el mensaje de entrada se considera procesado exitosamente.
+// Si falla un envio se retorna el error, los mensajes ya enviados pueden duplicarse al reprocesar.
+func NewFanOutStreamHandler(producer MessageProducer, process FanOutStreamProcessor) MessageHandler {
+	return &fanOutStreamHandler{
+		producer: producer,
+		process:  process,
+	}
+}
+
+func (h *fanOutStreamHandler) HandleMessage(ctx context.Context, inMsg *ConsumerMessage) error {
+	outMsgs, err := h.process(ctx, inMsg)
+	if err != nil {
+		return err
+	}
+
+	if len(outMsgs) == 0 {
+		logFilteredMessage(h.logger(), inMsg)
+		return nil
+	}
+
+	for _, outMsg := range outMsgs {
+		if outMsg == nil {
+			continue
+		}
+
+		if err := h.producer.SendMessage(ctx, outMsg); err != nil {
+			h.logger().Error(
+				"errorMessage", "Error enviando mensaje",
+				"message", err.Error(),
+				"topic", outMsg.Topic,
+				"error", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *fanOutStreamHandler) logger() BaseLogger {
+	if h.log != nil {
+		return h.log
+	}
+
+	return Log
+}
+
+func logFilteredMessage(logger BaseLogger, inMsg *ConsumerMessage) {
+	logger.Debug(
+		"message", "Mensaje filtrado",
+		"topic", inMsg.Topic,
+		"partition", inMsg.Partition,
+		"offset", inMsg.Offset)
+}
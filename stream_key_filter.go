@@ -2,22 +2,25 @@ package kafka_toolkit
 
 import (
 	"context"
-	"fmt"
 )
 
-// MakeKeyFilterStreamMiddleware middleware de filtrado de keys para streams
+// MakeKeyFilterStreamMiddleware middleware de filtrado de keys para streams, los mensajes con keys no permitidas
+// se filtran sin error: se comprometen y se miden como exitosos
 func MakeKeyFilterStreamMiddleware(allowedKeys []string) StreamProcessorMiddleware {
-	return func(next StreamProcessor) StreamProcessor {
-		return func(ctx context.Context, inMsg *ConsumerMessage) (*ProducerMessage, error) {
-			msgKey := string(inMsg.Key)
+	return MakeFilterStreamProcessorMiddleware(func(ctx context.Context, inMsg *ConsumerMessage) bool {
+		return allowedKey(allowedKeys, inMsg)
+	})
+}
 
-			for _, key := range allowedKeys {
-				if key == msgKey {
-					return next(ctx, inMsg)
-				}
-			}
+// allowedKey indica si la key del mensaje esta en la lista de keys permitidas
+func allowedKey(allowedKeys []string, inMsg *ConsumerMessage) bool {
+	msgKey := string(inMsg.Key)
 
-			return nil, fmt.Errorf("Key no soportada %s - debe ser una de: %v", msgKey, allowedKeys)
+	for _, key := range allowedKeys {
+		if key == msgKey {
+			return true
 		}
 	}
+
+	return false
 }
@@ -38,3 +38,43 @@ func StreamTimeTakenMetricsMiddleware(duration metrics.Histogram, operation stri
 		}
 	}
 }
+
+// FanOutSuccesAndFailureMetricsMiddleware cuenta los mensajes de entrada de un FanOutStreamProcessor por status,
+// los mensajes filtrados (sin salidas) se cuentan como SUCCESS
+func FanOutSuccesAndFailureMetricsMiddleware(requests metrics.Counter, operation string) FanOutStreamProcessorMiddleware {
+	return func(process FanOutStreamProcessor) FanOutStreamProcessor {
+		return func(ctx context.Context, inMsg *ConsumerMessage) (outMsgs []*ProducerMessage, err error) {
+			defer func() {
+				status := "SUCCESS"
+				if err != nil {
+					status = "ERROR"
+				}
+				requests.With("operation", operation, "status", status).Add(1)
+			}()
+
+			return process(ctx, inMsg)
+		}
+	}
+}
+
+// FanOutRecordsMetricsMiddleware cuenta los mensajes de salida por topico de destino. Aplicado sobre
+// MakeBranchStreamProcessorMiddleware mide los mensajes enviados a cada rama, topic vacio corresponde al
+// topico del producer.
+func FanOutRecordsMetricsMiddleware(records metrics.Counter, operation string) FanOutStreamProcessorMiddleware {
+	return func(process FanOutStreamProcessor) FanOutStreamProcessor {
+		return func(ctx context.Context, inMsg *ConsumerMessage) ([]*ProducerMessage, error) {
+			outMsgs, err := process(ctx, inMsg)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, outMsg := range outMsgs {
+				if outMsg != nil {
+					records.With("operation", operation, "topic", outMsg.Topic).Add(1)
+				}
+			}
+
+			return outMsgs, nil
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/metrics"
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+// recordingCounter metrics.Counter que acumula los valores por combinacion de labels
+type recordingCounter struct {
+	mu     *sync.Mutex
+	values map[string]float64
+	labels []string
+}
+
+func newRecordingCounter() *recordingCounter {
+	return &recordingCounter{mu: &sync.Mutex{}, values: make(map[string]float64)}
+}
+
+func (c *recordingCounter) With(labelValues ...string) metrics.Counter {
+	return &recordingCounter{mu: c.mu, values: c.values, labels: append(append([]string(nil), c.labels...), labelValues...)}
+}
+
+func (c *recordingCounter) Add(delta float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[strings.Join(c.labels, ",")] += delta
+}
+
+func (c *recordingCounter) value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.values[strings.Join(labelValues, ",")]
+}
+
+func TestFanOutMetricsCountStatusAndBranches(t *testing.T) {
+	requests := newRecordingCounter()
+	records := newRecordingCounter()
+
+	processor := func(ctx context.Context, inMsg *kafka.ConsumerMessage) ([]*kafka.ProducerMessage, error) {
+		switch string(inMsg.Key) {
+		case "error":
+			return nil, errors.New("fallo")
+		case "filtrado":
+			return nil, nil
+		}
+
+		return []*kafka.ProducerMessage{
+			{Key: inMsg.Key, Msg: []byte("fraude")},
+			{Key: inMsg.Key, Msg: []byte("ok")},
+		}, nil
+	}
+
+	branched := kafka.MakeBranchStreamProcessorMiddleware(
+		kafka.StreamBranch{Name: "fraude", Topic: "payments-fraud", Predicate: func(ctx context.Context, inMsg *kafka.ConsumerMessage, outMsg *kafka.ProducerMessage) bool {
+			return string(outMsg.Msg) == "fraude"
+		}},
+		kafka.StreamBranch{Name: "default", Topic: "payments-ok"},
+	)(processor)
+	branched = kafka.FanOutRecordsMetricsMiddleware(records, "branch")(branched)
+	branched = kafka.FanOutSuccesAndFailureMetricsMiddleware(requests, "payments")(branched)
+
+	for _, key := range []string{"pago", "filtrado", "error"} {
+		branched(context.Background(), &kafka.ConsumerMessage{Key: []byte(key)})
+	}
+
+	if got := requests.value("operation", "payments", "status", "SUCCESS"); got != 2 {
+		t.Errorf("mensajes exitosos (incluye filtrados): se esperaba 2, se obtuvo %v", got)
+	}
+
+	if got := requests.value("operation", "payments", "status", "ERROR"); got != 1 {
+		t.Errorf("mensajes con error: se esperaba 1, se obtuvo %v", got)
+	}
+
+	for _, topic := range []string{"payments-fraud", "payments-ok"} {
+		if got := records.value("operation", "branch", "topic", topic); got != 1 {
+			t.Errorf("mensajes enviados a %s: se esperaba 1, se obtuvo %v", topic, got)
+		}
+	}
+}
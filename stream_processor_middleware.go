@@ -20,7 +20,7 @@ func MakeHeaderPassThruStreamProcessorMiddleware() StreamProcessorMiddleware {
 			ctx = headersToContext(ctx, inMsg)
 
 			outMsg, err := process(ctx, inMsg)
-			if err != nil {
+			if err != nil || outMsg == nil {
 				return nil, err
 			}
 
@@ -67,7 +67,7 @@ func MakeOpenTracingStreamProcessorMiddleware(operationName string, tracer opent
 			}
 
 			outMsg, err := process(ctxWithSpan, inMsg)
-			if err != nil {
+			if err != nil || outMsg == nil {
 				return nil, err
 			}
 
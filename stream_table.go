@@ -0,0 +1,383 @@
+package kafka_toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const defaultTableIdleTimeout = 10 * time.Second
+
+// TableNotReadyErrorKind la tabla aun no alcanza el high-water mark
+var TableNotReadyErrorKind = "Tabla no sincronizada"
+
+// ContextTableValuePrefix prefijo de key en context del valor obtenido en un join, se completa con el topico de la tabla
+const ContextTableValuePrefix = "TABLE_VALUE:"
+
+// TableConfig configuracion de tabla materializada desde un topico compactado
+type TableConfig struct {
+	// Topic topico compactado a materializar
+	Topic string
+	// Consumer brokers, version y seguridad del cluster, Topic y Group se ignoran
+	Consumer ConsumerGroupInput
+	// Store store local de la tabla, por defecto en memoria
+	Store KeyValueStore
+	// IdleTimeout tiempo sin recibir registros tras el cual una particion se considera sincronizada, por defecto 10 segundos
+	IdleTimeout time.Duration
+}
+
+// Table tabla materializada localmente desde un topico compactado. Consume todas las particiones desde el inicio,
+// los tombstones (valor nil) eliminan la key. Se considera lista al alcanzar el high-water mark capturado al iniciar.
+type Table struct {
+	config TableConfig
+	client sarama.Client
+
+	ready     chan struct{}
+	readyOnce sync.Once
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewTable constructor de Table
+func NewTable(config TableConfig) (*Table, error) {
+	if config.Topic == "" {
+		return nil, errors.New("Topico de tabla requerido")
+	}
+
+	if config.Store == nil {
+		config.Store = NewMemoryKeyValueStore()
+	}
+
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaultTableIdleTimeout
+	}
+
+	config.Consumer.Topic = config.Topic
+	// La tabla no utiliza consumer group, la estrategia solo se requiere para generar la configuracion
+	if config.Consumer.BalanceStrategy == "" {
+		config.Consumer.BalanceStrategy = Range
+	}
+
+	conf, err := NewSaramaConsumerConfigurer(NewBalanceStrategyResolver()).GenerateConfig(config.Consumer)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sarama.NewClient(conf.Brokers, conf.SaramaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Table{config: config, client: client, ready: make(chan struct{})}, nil
+}
+
+// Start inicia el consumo de la tabla en segundo plano hasta que el context se cancele o se llame a Close
+func (t *Table) Start(ctx context.Context) error {
+	partitions, err := t.client.Partitions(t.config.Topic)
+	if err != nil {
+		return err
+	}
+
+	ends := make(map[int32]int64, len(partitions))
+	for _, partition := range partitions {
+		oldest, err := t.client.GetOffset(t.config.Topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return err
+		}
+
+		if ends[partition], err = t.client.GetOffset(t.config.Topic, partition, sarama.OffsetNewest); err != nil {
+			return err
+		}
+
+		// Particion sin registros disponibles, se considera sincronizada desde el inicio
+		if oldest >= ends[partition] {
+			ends[partition] = 0
+		}
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(t.client)
+	if err != nil {
+		return err
+	}
+
+	ctx, t.cancel = context.WithCancel(ctx)
+
+	pending := &sync.WaitGroup{}
+	for _, partition := range partitions {
+		partitionConsumer, err := consumer.ConsumePartition(t.config.Topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			t.cancel()
+			t.wg.Wait()
+			consumer.Close()
+			return err
+		}
+
+		pending.Add(1)
+		t.wg.Add(1)
+		go t.consume(ctx, partition, ends[partition], partitionConsumer, pending)
+	}
+
+	go func() {
+		pending.Wait()
+		if ctx.Err() == nil {
+			t.markReady()
+		}
+	}()
+
+	go func() {
+		t.wg.Wait()
+		consumer.Close()
+	}()
+
+	Log.Info(
+		"message", "Iniciando tabla",
+		"topic", t.config.Topic,
+		"end_offsets", ends)
+
+	return nil
+}
+
+// Get obtiene el valor de la key
+func (t *Table) Get(key []byte) ([]byte, bool, error) {
+	return t.config.Store.Get(key)
+}
+
+// Topic topico de la tabla
+func (t *Table) Topic() string {
+	return t.config.Topic
+}
+
+// Ready canal que se cierra cuando la tabla alcanza el high-water mark capturado al iniciar
+func (t *Table) Ready() <-chan struct{} {
+	return t.ready
+}
+
+// WaitReady espera a que la tabla este lista, retorna ErrSessionClosed si termina la sesion del consumer
+func (t *Table) WaitReady(ctx context.Context) error {
+	select {
+	case <-t.ready:
+		return nil
+	case <-SessionDoneFromContext(ctx):
+		return ErrSessionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Health implementa HealthCheck, util como readiness check mientras la tabla sincroniza
+func (t *Table) Health() error {
+	select {
+	case <-t.ready:
+		return nil
+	default:
+		return fmt.Errorf("%s: %s", TableNotReadyErrorKind, t.config.Topic)
+	}
+}
+
+// Close detiene el consumo y cierra el cliente
+func (t *Table) Close() error {
+	if t.cancel != nil {
+		t.cancel()
+	}
+
+	t.wg.Wait()
+
+	if err := t.client.Close(); err != nil && err != sarama.ErrClosedClient {
+		return err
+	}
+
+	return nil
+}
+
+// GateStreamProcessorMiddleware bloquea el procesamiento hasta que la tabla este lista
+func (t *Table) GateStreamProcessorMiddleware() StreamProcessorMiddleware {
+	return func(next StreamProcessor) StreamProcessor {
+		return func(ctx context.Context, inMsg *ConsumerMessage) (*ProducerMessage, error) {
+			if err := t.WaitReady(ctx); err != nil {
+				return nil, err
+			}
+
+			return next(ctx, inMsg)
+		}
+	}
+}
+
+// GateMessageHandlerMiddleware bloquea el procesamiento hasta que la tabla este lista
+func (t *Table) GateMessageHandlerMiddleware() MessageHandlerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		return &tableGateMessageHandler{next: next, table: t}
+	}
+}
+
+func (t *Table) markReady() {
+	t.readyOnce.Do(func() {
+		Log.Info(
+			"message", "Tabla sincronizada",
+			"topic", t.config.Topic)
+		close(t.ready)
+	})
+}
+
+func (t *Table) consume(ctx context.Context, partition int32, end int64, partitionConsumer sarama.PartitionConsumer, pending *sync.WaitGroup) {
+	defer t.wg.Done()
+	defer partitionConsumer.AsyncClose()
+
+	caughtUp := false
+	catchUp := func() {
+		if !caughtUp {
+			caughtUp = true
+			pending.Done()
+		}
+	}
+	defer catchUp()
+
+	if end <= 0 {
+		catchUp()
+	}
+
+	idle := time.NewTicker(t.config.IdleTimeout)
+	defer idle.Stop()
+	lastMessage := time.Now()
+
+	for {
+		select {
+		case message, ok := <-partitionConsumer.Messages():
+			if !ok {
+				return
+			}
+
+			t.apply(message)
+			lastMessage = time.Now()
+
+			if message.Offset >= end-1 {
+				catchUp()
+			}
+		case <-idle.C:
+			// Los ultimos offsets pueden no existir (por ejemplo marcadores de transaccion)
+			if !caughtUp && time.Since(lastMessage) >= t.config.IdleTimeout {
+				Log.Warn(
+					"message", "Particion de tabla sincronizada por inactividad",
+					"topic", t.config.Topic,
+					"partition", partition,
+					"end", end)
+				catchUp()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (t *Table) apply(message *sarama.ConsumerMessage) {
+	var err error
+	if message.Value == nil {
+		err = t.config.Store.Delete(message.Key)
+	} else {
+		err = t.config.Store.Put(message.Key, message.Value)
+	}
+
+	if err != nil {
+		Log.Error(
+			"errorMessage", "Error actualizando tabla",
+			"topic", t.config.Topic,
+			"partition", message.Partition,
+			"offset", message.Offset,
+			"error", err)
+	}
+}
+
+type tableGateMessageHandler struct {
+	next  MessageHandler
+	table *Table
+}
+
+func (h *tableGateMessageHandler) HandleMessage(ctx context.Context, inMsg *ConsumerMessage) error {
+	if err := h.table.WaitReady(ctx); err != nil {
+		return err
+	}
+
+	return h.next.HandleMessage(ctx, inMsg)
+}
+
+// TableJoiner combina el mensaje de entrada con el valor de la tabla, found en false si la key no existe
+type TableJoiner func(ctx context.Context, inMsg *ConsumerMessage, value []byte, found bool) (*ConsumerMessage, error)
+
+// TableJoinConfig configuracion de join contra una tabla
+type TableJoinConfig struct {
+	// KeyFunc key de busqueda en la tabla, por defecto la key del mensaje
+	KeyFunc func(inMsg *ConsumerMessage) []byte
+	// Joiner enriquece el mensaje, por defecto lo deja sin cambios y el valor queda disponible con TableValueFromContext
+	Joiner TableJoiner
+	// Inner filtra los mensajes cuya key no existe en la tabla, por defecto left join
+	Inner bool
+}
+
+// JoinAsHeader joiner que agrega el valor de la tabla como header del mensaje
+func JoinAsHeader(header string) TableJoiner {
+	return func(ctx context.Context, inMsg *ConsumerMessage, value []byte, found bool) (*ConsumerMessage, error) {
+		if !found {
+			return inMsg, nil
+		}
+
+		joined := *inMsg
+		joined.Headers = make(map[string]string, len(inMsg.Headers)+1)
+		for k, v := range inMsg.Headers {
+			joined.Headers[k] = v
+		}
+		joined.Headers[header] = string(value)
+
+		return &joined, nil
+	}
+}
+
+// TableValueFromContext valor obtenido de la tabla en el join, nil si la key no existe
+func TableValueFromContext(ctx context.Context, topic string) []byte {
+	value, _ := ctx.Value(ContextTableValuePrefix + topic).([]byte)
+	return value
+}
+
+// MakeTableJoinStreamProcessorMiddleware enriquece cada mensaje con el valor de la tabla, espera a que la tabla este lista
+func MakeTableJoinStreamProcessorMiddleware(table *Table, config TableJoinConfig) StreamProcessorMiddleware {
+	if config.KeyFunc == nil {
+		config.KeyFunc = func(inMsg *ConsumerMessage) []byte { return inMsg.Key }
+	}
+
+	if config.Joiner == nil {
+		config.Joiner = func(ctx context.Context, inMsg *ConsumerMessage, value []byte, found bool) (*ConsumerMessage, error) {
+			return inMsg, nil
+		}
+	}
+
+	return func(next StreamProcessor) StreamProcessor {
+		return func(ctx context.Context, inMsg *ConsumerMessage) (*ProducerMessage, error) {
+			if err := table.WaitReady(ctx); err != nil {
+				return nil, err
+			}
+
+			key := config.KeyFunc(inMsg)
+			value, found, err := table.Get(key)
+			if err != nil {
+				return nil, err
+			}
+
+			if !found && config.Inner {
+				return nil, nil
+			}
+
+			joined, err := config.Joiner(ctx, inMsg, value, found)
+			if err != nil {
+				return nil, err
+			}
+
+			if found {
+				ctx = context.WithValue(ctx, ContextTableValuePrefix+table.Topic(), value)
+			}
+
+			return next(ctx, joined)
+		}
+	}
+}
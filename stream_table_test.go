@@ -0,0 +1,227 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+var tableBaseTime = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+func tableRecord(key string, value *string) kafkatest.MockRecord {
+	record := kafkatest.MockRecord{Key: []byte(key), Timestamp: tableBaseTime}
+	if value != nil {
+		record.Value = []byte(*value)
+	}
+
+	return record
+}
+
+// newCustomersCluster topico compactado de dos particiones, b se elimina con un tombstone
+func newCustomersCluster(t *testing.T) *kafkatest.MockCluster {
+	t.Helper()
+
+	cluster := kafkatest.NewMockCluster(t, kafkatest.MockClusterConfig{Topics: map[string]int32{"customers": 2}})
+	cluster.SetRecords("customers", 0,
+		tableRecord("a", changelogValue("gold")),
+		tableRecord("b", changelogValue("silver")),
+		tableRecord("a", changelogValue("platinum")),
+		tableRecord("b", nil))
+	cluster.SetRecords("customers", 1, tableRecord("c", changelogValue("gold")))
+
+	return cluster
+}
+
+func newTestTable(t *testing.T, cluster *kafkatest.MockCluster, idleTimeout time.Duration) *kafka.Table {
+	t.Helper()
+
+	table, err := kafka.NewTable(kafka.TableConfig{
+		Topic:       "customers",
+		Consumer:    cluster.ConsumerInput("customers", "table"),
+		IdleTimeout: idleTimeout,
+	})
+	if err != nil {
+		t.Fatalf("error creando tabla: %v", err)
+	}
+	t.Cleanup(func() { table.Close() })
+
+	return table
+}
+
+func startTable(t *testing.T, table *kafka.Table) {
+	t.Helper()
+
+	if err := table.Start(context.Background()); err != nil {
+		t.Fatalf("error iniciando tabla: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kafkatest.DefaultTimeout)
+	defer cancel()
+
+	if err := table.WaitReady(ctx); err != nil {
+		t.Fatalf("la tabla no se sincronizo: %v", err)
+	}
+}
+
+func assertTableValue(t *testing.T, table *kafka.Table, key string, expected *string) {
+	t.Helper()
+
+	value, found, err := table.Get([]byte(key))
+	if err != nil {
+		t.Fatalf("error leyendo %s: %v", key, err)
+	}
+
+	switch {
+	case expected == nil && found:
+		t.Errorf("%s: se esperaba eliminada, se obtuvo %q", key, value)
+	case expected != nil && string(value) != *expected:
+		t.Errorf("%s: se esperaba %q, se obtuvo %q (%v)", key, *expected, value, found)
+	}
+}
+
+func TestTableReadinessGate(t *testing.T) {
+	cluster := newCustomersCluster(t)
+	table := newTestTable(t, cluster, kafkatest.DefaultTimeout)
+
+	if err := table.Health(); err == nil || !strings.HasPrefix(err.Error(), kafka.TableNotReadyErrorKind) {
+		t.Errorf("health antes de sincronizar: se esperaba %q, se obtuvo %v", kafka.TableNotReadyErrorKind, err)
+	}
+
+	processed := make(chan string, 1)
+	gated := table.GateStreamProcessorMiddleware()(func(ctx context.Context, inMsg *kafka.ConsumerMessage) (*kafka.ProducerMessage, error) {
+		value, _, err := table.Get(inMsg.Key)
+		processed <- string(value)
+		return nil, err
+	})
+
+	go gated(context.Background(), &kafka.ConsumerMessage{Key: []byte("a")})
+
+	select {
+	case value := <-processed:
+		t.Fatalf("se proceso el mensaje antes de sincronizar la tabla: %q", value)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	startTable(t, table)
+
+	// el mensaje bloqueado se procesa con la tabla completa
+	select {
+	case value := <-processed:
+		if value != "platinum" {
+			t.Errorf("valor leido al liberar el gate: se esperaba platinum, se obtuvo %q", value)
+		}
+	case <-time.After(kafkatest.DefaultTimeout):
+		t.Fatal("el gate no libero el mensaje al sincronizar la tabla")
+	}
+
+	if err := table.Health(); err != nil {
+		t.Errorf("health sincronizada: %v", err)
+	}
+
+	assertTableValue(t, table, "a", changelogValue("platinum"))
+	assertTableValue(t, table, "b", nil)
+	assertTableValue(t, table, "c", changelogValue("gold"))
+}
+
+func TestTableGateEndsWithSession(t *testing.T) {
+	table := newTestTable(t, newCustomersCluster(t), kafkatest.DefaultTimeout)
+
+	done := make(chan struct{})
+	close(done)
+	ctx := kafka.ContextWithSessionDone(context.Background(), done)
+
+	handler := table.GateMessageHandlerMiddleware()(kafkatest.HandlerFunc(func(ctx context.Context, inMsg *kafka.ConsumerMessage) error {
+		t.Error("se proceso el mensaje sin sincronizar la tabla")
+		return nil
+	}))
+
+	if err := handler.HandleMessage(ctx, &kafka.ConsumerMessage{}); !errors.Is(err, kafka.ErrSessionClosed) {
+		t.Errorf("se esperaba ErrSessionClosed, se obtuvo %v", err)
+	}
+}
+
+func TestTableReadyAfterIdleTimeout(t *testing.T) {
+	cluster := newCustomersCluster(t)
+	// offsets finales que no se entregan, la particion se sincroniza por inactividad
+	cluster.SetHighWaterMark("customers", 0, 5)
+
+	table := newTestTable(t, cluster, 200*time.Millisecond)
+	startTable(t, table)
+
+	assertTableValue(t, table, "a", changelogValue("platinum"))
+}
+
+func TestTableJoin(t *testing.T) {
+	table := newTestTable(t, newCustomersCluster(t), kafkatest.DefaultTimeout)
+	startTable(t, table)
+
+	process := func(ctx context.Context, inMsg *kafka.ConsumerMessage) (*kafka.ProducerMessage, error) {
+		return &kafka.ProducerMessage{
+			Key:     inMsg.Key,
+			Msg:     kafka.TableValueFromContext(ctx, "customers"),
+			Headers: inMsg.Headers,
+		}, nil
+	}
+
+	tests := []struct {
+		name     string
+		config   kafka.TableJoinConfig
+		key      string
+		filtered bool
+		header   string
+	}{
+		{name: "left join encontrada", config: kafka.TableJoinConfig{Joiner: kafka.JoinAsHeader("tier")}, key: "a", header: "platinum"},
+		{name: "left join sin key", config: kafka.TableJoinConfig{Joiner: kafka.JoinAsHeader("tier")}, key: "b"},
+		{name: "inner join sin key", config: kafka.TableJoinConfig{Inner: true}, key: "b", filtered: true},
+		{
+			name: "key desde header",
+			config: kafka.TableJoinConfig{
+				KeyFunc: func(inMsg *kafka.ConsumerMessage) []byte { return []byte(inMsg.Headers["customer"]) },
+				Joiner:  kafka.JoinAsHeader("tier"),
+				Inner:   true,
+			},
+			key:    "c",
+			header: "gold",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			joined := kafka.MakeTableJoinStreamProcessorMiddleware(table, test.config)(process)
+
+			inMsg := &kafka.ConsumerMessage{Key: []byte(test.key), Headers: map[string]string{"customer": test.key}}
+			if test.config.KeyFunc != nil {
+				inMsg.Key = []byte("order-1")
+			}
+
+			outMsg, err := joined(context.Background(), inMsg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.filtered {
+				if outMsg != nil {
+					t.Errorf("se esperaba filtrar el mensaje, se obtuvo %+v", outMsg)
+				}
+				return
+			}
+
+			if outMsg == nil {
+				t.Fatal("no se esperaba filtrar el mensaje")
+			}
+
+			if outMsg.Headers["tier"] != test.header || string(outMsg.Msg) != test.header {
+				t.Errorf("join: se esperaba %q en header y context, se obtuvo %q y %q", test.header, outMsg.Headers["tier"], outMsg.Msg)
+			}
+
+			if _, ok := inMsg.Headers["tier"]; ok {
+				t.Errorf("el join modifico los headers del mensaje de entrada")
+			}
+		})
+	}
+}
@@ -0,0 +1,416 @@
+package kafka_toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// InvalidTopologyKind topologia sin destino o mal definida
+var InvalidTopologyKind = "Topologia invalida"
+
+// TopologyFormat formato de salida de Describe
+type TopologyFormat string
+
+const (
+	// TopologyText descripcion en texto, un nodo por linea con sus sucesores
+	TopologyText TopologyFormat = "text"
+	// TopologyDOT descripcion como grafo DOT (graphviz)
+	TopologyDOT TopologyFormat = "dot"
+)
+
+const (
+	topologySource  = "source"
+	topologyFilter  = "filter"
+	topologyMap     = "map"
+	topologyFlatMap = "flatmap"
+	topologyProcess = "process"
+	topologyBranch  = "branch"
+	topologyRoute   = "route"
+	topologySink    = "sink"
+)
+
+// RecordMapper transforma un registro de la stream, retornar nil descarta el registro
+type RecordMapper func(ctx context.Context, record *ConsumerMessage) (*ConsumerMessage, error)
+
+// RecordFlatMapper transforma un registro de la stream en cero, uno o varios registros
+type RecordFlatMapper func(ctx context.Context, record *ConsumerMessage) ([]*ConsumerMessage, error)
+
+// TopologyBranch rama de una topologia, los registros que cumplen Predicate continuan en la sub-stream
+// definida por Stream. Predicate nil acepta todos los registros.
+type TopologyBranch struct {
+	Name      string
+	Predicate StreamPredicate
+	Stream    func(stream *TopologyStream)
+}
+
+// BranchTo rama que envia directamente los registros que cumplen el predicado al topico
+func BranchTo(name string, predicate StreamPredicate, topic string) TopologyBranch {
+	return TopologyBranch{
+		Name:      name,
+		Predicate: predicate,
+		Stream:    func(stream *TopologyStream) { stream.To(topic) },
+	}
+}
+
+type topologyNode struct {
+	id        string
+	kind      string
+	topic     string
+	next      *topologyNode
+	routes    []*topologyNode
+	predicate StreamPredicate
+	mapper    RecordMapper
+	flatMap   RecordFlatMapper
+	processor StreamProcessor
+}
+
+// Topology topologia declarativa de una stream: un topico de origen, transformaciones y topicos de destino.
+// Se compila a un FanOutStreamProcessor y se ejecuta con los consumers y producers del toolkit.
+type Topology struct {
+	source *topologyNode
+	nodes  []*topologyNode
+	err    error
+}
+
+// TopologyStream stream dentro de una topologia, cada operacion agrega un nodo a continuacion del anterior
+type TopologyStream struct {
+	topology *Topology
+	tail     *topologyNode
+}
+
+// From inicia una topologia que consume desde el topico
+func From(topic string) *TopologyStream {
+	topology := &Topology{}
+	topology.source = topology.newNode(topologySource)
+	topology.source.topic = topic
+
+	if topic == "" {
+		topology.fail(errors.New("topico de origen requerido"))
+	}
+
+	return &TopologyStream{topology: topology, tail: topology.source}
+}
+
+// Filter mantiene los registros que cumplen el predicado
+func (s *TopologyStream) Filter(predicate StreamPredicate) *TopologyStream {
+	node := s.append(topologyFilter)
+	node.predicate = predicate
+
+	return s
+}
+
+// Map transforma cada registro, un resultado nil descarta el registro
+func (s *TopologyStream) Map(mapper RecordMapper) *TopologyStream {
+	node := s.append(topologyMap)
+	node.mapper = mapper
+
+	return s
+}
+
+// FlatMap transforma cada registro en cero, uno o varios registros
+func (s *TopologyStream) FlatMap(mapper RecordFlatMapper) *TopologyStream {
+	node := s.append(topologyFlatMap)
+	node.flatMap = mapper
+
+	return s
+}
+
+// Process aplica un StreamProcessor existente (por ejemplo creado con MakeStreamProcessor), el mensaje de salida
+// continua en la stream con el timestamp y la posicion del registro de entrada
+func (s *TopologyStream) Process(processor StreamProcessor) *TopologyStream {
+	node := s.append(topologyProcess)
+	node.processor = processor
+
+	return s
+}
+
+// Branch envia cada registro a la primera rama cuyo predicado se cumple, los registros que no corresponden
+// a ninguna rama continuan en la stream
+func (s *TopologyStream) Branch(branches ...TopologyBranch) *TopologyStream {
+	node := s.append(topologyBranch)
+
+	for _, branch := range branches {
+		route := s.topology.newNode(topologyRoute)
+		route.predicate = branch.Predicate
+		if branch.Name != "" {
+			route.id = branch.Name
+		}
+		node.routes = append(node.routes, route)
+
+		if branch.Stream == nil {
+			s.topology.fail(fmt.Errorf("rama %s sin stream", route.id))
+			continue
+		}
+
+		branch.Stream(&TopologyStream{topology: s.topology, tail: route})
+	}
+
+	return s
+}
+
+// Named asigna un nombre al ultimo nodo de la stream, utilizado en Describe
+func (s *TopologyStream) Named(name string) *TopologyStream {
+	if name != "" {
+		s.tail.id = name
+	}
+
+	return s
+}
+
+// To envia los registros al topico y termina la stream
+func (s *TopologyStream) To(topic string) *Topology {
+	node := s.append(topologySink)
+	node.topic = topic
+
+	if topic == "" {
+		s.topology.fail(fmt.Errorf("topico de destino requerido en %s", node.id))
+	}
+
+	return s.topology
+}
+
+// Topology topologia a la que pertenece la stream
+func (s *TopologyStream) Topology() *Topology {
+	return s.topology
+}
+
+// Source topico de origen de la topologia
+func (t *Topology) Source() string {
+	return t.source.topic
+}
+
+// Sinks topicos de destino de la topologia
+func (t *Topology) Sinks() []string {
+	var topics []string
+	seen := make(map[string]bool)
+
+	for _, node := range t.nodes {
+		if node.kind == topologySink && !seen[node.topic] {
+			seen[node.topic] = true
+			topics = append(topics, node.topic)
+		}
+	}
+
+	return topics
+}
+
+// Validate verifica que la topologia este completa, toda stream debe terminar en un topico
+func (t *Topology) Validate() error {
+	if t.err != nil {
+		return fmt.Errorf("%s: %v", InvalidTopologyKind, t.err)
+	}
+
+	for _, node := range t.nodes {
+		switch node.kind {
+		case topologySink, topologyBranch:
+		default:
+			if node.next == nil {
+				return fmt.Errorf("%s: stream sin destino en %s", InvalidTopologyKind, node.id)
+			}
+		}
+	}
+
+	if len(t.Sinks()) == 0 {
+		return fmt.Errorf("%s: topologia sin destino", InvalidTopologyKind)
+	}
+
+	return nil
+}
+
+// Processor compila la topologia a un FanOutStreamProcessor
+func (t *Topology) Processor() (FanOutStreamProcessor, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, inMsg *ConsumerMessage) ([]*ProducerMessage, error) {
+		var outMsgs []*ProducerMessage
+		if err := t.run(ctx, t.source, inMsg, &outMsgs); err != nil {
+			return nil, err
+		}
+
+		return outMsgs, nil
+	}, nil
+}
+
+// Build crea el consumer de la topologia, el topico de consumo es el origen de la topologia y
+// el producer envia a los topicos de destino de cada stream
+func (t *Topology) Build(consumerCfg ConsumerGroupInput, producerCfg BaseProducerConfigInput, asyncProduce bool) (SaramaConsumerBuilder, error) {
+	processor, err := t.Processor()
+	if err != nil {
+		return nil, err
+	}
+
+	consumerCfg.Topic = t.Source()
+	if producerCfg.Topic == "" {
+		producerCfg.Topic = t.Sinks()[0]
+	}
+
+	return MakeFanOutStreamerBuilder(consumerCfg, processor, producerCfg, asyncProduce)
+}
+
+// Describe describe los nodos de la topologia y sus conexiones
+func (t *Topology) Describe(format TopologyFormat) string {
+	if format == TopologyDOT {
+		return t.describeDOT()
+	}
+
+	return t.describeText()
+}
+
+func (t *Topology) describeText() string {
+	builder := &strings.Builder{}
+	builder.WriteString("Topologia:\n")
+
+	for _, node := range t.nodes {
+		fmt.Fprintf(builder, "  %s [%s]", node.id, node.kind)
+		if node.topic != "" {
+			fmt.Fprintf(builder, " (topico: %s)", node.topic)
+		}
+		builder.WriteString("\n")
+
+		for _, route := range node.routes {
+			fmt.Fprintf(builder, "    --> %s\n", route.id)
+		}
+
+		if node.next != nil {
+			fmt.Fprintf(builder, "    --> %s\n", node.next.id)
+		}
+	}
+
+	return builder.String()
+}
+
+func (t *Topology) describeDOT() string {
+	builder := &strings.Builder{}
+	builder.WriteString("digraph topology {\n  rankdir=LR;\n")
+
+	for _, node := range t.nodes {
+		switch node.kind {
+		case topologySource, topologySink:
+			fmt.Fprintf(builder, "  %q [shape=box, label=%q];\n", node.id, node.id+"\n"+node.topic)
+		case topologyBranch:
+			fmt.Fprintf(builder, "  %q [shape=diamond];\n", node.id)
+		default:
+			fmt.Fprintf(builder, "  %q [shape=ellipse];\n", node.id)
+		}
+	}
+
+	for _, node := range t.nodes {
+		for _, route := range node.routes {
+			fmt.Fprintf(builder, "  %q -> %q;\n", node.id, route.id)
+		}
+
+		if node.next != nil {
+			fmt.Fprintf(builder, "  %q -> %q;\n", node.id, node.next.id)
+		}
+	}
+
+	builder.WriteString("}\n")
+
+	return builder.String()
+}
+
+func (t *Topology) newNode(kind string) *topologyNode {
+	node := &topologyNode{kind: kind, id: fmt.Sprintf("%s-%d", kind, len(t.nodes))}
+	t.nodes = append(t.nodes, node)
+
+	return node
+}
+
+func (t *Topology) fail(err error) {
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+func (s *TopologyStream) append(kind string) *topologyNode {
+	node := s.topology.newNode(kind)
+
+	if s.tail.kind == topologySink {
+		s.topology.fail(fmt.Errorf("%s agregado despues del destino %s", node.id, s.tail.id))
+	} else if s.tail.next != nil {
+		s.topology.fail(fmt.Errorf("%s ya tiene sucesor", s.tail.id))
+	}
+
+	s.tail.next = node
+	s.tail = node
+
+	return node
+}
+
+// run procesa el registro desde el nodo, los registros que llegan a un destino se agregan a outMsgs
+func (t *Topology) run(ctx context.Context, node *topologyNode, record *ConsumerMessage, outMsgs *[]*ProducerMessage) error {
+	switch node.kind {
+	case topologySource, topologyRoute:
+		return t.run(ctx, node.next, record, outMsgs)
+	case topologyFilter:
+		if !node.predicate(ctx, record) {
+			return nil
+		}
+
+		return t.run(ctx, node.next, record, outMsgs)
+	case topologyMap:
+		mapped, err := node.mapper(ctx, record)
+		if err != nil || mapped == nil {
+			return err
+		}
+
+		return t.run(ctx, node.next, mapped, outMsgs)
+	case topologyFlatMap:
+		records, err := node.flatMap(ctx, record)
+		if err != nil {
+			return err
+		}
+
+		for _, mapped := range records {
+			if mapped == nil {
+				continue
+			}
+
+			if err := t.run(ctx, node.next, mapped, outMsgs); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case topologyProcess:
+		outMsg, err := node.processor(ctx, record)
+		if err != nil || outMsg == nil {
+			return err
+		}
+
+		return t.run(ctx, node.next, &ConsumerMessage{
+			Headers:   outMsg.Headers,
+			Timestamp: record.Timestamp,
+			Key:       outMsg.Key,
+			Msg:       outMsg.Msg,
+			Topic:     record.Topic,
+			Partition: record.Partition,
+			Offset:    record.Offset,
+		}, outMsgs)
+	case topologyBranch:
+		for _, route := range node.routes {
+			if route.predicate == nil || route.predicate(ctx, record) {
+				return t.run(ctx, route, record, outMsgs)
+			}
+		}
+
+		if node.next == nil {
+			return nil
+		}
+
+		return t.run(ctx, node.next, record, outMsgs)
+	case topologySink:
+		*outMsgs = append(*outMsgs, &ProducerMessage{
+			Headers: record.Headers,
+			Key:     record.Key,
+			Msg:     record.Msg,
+			Topic:   node.topic,
+		})
+	}
+
+	return nil
+}
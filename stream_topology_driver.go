@@ -0,0 +1,118 @@
+package kafka_toolkit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	kitlog "github.com/go-kit/log"
+)
+
+// TopologyTestDriver ejecuta una topologia sobre mensajes en memoria, sin broker. Los mensajes pasan por el
+// mismo handler que utiliza el consumer de la topologia y los mensajes producidos quedan registrados por topico.
+type TopologyTestDriver struct {
+	source   string
+	handler  MessageHandler
+	producer *recordingTopologyProducer
+	offset   int64
+}
+
+// NewTopologyTestDriver constructor de TopologyTestDriver, los middlewares se aplican al handler de la topologia.
+// Los logs del driver se descartan, no utiliza ni modifica el logger global.
+func NewTopologyTestDriver(topology *Topology, middlewares ...MessageHandlerMiddleware) (*TopologyTestDriver, error) {
+	return NewTopologyTestDriverWithLogger(topology, kitlog.NewNopLogger(), middlewares...)
+}
+
+// NewTopologyTestDriverWithLogger constructor de TopologyTestDriver que registra los logs del driver en logger,
+// sin modificar el logger global, por lo que es seguro en tests en paralelo
+func NewTopologyTestDriverWithLogger(topology *Topology, logger kitlog.Logger, middlewares ...MessageHandlerMiddleware) (*TopologyTestDriver, error) {
+	processor, err := topology.Processor()
+	if err != nil {
+		return nil, err
+	}
+
+	producer := &recordingTopologyProducer{outputs: make(map[string][]*ProducerMessage)}
+
+	var handler MessageHandler = &fanOutStreamHandler{
+		producer: producer,
+		process:  processor,
+		log:      newBaseLogger(logger),
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return &TopologyTestDriver{
+		source:   topology.Source(),
+		handler:  handler,
+		producer: producer,
+	}, nil
+}
+
+// Pipe procesa un mensaje del topico de origen. Topic, Offset y Timestamp se completan si no se indican.
+func (d *TopologyTestDriver) Pipe(ctx context.Context, inMsg *ConsumerMessage) error {
+	if inMsg.Topic == "" {
+		inMsg.Topic = d.source
+	}
+
+	if inMsg.Offset == 0 {
+		inMsg.Offset = d.offset
+	}
+	d.offset = inMsg.Offset + 1
+
+	if inMsg.Timestamp.IsZero() {
+		inMsg.Timestamp = time.Now()
+	}
+
+	return d.handler.HandleMessage(ctx, inMsg)
+}
+
+// PipeInput procesa un mensaje con la key, valor y headers indicados
+func (d *TopologyTestDriver) PipeInput(key []byte, value []byte, headers map[string]string) error {
+	return d.Pipe(context.Background(), &ConsumerMessage{Key: key, Msg: value, Headers: headers})
+}
+
+// Output mensajes producidos en el topico que aun no se han leido
+func (d *TopologyTestDriver) Output(topic string) []*ProducerMessage {
+	d.producer.mu.Lock()
+	defer d.producer.mu.Unlock()
+
+	return append([]*ProducerMessage(nil), d.producer.outputs[topic]...)
+}
+
+// ReadOutput lee el siguiente mensaje producido en el topico, nil si no hay mensajes
+func (d *TopologyTestDriver) ReadOutput(topic string) *ProducerMessage {
+	d.producer.mu.Lock()
+	defer d.producer.mu.Unlock()
+
+	outputs := d.producer.outputs[topic]
+	if len(outputs) == 0 {
+		return nil
+	}
+
+	d.producer.outputs[topic] = outputs[1:]
+
+	return outputs[0]
+}
+
+// Reset descarta los mensajes producidos
+func (d *TopologyTestDriver) Reset() {
+	d.producer.mu.Lock()
+	defer d.producer.mu.Unlock()
+
+	d.producer.outputs = make(map[string][]*ProducerMessage)
+}
+
+type recordingTopologyProducer struct {
+	mu      sync.Mutex
+	outputs map[string][]*ProducerMessage
+}
+
+func (p *recordingTopologyProducer) SendMessage(ctx context.Context, msg *ProducerMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.outputs[msg.Topic] = append(p.outputs[msg.Topic], msg)
+
+	return nil
+}
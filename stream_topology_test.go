@@ -0,0 +1,296 @@
+package kafka_toolkit_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	kitlog "github.com/go-kit/log"
+	kafka "github.com/validatecl/kafka-toolkit"
+)
+
+func isHeartbeat(ctx context.Context, inMsg *kafka.ConsumerMessage) bool {
+	return string(inMsg.Msg) == "heartbeat"
+}
+
+func isNotHeartbeat(ctx context.Context, inMsg *kafka.ConsumerMessage) bool {
+	return !isHeartbeat(ctx, inMsg)
+}
+
+func hasHeader(name string) kafka.StreamPredicate {
+	return func(ctx context.Context, inMsg *kafka.ConsumerMessage) bool {
+		_, ok := inMsg.Headers[name]
+		return ok
+	}
+}
+
+// paymentsTopology descarta heartbeats, separa los pagos de una lista por coma, los enriquece y los enruta
+func paymentsTopology() *kafka.Topology {
+	return kafka.From("payments").
+		Filter(isNotHeartbeat).Named("sin-heartbeat").
+		FlatMap(func(ctx context.Context, record *kafka.ConsumerMessage) ([]*kafka.ConsumerMessage, error) {
+			var records []*kafka.ConsumerMessage
+			for _, value := range strings.Split(string(record.Msg), ",") {
+				split := *record
+				split.Msg = []byte(value)
+				records = append(records, &split)
+			}
+			return records, nil
+		}).
+		Map(func(ctx context.Context, record *kafka.ConsumerMessage) (*kafka.ConsumerMessage, error) {
+			if string(record.Msg) == "" {
+				return nil, nil
+			}
+			if string(record.Msg) == "invalido" {
+				return nil, errors.New("pago invalido")
+			}
+			return record, nil
+		}).
+		Process(func(ctx context.Context, inMsg *kafka.ConsumerMessage) (*kafka.ProducerMessage, error) {
+			headers := map[string]string{"source": inMsg.Topic}
+			if strings.HasPrefix(string(inMsg.Msg), "fraude") {
+				headers["fraud"] = "true"
+			}
+			if strings.HasPrefix(string(inMsg.Msg), "grande") {
+				headers["big"] = "true"
+			}
+			return &kafka.ProducerMessage{Key: inMsg.Key, Msg: inMsg.Msg, Headers: headers}, nil
+		}).Named("enrich").
+		Branch(
+			kafka.BranchTo("fraude", hasHeader("fraud"), "payments-fraud"),
+			kafka.TopologyBranch{
+				Name:      "grandes",
+				Predicate: hasHeader("big"),
+				Stream: func(stream *kafka.TopologyStream) {
+					stream.Map(func(ctx context.Context, record *kafka.ConsumerMessage) (*kafka.ConsumerMessage, error) {
+						reviewed := *record
+						reviewed.Msg = append([]byte("revisar:"), record.Msg...)
+						return &reviewed, nil
+					}).To("payments-review")
+				},
+			}).
+		To("payments-ok")
+}
+
+func outputValues(outMsgs []*kafka.ProducerMessage) []string {
+	values := []string{}
+	for _, outMsg := range outMsgs {
+		values = append(values, string(outMsg.Msg))
+	}
+
+	return values
+}
+
+func TestTopologyTestDriverRoutesRecords(t *testing.T) {
+	t.Parallel()
+
+	driver, err := kafka.NewTopologyTestDriver(paymentsTopology())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []string{"heartbeat", "a,fraude-1,,grande-1", "b"} {
+		if err := driver.PipeInput([]byte("k"), []byte(value), nil); err != nil {
+			t.Fatalf("error procesando %s: %v", value, err)
+		}
+	}
+
+	expected := map[string][]string{
+		"payments-ok":     {"a", "b"},
+		"payments-fraud":  {"fraude-1"},
+		"payments-review": {"revisar:grande-1"},
+	}
+
+	for topic, values := range expected {
+		if got := outputValues(driver.Output(topic)); strings.Join(got, "|") != strings.Join(values, "|") {
+			t.Errorf("%s: se esperaba %v, se obtuvo %v", topic, values, got)
+		}
+	}
+
+	outMsg := driver.ReadOutput("payments-ok")
+	if outMsg == nil || outMsg.Headers["source"] != "payments" {
+		t.Fatalf("se esperaba el mensaje con el topico de origen en el header, se obtuvo %+v", outMsg)
+	}
+
+	if got := outputValues(driver.Output("payments-ok")); len(got) != 1 || got[0] != "b" {
+		t.Errorf("ReadOutput no consumio el mensaje leido: %v", got)
+	}
+
+	driver.Reset()
+	if outMsg := driver.ReadOutput("payments-fraud"); outMsg != nil {
+		t.Errorf("Reset no descarto los mensajes producidos: %+v", outMsg)
+	}
+
+	if err := driver.PipeInput([]byte("k"), []byte("c,invalido"), nil); err == nil || err.Error() != "pago invalido" {
+		t.Errorf("se esperaba el error del map, se obtuvo %v", err)
+	}
+}
+
+func TestTopologyTestDriverPipeDefaults(t *testing.T) {
+	t.Parallel()
+
+	var received []*kafka.ConsumerMessage
+	topology := kafka.From("payments").
+		Process(func(ctx context.Context, inMsg *kafka.ConsumerMessage) (*kafka.ProducerMessage, error) {
+			received = append(received, inMsg)
+			return &kafka.ProducerMessage{Msg: inMsg.Msg}, nil
+		}).
+		To("payments-ok")
+
+	driver, err := kafka.NewTopologyTestDriver(topology)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	driver.PipeInput(nil, []byte("a"), nil)
+	driver.Pipe(context.Background(), &kafka.ConsumerMessage{Topic: "otro", Offset: 10, Msg: []byte("b")})
+	driver.PipeInput(nil, []byte("c"), nil)
+
+	if len(received) != 3 {
+		t.Fatalf("se esperaban 3 mensajes procesados, se obtuvo %d", len(received))
+	}
+
+	for i, expected := range []struct {
+		topic  string
+		offset int64
+	}{{"payments", 0}, {"otro", 10}, {"payments", 11}} {
+		if received[i].Topic != expected.topic || received[i].Offset != expected.offset || received[i].Timestamp.IsZero() {
+			t.Errorf("mensaje %d: se esperaba %s offset %d con timestamp, se obtuvo %s offset %d (%v)", i,
+				expected.topic, expected.offset, received[i].Topic, received[i].Offset, received[i].Timestamp)
+		}
+	}
+}
+
+func TestTopologyTestDriverLogger(t *testing.T) {
+	t.Parallel()
+
+	logger := kafka.Log
+
+	var (
+		mu  sync.Mutex
+		buf bytes.Buffer
+	)
+	writer := kitlog.NewSyncWriter(&lockedWriter{mu: &mu, buf: &buf})
+
+	driver, err := kafka.NewTopologyTestDriverWithLogger(paymentsTopology(), kitlog.NewLogfmtLogger(writer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := driver.PipeInput([]byte("k"), []byte("heartbeat"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	logged := buf.String()
+	mu.Unlock()
+
+	if !strings.Contains(logged, "Mensaje filtrado") {
+		t.Errorf("se esperaba el log del mensaje filtrado en el logger inyectado, se obtuvo %q", logged)
+	}
+
+	if kafka.Log != logger {
+		t.Errorf("el driver modifico el logger global")
+	}
+}
+
+type lockedWriter struct {
+	mu  *sync.Mutex
+	buf *bytes.Buffer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.buf.Write(p)
+}
+
+func TestTopologyValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		topology *kafka.Topology
+		expected string
+	}{
+		{name: "sin origen", topology: kafka.From("").To("out"), expected: "topico de origen requerido"},
+		{name: "sin destino", topology: kafka.From("in").Filter(isNotHeartbeat).Topology(), expected: "stream sin destino en filter-1"},
+		{name: "destino vacio", topology: kafka.From("in").To(""), expected: "topico de destino requerido en sink-1"},
+		{name: "operacion despues del destino", topology: func() *kafka.Topology {
+			stream := kafka.From("in")
+			stream.To("out")
+			return stream.Filter(isNotHeartbeat).Topology()
+		}(), expected: "filter-2 agregado despues del destino sink-1"},
+		{name: "rama sin stream", topology: kafka.From("in").Branch(kafka.TopologyBranch{Name: "vacia"}).To("out"), expected: "rama vacia sin stream"},
+		{name: "rama sin destino", topology: kafka.From("in").Branch(kafka.TopologyBranch{
+			Name:   "incompleta",
+			Stream: func(stream *kafka.TopologyStream) { stream.Filter(isHeartbeat) },
+		}).To("out"), expected: "stream sin destino en filter-3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected := kafka.InvalidTopologyKind + ": " + test.expected
+			if err := test.topology.Validate(); err == nil || err.Error() != expected {
+				t.Errorf("se esperaba %q, se obtuvo %v", expected, err)
+			}
+
+			if _, err := kafka.NewTopologyTestDriver(test.topology); err == nil {
+				t.Errorf("se esperaba error creando el driver de una topologia invalida")
+			}
+		})
+	}
+}
+
+func TestTopologyDescribe(t *testing.T) {
+	t.Parallel()
+
+	topology := kafka.From("payments").
+		Filter(isNotHeartbeat).Named("sin-heartbeat").
+		Branch(kafka.BranchTo("fraude", isHeartbeat, "payments-fraud")).
+		To("payments-ok")
+
+	if sinks := topology.Sinks(); strings.Join(sinks, ",") != "payments-fraud,payments-ok" {
+		t.Errorf("destinos: %v", sinks)
+	}
+
+	text := `Topologia:
+  source-0 [source] (topico: payments)
+    --> sin-heartbeat
+  sin-heartbeat [filter]
+    --> branch-2
+  branch-2 [branch]
+    --> fraude
+    --> sink-5
+  fraude [route]
+    --> sink-4
+  sink-4 [sink] (topico: payments-fraud)
+  sink-5 [sink] (topico: payments-ok)
+`
+	if got := topology.Describe(kafka.TopologyText); got != text {
+		t.Errorf("descripcion en texto:\n%s\nse esperaba:\n%s", got, text)
+	}
+
+	dot := `digraph topology {
+  rankdir=LR;
+  "source-0" [shape=box, label="source-0\npayments"];
+  "sin-heartbeat" [shape=ellipse];
+  "branch-2" [shape=diamond];
+  "fraude" [shape=ellipse];
+  "sink-4" [shape=box, label="sink-4\npayments-fraud"];
+  "sink-5" [shape=box, label="sink-5\npayments-ok"];
+  "source-0" -> "sin-heartbeat";
+  "sin-heartbeat" -> "branch-2";
+  "branch-2" -> "fraude";
+  "branch-2" -> "sink-5";
+  "fraude" -> "sink-4";
+}
+`
+	if got := topology.Describe(kafka.TopologyDOT); got != dot {
+		t.Errorf("descripcion DOT:\n%s\nse esperaba:\n%s", got, dot)
+	}
+}
@@ -0,0 +1,509 @@
+package kafka_toolkit
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+// Tipos de ventana
+const (
+	// WindowTumbling ventanas fijas de tamaño Size sin superposicion
+	WindowTumbling = "tumbling"
+	// WindowHopping ventanas de tamaño Size que avanzan cada Advance, un registro pertenece a varias ventanas
+	WindowHopping = "hopping"
+	// WindowSession ventanas por actividad de la key, se cierran tras Gap sin registros
+	WindowSession = "session"
+)
+
+// Modos de emision de resultados
+const (
+	// EmitOnClose emite el resultado final al cerrar la ventana (fin de ventana mas Grace)
+	EmitOnClose = "close"
+	// EmitOnUpdate emite el resultado parcial en cada actualizacion
+	EmitOnUpdate = "update"
+)
+
+const (
+	// WindowStartHeader header con inicio de ventana en unix ms
+	WindowStartHeader = "window-start"
+	// WindowEndHeader header con fin de ventana en unix ms
+	WindowEndHeader = "window-end"
+
+	windowKeyPrefixSize = 16
+)
+
+// InvalidWindowConfigKind configuracion de ventana invalida
+var InvalidWindowConfigKind = "Configuracion de ventana invalida"
+
+// TimestampExtractor obtiene el tiempo de evento de un mensaje
+type TimestampExtractor func(inMsg *ConsumerMessage) time.Time
+
+// WindowAggregator agrega el valor del mensaje al agregado actual de la ventana, aggregate es nil al iniciar la ventana
+type WindowAggregator func(key []byte, value []byte, aggregate []byte) ([]byte, error)
+
+// WindowMerger combina los agregados de dos sesiones que se unen, requerido para ventanas de sesion
+type WindowMerger func(key []byte, a []byte, b []byte) ([]byte, error)
+
+// WindowResult resultado de una ventana
+type WindowResult struct {
+	Key       []byte
+	Value     []byte
+	Start     time.Time
+	End       time.Time
+	Topic     string
+	Partition int32
+	// Final en true si la ventana se cerro y no recibira mas registros
+	Final bool
+}
+
+// WindowEmitter recibe los resultados de las ventanas
+type WindowEmitter func(ctx context.Context, result *WindowResult) error
+
+// WindowConfig configuracion de agregacion por ventanas
+type WindowConfig struct {
+	// Type tipo de ventana: WindowTumbling, WindowHopping o WindowSession
+	Type string
+	// Size tamaño de ventana tumbling y hopping
+	Size time.Duration
+	// Advance avance de ventana hopping
+	Advance time.Duration
+	// Gap inactividad que cierra una ventana de sesion
+	Gap time.Duration
+	// Grace tiempo que se aceptan registros atrasados luego del fin de la ventana
+	Grace time.Duration
+	// TimestampExtractor tiempo de evento, por defecto ConsumerMessage.Timestamp
+	TimestampExtractor TimestampExtractor
+	Aggregator         WindowAggregator
+	Merger             WindowMerger
+	// Emit modo de emision: EmitOnClose (por defecto) o EmitOnUpdate
+	Emit    string
+	Emitter WindowEmitter
+	// StoreName state store (ver NewStateStore) donde se guardan las ventanas abiertas para no perderlas al
+	// rebalancear, debe agregarse al context con su middleware. Vacio utiliza memoria local.
+	StoreName string
+	// LateRecords contador de registros descartados por llegar luego del cierre de la ventana, opcional
+	LateRecords metrics.Counter
+}
+
+// WindowedAggregation message handler que agrega los mensajes por key y ventana de tiempo de evento.
+// El tiempo de la stream avanza por particion con el mayor tiempo de evento recibido.
+type WindowedAggregation struct {
+	config WindowConfig
+
+	mu         sync.Mutex
+	partitions map[string]*windowPartition
+}
+
+type windowPartition struct {
+	topic      string
+	number     int32
+	store      KeyValueStore
+	streamTime time.Time
+	open       map[string]*windowEntry
+}
+
+type windowEntry struct {
+	key   []byte
+	start time.Time
+	end   time.Time
+}
+
+// NewWindowedAggregation constructor de WindowedAggregation
+func NewWindowedAggregation(config WindowConfig) (*WindowedAggregation, error) {
+	switch config.Type {
+	case WindowTumbling:
+		if config.Size <= 0 {
+			return nil, fmt.Errorf("%s: Size requerido", InvalidWindowConfigKind)
+		}
+		config.Advance = config.Size
+	case WindowHopping:
+		if config.Size <= 0 || config.Advance <= 0 || config.Advance > config.Size {
+			return nil, fmt.Errorf("%s: Size y Advance requeridos, Advance no puede ser mayor a Size", InvalidWindowConfigKind)
+		}
+	case WindowSession:
+		if config.Gap <= 0 || config.Merger == nil {
+			return nil, fmt.Errorf("%s: Gap y Merger requeridos", InvalidWindowConfigKind)
+		}
+	default:
+		return nil, fmt.Errorf("%s: tipo %q", InvalidWindowConfigKind, config.Type)
+	}
+
+	if config.Aggregator == nil || config.Emitter == nil {
+		return nil, fmt.Errorf("%s: Aggregator y Emitter requeridos", InvalidWindowConfigKind)
+	}
+
+	if config.Emit == "" {
+		config.Emit = EmitOnClose
+	}
+
+	if config.Emit != EmitOnClose && config.Emit != EmitOnUpdate {
+		return nil, fmt.Errorf("%s: modo de emision %q", InvalidWindowConfigKind, config.Emit)
+	}
+
+	if config.TimestampExtractor == nil {
+		config.TimestampExtractor = func(inMsg *ConsumerMessage) time.Time { return inMsg.Timestamp }
+	}
+
+	return &WindowedAggregation{config: config, partitions: make(map[string]*windowPartition)}, nil
+}
+
+// HandleMessage implementa MessageHandler
+func (w *WindowedAggregation) HandleMessage(ctx context.Context, inMsg *ConsumerMessage) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	partition, err := w.partition(ctx, inMsg)
+	if err != nil {
+		return err
+	}
+
+	timestamp := w.config.TimestampExtractor(inMsg)
+	if timestamp.After(partition.streamTime) {
+		partition.streamTime = timestamp
+	}
+
+	if w.config.Type == WindowSession {
+		err = w.aggregateSession(ctx, partition, inMsg, timestamp)
+	} else {
+		err = w.aggregateTimeWindows(ctx, partition, inMsg, timestamp)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return w.closeExpired(ctx, partition, inMsg)
+}
+
+// Flush cierra y emite todas las ventanas abiertas, util al finalizar un consumo acotado
+func (w *WindowedAggregation) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, partition := range w.partitions {
+		partition.streamTime = time.Unix(1<<40, 0)
+
+		if err := w.closeExpired(ctx, partition, &ConsumerMessage{Topic: partition.topic, Partition: partition.number}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *WindowedAggregation) aggregateTimeWindows(ctx context.Context, partition *windowPartition, inMsg *ConsumerMessage, timestamp time.Time) error {
+	size := w.config.Size.Milliseconds()
+	advance := w.config.Advance.Milliseconds()
+	ts := timestamp.UnixNano() / int64(time.Millisecond)
+
+	first := floorDiv(ts, advance) * advance
+	for start := first; start > ts-size; start -= advance {
+		entry := &windowEntry{
+			key:   inMsg.Key,
+			start: msToTime(start),
+			end:   msToTime(start + size),
+		}
+
+		if w.expired(partition, entry) {
+			w.late(inMsg, entry)
+			continue
+		}
+
+		storeKey := encodeWindowKey(entry)
+		aggregate, _, err := partition.store.Get(storeKey)
+		if err != nil {
+			return err
+		}
+
+		aggregate, err = w.config.Aggregator(inMsg.Key, inMsg.Msg, aggregate)
+		if err != nil {
+			return err
+		}
+
+		if err := partition.store.Put(storeKey, aggregate); err != nil {
+			return err
+		}
+
+		partition.open[string(storeKey)] = entry
+
+		if err := w.emitUpdate(ctx, inMsg, entry, aggregate); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *WindowedAggregation) aggregateSession(ctx context.Context, partition *windowPartition, inMsg *ConsumerMessage, timestamp time.Time) error {
+	session := &windowEntry{key: inMsg.Key, start: timestamp, end: timestamp}
+
+	if w.expired(partition, session) {
+		w.late(inMsg, session)
+		return nil
+	}
+
+	aggregate, err := w.config.Aggregator(inMsg.Key, inMsg.Msg, nil)
+	if err != nil {
+		return err
+	}
+
+	merged := make([]string, 0)
+	for storeKey, entry := range partition.open {
+		if string(entry.key) != string(inMsg.Key) {
+			continue
+		}
+
+		if timestamp.Before(entry.start.Add(-w.config.Gap)) || timestamp.After(entry.end.Add(w.config.Gap)) {
+			continue
+		}
+
+		merged = append(merged, storeKey)
+	}
+
+	sort.Strings(merged)
+
+	for _, storeKey := range merged {
+		entry := partition.open[storeKey]
+
+		existing, found, err := partition.store.Get([]byte(storeKey))
+		if err != nil {
+			return err
+		}
+
+		if found {
+			if aggregate, err = w.config.Merger(inMsg.Key, existing, aggregate); err != nil {
+				return err
+			}
+		}
+
+		if entry.start.Before(session.start) {
+			session.start = entry.start
+		}
+
+		if entry.end.After(session.end) {
+			session.end = entry.end
+		}
+
+		if err := partition.store.Delete([]byte(storeKey)); err != nil {
+			return err
+		}
+
+		delete(partition.open, storeKey)
+	}
+
+	storeKey := encodeWindowKey(session)
+	if err := partition.store.Put(storeKey, aggregate); err != nil {
+		return err
+	}
+
+	partition.open[string(storeKey)] = session
+
+	return w.emitUpdate(ctx, inMsg, session, aggregate)
+}
+
+// closeExpired emite y elimina las ventanas cuyo cierre ya fue alcanzado por el tiempo de la stream
+func (w *WindowedAggregation) closeExpired(ctx context.Context, partition *windowPartition, inMsg *ConsumerMessage) error {
+	expired := make([]string, 0)
+	for storeKey, entry := range partition.open {
+		if w.expired(partition, entry) {
+			expired = append(expired, storeKey)
+		}
+	}
+
+	sort.Slice(expired, func(i, j int) bool {
+		return partition.open[expired[i]].end.Before(partition.open[expired[j]].end)
+	})
+
+	for _, storeKey := range expired {
+		entry := partition.open[storeKey]
+
+		if w.config.Emit == EmitOnClose {
+			aggregate, found, err := partition.store.Get([]byte(storeKey))
+			if err != nil {
+				return err
+			}
+
+			if found {
+				err = w.config.Emitter(ctx, &WindowResult{
+					Key:       entry.key,
+					Value:     aggregate,
+					Start:     entry.start,
+					End:       entry.end,
+					Topic:     inMsg.Topic,
+					Partition: inMsg.Partition,
+					Final:     true,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := partition.store.Delete([]byte(storeKey)); err != nil {
+			return err
+		}
+
+		delete(partition.open, storeKey)
+	}
+
+	return nil
+}
+
+func (w *WindowedAggregation) emitUpdate(ctx context.Context, inMsg *ConsumerMessage, entry *windowEntry, aggregate []byte) error {
+	if w.config.Emit != EmitOnUpdate {
+		return nil
+	}
+
+	return w.config.Emitter(ctx, &WindowResult{
+		Key:       entry.key,
+		Value:     aggregate,
+		Start:     entry.start,
+		End:       entry.end,
+		Topic:     inMsg.Topic,
+		Partition: inMsg.Partition,
+	})
+}
+
+// expired indica si la ventana ya cerro: fin de ventana (mas Gap en sesiones) mas Grace
+func (w *WindowedAggregation) expired(partition *windowPartition, entry *windowEntry) bool {
+	closeAt := entry.end.Add(w.config.Grace)
+	if w.config.Type == WindowSession {
+		closeAt = closeAt.Add(w.config.Gap)
+	}
+
+	return !partition.streamTime.Before(closeAt)
+}
+
+func (w *WindowedAggregation) late(inMsg *ConsumerMessage, entry *windowEntry) {
+	if w.config.LateRecords != nil {
+		w.config.LateRecords.With("topic", inMsg.Topic).Add(1)
+	}
+
+	Log.Debug(
+		"message", "Registro atrasado descartado",
+		"topic", inMsg.Topic,
+		"partition", inMsg.Partition,
+		"offset", inMsg.Offset,
+		"window_start", entry.start,
+		"window_end", entry.end)
+}
+
+// partition obtiene el estado de la particion, reconstruye el indice de ventanas abiertas si el store cambio
+func (w *WindowedAggregation) partition(ctx context.Context, inMsg *ConsumerMessage) (*windowPartition, error) {
+	name := fmt.Sprintf("%s/%d", inMsg.Topic, inMsg.Partition)
+	partition := w.partitions[name]
+
+	var store KeyValueStore
+	if w.config.StoreName != "" {
+		if store = StateStoreFromContext(ctx, w.config.StoreName); store == nil {
+			return nil, fmt.Errorf("%s: %s", StateStoreUnavailableErrorKind, w.config.StoreName)
+		}
+	} else if partition != nil {
+		store = partition.store
+	} else {
+		store = NewMemoryKeyValueStore()
+	}
+
+	if partition != nil && partition.store == store {
+		return partition, nil
+	}
+
+	partition = &windowPartition{
+		topic:  inMsg.Topic,
+		number: inMsg.Partition,
+		store:  store,
+		open:   make(map[string]*windowEntry),
+	}
+
+	err := store.Range(func(key []byte, value []byte) error {
+		entry, err := decodeWindowKey(key)
+		if err != nil {
+			return nil
+		}
+
+		partition.open[string(key)] = entry
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	w.partitions[name] = partition
+
+	return partition, nil
+}
+
+func encodeWindowKey(entry *windowEntry) []byte {
+	key := make([]byte, windowKeyPrefixSize+len(entry.key))
+	binary.BigEndian.PutUint64(key[0:8], uint64(entry.start.UnixNano()/int64(time.Millisecond)))
+	binary.BigEndian.PutUint64(key[8:16], uint64(entry.end.UnixNano()/int64(time.Millisecond)))
+	copy(key[windowKeyPrefixSize:], entry.key)
+
+	return key
+}
+
+func decodeWindowKey(key []byte) (*windowEntry, error) {
+	if len(key) < windowKeyPrefixSize {
+		return nil, errors.New("key de ventana invalida")
+	}
+
+	return &windowEntry{
+		start: msToTime(int64(binary.BigEndian.Uint64(key[0:8]))),
+		end:   msToTime(int64(binary.BigEndian.Uint64(key[8:16]))),
+		key:   append([]byte(nil), key[windowKeyPrefixSize:]...),
+	}, nil
+}
+
+func msToTime(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+
+	return q
+}
+
+// CountAggregator agregador que cuenta registros, el agregado es el conteo en decimal
+func CountAggregator() WindowAggregator {
+	return func(key []byte, value []byte, aggregate []byte) ([]byte, error) {
+		count, _ := strconv.ParseInt(string(aggregate), 10, 64)
+		return []byte(strconv.FormatInt(count+1, 10)), nil
+	}
+}
+
+// CountMerger combina conteos de CountAggregator en ventanas de sesion
+func CountMerger() WindowMerger {
+	return func(key []byte, a []byte, b []byte) ([]byte, error) {
+		countA, _ := strconv.ParseInt(string(a), 10, 64)
+		countB, _ := strconv.ParseInt(string(b), 10, 64)
+		return []byte(strconv.FormatInt(countA+countB, 10)), nil
+	}
+}
+
+// ProduceWindowResults emitter que envia cada resultado con el producer, con key de la ventana,
+// el agregado como mensaje y headers window-start y window-end en unix ms
+func ProduceWindowResults(producer MessageProducer) WindowEmitter {
+	return func(ctx context.Context, result *WindowResult) error {
+		return producer.SendMessage(ctx, &ProducerMessage{
+			Key: result.Key,
+			Msg: result.Value,
+			Headers: map[string]string{
+				WindowStartHeader: strconv.FormatInt(result.Start.UnixNano()/int64(time.Millisecond), 10),
+				WindowEndHeader:   strconv.FormatInt(result.End.UnixNano()/int64(time.Millisecond), 10),
+			},
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package kafka_toolkit_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	kafka "github.com/validatecl/kafka-toolkit"
+	"github.com/validatecl/kafka-toolkit/kafkatest"
+)
+
+var windowBaseTime = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+// windowRecorder emitter que registra los resultados como "key [inicio,fin)=valor" en segundos desde windowBaseTime,
+// con sufijo final para las ventanas cerradas
+type windowRecorder struct {
+	results []string
+}
+
+func (r *windowRecorder) emit(ctx context.Context, result *kafka.WindowResult) error {
+	line := fmt.Sprintf("%s [%g,%g)=%s", result.Key, result.Start.Sub(windowBaseTime).Seconds(),
+		result.End.Sub(windowBaseTime).Seconds(), result.Value)
+	if result.Final {
+		line += " final"
+	}
+
+	r.results = append(r.results, line)
+
+	return nil
+}
+
+// sorted resultados ordenados, el cierre de ventanas con el mismo fin no tiene orden entre keys
+func (r *windowRecorder) sorted() []string {
+	results := append([]string{}, r.results...)
+	sort.Strings(results)
+
+	return results
+}
+
+func newTestWindow(t *testing.T, config kafka.WindowConfig) (*kafka.WindowedAggregation, *windowRecorder) {
+	t.Helper()
+	kafkatest.EnsureLogger()
+
+	recorder := &windowRecorder{}
+	config.Aggregator = kafka.CountAggregator()
+	config.Emitter = recorder.emit
+
+	window, err := kafka.NewWindowedAggregation(config)
+	if err != nil {
+		t.Fatalf("error creando ventana: %v", err)
+	}
+
+	return window, recorder
+}
+
+func handleWindowMessage(t *testing.T, window *kafka.WindowedAggregation, key string, at time.Duration) {
+	t.Helper()
+
+	err := window.HandleMessage(context.Background(), &kafka.ConsumerMessage{
+		Topic:     "clicks",
+		Key:       []byte(key),
+		Msg:       []byte("1"),
+		Timestamp: windowBaseTime.Add(at),
+	})
+	if err != nil {
+		t.Fatalf("error agregando %s en %v: %v", key, at, err)
+	}
+}
+
+func TestTumblingWindowBoundaries(t *testing.T) {
+	window, recorder := newTestWindow(t, kafka.WindowConfig{Type: kafka.WindowTumbling, Size: time.Minute})
+
+	handleWindowMessage(t, window, "a", 0)
+	handleWindowMessage(t, window, "a", time.Minute-time.Millisecond)
+
+	if len(recorder.results) != 0 {
+		t.Fatalf("no se esperaban ventanas cerradas antes del fin, se obtuvo %v", recorder.results)
+	}
+
+	// el fin de la ventana es exclusivo, el registro en 60s abre la siguiente y cierra la primera
+	handleWindowMessage(t, window, "a", time.Minute)
+
+	if expected := []string{"a [0,60)=2 final"}; !reflect.DeepEqual(recorder.results, expected) {
+		t.Fatalf("se esperaba %v, se obtuvo %v", expected, recorder.results)
+	}
+
+	handleWindowMessage(t, window, "b", time.Minute+time.Second)
+
+	if err := window.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a [0,60)=2 final", "a [60,120)=1 final", "b [60,120)=1 final"}
+	if results := recorder.sorted(); !reflect.DeepEqual(results, expected) {
+		t.Errorf("se esperaba %v, se obtuvo %v", expected, results)
+	}
+}
+
+func TestHoppingWindowOverlap(t *testing.T) {
+	window, recorder := newTestWindow(t, kafka.WindowConfig{
+		Type:    kafka.WindowHopping,
+		Size:    time.Minute,
+		Advance: 30 * time.Second,
+	})
+
+	// cada registro pertenece a las dos ventanas que lo contienen
+	handleWindowMessage(t, window, "a", 45*time.Second)
+	handleWindowMessage(t, window, "a", 75*time.Second)
+
+	if err := window.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a [0,60)=1 final", "a [30,90)=2 final", "a [60,120)=1 final"}
+	if !reflect.DeepEqual(recorder.results, expected) {
+		t.Errorf("se esperaba %v, se obtuvo %v", expected, recorder.results)
+	}
+}
+
+func TestWindowGraceAndLateRecords(t *testing.T) {
+	late := newRecordingCounter()
+	window, recorder := newTestWindow(t, kafka.WindowConfig{
+		Type:        kafka.WindowTumbling,
+		Size:        time.Minute,
+		Grace:       10 * time.Second,
+		LateRecords: late,
+	})
+
+	handleWindowMessage(t, window, "a", 0)
+	handleWindowMessage(t, window, "a", 65*time.Second)
+	// dentro de Grace el registro atrasado se agrega a la ventana anterior
+	handleWindowMessage(t, window, "a", 5*time.Second)
+	handleWindowMessage(t, window, "a", 70*time.Second)
+	// la ventana ya cerro, el registro se descarta
+	handleWindowMessage(t, window, "a", 10*time.Second)
+
+	if expected := []string{"a [0,60)=2 final"}; !reflect.DeepEqual(recorder.results, expected) {
+		t.Errorf("se esperaba %v, se obtuvo %v", expected, recorder.results)
+	}
+
+	if got := late.value("topic", "clicks"); got != 1 {
+		t.Errorf("registros atrasados: se esperaba 1, se obtuvo %v", got)
+	}
+}
+
+func TestSessionWindowMerging(t *testing.T) {
+	window, recorder := newTestWindow(t, kafka.WindowConfig{
+		Type:   kafka.WindowSession,
+		Gap:    10 * time.Second,
+		Grace:  30 * time.Second,
+		Merger: kafka.CountMerger(),
+	})
+
+	handleWindowMessage(t, window, "a", 0)
+	handleWindowMessage(t, window, "a", 20*time.Second)
+	handleWindowMessage(t, window, "b", 5*time.Second)
+	// el registro atrasado queda a menos de Gap de ambas sesiones de a y las une
+	handleWindowMessage(t, window, "a", 10*time.Second)
+
+	if len(recorder.results) != 0 {
+		t.Fatalf("no se esperaban sesiones cerradas, se obtuvo %v", recorder.results)
+	}
+
+	if err := window.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a [0,20)=3 final", "b [5,5)=1 final"}
+	if results := recorder.sorted(); !reflect.DeepEqual(results, expected) {
+		t.Errorf("se esperaba %v, se obtuvo %v", expected, results)
+	}
+}
+
+func TestSessionWindowClosesAfterGap(t *testing.T) {
+	window, recorder := newTestWindow(t, kafka.WindowConfig{
+		Type:   kafka.WindowSession,
+		Gap:    10 * time.Second,
+		Merger: kafka.CountMerger(),
+	})
+
+	handleWindowMessage(t, window, "a", 0)
+	handleWindowMessage(t, window, "a", 9*time.Second)
+	handleWindowMessage(t, window, "a", 30*time.Second)
+
+	if expected := []string{"a [0,9)=2 final"}; !reflect.DeepEqual(recorder.results, expected) {
+		t.Errorf("se esperaba %v, se obtuvo %v", expected, recorder.results)
+	}
+}
+
+func TestWindowEmitOnUpdate(t *testing.T) {
+	window, recorder := newTestWindow(t, kafka.WindowConfig{
+		Type: kafka.WindowTumbling,
+		Size: time.Minute,
+		Emit: kafka.EmitOnUpdate,
+	})
+
+	handleWindowMessage(t, window, "a", 0)
+	handleWindowMessage(t, window, "a", time.Second)
+	handleWindowMessage(t, window, "a", time.Minute)
+
+	// en modo update no se emite al cerrar
+	expected := []string{"a [0,60)=1", "a [0,60)=2", "a [60,120)=1"}
+	if !reflect.DeepEqual(recorder.results, expected) {
+		t.Errorf("se esperaba %v, se obtuvo %v", expected, recorder.results)
+	}
+}
+
+func TestWindowConfigValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		config kafka.WindowConfig
+	}{
+		{name: "tipo desconocido", config: kafka.WindowConfig{Type: "sliding", Size: time.Minute}},
+		{name: "tumbling sin tamaño", config: kafka.WindowConfig{Type: kafka.WindowTumbling}},
+		{name: "hopping con avance mayor al tamaño", config: kafka.WindowConfig{Type: kafka.WindowHopping, Size: time.Minute, Advance: 2 * time.Minute}},
+		{name: "sesion sin merger", config: kafka.WindowConfig{Type: kafka.WindowSession, Gap: time.Minute}},
+		{name: "modo de emision", config: kafka.WindowConfig{Type: kafka.WindowTumbling, Size: time.Minute, Emit: "always"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.Aggregator = kafka.CountAggregator()
+			test.config.Emitter = (&windowRecorder{}).emit
+
+			_, err := kafka.NewWindowedAggregation(test.config)
+			if err == nil || !strings.HasPrefix(err.Error(), kafka.InvalidWindowConfigKind) {
+				t.Errorf("se esperaba %q, se obtuvo %v", kafka.InvalidWindowConfigKind, err)
+			}
+		})
+	}
+}